@@ -0,0 +1,316 @@
+package gohalt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NewMiddlewareHTTP creates net/http middleware instance
+// that acquires the provided throttler before each wrapped handler call and releases it after the call.
+// Request context is stamped with `WithTimestamp` on arrival,
+// so `latency` and `percentile` throttlers observe the wrapped handler latency.
+// Throttled requests are passed to the provided deny handler,
+// if no deny handler is provided then `429 Too Many Requests` is responded
+// with `Retry-After` header set from `ErrorRetry` retry after duration if any.
+// Release errors are only logged.
+func NewMiddlewareHTTP(
+	handler http.Handler,
+	thr Throttler,
+	deny func(http.ResponseWriter, *http.Request, error),
+) http.Handler {
+	if deny == nil {
+		deny = denyHTTP
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithTimestamp(r.Context(), time.Now().UTC())
+		r = r.WithContext(ctx)
+		defer func() {
+			if err := thr.Release(ctx); err != nil {
+				log("http middleware release error happened: %v", err)
+			}
+		}()
+		if err := thr.Acquire(ctx); err != nil {
+			deny(w, r, err)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func denyHTTP(w http.ResponseWriter, _ *http.Request, err error) {
+	var rerr ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(rerr.After.Seconds())), 10))
+	}
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+type rtthrottled struct {
+	rt    http.RoundTripper
+	thr   Throttler
+	proxy bool
+}
+
+// NewRoundTripperHTTP creates net/http round tripper instance
+// that acquires the provided throttler before each wrapped round tripper call and releases it after the call,
+// if no round tripper is provided then `http.DefaultTransport` is used.
+// Request context is stamped with `WithKey` set to the request host, so keyed throttlers limit calls per host,
+// and with `WithTimestamp` on sending, so `latency` and `percentile` throttlers observe the round trip latency.
+// Response status is reported on release with `WithStatus`, round trip errors are reported as `503 Service Unavailable`,
+// so adaptive `client` throttler backs off on overloaded hosts.
+// Throttling errors are returned from round trip as is, release errors are only logged.
+func NewRoundTripperHTTP(rt http.RoundTripper, thr Throttler) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return rtthrottled{rt: rt, thr: thr}
+}
+
+func (rt rtthrottled) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := WithTimestamp(WithKey(req.Context(), req.URL.Host), time.Now().UTC())
+	if err := rt.thr.Acquire(ctx); err != nil {
+		if err := rt.thr.Release(ctx); err != nil {
+			log("http round tripper release error happened: %v", err)
+		}
+		// mark throttling errors, so reverse proxy error handler could tell them from upstream errors.
+		if rt.proxy {
+			return nil, proxythrottled{err: err}
+		}
+		return nil, err
+	}
+	resp, err := rt.rt.RoundTrip(req)
+	status := http.StatusServiceUnavailable
+	if err == nil {
+		status = resp.StatusCode
+	}
+	if err := rt.thr.Release(WithStatus(ctx, status)); err != nil {
+		log("http round tripper release error happened: %v", err)
+	}
+	return resp, err
+}
+
+type proxythrottled struct {
+	err error
+}
+
+func (err proxythrottled) Error() string {
+	return err.err.Error()
+}
+
+func (err proxythrottled) Unwrap() error {
+	return err.err
+}
+
+// NewReverseProxyHTTP wraps the provided reverse proxy transport with `NewRoundTripperHTTP`
+// to acquire the provided throttler before each upstream call and release it after the call,
+// so each upstream could be throttled independently as round tripper stamps `WithKey` set to the upstream host,
+// e.g. with `NewThrottlerGenerator` that keeps separate adaptive `client` throttler per upstream.
+// Upstream calls throttled by the throttler are responded with `429 Too Many Requests`
+// and internal throttling errors are responded with `503 Service Unavailable`,
+// both with `Retry-After` header set from `ErrorRetry` retry after duration if any.
+// Other upstream errors are passed to the already configured reverse proxy error handler if any,
+// otherwise they are logged and responded with `502 Bad Gateway` the same way as reverse proxy does by default.
+func NewReverseProxyHTTP(proxy *httputil.ReverseProxy, thr Throttler) *httputil.ReverseProxy {
+	rt := proxy.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	proxy.Transport = rtthrottled{rt: rt, thr: thr, proxy: true}
+	handler := proxy.ErrorHandler
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		var perr proxythrottled
+		if !errors.As(err, &perr) {
+			if handler != nil {
+				handler(w, r, err)
+				return
+			}
+			log("http reverse proxy error happened: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var ierr ErrorInternal
+		if !errors.As(perr.err, &ierr) {
+			denyHTTP(w, r, perr.err)
+			return
+		}
+		var rerr ErrorRetry
+		if errors.As(perr.err, &rerr) && rerr.After > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(rerr.After.Seconds())), 10))
+		}
+		http.Error(w, perr.err.Error(), http.StatusServiceUnavailable)
+	}
+	return proxy
+}
+
+type lthrottled struct {
+	net.Listener
+	thr Throttler
+}
+
+type cthrottled struct {
+	net.Conn
+	ctx  context.Context
+	thr  Throttler
+	once sync.Once
+}
+
+// NewListenerNet wraps the provided listener to acquire the provided throttler
+// on each accepted connection and release it on the connection close,
+// so floods of connections are shed before any application protocol work happens.
+// Connection context is stamped with `WithKey` set to the connection source ip,
+// so keyed throttlers limit connections per source ip,
+// and with `WithTimestamp` on connection accept.
+// Throttled connections are closed right away and accept continues with the next connection,
+// throttling and release errors are only logged.
+func NewListenerNet(l net.Listener, thr Throttler) net.Listener {
+	return lthrottled{Listener: l, thr: thr}
+}
+
+func (l lthrottled) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		key := conn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(key); err == nil {
+			key = host
+		}
+		ctx := WithTimestamp(WithKey(context.Background(), key), time.Now().UTC())
+		if err := l.thr.Acquire(ctx); err != nil {
+			log("net listener connection from %q is throttled: %v", key, err)
+			if err := l.thr.Release(ctx); err != nil {
+				log("net listener release error happened: %v", err)
+			}
+			if err := conn.Close(); err != nil {
+				log("net listener close error happened: %v", err)
+			}
+			continue
+		}
+		return &cthrottled{Conn: conn, ctx: ctx, thr: l.thr}, nil
+	}
+}
+
+func (conn *cthrottled) Close() error {
+	err := conn.Conn.Close()
+	conn.once.Do(func() {
+		if err := conn.thr.Release(conn.ctx); err != nil {
+			log("net listener release error happened: %v", err)
+		}
+	})
+	return err
+}
+
+type rdthrottled struct {
+	r     io.Reader
+	ctx   context.Context
+	thr   Throttler
+	chunk int
+	poll  time.Duration
+}
+
+type wrthrottled struct {
+	w     io.Writer
+	ctx   context.Context
+	thr   Throttler
+	chunk int
+	poll  time.Duration
+}
+
+// NewReaderIO wraps the provided reader to cap its bandwidth with the provided throttler,
+// each read is limited to at most the provided chunk size, 32KB by default,
+// and waits until the provided throttler is acquired with `WithWeight` set to the read bytes count,
+// retrying after `ErrorRetry` retry after duration if any or after the provided poll interval otherwise.
+// Use it with monotone `NewThrottlerBucketLimiter` which burst is not less than the chunk size,
+// so the bandwidth could be adjusted at runtime via `SetRate`.
+// Internal throttling and context errors are returned from read, release errors are only logged.
+func NewReaderIO(ctx context.Context, r io.Reader, thr Throttler, chunk int, poll time.Duration) io.Reader {
+	if chunk <= 0 {
+		chunk = 32 * 1024
+	}
+	return rdthrottled{r: r, ctx: ctx, thr: thr, chunk: chunk, poll: poll}
+}
+
+func (r rdthrottled) Read(p []byte) (int, error) {
+	if len(p) > r.chunk {
+		p = p[:r.chunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if err := waitIO(r.ctx, r.thr, n, r.poll); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// NewWriterIO wraps the provided writer to cap its bandwidth with the provided throttler,
+// each write is split into chunks of at most the provided chunk size, 32KB by default,
+// and each chunk waits until the provided throttler is acquired with `WithWeight` set to the chunk bytes count,
+// retrying after `ErrorRetry` retry after duration if any or after the provided poll interval otherwise.
+// Use it with monotone `NewThrottlerBucketLimiter` which burst is not less than the chunk size,
+// so the bandwidth could be adjusted at runtime via `SetRate`.
+// Internal throttling and context errors are returned from write, release errors are only logged.
+func NewWriterIO(ctx context.Context, w io.Writer, thr Throttler, chunk int, poll time.Duration) io.Writer {
+	if chunk <= 0 {
+		chunk = 32 * 1024
+	}
+	return wrthrottled{w: w, ctx: ctx, thr: thr, chunk: chunk, poll: poll}
+}
+
+func (w wrthrottled) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > w.chunk {
+			chunk = chunk[:w.chunk]
+		}
+		if err := waitIO(w.ctx, w.thr, len(chunk), w.poll); err != nil {
+			return n, err
+		}
+		written, err := w.w.Write(chunk)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		p = p[written:]
+	}
+	return n, nil
+}
+
+func waitIO(ctx context.Context, thr Throttler, weight int, poll time.Duration) error {
+	ctx = WithWeight(ctx, int64(weight))
+	for {
+		err := thr.Acquire(ctx)
+		if err := thr.Release(ctx); err != nil {
+			log("io release error happened: %v", err)
+		}
+		if err == nil {
+			return nil
+		}
+		var ierr ErrorInternal
+		if errors.As(err, &ierr) {
+			return err
+		}
+		delay := poll
+		var rerr ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			delay = rerr.After
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
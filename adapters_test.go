@@ -0,0 +1,280 @@
+package gohalt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareHTTP(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ctxTimestamp(r.Context()).IsZero() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	})
+	table := map[string]struct {
+		thr    Throttler
+		deny   func(http.ResponseWriter, *http.Request, error)
+		code   int
+		body   string
+		header http.Header
+	}{
+		"HTTP middleware should pass not throttled requests": {
+			thr:  NewThrottlerEcho(nil),
+			code: http.StatusOK,
+			body: "ok",
+		},
+		"HTTP middleware should deny throttled requests": {
+			thr:  NewThrottlerEcho(errors.New("test")),
+			code: http.StatusTooManyRequests,
+			body: "test\n",
+		},
+		"HTTP middleware should set retry after on retry errors": {
+			thr:    NewThrottlerEcho(ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond, Err: errors.New("test")}),
+			code:   http.StatusTooManyRequests,
+			body:   "throttler \"test\" has rejected call, retry after 1.5s: test\n",
+			header: http.Header{"Retry-After": []string{"2"}},
+		},
+		"HTTP middleware should use custom deny handler": {
+			thr: NewThrottlerEcho(errors.New("test")),
+			deny: func(w http.ResponseWriter, _ *http.Request, err error) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				_, _ = w.Write([]byte(err.Error()))
+			},
+			code: http.StatusServiceUnavailable,
+			body: "test",
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewMiddlewareHTTP(handler, tcase.thr, tcase.deny).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			require.Equal(t, tcase.code, w.Code)
+			require.Equal(t, tcase.body, w.Body.String())
+			for key := range tcase.header {
+				require.Equal(t, tcase.header.Get(key), w.Header().Get(key))
+			}
+		})
+	}
+	thr := NewThrottlerRunning(1)
+	blocked := make(chan struct{}, 1)
+	done := make(chan struct{})
+	mw := NewMiddlewareHTTP(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		select {
+		case blocked <- struct{}{}:
+		default:
+		}
+		<-done
+	}), thr, nil)
+	go mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-blocked
+	w := httptest.NewRecorder()
+	mw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	close(done)
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code == http.StatusOK
+	}, time.Second, time.Millisecond)
+}
+
+func TestRoundTripperHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/busy" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: NewRoundTripperHTTP(nil, NewThrottlerClient(2, time.Hour, 0.5, 0))}
+	resp, err := client.Get(srv.URL + "/busy")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	_ = resp.Body.Close()
+	_, err = client.Get(srv.URL)
+	var terr ErrorThreshold
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, ErrorThreshold{Throttler: "client", Threshold: strpair{current: 2, threshold: 1}}, terr)
+	unknown := errors.New("unknown host")
+	client = &http.Client{Transport: NewRoundTripperHTTP(nil, NewThrottlerPattern(
+		Pattern{Pattern: regexp.MustCompile(regexp.QuoteMeta(srv.Listener.Addr().String())), Throttler: NewThrottlerEcho(nil)},
+		Pattern{Throttler: NewThrottlerEcho(unknown)},
+	))}
+	resp, err = client.Get(srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_ = resp.Body.Close()
+	_, err = client.Get(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+	require.True(t, errors.Is(err, unknown))
+}
+
+func TestReverseProxyHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	target, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	table := map[string]struct {
+		thr    Throttler
+		target *url.URL
+		code   int
+		header string
+	}{
+		"HTTP reverse proxy should pass not throttled requests": {
+			thr:    NewThrottlerEcho(nil),
+			target: target,
+			code:   http.StatusOK,
+		},
+		"HTTP reverse proxy should deny throttled requests": {
+			thr:    NewThrottlerEcho(errors.New("test")),
+			target: target,
+			code:   http.StatusTooManyRequests,
+		},
+		"HTTP reverse proxy should deny throttled requests with retry after": {
+			thr:    NewThrottlerEcho(ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond}),
+			target: target,
+			code:   http.StatusTooManyRequests,
+			header: "2",
+		},
+		"HTTP reverse proxy should fail on internal throttling errors": {
+			thr:    NewThrottlerEcho(ErrorInternal{Throttler: "test", Message: "test"}),
+			target: target,
+			code:   http.StatusServiceUnavailable,
+		},
+		"HTTP reverse proxy should fail on upstream errors": {
+			thr:    NewThrottlerEcho(nil),
+			target: &url.URL{Scheme: "http", Host: "127.0.0.1:1"},
+			code:   http.StatusBadGateway,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			proxy := NewReverseProxyHTTP(httputil.NewSingleHostReverseProxy(tcase.target), tcase.thr)
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			require.Equal(t, tcase.code, rec.Code)
+			require.Equal(t, tcase.header, rec.Header().Get("Retry-After"))
+		})
+	}
+	t.Run("HTTP reverse proxy should throttle upstreams independently", func(t *testing.T) {
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer other.Close()
+		upstreams := []string{srv.Listener.Addr().String(), other.Listener.Addr().String()}
+		var next uint64
+		proxy := NewReverseProxyHTTP(&httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.Out.URL.Scheme = "http"
+				r.Out.URL.Host = upstreams[atomic.AddUint64(&next, 1)%2]
+			},
+		}, NewThrottlerGenerator(func(string) (Throttler, error) {
+			return NewThrottlerAfter(1), nil
+		}, 2, 0))
+		statuses := make([]int, 0, 4)
+		for i := 0; i < 4; i++ {
+			rec := httptest.NewRecorder()
+			proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			statuses = append(statuses, rec.Code)
+		}
+		require.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}, statuses)
+	})
+}
+
+func TestListenerNet(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	thr := NewThrottlerGenerator(func(string) (Throttler, error) {
+		return NewThrottlerRunning(1), nil
+	}, 1, 0)
+	l = NewListenerNet(l, thr)
+	defer l.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	first, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	conn := <-accepted
+	second, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	require.NoError(t, second.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = second.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, conn.Close())
+	require.Error(t, conn.Close())
+	third, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer third.Close()
+	select {
+	case conn := <-accepted:
+		require.NoError(t, conn.Close())
+	case <-time.After(time.Second):
+		require.Fail(t, "net listener should accept connection after previous connection close")
+	}
+}
+
+func TestReaderWriterIO(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 3000)
+	t.Run("IO reader and writer should cap bandwidth with adjustable rate", func(t *testing.T) {
+		ctx := context.Background()
+		thr := NewThrottlerBucketLimiter(RateSpec{Rate: 1000, Interval: 100 * time.Millisecond}, true)
+		var buf bytes.Buffer
+		ts := time.Now()
+		n, err := io.Copy(NewWriterIO(ctx, &buf, thr, 1000, time.Millisecond), bytes.NewReader(payload))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(payload)), n)
+		require.GreaterOrEqual(t, time.Since(ts), 150*time.Millisecond)
+		thr.SetRate(RateSpec{Rate: 1000, Interval: time.Millisecond})
+		time.Sleep(5 * time.Millisecond)
+		ts = time.Now()
+		out, err := io.ReadAll(NewReaderIO(ctx, &buf, thr, 1000, time.Millisecond))
+		require.NoError(t, err)
+		require.Equal(t, payload, out)
+		require.Less(t, time.Since(ts), 100*time.Millisecond)
+	})
+	t.Run("IO reader and writer should fail on internal throttling errors", func(t *testing.T) {
+		ctx := context.Background()
+		thr := NewThrottlerEcho(ErrorInternal{Throttler: "test", Message: "test"})
+		_, err := NewWriterIO(ctx, io.Discard, thr, 0, time.Millisecond).Write(payload)
+		require.EqualError(t, err, "throttler \"test\" internal error happened: test")
+		n, err := NewReaderIO(ctx, bytes.NewReader(payload), thr, 0, time.Millisecond).Read(make([]byte, 10))
+		require.Equal(t, 10, n)
+		require.EqualError(t, err, "throttler \"test\" internal error happened: test")
+	})
+	t.Run("IO reader and writer should stop waiting on context cancel", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		thr := NewThrottlerEcho(ErrorRetry{Throttler: "test", After: time.Millisecond, Err: errors.New("test")})
+		n, err := NewWriterIO(ctx, io.Discard, thr, 0, time.Hour).Write(payload)
+		require.Equal(t, 0, n)
+		require.Equal(t, context.DeadlineExceeded, err)
+	})
+}
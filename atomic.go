@@ -44,6 +44,15 @@ func atomicBDecr(number *uint64) (res uint64) {
 	return
 }
 
+func atomicTryDecr(number *uint64) bool {
+	for current := atomic.LoadUint64(number); current > 0; current = atomic.LoadUint64(number) {
+		if atomic.CompareAndSwapUint64(number, current, current-1) {
+			return true
+		}
+	}
+	return false
+}
+
 func atomicIncr(number *uint64) uint64 {
 	return atomic.AddUint64(number, 1)
 }
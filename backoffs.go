@@ -0,0 +1,37 @@
+package gohalt
+
+import (
+	"math"
+	"time"
+)
+
+// Backoff defines func signature that is able
+// to calculate delay before the provided retry attempt, attempts start from 1.
+type Backoff func(attempt uint64) time.Duration
+
+// NewBackoffConstant creates backoff instance that
+// always delays retry attempts for the specified delay.
+func NewBackoffConstant(delay time.Duration) Backoff {
+	return func(uint64) time.Duration {
+		return delay
+	}
+}
+
+// NewBackoffExponential creates backoff instance that
+// exponentially doubles retry attempts delay starting from the specified initial delay
+// up until the specified max delay.
+// Each delay is reduced by random jitter defined by the specified jitter factor normalized to [0.0, 1.0].
+// Implementation uses secure `crypto/rand` as PRNG function.
+func NewBackoffExponential(initial time.Duration, max time.Duration, jitter float64) Backoff {
+	jitter = math.Min(math.Max(jitter, 0.0), 1.0)
+	return func(attempt uint64) time.Duration {
+		delay := float64(max)
+		if attempt > 0 && attempt < 64 {
+			delay = math.Min(float64(initial)*math.Pow(2, float64(attempt-1)), float64(max))
+		}
+		if jitter > 0 {
+			delay -= delay * jitter * rndf64(0.0)
+		}
+		return time.Duration(delay)
+	}
+}
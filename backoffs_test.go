@@ -0,0 +1,46 @@
+package gohalt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffs(t *testing.T) {
+	table := map[string]struct {
+		backoff Backoff
+		delays  []time.Duration
+	}{
+		"Constant backoff should always return the same delay": {
+			backoff: NewBackoffConstant(time.Millisecond),
+			delays:  []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond},
+		},
+		"Exponential backoff should double delay up until max delay": {
+			backoff: NewBackoffExponential(time.Millisecond, 5*time.Millisecond, 0),
+			delays: []time.Duration{
+				time.Millisecond,
+				2 * time.Millisecond,
+				4 * time.Millisecond,
+				5 * time.Millisecond,
+				5 * time.Millisecond,
+			},
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			for i, delay := range tcase.delays {
+				require.Equal(t, delay, tcase.backoff(uint64(i+1)))
+			}
+		})
+	}
+}
+
+func TestBackoffExponentialJitter(t *testing.T) {
+	backoff := NewBackoffExponential(time.Millisecond, time.Second, 1.0)
+	for i := uint64(1); i < 100; i++ {
+		delay := backoff(i)
+		require.GreaterOrEqual(t, int64(delay), int64(0))
+		require.LessOrEqual(t, int64(delay), int64(time.Second))
+	}
+}
@@ -0,0 +1,87 @@
+package gohalt
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot defines default cgroup file system mount point.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroup defines inner container cgroup limits and usage snapshot:
+// - memLimit shows container memory limit in bytes, zero if unlimited.
+// - memUsage shows container memory usage in bytes.
+// - cpuQuota shows container CPU quota in cores, zero if unlimited.
+// - cpuUsage shows container cumulative CPU usage in nanoseconds.
+type cgroup struct {
+	memLimit uint64
+	memUsage uint64
+	cpuQuota float64
+	cpuUsage uint64
+}
+
+// cgroupRead reads container cgroup v2 or v1 limits and usage from the provided cgroup root
+// and returns whether any cgroup has been found.
+func cgroupRead(root string) (cg cgroup, ok bool) {
+	// cgroup v2 unified hierarchy.
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		if max, err := cgroupLine(root, "memory.max"); err == nil && max != "max" {
+			cg.memLimit, _ = strconv.ParseUint(max, 10, 64)
+		}
+		cg.memUsage, _ = cgroupUint(root, "memory.current")
+		if max, err := cgroupLine(root, "cpu.max"); err == nil {
+			if fields := strings.Fields(max); len(fields) == 2 && fields[0] != "max" {
+				quota, qerr := strconv.ParseFloat(fields[0], 64)
+				period, perr := strconv.ParseFloat(fields[1], 64)
+				if qerr == nil && perr == nil && period > 0 {
+					cg.cpuQuota = quota / period
+				}
+			}
+		}
+		if stat, err := os.ReadFile(filepath.Join(root, "cpu.stat")); err == nil {
+			for _, line := range strings.Split(string(stat), "\n") {
+				if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "usage_usec" {
+					usec, _ := strconv.ParseUint(fields[1], 10, 64)
+					cg.cpuUsage = usec * 1000
+				}
+			}
+		}
+		return cg, true
+	}
+	// cgroup v1 separate hierarchies.
+	limit, lerr := cgroupUint(root, "memory", "memory.limit_in_bytes")
+	quota, qerr := cgroupLine(root, "cpu", "cpu.cfs_quota_us")
+	if lerr != nil && qerr != nil {
+		return cg, false
+	}
+	// v1 reports unlimited memory as huge page aligned max int64.
+	if lerr == nil && limit < 1<<62 {
+		cg.memLimit = limit
+	}
+	cg.memUsage, _ = cgroupUint(root, "memory", "memory.usage_in_bytes")
+	if quota, err := strconv.ParseFloat(quota, 64); qerr == nil && err == nil && quota > 0 {
+		if period, err := cgroupUint(root, "cpu", "cpu.cfs_period_us"); err == nil && period > 0 {
+			cg.cpuQuota = quota / float64(period)
+		}
+	}
+	cg.cpuUsage, _ = cgroupUint(root, "cpuacct", "cpuacct.usage")
+	return cg, true
+}
+
+func cgroupLine(path ...string) (string, error) {
+	line, err := os.ReadFile(filepath.Join(path...))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+func cgroupUint(path ...string) (uint64, error) {
+	line, err := cgroupLine(path...)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(line, 10, 64)
+}
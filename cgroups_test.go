@@ -0,0 +1,90 @@
+package gohalt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCgroupRead(t *testing.T) {
+	table := map[string]struct {
+		files map[string]string
+		cg    cgroup
+		ok    bool
+	}{
+		"Cgroup read should return nothing without cgroup": {},
+		"Cgroup read should read cgroup v2 limits and usage": {
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory",
+				"memory.max":         "1000\n",
+				"memory.current":     "250\n",
+				"cpu.max":            "150000 100000\n",
+				"cpu.stat":           "usage_usec 20\nuser_usec 10\n",
+			},
+			cg: cgroup{memLimit: 1000, memUsage: 250, cpuQuota: 1.5, cpuUsage: 20000},
+			ok: true,
+		},
+		"Cgroup read should read unlimited cgroup v2": {
+			files: map[string]string{
+				"cgroup.controllers": "cpu memory",
+				"memory.max":         "max\n",
+				"memory.current":     "250\n",
+				"cpu.max":            "max 100000\n",
+			},
+			cg: cgroup{memUsage: 250},
+			ok: true,
+		},
+		"Cgroup read should read cgroup v1 limits and usage": {
+			files: map[string]string{
+				"memory/memory.limit_in_bytes": "2000\n",
+				"memory/memory.usage_in_bytes": "500\n",
+				"cpu/cpu.cfs_quota_us":         "50000\n",
+				"cpu/cpu.cfs_period_us":        "100000\n",
+				"cpuacct/cpuacct.usage":        "30000\n",
+			},
+			cg: cgroup{memLimit: 2000, memUsage: 500, cpuQuota: 0.5, cpuUsage: 30000},
+			ok: true,
+		},
+		"Cgroup read should read unlimited cgroup v1": {
+			files: map[string]string{
+				"memory/memory.limit_in_bytes": "9223372036854771712\n",
+				"cpu/cpu.cfs_quota_us":         "-1\n",
+			},
+			ok: true,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tcase.files {
+				path := filepath.Join(root, name)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+				require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+			}
+			cg, ok := cgroupRead(root)
+			require.Equal(t, tcase.ok, ok)
+			require.Equal(t, tcase.cg, cg)
+		})
+	}
+}
+
+func TestMonitorSystemCgroup(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0o644))
+	}
+	write("cgroup.controllers", "cpu memory")
+	write("memory.max", "1000")
+	write("memory.current", "800")
+	write("cpu.max", "100000 100000")
+	write("cpu.stat", "usage_usec 0")
+	mnt := &mntsys{root: root}
+	mnt.syncCgroup()
+	require.Equal(t, 80.0, mnt.stats.MEMUsage)
+	require.Equal(t, 0.0, mnt.stats.CPUUsage)
+	write("cpu.stat", "usage_usec 1000000000")
+	mnt.syncCgroup()
+	require.Greater(t, mnt.stats.CPUUsage, 0.0)
+}
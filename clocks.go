@@ -0,0 +1,68 @@
+package gohalt
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ClockJump defines wall clock jump event that is detected by throttler
+// when wall clock drifts away from monotonic clock, e.g. after laptop sleep, VM pause or clock step:
+// - Throttler shows name of throttler that detected the jump.
+// - Jump shows wall clock drift relative to monotonic clock, negative for backward jumps.
+// - Timestamp shows UTC wall time when the jump was detected.
+type ClockJump struct {
+	Throttler string
+	Jump      time.Duration
+	Timestamp time.Time
+}
+
+// DefaultClockJumpThreshold defines minimal absolute wall clock drift
+// relative to monotonic clock that is treated as wall clock jump.
+// By default DefaultClockJumpThreshold is set to one second.
+var DefaultClockJumpThreshold = time.Second
+
+// DefaultClockJumpHandler defines default handler that is called on each detected wall clock jump.
+// By default DefaultClockJumpHandler is set to log detected jumps.
+// Clock jumps handling can be completely disabled by setting DefaultClockJumpHandler to nil.
+var DefaultClockJumpHandler = func(jump ClockJump) {
+	log("throttler %q has detected clock jump: %s", jump.Throttler, jump.Jump)
+}
+
+// clockstart defines process monotonic clock reference point.
+var clockstart = time.Now()
+
+// clock defines inner wall clock jumps detector that tracks
+// offset between wall clock and monotonic clock lock free.
+type clock struct {
+	offset int64
+}
+
+// now returns current UTC wall time and wall clock jump detected since the previous call
+// or zero if no jump was detected, detected jumps are reported to `DefaultClockJumpHandler`.
+func (c *clock) now(throttler string) (time.Time, time.Duration) {
+	now := time.Now()
+	offset := now.UnixNano() - int64(now.Sub(clockstart))
+	prev := atomic.SwapInt64(&c.offset, offset)
+	jump := time.Duration(offset - prev)
+	if prev == 0 || (jump < DefaultClockJumpThreshold && jump > -DefaultClockJumpThreshold) {
+		return now.UTC(), 0
+	}
+	if handler := DefaultClockJumpHandler; handler != nil {
+		handler(ClockJump{Throttler: throttler, Jump: jump, Timestamp: now.UTC()})
+	}
+	return now.UTC(), jump
+}
+
+// Clock defines wall clock jumps detector intended for gohalt integrations
+// that need to follow gohalt clock jumps handling, see `ClockJump`.
+// Zero value clock is ready to use.
+type Clock struct {
+	clock clock
+}
+
+// Now returns current UTC wall time and wall clock jump detected since the previous call
+// or zero if no jump was detected, detected jumps are reported to `DefaultClockJumpHandler`
+// with the provided throttler name.
+func (c *Clock) Now(throttler string) (time.Time, time.Duration) {
+	return c.clock.now(throttler)
+}
@@ -7,43 +7,124 @@ import (
 
 type ghctxid string
 
+const ghctxparams ghctxid = "gohalt_context_params"
+
+// ghctxflag defines bit flag of explicitly set context param.
+type ghctxflag uint16
+
 const (
-	ghctxpriority  ghctxid = "gohalt_context_priority"
-	ghctxkey       ghctxid = "gohalt_context_key"
-	ghctxmessage   ghctxid = "gohalt_context_message"
-	ghctxtimestamp ghctxid = "gohalt_context_timestamp"
-	ghctxmarshaler ghctxid = "gohalt_context_marshaler"
-	ghctxweight    ghctxid = "gohalt_context_weight"
+	ghctxtimestamp ghctxflag = 1 << iota
+	ghctxpriority
+	ghctxweight
+	ghctxkey
+	ghctxmessage
+	ghctxmarshaler
+	ghctxtoken
+	ghctxqueueing
+	ghctxtenant
+	ghctxlease
+	ghctxfence
+	ghctxaccess
+	ghctxstatus
+	ghctxhedge
 )
 
+// ghctxrecord defines typed record of all gohalt context params
+// that is kept under single context key, so each context helper
+// adds single context layer instead of boxing each value separately.
+// Context record is immutable once it is added to context,
+// each context helper copies parent record before update
+// and keeps parent record reference to track the call context lineage.
+type ghctxrecord struct {
+	parent    *ghctxrecord
+	flags     ghctxflag
+	timestamp time.Time
+	priority  uint8
+	weight    int64
+	key       string
+	message   interface{}
+	marshaler Marshaler
+	token     string
+	queueing  func(Queueing)
+	tenant    string
+	lease     string
+	fence     func(uint64)
+	access    AccessMode
+	status    int
+	hedge     bool
+}
+
+// ghctxempty defines shared read only empty context record.
+var ghctxempty ghctxrecord
+
+func ctxRecord(ctx context.Context) *ghctxrecord {
+	if rec, ok := ctx.Value(ghctxparams).(*ghctxrecord); ok {
+		return rec
+	}
+	return &ghctxempty
+}
+
+func withRecord(ctx context.Context, update func(*ghctxrecord)) context.Context {
+	parent := ctxRecord(ctx)
+	rec := *parent
+	rec.parent = parent
+	update(&rec)
+	return context.WithValue(ctx, ghctxparams, &rec)
+}
+
+// ctxOrigin checks if the provided context is the provided origin context
+// or is derived from it, e.g. by `WithStatus` on release.
+// Contexts without own gohalt record are matched only by identity.
+func ctxOrigin(ctx context.Context, origin context.Context) bool {
+	if ctx == origin {
+		return true
+	}
+	orig := ctxRecord(origin)
+	if orig == &ghctxempty {
+		return false
+	}
+	for rec := ctxRecord(ctx); rec != nil; rec = rec.parent {
+		if rec == orig {
+			return true
+		}
+	}
+	return false
+}
+
+func (rec *ghctxrecord) has(flag ghctxflag) bool {
+	return rec.flags&flag != 0
+}
+
 // WithTimestamp adds the provided timestamp to the provided context
 // to determine latency between `Acquire` and `Release`.
 // Resulted context is used by: `latency` and `percentile` throtttlers.
 func WithTimestamp(ctx context.Context, ts time.Time) context.Context {
-	return context.WithValue(ctx, ghctxtimestamp, ts)
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxtimestamp
+		rec.timestamp = ts
+	})
 }
 
 func ctxTimestamp(ctx context.Context) time.Time {
-	if val := ctx.Value(ghctxtimestamp); val != nil {
-		if timestamp, ok := val.(time.Time); ok {
-			return timestamp.UTC()
-		}
+	if rec := ctxRecord(ctx); rec.has(ghctxtimestamp) {
+		return rec.timestamp.UTC()
 	}
 	return time.Now().UTC()
 }
 
 // WithPriority adds the provided priority to the provided context
 // to differ `Acquire` priority levels.
-// Resulted context is used by: `priority` throtttler.
+// Resulted context is used by: `priority`, `defer` and `gc` throtttlers and by worker pool.
 func WithPriority(ctx context.Context, priority uint8) context.Context {
-	return context.WithValue(ctx, ghctxpriority, priority)
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxpriority
+		rec.priority = priority
+	})
 }
 
 func ctxPriority(ctx context.Context, limit uint8) uint8 {
-	if val := ctx.Value(ghctxpriority); val != nil {
-		if priority, ok := val.(uint8); ok && priority > 0 && priority <= limit {
-			return priority
-		}
+	if rec := ctxRecord(ctx); rec.has(ghctxpriority) && rec.priority > 0 && rec.priority <= limit {
+		return rec.priority
 	}
 	return 1
 }
@@ -52,70 +133,209 @@ func ctxPriority(ctx context.Context, limit uint8) uint8 {
 // to differ `Acquire` weight levels.
 // Resulted context is used by: `before`, `after`, `timed`, `adaptive`, `semaphore`, `cellrate` and `bucket` throtttlers.
 func WithWeight(ctx context.Context, weight int64) context.Context {
-	return context.WithValue(ctx, ghctxweight, weight)
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxweight
+		rec.weight = weight
+	})
+}
+
+// Weight returns the provided context weight added by `WithWeight`,
+// missing or non positive weight is treated as single call weight 1,
+// it is intended for gohalt integrations that implement weighted throttlers.
+func Weight(ctx context.Context) int64 {
+	return ctxWeightMod(ctx)
 }
 
 func ctxWeight(ctx context.Context) int64 {
-	if val := ctx.Value(ghctxweight); val != nil {
-		if weight, ok := val.(int64); ok {
-			return weight
-		}
+	if rec := ctxRecord(ctx); rec.has(ghctxweight) {
+		return rec.weight
 	}
 	return 1
 }
 
 func ctxWeightMod(ctx context.Context) int64 {
-	if val := ctx.Value(ghctxweight); val != nil {
-		if weight, ok := val.(int64); ok && weight > 0 {
-			return weight
-		}
+	if rec := ctxRecord(ctx); rec.has(ghctxweight) && rec.weight > 0 {
+		return rec.weight
 	}
 	return 1
 }
 
 // WithKey adds the provided key to the provided context
 // to add additional call identifier to context.
-// Resulted context is used by: `pattern` and `generator` throtttlers.
+// Resulted context is used by: `pattern`, `generator`, `cached`, `router`, `gcra`, `quota` and `rls` throtttlers.
 func WithKey(ctx context.Context, key string) context.Context {
-	return context.WithValue(ctx, ghctxkey, key)
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxkey
+		rec.key = key
+	})
+}
+
+// Key returns the provided context key added by `WithKey` or empty key,
+// it is intended for gohalt integrations that implement keyed throttlers.
+func Key(ctx context.Context) string {
+	return ctxKey(ctx)
 }
 
 func ctxKey(ctx context.Context) string {
-	if val, ok := ctx.Value(ghctxkey).(string); ok {
-		return val
-	}
-	return ""
+	return ctxRecord(ctx).key
 }
 
 // WithMessage adds the provided message to the provided context
 // to add additional message that need to be used to context.
-// Resulted context is used by: `enqueue` throtttler.
+// Resulted context is used by: `enqueue` and `defer` throtttlers.
 // Used in pair with `WithMarshaler`.
 func WithMessage(ctx context.Context, message interface{}) context.Context {
-	return context.WithValue(ctx, ghctxmessage, message)
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxmessage
+		rec.message = message
+	})
 }
 
 func ctxMessage(ctx context.Context) interface{} {
-	return ctx.Value(ghctxmessage)
+	return ctxRecord(ctx).message
 }
 
 // WithMarshaler adds the provided marshaler to the provided context
 // to add additional message marshaler that need to be used to context.
-// Resulted context is used by: `enqueue` throtttler.
+// Resulted context is used by: `enqueue` and `defer` throtttlers.
 // Used in pair with `WithMessage`.
 func WithMarshaler(ctx context.Context, mrsh Marshaler) context.Context {
-	return context.WithValue(ctx, ghctxmarshaler, mrsh)
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxmarshaler
+		rec.marshaler = mrsh
+	})
 }
 
 func ctxMarshaler(ctx context.Context) Marshaler {
-	if val := ctx.Value(ghctxmarshaler); val != nil {
-		if marshaler, ok := val.(Marshaler); ok {
-			return marshaler
-		}
+	if rec := ctxRecord(ctx); rec.has(ghctxmarshaler) {
+		return rec.marshaler
 	}
 	return DefaultMarshaler
 }
 
+// WithDelegation adds the provided delegation token to the provided context
+// to pass quota slice minted by upstream service to downstream service.
+// Resulted context is used by: `delegation` throtttler.
+func WithDelegation(ctx context.Context, token string) context.Context {
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxtoken
+		rec.token = token
+	})
+}
+
+func ctxDelegation(ctx context.Context) string {
+	return ctxRecord(ctx).token
+}
+
+// WithQueueing adds the provided queueing observer to the provided context
+// to report waiter queue position and estimated admission duration
+// each time waiter queue state changes.
+// Resulted context is used by: `buffered` and `priority` throtttlers.
+func WithQueueing(ctx context.Context, observer func(Queueing)) context.Context {
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxqueueing
+		rec.queueing = observer
+	})
+}
+
+func ctxQueueing(ctx context.Context) func(Queueing) {
+	return ctxRecord(ctx).queueing
+}
+
+// WithTenant adds the provided tenant to the provided context
+// to add additional tenant identifier to context.
+// Resulted context is used by: `tenant` throtttler.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxtenant
+		rec.tenant = tenant
+	})
+}
+
+func ctxTenant(ctx context.Context) string {
+	return ctxRecord(ctx).tenant
+}
+
+// WithLease adds the provided lease to the provided context
+// to add additional held slot lease identifier to context.
+// Resulted context is used by: `lease` throtttler.
+func WithLease(ctx context.Context, lease string) context.Context {
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxlease
+		rec.lease = lease
+	})
+}
+
+func ctxLease(ctx context.Context) string {
+	return ctxRecord(ctx).lease
+}
+
+// WithFence adds the provided fencing token observer to the provided context
+// to report monotonically increasing fencing token each time lock is acquired.
+// Resulted context is used by: `mutex` throtttler.
+func WithFence(ctx context.Context, observer func(uint64)) context.Context {
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxfence
+		rec.fence = observer
+	})
+}
+
+func ctxFence(ctx context.Context) func(uint64) {
+	return ctxRecord(ctx).fence
+}
+
+// AccessMode defines call access mode.
+type AccessMode uint8
+
+const (
+	// AccessRead defines read access mode.
+	AccessRead AccessMode = iota
+	// AccessWrite defines write access mode.
+	AccessWrite
+)
+
+// WithAccessMode adds the provided access mode to the provided context
+// to differ `Acquire` read and write access modes.
+// Resulted context is used by: `rw` throtttler.
+func WithAccessMode(ctx context.Context, mode AccessMode) context.Context {
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxaccess
+		rec.access = mode
+	})
+}
+
+func ctxAccessMode(ctx context.Context) AccessMode {
+	return ctxRecord(ctx).access
+}
+
+// WithStatus adds the provided response status code to the provided context
+// to report outbound call response status back to throttler on `Release`.
+// Resulted context is used by: `client` throtttler.
+func WithStatus(ctx context.Context, status int) context.Context {
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxstatus
+		rec.status = status
+	})
+}
+
+func ctxStatus(ctx context.Context) int {
+	return ctxRecord(ctx).status
+}
+
+// WithHedge adds the provided hedge flag to the provided context
+// to differ hedged speculative calls from primary calls.
+// Resulted context is used by: `hedge` throtttler.
+func WithHedge(ctx context.Context, hedge bool) context.Context {
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxhedge
+		rec.hedge = hedge
+	})
+}
+
+func ctxHedge(ctx context.Context) bool {
+	return ctxRecord(ctx).hedge
+}
+
 // WithParams facade call that respectively calls:
 // - `WithTimestamp`
 // - `WithPriority`
@@ -132,13 +352,15 @@ func WithParams(
 	message interface{},
 	marshaler Marshaler,
 ) context.Context {
-	ctx = WithTimestamp(ctx, ts)
-	ctx = WithPriority(ctx, priority)
-	ctx = WithWeight(ctx, weight)
-	ctx = WithKey(ctx, key)
-	ctx = WithMessage(ctx, message)
-	ctx = WithMarshaler(ctx, marshaler)
-	return ctx
+	return withRecord(ctx, func(rec *ghctxrecord) {
+		rec.flags |= ghctxtimestamp | ghctxpriority | ghctxweight | ghctxkey | ghctxmessage | ghctxmarshaler
+		rec.timestamp = ts
+		rec.priority = priority
+		rec.weight = weight
+		rec.key = key
+		rec.message = message
+		rec.marshaler = marshaler
+	})
 }
 
 type ctxthr struct {
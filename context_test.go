@@ -56,3 +56,58 @@ func TestContext(t *testing.T) {
 		})
 	}
 }
+
+func TestContextOrigin(t *testing.T) {
+	origin := WithKey(context.Background(), "origin")
+	cctx, cancel := context.WithCancel(WithStatus(origin, 200))
+	defer cancel()
+	table := map[string]struct {
+		ctx    context.Context
+		origin context.Context
+		match  bool
+	}{
+		"Context origin should match the same context": {
+			ctx:    context.Background(),
+			origin: context.Background(),
+			match:  true,
+		},
+		"Context origin should match derived contexts": {
+			ctx:    cctx,
+			origin: origin,
+			match:  true,
+		},
+		"Context origin should not match sibling contexts": {
+			ctx:    WithKey(context.Background(), "origin"),
+			origin: origin,
+		},
+		"Context origin should not match parent contexts": {
+			ctx:    context.Background(),
+			origin: origin,
+		},
+		"Context origin should not match contexts without records by lineage": {
+			ctx:    WithKey(context.TODO(), "test"),
+			origin: context.TODO(),
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			assert.Equal(t, tcase.match, ctxOrigin(tcase.ctx, tcase.origin))
+		})
+	}
+}
+
+func BenchmarkContextParams(b *testing.B) {
+	b.ReportAllocs()
+	ts := time.Now()
+	for i := 0; i < b.N; i++ {
+		ctx := WithParams(context.Background(), ts, 1, 1, "test", nil, DefaultMarshaler)
+		ctx = WithTenant(ctx, "test")
+		_ = ctxTimestamp(ctx)
+		_ = ctxPriority(ctx, 1)
+		_ = ctxWeight(ctx)
+		_ = ctxKey(ctx)
+		_ = ctxMessage(ctx)
+		_ = ctxMarshaler(ctx)
+		_ = ctxTenant(ctx)
+	}
+}
@@ -0,0 +1,195 @@
+// Package gohaltamqp provides rabbitmq amqp091-go integration for gohalt throttlers,
+// so rabbitmq consumers could slow down coherently instead of failing throttled messages.
+package gohaltamqp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Channel defines amqp channel prefetch control abstraction, e.g. `*amqp.Channel`.
+type Channel interface {
+	Qos(prefetchCount int, prefetchSize int, global bool) error
+}
+
+// Consumer defines rabbitmq consumer flow controller
+// that converts throttler decisions into channel prefetch adjustments and delayed acks.
+type Consumer struct {
+	ch       Channel
+	thr      gohalt.Throttler
+	prefetch int
+	poll     time.Duration
+	lock     sync.Mutex
+	current  int
+	acquired map[uint64]context.Context
+}
+
+// NewConsumer creates rabbitmq consumer flow controller instance for the provided channel
+// with the specified max channel prefetch count and throttling poll interval, 10ms by default, see `Consumer.Consume`.
+// Channel prefetch count is set with global channel qos,
+// so it could be adjusted for already existing channel consumers.
+func NewConsumer(ch Channel, thr gohalt.Throttler, prefetch int, poll time.Duration) (*Consumer, error) {
+	if prefetch < 1 {
+		prefetch = 1
+	}
+	if poll <= 0 {
+		poll = 10 * time.Millisecond
+	}
+	if err := ch.Qos(prefetch, 0, true); err != nil {
+		return nil, err
+	}
+	return &Consumer{
+		ch:       ch,
+		thr:      thr,
+		prefetch: prefetch,
+		poll:     poll,
+		current:  prefetch,
+		acquired: make(map[uint64]context.Context),
+	}, nil
+}
+
+// Consume forwards the provided channel deliveries to the returned deliveries channel
+// acquiring the throttler before each delivery is forwarded and releasing it after the delivery is acked,
+// nacked or rejected, so `running` throttler caps unacknowledged deliveries in processing.
+// Throttled deliveries are not failed, they are held unacknowledged waiting for the poll interval
+// or for `gohalt.ErrorRetry` retry after duration if any before the next throttler acquire
+// and the channel prefetch count is halved on each throttling, so rabbitmq stops pushing new deliveries.
+// Channel prefetch count is ramped back up by one on each forwarded delivery until it reaches the max prefetch count.
+// Note that rabbitmq doesn't support client side channel flow pause, so prefetch count is used instead.
+// Throttler context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe deliveries processing latency,
+// and with `gohalt.WithKey` set to the delivery routing key,
+// so `pattern` and `router` throttlers could select throttler per routing key.
+// Returned deliveries channel is closed when either the provided deliveries channel is closed
+// or the provided context is done, release and qos errors are only logged.
+func (c *Consumer) Consume(ctx context.Context, deliveries <-chan amqp.Delivery) <-chan amqp.Delivery {
+	out := make(chan amqp.Delivery)
+	go func() {
+		defer close(out)
+		for {
+			var d amqp.Delivery
+			var ok bool
+			select {
+			case <-ctx.Done():
+				return
+			case d, ok = <-deliveries:
+				if !ok {
+					return
+				}
+			}
+			if !c.wait(ctx, &d) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				c.done(d.DeliveryTag, false)
+				return
+			case out <- d:
+			}
+		}
+	}()
+	return out
+}
+
+func (c *Consumer) wait(ctx context.Context, d *amqp.Delivery) bool {
+	for {
+		tctx := gohalt.WithTimestamp(ctx, time.Now().UTC())
+		tctx = gohalt.WithKey(tctx, d.RoutingKey)
+		err := c.thr.Acquire(tctx)
+		if err == nil {
+			c.lock.Lock()
+			c.acquired[d.DeliveryTag] = tctx
+			c.lock.Unlock()
+			d.Acknowledger = acknowledger{Acknowledger: d.Acknowledger, c: c}
+			c.adjust(1)
+			return true
+		}
+		release(c.thr, tctx)
+		c.adjust(0)
+		wait := c.poll
+		var rerr gohalt.ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			wait = rerr.After
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// adjust ramps channel prefetch count up by one if the delta is positive
+// or halves channel prefetch count otherwise.
+func (c *Consumer) adjust(delta int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	prefetch := c.current / 2
+	if delta > 0 {
+		prefetch = c.current + delta
+	}
+	if prefetch < 1 {
+		prefetch = 1
+	}
+	if prefetch > c.prefetch {
+		prefetch = c.prefetch
+	}
+	if prefetch == c.current {
+		return
+	}
+	if err := c.ch.Qos(prefetch, 0, true); err != nil {
+		gohalt.Log("amqp consumer qos error happened: %v", err)
+		return
+	}
+	c.current = prefetch
+}
+
+// done releases the throttler for acknowledged delivery tag
+// or for all delivery tags up to the acknowledged tag if multiple flag is set.
+func (c *Consumer) done(tag uint64, multiple bool) {
+	c.lock.Lock()
+	ctxs := make([]context.Context, 0, 1)
+	for dtag, ctx := range c.acquired {
+		if dtag == tag || (multiple && dtag < tag) {
+			ctxs = append(ctxs, ctx)
+			delete(c.acquired, dtag)
+		}
+	}
+	c.lock.Unlock()
+	for _, ctx := range ctxs {
+		release(c.thr, ctx)
+	}
+}
+
+type acknowledger struct {
+	amqp.Acknowledger
+	c *Consumer
+}
+
+func (a acknowledger) Ack(tag uint64, multiple bool) error {
+	defer a.c.done(tag, multiple)
+	return a.Acknowledger.Ack(tag, multiple)
+}
+
+func (a acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	defer a.c.done(tag, multiple)
+	return a.Acknowledger.Nack(tag, multiple, requeue)
+}
+
+func (a acknowledger) Reject(tag uint64, requeue bool) error {
+	defer a.c.done(tag, false)
+	return a.Acknowledger.Reject(tag, requeue)
+}
+
+func release(thr gohalt.Throttler, ctx context.Context) {
+	if err := thr.Release(ctx); err != nil {
+		gohalt.Log("amqp consumer release error happened: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package gohaltamqp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+)
+
+type tchannel struct {
+	lock sync.Mutex
+	qos  []int
+	err  error
+}
+
+func (ch *tchannel) Qos(prefetchCount int, prefetchSize int, global bool) error {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	if ch.err != nil {
+		return ch.err
+	}
+	ch.qos = append(ch.qos, prefetchCount)
+	return nil
+}
+
+type tacknowledger struct {
+	lock sync.Mutex
+	acks []uint64
+}
+
+func (a *tacknowledger) Ack(tag uint64, multiple bool) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.acks = append(a.acks, tag)
+	return nil
+}
+
+func (a *tacknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	return a.Ack(tag, multiple)
+}
+
+func (a *tacknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Ack(tag, false)
+}
+
+func TestConsumer(t *testing.T) {
+	ch := &tchannel{}
+	ack := &tacknowledger{}
+	cons, err := NewConsumer(ch, gohalt.NewThrottlerRunning(1), 4, time.Millisecond)
+	require.NoError(t, err)
+	in := make(chan amqp.Delivery, 2)
+	in <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 1}
+	in <- amqp.Delivery{Acknowledger: ack, DeliveryTag: 2}
+	close(in)
+	out := cons.Consume(context.Background(), in)
+	d := <-out
+	require.Equal(t, uint64(1), d.DeliveryTag)
+	select {
+	case <-out:
+		require.Fail(t, "amqp consumer should hold delivery while throttled")
+	case <-time.After(20 * time.Millisecond):
+	}
+	require.NoError(t, d.Ack(false))
+	d = <-out
+	require.Equal(t, uint64(2), d.DeliveryTag)
+	require.NoError(t, d.Nack(true, false))
+	_, ok := <-out
+	require.False(t, ok)
+	require.Equal(t, []uint64{1, 2}, ack.acks)
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+	require.Equal(t, []int{4, 2, 1, 2}, ch.qos)
+}
+
+func TestConsumerCancel(t *testing.T) {
+	cons, err := NewConsumer(&tchannel{}, gohalt.NewThrottlerEcho(errors.New("test")), 1, 0)
+	require.NoError(t, err)
+	// zero poll interval falls back to default poll interval.
+	require.Equal(t, 10*time.Millisecond, cons.poll)
+	in := make(chan amqp.Delivery, 1)
+	in <- amqp.Delivery{DeliveryTag: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, ok := <-cons.Consume(ctx, in)
+	require.False(t, ok)
+	_, err = NewConsumer(&tchannel{err: errors.New("test")}, gohalt.NewThrottlerEcho(nil), 1, time.Millisecond)
+	require.Error(t, err)
+}
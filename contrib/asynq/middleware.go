@@ -0,0 +1,92 @@
+// Package gohaltasynq provides asynq task queue integration for gohalt throttlers,
+// so throttled tasks are delayed instead of being failed.
+package gohaltasynq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/hibiken/asynq"
+)
+
+// throttled defines throttled task error that carries task retry delay.
+type throttled struct {
+	err   error
+	delay time.Duration
+}
+
+func (err throttled) Error() string {
+	return fmt.Sprintf("task is throttled, retry after %s: %v", err.delay, err.err)
+}
+
+func (err throttled) Unwrap() error {
+	return err.err
+}
+
+// NewMiddleware creates asynq worker middleware instance that acquires the provided throttler
+// before each task is processed and releases it after the task is processed.
+// Throttler context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe tasks processing latency,
+// and with `gohalt.WithKey` set to the task type,
+// so `pattern` and `router` throttlers could select throttler per task type.
+// Throttled tasks are not processed, instead they fail with throttling error
+// that carries retry delay equal to `gohalt.ErrorRetry` retry after duration if any or to the specified delay.
+// Use `RetryDelay` and `IsFailure` with `asynq.Config` to re-enqueue throttled tasks with the carried delay
+// without counting them as failures and exhausting their retries, release errors are only logged.
+func NewMiddleware(thr gohalt.Throttler, delay time.Duration) asynq.MiddlewareFunc {
+	return func(next asynq.Handler) asynq.Handler {
+		return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+			ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+			ctx = gohalt.WithKey(ctx, task.Type())
+			defer func() {
+				if err := thr.Release(ctx); err != nil {
+					gohalt.Log("asynq middleware release error happened: %v", err)
+				}
+			}()
+			if err := thr.Acquire(ctx); err != nil {
+				terr := throttled{err: err, delay: delay}
+				var rerr gohalt.ErrorRetry
+				if errors.As(err, &rerr) && rerr.After > 0 {
+					terr.delay = rerr.After
+				}
+				return terr
+			}
+			return next.ProcessTask(ctx, task)
+		})
+	}
+}
+
+// RetryDelay returns asynq retry delay func that uses throttled tasks retry delay carried by `NewMiddleware`
+// and falls back to the provided retry delay func otherwise or to `asynq.DefaultRetryDelayFunc` if it's nil,
+// use it with `asynq.Config.RetryDelayFunc`.
+func RetryDelay(fallback asynq.RetryDelayFunc) asynq.RetryDelayFunc {
+	if fallback == nil {
+		fallback = asynq.DefaultRetryDelayFunc
+	}
+	return func(n int, err error, task *asynq.Task) time.Duration {
+		var terr throttled
+		if errors.As(err, &terr) {
+			return terr.delay
+		}
+		return fallback(n, err, task)
+	}
+}
+
+// IsFailure returns asynq failure func that doesn't count throttled tasks errors as failures
+// and falls back to the provided failure func otherwise or treats any error as failure if it's nil,
+// use it with `asynq.Config.IsFailure`.
+func IsFailure(fallback func(error) bool) func(error) bool {
+	return func(err error) bool {
+		var terr throttled
+		if errors.As(err, &terr) {
+			return false
+		}
+		if fallback == nil {
+			return err != nil
+		}
+		return fallback(err)
+	}
+}
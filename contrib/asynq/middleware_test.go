@@ -0,0 +1,71 @@
+package gohaltasynq
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	err := errors.New("test")
+	table := map[string]struct {
+		thr     gohalt.Throttler
+		err     error
+		delay   time.Duration
+		failure bool
+	}{
+		"Asynq middleware should process task on throttler pass": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"Asynq middleware should retry task with default delay on throttler error": {
+			thr:   gohalt.NewThrottlerEcho(err),
+			err:   err,
+			delay: time.Minute,
+		},
+		"Asynq middleware should retry task with retry after delay on throttler retry error": {
+			thr:   gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Hour, Err: err}),
+			err:   gohalt.ErrorRetry{Throttler: "test", After: time.Hour, Err: err},
+			delay: time.Hour,
+		},
+		"Asynq middleware should retry task on matched task type": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^test$"), Throttler: gohalt.NewThrottlerEcho(err)},
+			),
+			err:   err,
+			delay: time.Minute,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			var processed bool
+			handler := NewMiddleware(tcase.thr, time.Minute)(asynq.HandlerFunc(func(context.Context, *asynq.Task) error {
+				processed = true
+				return nil
+			}))
+			task := asynq.NewTask("test", nil)
+			perr := handler.ProcessTask(context.Background(), task)
+			require.Equal(t, tcase.err == nil, processed)
+			if tcase.err == nil {
+				require.NoError(t, perr)
+				return
+			}
+			require.ErrorIs(t, perr, tcase.err)
+			require.False(t, IsFailure(nil)(perr))
+			require.Equal(t, tcase.delay, RetryDelay(nil)(0, perr, task))
+		})
+	}
+}
+
+func TestFallbacks(t *testing.T) {
+	err := errors.New("test")
+	task := asynq.NewTask("test", nil)
+	require.True(t, IsFailure(nil)(err))
+	require.False(t, IsFailure(func(error) bool { return false })(err))
+	require.Equal(t, time.Second, RetryDelay(func(int, error, *asynq.Task) time.Duration { return time.Second })(0, err, task))
+}
@@ -0,0 +1,108 @@
+// Package gohaltchi provides chi router integration for gohalt throttlers,
+// so chi routers could throttle requests per route pattern on top of plain net/http middleware.
+package gohaltchi
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/1pkg/gohalt"
+	"github.com/go-chi/chi/v5"
+)
+
+// Key defines chi request throttling key extractor,
+// resulted key is stamped to request context with `gohalt.WithKey`.
+type Key func(*http.Request) string
+
+// KeyRoutePattern extracts matched route pattern as throttling key, see `chi.Context.RoutePattern`,
+// so "/users/{id}" route is throttled as single route and `pattern` and `router` throttlers
+// could select throttler per route.
+func KeyRoutePattern() Key {
+	return func(r *http.Request) string {
+		if rctx := route(r); rctx != nil {
+			return rctx.RoutePattern()
+		}
+		return ""
+	}
+}
+
+// KeyParam extracts the specified route param value as throttling key.
+func KeyParam(name string) Key {
+	return func(r *http.Request) string {
+		if rctx := route(r); rctx != nil {
+			return rctx.URLParam(name)
+		}
+		return ""
+	}
+}
+
+// KeyHeader extracts the specified request header value as throttling key.
+func KeyHeader(name string) Key {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// KeyRemoteIP extracts request remote ip as throttling key,
+// use `middleware.RealIP` to respect proxy headers.
+func KeyRemoteIP() Key {
+	return func(r *http.Request) string {
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			return host
+		}
+		return r.RemoteAddr
+	}
+}
+
+// NewMiddleware creates chi middleware instance on top of `gohalt.NewMiddlewareHTTP`
+// that stamps request context with `gohalt.WithKey` set to the provided key extractor result,
+// if no key extractor is provided then `KeyRoutePattern` is used.
+// Middleware could be attached either to the whole router, to route group or to single route,
+// route pattern and route params are resolved even if middleware is attached before routing happens.
+// Throttled requests are passed to the provided deny handler, see `gohalt.NewMiddlewareHTTP`.
+func NewMiddleware(
+	thr gohalt.Throttler,
+	key Key,
+	deny func(http.ResponseWriter, *http.Request, error),
+) func(http.Handler) http.Handler {
+	if key == nil {
+		key = KeyRoutePattern()
+	}
+	return func(next http.Handler) http.Handler {
+		handler := gohalt.NewMiddlewareHTTP(next, thr, deny)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(gohalt.WithKey(r.Context(), key(r)))
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// route returns request route context resolved up to the final route,
+// as middlewares attached with `chi.Router.Use` are executed before routing happens.
+func route(r *http.Request) *chi.Context {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return nil
+	}
+	// route is already resolved if the last matched pattern is not a subrouter mount.
+	if patterns := rctx.RoutePatterns; rctx.Routes == nil ||
+		len(patterns) > 0 && !strings.HasSuffix(patterns[len(patterns)-1], "*") {
+		return rctx
+	}
+	path := rctx.RoutePath
+	if path == "" {
+		path = r.URL.RawPath
+		if path == "" {
+			path = r.URL.Path
+		}
+	}
+	tctx := chi.NewRouteContext()
+	tctx.RoutePatterns = append(tctx.RoutePatterns, rctx.RoutePatterns...)
+	tctx.URLParams.Keys = append(tctx.URLParams.Keys, rctx.URLParams.Keys...)
+	tctx.URLParams.Values = append(tctx.URLParams.Values, rctx.URLParams.Values...)
+	if !rctx.Routes.Match(tctx, r.Method, path) {
+		return rctx
+	}
+	return tctx
+}
@@ -0,0 +1,112 @@
+package gohaltchi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/1pkg/gohalt"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	routes := func(pattern string, thr gohalt.Throttler) gohalt.Throttler {
+		return gohalt.NewThrottlerPattern(
+			gohalt.Pattern{Pattern: regexp.MustCompile(pattern), Throttler: thr},
+			gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+		)
+	}
+	table := map[string]struct {
+		router func(func(http.Handler) http.Handler) http.Handler
+		thr    gohalt.Throttler
+		key    Key
+		path   string
+		code   int
+	}{
+		"Chi middleware should pass not throttled requests": {
+			router: func(mw func(http.Handler) http.Handler) http.Handler {
+				r := chi.NewRouter()
+				r.Use(mw)
+				r.Get("/users/{id}", ok)
+				return r
+			},
+			thr:  routes(`^/users/\{id\}$`, gohalt.NewThrottlerEcho(nil)),
+			path: "/users/1",
+			code: http.StatusOK,
+		},
+		"Chi middleware should throttle by route pattern before routing": {
+			router: func(mw func(http.Handler) http.Handler) http.Handler {
+				r := chi.NewRouter()
+				r.Use(mw)
+				r.Get("/users/{id}", ok)
+				return r
+			},
+			thr:  routes(`^/users/\{id\}$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			path: "/users/1",
+			code: http.StatusTooManyRequests,
+		},
+		"Chi middleware should throttle by route pattern of mounted router": {
+			router: func(mw func(http.Handler) http.Handler) http.Handler {
+				r := chi.NewRouter()
+				r.Use(mw)
+				r.Route("/api", func(r chi.Router) {
+					r.Use(mw)
+					r.Get("/users/{id}", ok)
+				})
+				return r
+			},
+			thr:  routes(`^/api/users/\{id\}$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			path: "/api/users/1",
+			code: http.StatusTooManyRequests,
+		},
+		"Chi middleware should throttle by route pattern of inline route": {
+			router: func(mw func(http.Handler) http.Handler) http.Handler {
+				r := chi.NewRouter()
+				r.With(mw).Get("/users/{id}", ok)
+				return r
+			},
+			thr:  routes(`^/users/\{id\}$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			path: "/users/1",
+			code: http.StatusTooManyRequests,
+		},
+		"Chi middleware should throttle by route params": {
+			router: func(mw func(http.Handler) http.Handler) http.Handler {
+				r := chi.NewRouter()
+				r.Use(mw)
+				r.Get("/users/{id}", ok)
+				return r
+			},
+			thr:  routes(`^1$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			key:  KeyParam("id"),
+			path: "/users/1",
+			code: http.StatusTooManyRequests,
+		},
+		"Chi middleware should throttle by remote ip": {
+			router: func(mw func(http.Handler) http.Handler) http.Handler {
+				r := chi.NewRouter()
+				r.Use(mw)
+				r.Get("/users/{id}", ok)
+				return r
+			},
+			thr:  routes(`^192\.0\.2\.1$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			key:  KeyRemoteIP(),
+			path: "/users/1",
+			code: http.StatusTooManyRequests,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			router := tcase.router(NewMiddleware(tcase.thr, tcase.key, nil))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tcase.path, nil))
+			require.Equal(t, tcase.code, w.Code)
+		})
+	}
+}
+
+func ok(w http.ResponseWriter, _ *http.Request) {
+	_, _ = w.Write([]byte("ok"))
+}
@@ -0,0 +1,92 @@
+// Package gohaltcloudwatch provides aws cloudwatch metrics integration for gohalt throttlers,
+// so work against aws managed services could be throttled based on their own health metrics.
+package gohaltcloudwatch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Client defines cloudwatch client abstraction used by `NewMetric`, e.g. `*cloudwatch.Client`.
+type Client interface {
+	GetMetricData(
+		context.Context,
+		*cloudwatch.GetMetricDataInput,
+		...func(*cloudwatch.Options),
+	) (*cloudwatch.GetMetricDataOutput, error)
+}
+
+type metric struct {
+	client    Client
+	query     types.MetricDataQuery
+	window    time.Duration
+	threshold float64
+	cache     time.Duration
+	lock      sync.Mutex
+	value     bool
+	ts        time.Time
+}
+
+// NewMetric creates cloudwatch metric querier instance
+// with cache interval defined by the provided duration
+// that executes the provided metric data query with the provided client over the provided time window ending now,
+// e.g. rds `CPUUtilization` or sqs `ApproximateNumberOfMessagesVisible` metric stat with its own period,
+// and checks if the latest query value exceeds the provided threshold.
+// Metric data query id is defaulted to `gohalt` if it isn't set.
+// Only successful metric results are cached.
+func NewMetric(
+	client Client,
+	query types.MetricDataQuery,
+	window time.Duration,
+	threshold float64,
+	cache time.Duration,
+) gohalt.Metric {
+	if query.Id == nil {
+		query.Id = aws.String("gohalt")
+	}
+	return &metric{client: client, query: query, window: window, threshold: threshold, cache: cache}
+}
+
+func (mtc *metric) Query(ctx context.Context) (bool, error) {
+	mtc.lock.Lock()
+	defer mtc.lock.Unlock()
+	now := time.Now()
+	if !mtc.ts.IsZero() && now.Sub(mtc.ts) < mtc.cache {
+		return mtc.value, nil
+	}
+	value, err := mtc.pull(ctx, now)
+	if err != nil {
+		return mtc.value, err
+	}
+	mtc.value, mtc.ts = value, now
+	return mtc.value, nil
+}
+
+func (mtc *metric) pull(ctx context.Context, now time.Time) (bool, error) {
+	out, err := mtc.client.GetMetricData(ctx, &cloudwatch.GetMetricDataInput{
+		StartTime:         aws.Time(now.Add(-mtc.window)),
+		EndTime:           aws.Time(now),
+		MetricDataQueries: []types.MetricDataQuery{mtc.query},
+		ScanBy:            types.ScanByTimestampDescending,
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, result := range out.MetricDataResults {
+		if aws.ToString(result.Id) != aws.ToString(mtc.query.Id) {
+			continue
+		}
+		if len(result.Values) == 0 {
+			return false, fmt.Errorf("cloudwatch metric %q returned no values", aws.ToString(mtc.query.Id))
+		}
+		return result.Values[0] > mtc.threshold, nil
+	}
+	return false, fmt.Errorf("cloudwatch metric %q returned no results", aws.ToString(mtc.query.Id))
+}
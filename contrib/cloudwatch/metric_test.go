@@ -0,0 +1,100 @@
+package gohaltcloudwatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/require"
+)
+
+type tclient struct {
+	calls  int
+	input  *cloudwatch.GetMetricDataInput
+	output *cloudwatch.GetMetricDataOutput
+	err    error
+}
+
+func (c *tclient) GetMetricData(
+	_ context.Context,
+	input *cloudwatch.GetMetricDataInput,
+	_ ...func(*cloudwatch.Options),
+) (*cloudwatch.GetMetricDataOutput, error) {
+	c.calls++
+	c.input = input
+	return c.output, c.err
+}
+
+func TestMetric(t *testing.T) {
+	query := types.MetricDataQuery{
+		MetricStat: &types.MetricStat{
+			Metric: &types.Metric{
+				Namespace:  aws.String("AWS/RDS"),
+				MetricName: aws.String("CPUUtilization"),
+			},
+			Period: aws.Int32(60),
+			Stat:   aws.String("Average"),
+		},
+	}
+	table := map[string]struct {
+		client *tclient
+		metric bool
+		err    string
+	}{
+		"Cloudwatch metric should be reached if latest value exceeds threshold": {
+			client: &tclient{output: &cloudwatch.GetMetricDataOutput{
+				MetricDataResults: []types.MetricDataResult{{Id: aws.String("gohalt"), Values: []float64{90, 10}}},
+			}},
+			metric: true,
+		},
+		"Cloudwatch metric should not be reached if latest value is below threshold": {
+			client: &tclient{output: &cloudwatch.GetMetricDataOutput{
+				MetricDataResults: []types.MetricDataResult{{Id: aws.String("gohalt"), Values: []float64{10, 90}}},
+			}},
+		},
+		"Cloudwatch metric should fail on empty values": {
+			client: &tclient{output: &cloudwatch.GetMetricDataOutput{
+				MetricDataResults: []types.MetricDataResult{{Id: aws.String("gohalt")}},
+			}},
+			err: `cloudwatch metric "gohalt" returned no values`,
+		},
+		"Cloudwatch metric should fail on missing results": {
+			client: &tclient{output: &cloudwatch.GetMetricDataOutput{
+				MetricDataResults: []types.MetricDataResult{{Id: aws.String("other"), Values: []float64{90}}},
+			}},
+			err: `cloudwatch metric "gohalt" returned no results`,
+		},
+		"Cloudwatch metric should fail on client errors": {
+			client: &tclient{err: errors.New("test")},
+			err:    "test",
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			metric, err := NewMetric(tcase.client, query, 5*time.Minute, 50, time.Minute).Query(context.Background())
+			require.Equal(t, types.ScanByTimestampDescending, tcase.client.input.ScanBy)
+			require.Equal(t, 5*time.Minute, tcase.client.input.EndTime.Sub(*tcase.client.input.StartTime))
+			if tcase.err != "" {
+				require.EqualError(t, err, tcase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tcase.metric, metric)
+		})
+	}
+	t.Run("Cloudwatch metric should cache successful results", func(t *testing.T) {
+		client := &tclient{output: &cloudwatch.GetMetricDataOutput{
+			MetricDataResults: []types.MetricDataResult{{Id: aws.String("gohalt"), Values: []float64{90}}},
+		}}
+		thr := gohalt.NewThrottlerMetric(NewMetric(client, query, time.Minute, 50, time.Hour))
+		for i := 0; i < 3; i++ {
+			require.Error(t, thr.Acquire(context.Background()))
+		}
+		require.Equal(t, 1, client.calls)
+	})
+}
@@ -0,0 +1,162 @@
+// Package gohaltconnect provides connect rpc integration for gohalt throttlers,
+// see `gohaltgrpc.NewInterceptorUnary` for grpc integration.
+package gohaltconnect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/1pkg/gohalt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type interceptor struct {
+	thr gohalt.Throttler
+}
+
+// NewInterceptor creates connect interceptor instance for both clients and handlers
+// that acquires the provided throttler before each unary call or stream and releases it after the call or stream.
+// Call context is stamped with `gohalt.WithKey` set to the procedure name, so `pattern` and `router` throttlers
+// could select throttler per procedure, and with `gohalt.WithTimestamp` on call,
+// so `latency` and `percentile` throttlers observe the call latency.
+// Client call status is reported on release with `gohalt.WithStatus`, `CodeResourceExhausted` is reported as
+// `429 Too Many Requests`, `CodeUnavailable` is reported as `503 Service Unavailable`
+// and other codes are reported as `200 OK`, so adaptive `client` throttler backs off on overloaded servers.
+// Throttled calls are failed with `CodeResourceExhausted` connect error that wraps throttling error
+// and carries `errdetails.ErrorInfo` detail and `errdetails.RetryInfo` detail set from `gohalt.ErrorRetry` if any,
+// internal throttling errors are failed with `CodeInternal` connect error.
+// Release errors are only logged.
+func NewInterceptor(thr gohalt.Throttler) connect.Interceptor {
+	return interceptor{thr: thr}
+}
+
+func (i interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		ctx = gohalt.WithTimestamp(gohalt.WithKey(ctx, req.Spec().Procedure), time.Now().UTC())
+		if err := i.thr.Acquire(ctx); err != nil {
+			i.release(ctx)
+			return nil, deny(err)
+		}
+		resp, err := next(ctx, req)
+		if req.Spec().IsClient {
+			ctx = gohalt.WithStatus(ctx, status(err))
+		}
+		i.release(ctx)
+		return resp, err
+	}
+}
+
+func (i interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		ctx = gohalt.WithTimestamp(gohalt.WithKey(ctx, spec.Procedure), time.Now().UTC())
+		conn := next(ctx, spec)
+		if err := i.thr.Acquire(ctx); err != nil {
+			i.release(ctx)
+			return deniedconn{StreamingClientConn: conn, err: deny(err)}
+		}
+		return &throttledconn{StreamingClientConn: conn, release: func(err error) {
+			i.release(gohalt.WithStatus(ctx, status(err)))
+		}}
+	}
+}
+
+func (i interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx = gohalt.WithTimestamp(gohalt.WithKey(ctx, conn.Spec().Procedure), time.Now().UTC())
+		defer i.release(ctx)
+		if err := i.thr.Acquire(ctx); err != nil {
+			return deny(err)
+		}
+		return next(ctx, conn)
+	}
+}
+
+func (i interceptor) release(ctx context.Context) {
+	if err := i.thr.Release(ctx); err != nil {
+		gohalt.Log("connect interceptor release error happened: %v", err)
+	}
+}
+
+// deniedconn fails outbound stream that was throttled before it is established.
+type deniedconn struct {
+	connect.StreamingClientConn
+	err error
+}
+
+func (conn deniedconn) Send(interface{}) error {
+	return conn.err
+}
+
+func (conn deniedconn) Receive(interface{}) error {
+	return conn.err
+}
+
+func (conn deniedconn) CloseRequest() error {
+	return nil
+}
+
+func (conn deniedconn) CloseResponse() error {
+	return nil
+}
+
+// throttledconn releases throttler once outbound stream is finished.
+type throttledconn struct {
+	connect.StreamingClientConn
+	release func(error)
+	err     error
+}
+
+func (conn *throttledconn) Receive(msg interface{}) error {
+	err := conn.StreamingClientConn.Receive(msg)
+	if err != nil && !errors.Is(err, io.EOF) && conn.err == nil {
+		conn.err = err
+	}
+	return err
+}
+
+func (conn *throttledconn) CloseResponse() error {
+	err := conn.StreamingClientConn.CloseResponse()
+	if conn.release != nil {
+		conn.release(conn.err)
+		conn.release = nil
+	}
+	return err
+}
+
+// deny converts throttling error to connect error with structured error details.
+func deny(err error) error {
+	var ierr gohalt.ErrorInternal
+	if errors.As(err, &ierr) {
+		return connect.NewError(connect.CodeInternal, err)
+	}
+	cerr := connect.NewError(connect.CodeResourceExhausted, err)
+	info := &errdetails.ErrorInfo{Reason: "THROTTLED", Domain: "gohalt"}
+	if detail, derr := connect.NewErrorDetail(info); derr == nil {
+		cerr.AddDetail(detail)
+	}
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		retry := &errdetails.RetryInfo{RetryDelay: durationpb.New(rerr.After)}
+		if detail, derr := connect.NewErrorDetail(retry); derr == nil {
+			cerr.AddDetail(detail)
+		}
+	}
+	return cerr
+}
+
+// status maps connect call error to http response status reported to throttlers.
+func status(err error) int {
+	switch connect.CodeOf(err) {
+	case connect.CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case connect.CodeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusOK
+	}
+}
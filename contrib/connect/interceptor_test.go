@@ -0,0 +1,144 @@
+package gohaltconnect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	unary  = "/gohalt.test.v1.Test/Unary"
+	stream = "/gohalt.test.v1.Test/Stream"
+)
+
+func testServer(t *testing.T, opts ...connect.HandlerOption) string {
+	mux := http.NewServeMux()
+	mux.Handle(unary, connect.NewUnaryHandler(
+		unary,
+		func(_ context.Context, req *connect.Request[wrapperspb.StringValue]) (*connect.Response[wrapperspb.StringValue], error) {
+			if req.Msg.GetValue() == "busy" {
+				return nil, connect.NewError(connect.CodeResourceExhausted, errors.New("busy"))
+			}
+			return connect.NewResponse(req.Msg), nil
+		},
+		opts...,
+	))
+	mux.Handle(stream, connect.NewServerStreamHandler(
+		stream,
+		func(_ context.Context, req *connect.Request[wrapperspb.StringValue], s *connect.ServerStream[wrapperspb.StringValue]) error {
+			return s.Send(req.Msg)
+		},
+		opts...,
+	))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestInterceptorHandler(t *testing.T) {
+	table := map[string]struct {
+		thr     gohalt.Throttler
+		code    connect.Code
+		details int
+		retry   time.Duration
+	}{
+		"Connect handler interceptor should pass not throttled calls": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"Connect handler interceptor should deny throttled calls": {
+			thr:     gohalt.NewThrottlerEcho(errors.New("test")),
+			code:    connect.CodeResourceExhausted,
+			details: 1,
+		},
+		"Connect handler interceptor should deny throttled calls with retry info": {
+			thr:     gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Second}),
+			code:    connect.CodeResourceExhausted,
+			details: 2,
+			retry:   time.Second,
+		},
+		"Connect handler interceptor should fail on internal throttling errors": {
+			thr:  gohalt.NewThrottlerEcho(gohalt.ErrorInternal{Throttler: "test", Message: "test"}),
+			code: connect.CodeInternal,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			url := testServer(t, connect.WithInterceptors(NewInterceptor(tcase.thr)))
+			ctx := context.Background()
+			req := connect.NewRequest(wrapperspb.String("test"))
+			uclient := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](http.DefaultClient, url+unary)
+			_, uerr := uclient.CallUnary(ctx, req)
+			sclient := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](http.DefaultClient, url+stream)
+			resp, err := sclient.CallServerStream(ctx, req)
+			require.NoError(t, err)
+			for resp.Receive() {
+			}
+			serr := resp.Err()
+			require.NoError(t, resp.Close())
+			for _, err := range []error{uerr, serr} {
+				if tcase.code == 0 {
+					require.NoError(t, err)
+					continue
+				}
+				var cerr *connect.Error
+				require.True(t, errors.As(err, &cerr))
+				require.Equal(t, tcase.code, cerr.Code())
+				require.Len(t, cerr.Details(), tcase.details)
+				for _, detail := range cerr.Details() {
+					msg, err := detail.Value()
+					require.NoError(t, err)
+					switch msg := msg.(type) {
+					case *errdetails.ErrorInfo:
+						require.Equal(t, "THROTTLED", msg.GetReason())
+					case *errdetails.RetryInfo:
+						require.Equal(t, tcase.retry, msg.GetRetryDelay().AsDuration())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInterceptorClient(t *testing.T) {
+	url := testServer(t)
+	ctx := context.Background()
+	thr := gohalt.NewThrottlerClient(2, time.Hour, 0.5, 0)
+	uclient := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		http.DefaultClient,
+		url+unary,
+		connect.WithInterceptors(NewInterceptor(thr)),
+	)
+	_, err := uclient.CallUnary(ctx, connect.NewRequest(wrapperspb.String("busy")))
+	require.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(err))
+	_, err = uclient.CallUnary(ctx, connect.NewRequest(wrapperspb.String("test")))
+	var terr gohalt.ErrorThreshold
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, "client", terr.Throttler)
+	require.Equal(t, connect.CodeResourceExhausted, connect.CodeOf(err))
+	thr = gohalt.NewThrottlerRunning(1)
+	sclient := connect.NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+		http.DefaultClient,
+		url+stream,
+		connect.WithInterceptors(NewInterceptor(thr)),
+	)
+	first, err := sclient.CallServerStream(ctx, connect.NewRequest(wrapperspb.String("test")))
+	require.NoError(t, err)
+	_, err = sclient.CallServerStream(ctx, connect.NewRequest(wrapperspb.String("test")))
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, "running", terr.Throttler)
+	for first.Receive() {
+	}
+	require.NoError(t, first.Close())
+	second, err := sclient.CallServerStream(ctx, connect.NewRequest(wrapperspb.String("test")))
+	require.NoError(t, err)
+	require.NoError(t, second.Close())
+}
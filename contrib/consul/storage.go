@@ -0,0 +1,156 @@
+// Package gohaltconsul provides consul integration for gohalt throttlers,
+// so consul KV could keep shared state of gohalt storage throttlers without extra infrastructure.
+package gohaltconsul
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/hashicorp/consul/api"
+)
+
+type storage struct {
+	client *api.Client
+}
+
+// NewStorage creates consul storage instance
+// which keeps all keys in consul KV reached by the provided client.
+// All updates are done via KV check and set operations and transactions.
+// Expiring keys are acquired by consul sessions with delete behavior and the specified ttl,
+// so ttl is rounded up to 10 seconds consul sessions minimum
+// and expired keys could be deleted up to twice the ttl later.
+// Use `gohalt.NewStorageRetried` to retry failed storage operations.
+func NewStorage(client *api.Client) gohalt.Storage {
+	return storage{client: client}
+}
+
+func (stg storage) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	pair, _, err := stg.client.KV().Get(key, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	if pair == nil {
+		return nil, false, nil
+	}
+	return pair.Value, true, nil
+}
+
+func (stg storage) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl == 0 {
+		_, err := stg.client.KV().Put(&api.KVPair{Key: key, Value: value}, (&api.WriteOptions{}).WithContext(ctx))
+		return err
+	}
+	for {
+		pair, _, err := stg.client.KV().Get(key, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		if ok, err := stg.put(ctx, key, value, pair, ttl); ok || err != nil {
+			return err
+		}
+	}
+}
+
+func (stg storage) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	for {
+		pair, _, err := stg.client.KV().Get(key, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return 0, err
+		}
+		// missing key is created with provided ttl.
+		if pair == nil {
+			ok, err := stg.put(ctx, key, []byte(strconv.FormatInt(delta, 10)), nil, ttl)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				return delta, nil
+			}
+			continue
+		}
+		current, err := strconv.ParseInt(string(pair.Value), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		// existing key is updated in place to keep its session.
+		next := &api.KVPair{
+			Key:         key,
+			Value:       []byte(strconv.FormatInt(current+delta, 10)),
+			ModifyIndex: pair.ModifyIndex,
+		}
+		ok, _, err := stg.client.KV().CAS(next, (&api.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return current + delta, nil
+		}
+	}
+}
+
+func (stg storage) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	old []byte,
+	new []byte,
+	ttl time.Duration,
+) (bool, error) {
+	pair, _, err := stg.client.KV().Get(key, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return false, err
+	}
+	if (old == nil && pair != nil) || (old != nil && (pair == nil || !bytes.Equal(old, pair.Value))) {
+		return false, nil
+	}
+	if new == nil {
+		if pair == nil {
+			return true, nil
+		}
+		swapped, _, err := stg.client.KV().DeleteCAS(pair, (&api.WriteOptions{}).WithContext(ctx))
+		return swapped, err
+	}
+	return stg.put(ctx, key, new, pair, ttl)
+}
+
+func (stg storage) Delete(ctx context.Context, key string) error {
+	_, err := stg.client.KV().Delete(key, (&api.WriteOptions{}).WithContext(ctx))
+	return err
+}
+
+// put atomically replaces the provided previous key pair or creates missing key if previous pair is nil
+// and acquires the key with new delete behavior session if ttl is provided.
+func (stg storage) put(ctx context.Context, key string, value []byte, prev *api.KVPair, ttl time.Duration) (bool, error) {
+	ops := api.TxnOps{}
+	if prev != nil {
+		ops = append(ops, &api.TxnOp{KV: &api.KVTxnOp{Verb: api.KVDeleteCAS, Key: key, Index: prev.ModifyIndex}})
+	} else {
+		ops = append(ops, &api.TxnOp{KV: &api.KVTxnOp{Verb: api.KVCheckNotExists, Key: key}})
+	}
+	var session string
+	if ttl > 0 {
+		if ttl < 10*time.Second {
+			ttl = 10 * time.Second
+		}
+		id, _, err := stg.client.Session().Create(&api.SessionEntry{
+			Name:      "gohalt_storage",
+			TTL:       ttl.String(),
+			Behavior:  api.SessionBehaviorDelete,
+			LockDelay: time.Millisecond,
+		}, (&api.WriteOptions{}).WithContext(ctx))
+		if err != nil {
+			return false, err
+		}
+		session = id
+		ops = append(ops, &api.TxnOp{KV: &api.KVTxnOp{Verb: api.KVLock, Key: key, Value: value, Session: session}})
+	} else {
+		ops = append(ops, &api.TxnOp{KV: &api.KVTxnOp{Verb: api.KVSet, Key: key, Value: value}})
+	}
+	ok, _, _, err := stg.client.Txn().Txn(ops, (&api.QueryOptions{}).WithContext(ctx))
+	if (!ok || err != nil) && session != "" {
+		_, _ = stg.client.Session().Destroy(session, (&api.WriteOptions{}).WithContext(ctx))
+	}
+	return ok, err
+}
@@ -0,0 +1,247 @@
+package gohaltconsul
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+)
+
+// tconsul defines in process consul agent fake
+// that serves kv, transactions and sessions endpoints used by the storage.
+type tconsul struct {
+	lock     sync.Mutex
+	index    uint64
+	kv       map[string]*api.KVPair
+	sessions map[string]string
+	conflict bool
+}
+
+func (c *tconsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	query := r.URL.Query()
+	switch path := r.URL.Path; {
+	case strings.HasPrefix(path, "/v1/kv/") && r.Method == http.MethodGet:
+		pair, ok := c.kv[strings.TrimPrefix(path, "/v1/kv/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]*api.KVPair{pair})
+	case strings.HasPrefix(path, "/v1/kv/") && r.Method == http.MethodPut:
+		key := strings.TrimPrefix(path, "/v1/kv/")
+		value, _ := io.ReadAll(r.Body)
+		pair, ok := c.kv[key]
+		if cas := query.Get("cas"); cas != "" {
+			// inject single concurrent update conflict.
+			if c.conflict && ok {
+				c.conflict = false
+				pair.ModifyIndex = c.next()
+			}
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if (index == 0 && ok) || (index != 0 && (!ok || pair.ModifyIndex != index)) {
+				_, _ = w.Write([]byte("false"))
+				return
+			}
+		}
+		c.set(key, value, "")
+		_, _ = w.Write([]byte("true"))
+	case strings.HasPrefix(path, "/v1/kv/") && r.Method == http.MethodDelete:
+		key := strings.TrimPrefix(path, "/v1/kv/")
+		if cas := query.Get("cas"); cas != "" {
+			index, _ := strconv.ParseUint(cas, 10, 64)
+			if pair, ok := c.kv[key]; !ok || pair.ModifyIndex != index {
+				_, _ = w.Write([]byte("false"))
+				return
+			}
+		}
+		delete(c.kv, key)
+		_, _ = w.Write([]byte("true"))
+	case path == "/v1/session/create":
+		var entry struct {
+			TTL      string
+			Behavior string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&entry)
+		id := strconv.FormatUint(c.next(), 10)
+		c.sessions[id] = entry.TTL
+		_ = json.NewEncoder(w).Encode(map[string]string{"ID": id})
+	case strings.HasPrefix(path, "/v1/session/destroy/"):
+		c.destroy(strings.TrimPrefix(path, "/v1/session/destroy/"))
+		_, _ = w.Write([]byte("true"))
+	case path == "/v1/txn":
+		var ops api.TxnOps
+		_ = json.NewDecoder(r.Body).Decode(&ops)
+		for i, op := range ops {
+			pair, ok := c.kv[op.KV.Key]
+			var failed bool
+			switch op.KV.Verb {
+			case api.KVCheckNotExists:
+				failed = ok
+			case api.KVDeleteCAS:
+				failed = !ok || pair.ModifyIndex != op.KV.Index
+			case api.KVLock:
+				_, exists := c.sessions[op.KV.Session]
+				failed = !exists
+			}
+			if failed {
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(api.TxnResponse{Errors: api.TxnErrors{{OpIndex: i, What: "failed"}}})
+				return
+			}
+		}
+		for _, op := range ops {
+			switch op.KV.Verb {
+			case api.KVDeleteCAS:
+				delete(c.kv, op.KV.Key)
+			case api.KVSet, api.KVLock:
+				c.set(op.KV.Key, op.KV.Value, op.KV.Session)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(api.TxnResponse{})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// expire invalidates all sessions, which deletes all keys acquired by them.
+func (c *tconsul) expire() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for id := range c.sessions {
+		c.destroy(id)
+	}
+}
+
+func (c *tconsul) ttl() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ttls := make([]string, 0, len(c.sessions))
+	for _, ttl := range c.sessions {
+		ttls = append(ttls, ttl)
+	}
+	return ttls
+}
+
+func (c *tconsul) set(key string, value []byte, session string) {
+	index := c.next()
+	if pair, ok := c.kv[key]; ok {
+		pair.Value, pair.ModifyIndex = value, index
+		if session != "" {
+			pair.Session = session
+		}
+		return
+	}
+	c.kv[key] = &api.KVPair{Key: key, Value: value, CreateIndex: index, ModifyIndex: index, Session: session}
+}
+
+func (c *tconsul) destroy(id string) {
+	delete(c.sessions, id)
+	for key, pair := range c.kv {
+		if pair.Session == id {
+			delete(c.kv, key)
+		}
+	}
+}
+
+func (c *tconsul) next() uint64 {
+	c.index++
+	return c.index
+}
+
+func TestStorage(t *testing.T) {
+	agent := &tconsul{kv: make(map[string]*api.KVPair), sessions: make(map[string]string)}
+	srv := httptest.NewServer(agent)
+	defer srv.Close()
+	client, err := api.NewClient(&api.Config{Address: srv.URL})
+	require.NoError(t, err)
+	stg := NewStorage(client)
+	ctx := context.TODO()
+	t.Run("Consul storage should get set and delete keys", func(t *testing.T) {
+		_, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, stg.Set(ctx, "key", []byte("val"), 0))
+		val, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("val"), val)
+		require.NoError(t, stg.Delete(ctx, "key"))
+		_, ok, _ = stg.Get(ctx, "key")
+		require.False(t, ok)
+	})
+	t.Run("Consul storage should increment counters with check and set", func(t *testing.T) {
+		cnt, err := stg.Incr(ctx, "cnt", 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cnt)
+		// concurrent update conflict is retried with fresh counter.
+		agent.lock.Lock()
+		agent.conflict = true
+		agent.lock.Unlock()
+		cnt, err = stg.Incr(ctx, "cnt", -3, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(-1), cnt)
+		require.NoError(t, stg.Set(ctx, "cnt", []byte("nan"), 0))
+		_, err = stg.Incr(ctx, "cnt", 1, 0)
+		require.Error(t, err)
+	})
+	t.Run("Consul storage should compare and swap keys", func(t *testing.T) {
+		swapped, err := stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.NoError(t, err)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("old"), 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.True(t, swapped)
+		val, _, _ := stg.Get(ctx, "cas")
+		require.Equal(t, []byte("new"), val)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), nil, 0)
+		require.True(t, swapped)
+		_, ok, _ := stg.Get(ctx, "cas")
+		require.False(t, ok)
+	})
+	t.Run("Consul storage should expire keys with sessions", func(t *testing.T) {
+		require.NoError(t, stg.Set(ctx, "ttl", []byte("val"), time.Millisecond))
+		_, _ = stg.Incr(ctx, "ttlcnt", 1, time.Minute)
+		cnt, _ := stg.Incr(ctx, "ttlcnt", 1, time.Minute)
+		require.Equal(t, int64(2), cnt)
+		swapped, _ := stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("val"), time.Minute)
+		require.True(t, swapped)
+		require.ElementsMatch(t, []string{"10s", "1m0s", "1m0s"}, agent.ttl())
+		_, ok, _ := stg.Get(ctx, "ttl")
+		require.True(t, ok)
+		agent.expire()
+		_, ok, _ = stg.Get(ctx, "ttl")
+		require.False(t, ok)
+		_, ok, _ = stg.Get(ctx, "ttlcas")
+		require.False(t, ok)
+		cnt, _ = stg.Incr(ctx, "ttlcnt", 1, 0)
+		require.Equal(t, int64(1), cnt)
+	})
+	t.Run("Consul storage should fail on unreachable agent", func(t *testing.T) {
+		client, err := api.NewClient(&api.Config{Address: "127.0.0.1:1"})
+		require.NoError(t, err)
+		stg := gohalt.NewStorageRetried(NewStorage(client), 1)
+		_, _, err = stg.Get(ctx, "key")
+		require.Error(t, err)
+		require.Error(t, stg.Set(ctx, "key", nil, 0))
+		_, err = stg.Incr(ctx, "key", 1, 0)
+		require.Error(t, err)
+		_, err = stg.CompareAndSwap(ctx, "key", nil, nil, 0)
+		require.Error(t, err)
+		require.Error(t, stg.Delete(ctx, "key"))
+	})
+}
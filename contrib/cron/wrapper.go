@@ -0,0 +1,72 @@
+// Package gohaltcron provides robfig cron integration for gohalt throttlers,
+// so overlapping or too frequent scheduled jobs runs could be suppressed centrally.
+package gohaltcron
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/robfig/cron/v3"
+)
+
+// Skip returns cron job wrapper that acquires the provided throttler before each job run
+// and releases it after the job run, throttled job runs are skipped and only logged,
+// e.g. with `running` throttler to skip overlapping runs or with `spacing` throttler to skip too frequent runs.
+// Throttler context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe job runs latency,
+// and with `gohalt.WithKey` set to the specified key, so jobs sharing the same throttler
+// could be distinguished by `pattern` and `router` throttlers.
+// Use it with `cron.WithChain` or `cron.NewChain`, release errors are only logged.
+func Skip(thr gohalt.Throttler, key string) cron.JobWrapper {
+	return func(job cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			ctx := context.Background()
+			ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+			ctx = gohalt.WithKey(ctx, key)
+			defer release(thr, ctx)
+			if err := thr.Acquire(ctx); err != nil {
+				gohalt.Log("cron job %q run is skipped: %v", key, err)
+				return
+			}
+			job.Run()
+		})
+	}
+}
+
+// Delay returns cron job wrapper that acquires the provided throttler before each job run
+// and releases it after the job run the same way as `Skip` does,
+// but throttled job runs are delayed instead of being skipped, they wait for the specified poll interval
+// or for `gohalt.ErrorRetry` retry after duration if any before the next throttler acquire until the throttler passes.
+func Delay(thr gohalt.Throttler, key string, poll time.Duration) cron.JobWrapper {
+	return func(job cron.Job) cron.Job {
+		return cron.FuncJob(func() {
+			for {
+				ctx := context.Background()
+				ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+				ctx = gohalt.WithKey(ctx, key)
+				err := thr.Acquire(ctx)
+				if err == nil {
+					defer release(thr, ctx)
+					job.Run()
+					return
+				}
+				release(thr, ctx)
+				wait := poll
+				var rerr gohalt.ErrorRetry
+				if errors.As(err, &rerr) && rerr.After > 0 {
+					wait = rerr.After
+				}
+				gohalt.Log("cron job %q run is delayed for %s: %v", key, wait, err)
+				time.Sleep(wait)
+			}
+		})
+	}
+}
+
+func release(thr gohalt.Throttler, ctx context.Context) {
+	if err := thr.Release(ctx); err != nil {
+		gohalt.Log("cron job release error happened: %v", err)
+	}
+}
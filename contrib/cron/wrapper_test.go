@@ -0,0 +1,93 @@
+package gohaltcron
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/require"
+)
+
+type tretry struct {
+	calls int32
+	after time.Duration
+}
+
+func (thr *tretry) Acquire(context.Context) error {
+	if atomic.AddInt32(&thr.calls, 1) == 1 {
+		return gohalt.ErrorRetry{Throttler: "test", After: thr.after, Err: errors.New("test")}
+	}
+	return nil
+}
+
+func (thr *tretry) Release(context.Context) error {
+	return nil
+}
+
+func TestWrapper(t *testing.T) {
+	err := errors.New("test")
+	table := map[string]struct {
+		wrapper  cron.JobWrapper
+		runs     int
+		duration time.Duration
+	}{
+		"Cron skip wrapper should run jobs on throttler pass": {
+			wrapper: Skip(gohalt.NewThrottlerEcho(nil), "test"),
+			runs:    3,
+		},
+		"Cron skip wrapper should skip jobs on throttler error": {
+			wrapper: Skip(gohalt.NewThrottlerEcho(err), "test"),
+		},
+		"Cron skip wrapper should skip overlapping jobs": {
+			wrapper: Skip(gohalt.NewThrottlerRunning(1), "test"),
+			runs:    1,
+		},
+		"Cron skip wrapper should run jobs on unmatched key": {
+			wrapper: Skip(gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^other$"), Throttler: gohalt.NewThrottlerEcho(err)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			), "test"),
+			runs: 3,
+		},
+		"Cron delay wrapper should delay overlapping jobs": {
+			wrapper:  Delay(gohalt.NewThrottlerRunning(1), "test", time.Millisecond),
+			runs:     3,
+			duration: 30 * time.Millisecond,
+		},
+		"Cron delay wrapper should delay jobs for retry after duration": {
+			wrapper:  Delay(&tretry{after: 30 * time.Millisecond}, "test", time.Hour),
+			runs:     3,
+			duration: 30 * time.Millisecond,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			var lock sync.Mutex
+			var runs int
+			job := tcase.wrapper(cron.FuncJob(func() {
+				time.Sleep(10 * time.Millisecond)
+				lock.Lock()
+				defer lock.Unlock()
+				runs++
+			}))
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i := 0; i < 3; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					job.Run()
+				}()
+			}
+			wg.Wait()
+			require.Equal(t, tcase.runs, runs)
+			require.GreaterOrEqual(t, time.Since(start), tcase.duration)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Package gohaltdatadog provides datadog metrics integration for gohalt throttlers,
+// so datadog monitored services could throttle on the same metrics their dashboards show.
+package gohaltdatadog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+)
+
+// DefaultURL defines default datadog api url used if no url is provided.
+const DefaultURL = "https://api.datadoghq.com"
+
+// Query defines datadog metric query:
+// - URL defines datadog site api url, `DefaultURL` by default.
+// - APIKey and AppKey define datadog api and application keys.
+// - Query defines datadog metric query, e.g. `avg:trace.http.request.duration{service:db}`.
+// - Window defines queried time window ending now.
+// - Threshold defines metric value threshold.
+type Query struct {
+	URL       string
+	APIKey    string
+	AppKey    string
+	Query     string
+	Window    time.Duration
+	Threshold float64
+}
+
+type metric struct {
+	query    Query
+	client   *http.Client
+	cache    time.Duration
+	jitter   float64
+	lock     sync.Mutex
+	value    bool
+	deadline time.Time
+}
+
+// NewMetric creates datadog metric querier instance
+// that polls datadog query api with the provided query and caches the result
+// for the provided cache interval reduced by random jitter defined by the provided jitter factor normalized to [0.0, 1.0],
+// so the fleet of services doesn't refresh the metric simultaneously.
+// Metric is reached if the last point value of any queried series exceeds the query threshold.
+// Only successful metric results are cached.
+func NewMetric(query Query, cache time.Duration, jitter float64) gohalt.Metric {
+	if query.URL == "" {
+		query.URL = DefaultURL
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return &metric{query: query, client: http.DefaultClient, cache: cache, jitter: jitter}
+}
+
+func (mtc *metric) Query(ctx context.Context) (bool, error) {
+	mtc.lock.Lock()
+	defer mtc.lock.Unlock()
+	now := time.Now()
+	if now.Before(mtc.deadline) {
+		return mtc.value, nil
+	}
+	value, err := mtc.pull(ctx, now)
+	if err != nil {
+		return mtc.value, err
+	}
+	mtc.value = value
+	mtc.deadline = now.Add(time.Duration(float64(mtc.cache) * (1 - mtc.jitter*rand.Float64())))
+	return mtc.value, nil
+}
+
+type response struct {
+	Status string   `json:"status"`
+	Error  string   `json:"error"`
+	Errors []string `json:"errors"`
+	Series []struct {
+		Pointlist [][2]*float64 `json:"pointlist"`
+	} `json:"series"`
+}
+
+func (mtc *metric) pull(ctx context.Context, now time.Time) (bool, error) {
+	params := url.Values{}
+	params.Set("from", strconv.FormatInt(now.Add(-mtc.query.Window).Unix(), 10))
+	params.Set("to", strconv.FormatInt(now.Unix(), 10))
+	params.Set("query", mtc.query.Query)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mtc.query.URL+"/api/v1/query?"+params.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("DD-API-KEY", mtc.query.APIKey)
+	req.Header.Set("DD-APPLICATION-KEY", mtc.query.AppKey)
+	resp, err := mtc.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	var body response
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false, fmt.Errorf("datadog query response decode failed with %d status: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Status == "error" {
+		reasons := append([]string{body.Error}, body.Errors...)
+		return false, fmt.Errorf("datadog query failed with %d status: %s", resp.StatusCode, strings.Trim(strings.Join(reasons, "; "), "; "))
+	}
+	var found bool
+	for _, series := range body.Series {
+		for i := len(series.Pointlist) - 1; i >= 0; i-- {
+			if point := series.Pointlist[i][1]; point != nil {
+				if *point > mtc.query.Threshold {
+					return true, nil
+				}
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("datadog query %q returned no points", mtc.query.Query)
+	}
+	return false, nil
+}
@@ -0,0 +1,81 @@
+package gohaltdatadog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetric(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path != "/api/v1/query" || r.Header.Get("DD-API-KEY") != "api" || r.Header.Get("DD-APPLICATION-KEY") != "app" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["Forbidden"]}`))
+			return
+		}
+		switch r.URL.Query().Get("query") {
+		case "high":
+			_, _ = w.Write([]byte(`{"status":"ok","series":[{"pointlist":[[1,0.1],[2,0.2]]},{"pointlist":[[1,0.1],[2,0.9],[3,null]]}]}`))
+		case "low":
+			_, _ = w.Write([]byte(`{"status":"ok","series":[{"pointlist":[[1,0.9],[2,0.2]]}]}`))
+		case "empty":
+			_, _ = w.Write([]byte(`{"status":"ok","series":[]}`))
+		default:
+			_, _ = w.Write([]byte(`{"status":"error","error":"invalid query"}`))
+		}
+	}))
+	defer srv.Close()
+	table := map[string]struct {
+		query  Query
+		metric bool
+		err    string
+	}{
+		"Datadog metric should be reached if any series last point exceeds threshold": {
+			query:  Query{URL: srv.URL, APIKey: "api", AppKey: "app", Query: "high", Window: time.Minute, Threshold: 0.5},
+			metric: true,
+		},
+		"Datadog metric should not be reached if series last point is below threshold": {
+			query: Query{URL: srv.URL, APIKey: "api", AppKey: "app", Query: "low", Window: time.Minute, Threshold: 0.5},
+		},
+		"Datadog metric should fail on empty series": {
+			query: Query{URL: srv.URL, APIKey: "api", AppKey: "app", Query: "empty", Window: time.Minute},
+			err:   `datadog query "empty" returned no points`,
+		},
+		"Datadog metric should fail on query errors": {
+			query: Query{URL: srv.URL, APIKey: "api", AppKey: "app", Query: "invalid", Window: time.Minute},
+			err:   "datadog query failed with 200 status: invalid query",
+		},
+		"Datadog metric should fail on unauthorized requests": {
+			query: Query{URL: srv.URL, APIKey: "api", Query: "high", Window: time.Minute},
+			err:   "datadog query failed with 403 status: Forbidden",
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			metric, err := NewMetric(tcase.query, time.Minute, 0.5).Query(context.Background())
+			if tcase.err != "" {
+				require.EqualError(t, err, tcase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tcase.metric, metric)
+		})
+	}
+	t.Run("Datadog metric should cache successful results", func(t *testing.T) {
+		mtc := NewMetric(Query{URL: srv.URL, APIKey: "api", AppKey: "app", Query: "high", Window: time.Minute, Threshold: 0.5}, time.Hour, 0.1)
+		thr := gohalt.NewThrottlerMetric(mtc)
+		atomic.StoreInt32(&calls, 0)
+		for i := 0; i < 3; i++ {
+			require.Error(t, thr.Acquire(context.Background()))
+		}
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
@@ -0,0 +1,258 @@
+// Package gohaltdynamodb provides aws dynamodb integration for gohalt throttlers,
+// so serverless deployments could keep shared state of gohalt storage throttlers in dynamodb table.
+package gohaltdynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Client defines dynamodb client abstraction used by `NewStorage`, e.g. `*dynamodb.Client`.
+type Client interface {
+	GetItem(context.Context, *dynamodb.GetItemInput, ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(context.Context, *dynamodb.PutItemInput, ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(
+		context.Context,
+		*dynamodb.UpdateItemInput,
+		...func(*dynamodb.Options),
+	) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(
+		context.Context,
+		*dynamodb.DeleteItemInput,
+		...func(*dynamodb.Options),
+	) (*dynamodb.DeleteItemOutput, error)
+}
+
+type storage struct {
+	client Client
+	table  string
+}
+
+// NewStorage creates dynamodb storage instance
+// which keeps all keys in the specified dynamodb table reached by the provided client.
+// Table is expected to have string partition key `key`
+// and number `ttl` attribute configured as dynamodb TTL attribute with keys expiration unix timestamp.
+// All updates are done via dynamodb conditional writes, expired keys are ignored before they are deleted by dynamodb.
+// Use `gohalt.NewStorageRetried` to retry failed storage operations.
+func NewStorage(client Client, table string) gohalt.Storage {
+	return storage{client: client, table: table}
+}
+
+func (stg storage) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	out, err := stg.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(stg.table),
+		Key:            stg.key(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	val, ok := stg.value(out.Item)
+	return val, ok, nil
+}
+
+func (stg storage) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := stg.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(stg.table),
+		Item:      stg.item(key, value, ttl),
+	})
+	return err
+}
+
+func (stg storage) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	for {
+		update := "REMOVE #value ADD #count :delta"
+		values := map[string]types.AttributeValue{
+			":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(delta, 10)},
+			":now":   stg.now(),
+		}
+		// ttl is applied only on the key creation.
+		if ttl > 0 {
+			update = "SET #ttl = if_not_exists(#ttl, :ttl) " + update
+			values[":ttl"] = stg.ttl(ttl)
+		}
+		out, err := stg.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:        aws.String(stg.table),
+			Key:              stg.key(key),
+			UpdateExpression: aws.String(update),
+			ConditionExpression: aws.String(
+				"(attribute_not_exists(#value) OR attribute_exists(#count)) AND " +
+					"(attribute_not_exists(#ttl) OR #ttl > :now)",
+			),
+			ExpressionAttributeNames: map[string]string{
+				"#value": "value",
+				"#count": "count",
+				"#ttl":   "ttl",
+			},
+			ExpressionAttributeValues: values,
+			ReturnValues:              types.ReturnValueAllNew,
+		})
+		var cerr *types.ConditionalCheckFailedException
+		if errors.As(err, &cerr) {
+			// either non counter value or expired key is found,
+			// so try to replace expired key and retry the increment.
+			item, ok, err := stg.current(ctx, key)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				if _, ok := item["count"]; !ok {
+					return 0, fmt.Errorf("dynamodb key %q value is not a counter", key)
+				}
+			}
+			if err := stg.expire(ctx, key); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		count, _ := out.Attributes["count"].(*types.AttributeValueMemberN)
+		if count == nil {
+			return 0, fmt.Errorf("dynamodb key %q counter is missing", key)
+		}
+		return strconv.ParseInt(count.Value, 10, 64)
+	}
+}
+
+func (stg storage) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	old []byte,
+	new []byte,
+	ttl time.Duration,
+) (bool, error) {
+	names := map[string]string{"#key": "key", "#ttl": "ttl"}
+	values := map[string]types.AttributeValue{":now": stg.now()}
+	var cond string
+	if old == nil {
+		cond = "attribute_not_exists(#key) OR #ttl <= :now"
+	} else {
+		cond = "#value = :old AND (attribute_not_exists(#ttl) OR #ttl > :now)"
+		names["#value"] = "value"
+		values[":old"] = &types.AttributeValueMemberB{Value: old}
+		delete(names, "#key")
+	}
+	var err error
+	switch {
+	case old == nil && new == nil:
+		_, ok, err := stg.Get(ctx, key)
+		return !ok, err
+	case new == nil:
+		_, err = stg.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:                 aws.String(stg.table),
+			Key:                       stg.key(key),
+			ConditionExpression:       aws.String(cond),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+	default:
+		_, err = stg.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                 aws.String(stg.table),
+			Item:                      stg.item(key, new, ttl),
+			ConditionExpression:       aws.String(cond),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+	}
+	var cerr *types.ConditionalCheckFailedException
+	if errors.As(err, &cerr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (stg storage) Delete(ctx context.Context, key string) error {
+	_, err := stg.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(stg.table),
+		Key:       stg.key(key),
+	})
+	return err
+}
+
+// current returns the key item if it exists and is not expired yet.
+func (stg storage) current(ctx context.Context, key string) (map[string]types.AttributeValue, bool, error) {
+	out, err := stg.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(stg.table),
+		Key:            stg.key(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if _, ok := stg.value(out.Item); !ok {
+		return nil, false, nil
+	}
+	return out.Item, true, nil
+}
+
+// expire deletes the key only if it is already expired.
+func (stg storage) expire(ctx context.Context, key string) error {
+	_, err := stg.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                 aws.String(stg.table),
+		Key:                       stg.key(key),
+		ConditionExpression:       aws.String("#ttl <= :now"),
+		ExpressionAttributeNames:  map[string]string{"#ttl": "ttl"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{":now": stg.now()},
+	})
+	var cerr *types.ConditionalCheckFailedException
+	if errors.As(err, &cerr) {
+		return nil
+	}
+	return err
+}
+
+func (stg storage) key(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: key}}
+}
+
+func (stg storage) item(key string, value []byte, ttl time.Duration) map[string]types.AttributeValue {
+	item := stg.key(key)
+	item["value"] = &types.AttributeValueMemberB{Value: value}
+	if ttl > 0 {
+		item["ttl"] = stg.ttl(ttl)
+	}
+	return item
+}
+
+// value returns the item value or counter and whether the item exists and is not expired yet.
+func (stg storage) value(item map[string]types.AttributeValue) ([]byte, bool) {
+	if item == nil {
+		return nil, false
+	}
+	if ttl, ok := item["ttl"].(*types.AttributeValueMemberN); ok {
+		if deadline, err := strconv.ParseInt(ttl.Value, 10, 64); err == nil && deadline <= time.Now().UTC().Unix() {
+			return nil, false
+		}
+	}
+	if count, ok := item["count"].(*types.AttributeValueMemberN); ok {
+		return []byte(count.Value), true
+	}
+	if value, ok := item["value"].(*types.AttributeValueMemberB); ok {
+		return value.Value, true
+	}
+	return nil, true
+}
+
+func (stg storage) now() types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().UTC().Unix(), 10)}
+}
+
+// ttl returns expiration unix timestamp rounded up to the next second.
+func (stg storage) ttl(ttl time.Duration) types.AttributeValue {
+	deadline := time.Now().UTC().Add(ttl)
+	expiration := deadline.Unix()
+	if deadline.Nanosecond() > 0 {
+		expiration++
+	}
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(expiration, 10)}
+}
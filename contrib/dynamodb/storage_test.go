@@ -0,0 +1,260 @@
+package gohaltdynamodb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/require"
+)
+
+// tclient defines in memory dynamodb table fake
+// that evaluates conditional expressions used by the storage.
+type tclient struct {
+	lock  sync.Mutex
+	items map[string]map[string]types.AttributeValue
+	err   error
+}
+
+func (c *tclient) GetItem(
+	_ context.Context,
+	in *dynamodb.GetItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.GetItemOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &dynamodb.GetItemOutput{Item: c.items[c.key(in.Key)]}, nil
+}
+
+func (c *tclient) PutItem(
+	_ context.Context,
+	in *dynamodb.PutItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.PutItemOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	key := c.key(in.Item)
+	if err := c.check(c.items[key], in.ConditionExpression, in.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	c.items[key] = in.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (c *tclient) UpdateItem(
+	_ context.Context,
+	in *dynamodb.UpdateItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.UpdateItemOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	key := c.key(in.Key)
+	item := c.items[key]
+	if err := c.check(item, in.ConditionExpression, in.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	next := map[string]types.AttributeValue{"key": in.Key["key"]}
+	for name, value := range item {
+		next[name] = value
+	}
+	update := *in.UpdateExpression
+	if strings.HasPrefix(update, "SET #ttl = if_not_exists(#ttl, :ttl) ") {
+		update = strings.TrimPrefix(update, "SET #ttl = if_not_exists(#ttl, :ttl) ")
+		if _, ok := next["ttl"]; !ok {
+			next["ttl"] = in.ExpressionAttributeValues[":ttl"]
+		}
+	}
+	if update != "REMOVE #value ADD #count :delta" {
+		return nil, fmt.Errorf("unsupported update expression %q", *in.UpdateExpression)
+	}
+	count, _ := c.num(next, "count")
+	delta, _ := c.num(in.ExpressionAttributeValues, ":delta")
+	delete(next, "value")
+	next["count"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(count+delta, 10)}
+	c.items[key] = next
+	return &dynamodb.UpdateItemOutput{Attributes: next}, nil
+}
+
+func (c *tclient) DeleteItem(
+	_ context.Context,
+	in *dynamodb.DeleteItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.DeleteItemOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	key := c.key(in.Key)
+	if err := c.check(c.items[key], in.ConditionExpression, in.ExpressionAttributeValues); err != nil {
+		return nil, err
+	}
+	delete(c.items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (c *tclient) check(item map[string]types.AttributeValue, cond *string, values map[string]types.AttributeValue) error {
+	if cond == nil {
+		return nil
+	}
+	now, _ := c.num(values, ":now")
+	ttl, expiring := c.num(item, "ttl")
+	_, value := item["value"]
+	_, count := item["count"]
+	var ok bool
+	switch *cond {
+	case "(attribute_not_exists(#value) OR attribute_exists(#count)) AND (attribute_not_exists(#ttl) OR #ttl > :now)":
+		ok = (!value || count) && (!expiring || ttl > now)
+	case "attribute_not_exists(#key) OR #ttl <= :now":
+		ok = item == nil || (expiring && ttl <= now)
+	case "#value = :old AND (attribute_not_exists(#ttl) OR #ttl > :now)":
+		current, _ := item["value"].(*types.AttributeValueMemberB)
+		old, _ := values[":old"].(*types.AttributeValueMemberB)
+		ok = current != nil && bytes.Equal(current.Value, old.Value) && (!expiring || ttl > now)
+	case "#ttl <= :now":
+		ok = expiring && ttl <= now
+	default:
+		return fmt.Errorf("unsupported condition expression %q", *cond)
+	}
+	if !ok {
+		return &types.ConditionalCheckFailedException{}
+	}
+	return nil
+}
+
+func (c *tclient) num(item map[string]types.AttributeValue, name string) (int64, bool) {
+	attr, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, false
+	}
+	val, err := strconv.ParseInt(attr.Value, 10, 64)
+	return val, err == nil
+}
+
+func (c *tclient) key(item map[string]types.AttributeValue) string {
+	return item["key"].(*types.AttributeValueMemberS).Value
+}
+
+func (c *tclient) ttl(key string) (int64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.num(c.items[key], "ttl")
+}
+
+// expire moves the key deadline into the past before dynamodb deletes it.
+func (c *tclient) expire(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	deadline := strconv.FormatInt(time.Now().Unix()-1, 10)
+	c.items[key]["ttl"] = &types.AttributeValueMemberN{Value: deadline}
+}
+
+func TestStorage(t *testing.T) {
+	client := &tclient{items: make(map[string]map[string]types.AttributeValue)}
+	stg := NewStorage(client, "gohalt")
+	ctx := context.TODO()
+	t.Run("DynamoDB storage should get set and delete keys", func(t *testing.T) {
+		_, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, stg.Set(ctx, "key", []byte("val"), 0))
+		val, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("val"), val)
+		require.NoError(t, stg.Delete(ctx, "key"))
+		_, ok, _ = stg.Get(ctx, "key")
+		require.False(t, ok)
+	})
+	t.Run("DynamoDB storage should increment counters with conditional updates", func(t *testing.T) {
+		cnt, err := stg.Incr(ctx, "cnt", 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cnt)
+		cnt, err = stg.Incr(ctx, "cnt", -3, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(-1), cnt)
+		val, ok, _ := stg.Get(ctx, "cnt")
+		require.True(t, ok)
+		require.Equal(t, []byte("-1"), val)
+		require.NoError(t, stg.Set(ctx, "cnt", []byte("nan"), 0))
+		_, err = stg.Incr(ctx, "cnt", 1, 0)
+		require.EqualError(t, err, `dynamodb key "cnt" value is not a counter`)
+	})
+	t.Run("DynamoDB storage should compare and swap keys with conditional writes", func(t *testing.T) {
+		swapped, err := stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.NoError(t, err)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, nil, 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("old"), 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.True(t, swapped)
+		val, _, _ := stg.Get(ctx, "cas")
+		require.Equal(t, []byte("new"), val)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), nil, 0)
+		require.True(t, swapped)
+		_, ok, _ := stg.Get(ctx, "cas")
+		require.False(t, ok)
+	})
+	t.Run("DynamoDB storage should expire keys with ttl attribute", func(t *testing.T) {
+		require.NoError(t, stg.Set(ctx, "ttl", []byte("val"), time.Millisecond))
+		deadline, ok := client.ttl("ttl")
+		require.True(t, ok)
+		require.InDelta(t, time.Now().Unix()+1, deadline, 1)
+		_, _ = stg.Incr(ctx, "ttlcnt", 1, time.Minute)
+		created, _ := client.ttl("ttlcnt")
+		cnt, _ := stg.Incr(ctx, "ttlcnt", 1, time.Hour)
+		require.Equal(t, int64(2), cnt)
+		updated, _ := client.ttl("ttlcnt")
+		require.Equal(t, created, updated)
+		swapped, _ := stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("val"), time.Minute)
+		require.True(t, swapped)
+		for _, key := range []string{"ttl", "ttlcnt", "ttlcas"} {
+			client.expire(key)
+		}
+		_, ok, _ = stg.Get(ctx, "ttl")
+		require.False(t, ok)
+		swapped, _ = stg.CompareAndSwap(ctx, "ttlcas", []byte("val"), nil, 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("new"), 0)
+		require.True(t, swapped)
+		cnt, _ = stg.Incr(ctx, "ttlcnt", 1, 0)
+		require.Equal(t, int64(1), cnt)
+		_, ok = client.ttl("ttlcnt")
+		require.False(t, ok)
+	})
+	t.Run("DynamoDB storage should fail on client errors", func(t *testing.T) {
+		stg := gohalt.NewStorageRetried(NewStorage(&tclient{err: errors.New("test")}, "gohalt"), 1)
+		_, _, err := stg.Get(ctx, "key")
+		require.Error(t, err)
+		require.Error(t, stg.Set(ctx, "key", nil, 0))
+		_, err = stg.Incr(ctx, "key", 1, 0)
+		require.Error(t, err)
+		_, err = stg.CompareAndSwap(ctx, "key", nil, nil, 0)
+		require.Error(t, err)
+		require.Error(t, stg.Delete(ctx, "key"))
+	})
+}
@@ -0,0 +1,106 @@
+// Package gohaltecho provides echo framework integration for gohalt throttlers,
+// so echo servers could throttle requests per route with echo error handling.
+package gohaltecho
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/labstack/echo/v4"
+)
+
+// Key defines echo context throttling key extractor,
+// resulted key is stamped to request context with `gohalt.WithKey`.
+type Key func(echo.Context) string
+
+// KeyRealIP extracts request client ip as throttling key, see `echo.Context.RealIP`.
+func KeyRealIP() Key {
+	return func(c echo.Context) string {
+		return c.RealIP()
+	}
+}
+
+// KeyHeader extracts the specified request header value as throttling key.
+func KeyHeader(name string) Key {
+	return func(c echo.Context) string {
+		return c.Request().Header.Get(name)
+	}
+}
+
+// KeyParam extracts the specified route param value as throttling key.
+func KeyParam(name string) Key {
+	return func(c echo.Context) string {
+		return c.Param(name)
+	}
+}
+
+// KeyRoute extracts matched route path as throttling key, see `echo.Context.Path`,
+// so `pattern` and `router` throttlers could select throttler per route.
+func KeyRoute() Key {
+	return func(c echo.Context) string {
+		return c.Path()
+	}
+}
+
+// KeyRouteName extracts matched route name as throttling key, see `echo.Route.Name`,
+// so `pattern` and `router` throttlers could select throttler per named route.
+func KeyRouteName() Key {
+	return func(c echo.Context) string {
+		method, path := c.Request().Method, c.Path()
+		for _, route := range c.Echo().Routes() {
+			if route.Method == method && route.Path == path {
+				return route.Name
+			}
+		}
+		return ""
+	}
+}
+
+// NewMiddleware creates echo middleware instance
+// that acquires the provided throttler before each next handler call and releases it after the call.
+// Middleware could be attached either to the whole server, to route group or to single route,
+// so each route could be throttled by own throttler.
+// Request context is stamped with `gohalt.WithKey` set to the provided key extractor result if any,
+// and with `gohalt.WithTimestamp` on arrival, so `latency` and `percentile` throttlers observe the handler latency.
+// Throttled requests are passed to the provided abort handler and its result is returned to echo error handler,
+// if no abort handler is provided then `Abort` is used.
+// Release errors are only logged.
+func NewMiddleware(thr gohalt.Throttler, key Key, abort func(echo.Context, error) error) echo.MiddlewareFunc {
+	if abort == nil {
+		abort = Abort
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := gohalt.WithTimestamp(req.Context(), time.Now().UTC())
+			if key != nil {
+				ctx = gohalt.WithKey(ctx, key(c))
+			}
+			c.SetRequest(req.WithContext(ctx))
+			defer func() {
+				if err := thr.Release(ctx); err != nil {
+					gohalt.Log("echo middleware release error happened: %v", err)
+				}
+			}()
+			if err := thr.Acquire(ctx); err != nil {
+				return abort(c, err)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Abort sets `Retry-After` header from `gohalt.ErrorRetry` retry after duration if any
+// and returns `429 Too Many Requests` echo http error with the provided throttling error as internal error,
+// so the error is rendered by echo error handler.
+func Abort(c echo.Context, err error) error {
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		c.Response().Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(rerr.After.Seconds())), 10))
+	}
+	return echo.NewHTTPError(http.StatusTooManyRequests).SetInternal(err)
+}
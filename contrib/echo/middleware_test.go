@@ -0,0 +1,113 @@
+package gohaltecho
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	table := map[string]struct {
+		thr    gohalt.Throttler
+		key    Key
+		abort  func(echo.Context, error) error
+		req    *http.Request
+		code   int
+		header http.Header
+	}{
+		"Echo middleware should pass not throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusOK,
+		},
+		"Echo middleware should abort throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(errors.New("test")),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+		"Echo middleware should abort throttled requests with retry after": {
+			thr:    gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond}),
+			req:    httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code:   http.StatusTooManyRequests,
+			header: http.Header{"Retry-After": []string{"2"}},
+		},
+		"Echo middleware should pass custom abort handler errors to error handler": {
+			thr: gohalt.NewThrottlerEcho(errors.New("test")),
+			abort: func(c echo.Context, err error) error {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+			},
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusServiceUnavailable,
+		},
+		"Echo middleware should select throttler per route": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^/users/:id$`), Throttler: gohalt.NewThrottlerEcho(nil)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+			),
+			key:  KeyRoute(),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusOK,
+		},
+		"Echo middleware should select throttler per route name": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^user$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key:  KeyRouteName(),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+		"Echo middleware should extract throttling key from params": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^1$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key:  KeyParam("id"),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+		"Echo middleware should extract throttling key from headers": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^test$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key: KeyHeader("X-Tenant"),
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+				req.Header.Set("X-Tenant", "test")
+				return req
+			}(),
+			code: http.StatusTooManyRequests,
+		},
+		"Echo middleware should extract throttling key from client ip": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^192\.0\.2\.1$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key:  KeyRealIP(),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/users/:id", func(c echo.Context) error {
+				return c.String(http.StatusOK, "ok")
+			}, NewMiddleware(tcase.thr, tcase.key, tcase.abort)).Name = "user"
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, tcase.req)
+			require.Equal(t, tcase.code, w.Code)
+			for name := range tcase.header {
+				require.Equal(t, tcase.header.Get(name), w.Header().Get(name))
+			}
+		})
+	}
+}
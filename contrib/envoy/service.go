@@ -0,0 +1,64 @@
+package gohaltenvoy
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/1pkg/gohalt"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type svcrls struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+	thr gohalt.Throttler
+}
+
+// NewServiceRLS creates envoy rate limit service v3 gRPC service instance
+// that serves rate limit decisions from the provided throttler, see `NewThrottlerRLS`,
+// so it could be used as drop in envoy rate limit service.
+// Each request descriptor is acquired separately from the provided throttler
+// with request hits addend provided via `gohalt.WithWeight`
+// and descriptor key provided via `gohalt.WithKey`, descriptor key is defined as `{{domain}}:{{key}}={{value}}:...`.
+// Acquired descriptors are never released back to the throttler, so counting throttlers should not be used.
+// Throttler `gohalt.ErrorRetry` is propagated as descriptor duration until reset,
+// throttler `gohalt.ErrorInternal` is returned as gRPC internal error.
+func NewServiceRLS(thr gohalt.Throttler) rlsv3.RateLimitServiceServer {
+	return &svcrls{thr: thr}
+}
+
+func (svc *svcrls) ShouldRateLimit(
+	ctx context.Context,
+	req *rlsv3.RateLimitRequest,
+) (*rlsv3.RateLimitResponse, error) {
+	hits := int64(req.GetHitsAddend())
+	if hits == 0 {
+		hits = 1
+	}
+	ctx = gohalt.WithWeight(ctx, hits)
+	resp := &rlsv3.RateLimitResponse{OverallCode: rlsv3.RateLimitResponse_OK}
+	for _, descriptor := range req.GetDescriptors() {
+		key := []string{req.GetDomain()}
+		for _, entry := range descriptor.GetEntries() {
+			key = append(key, entry.GetKey()+"="+entry.GetValue())
+		}
+		stat := &rlsv3.RateLimitResponse_DescriptorStatus{Code: rlsv3.RateLimitResponse_OK}
+		if err := svc.thr.Acquire(gohalt.WithKey(ctx, strings.Join(key, ":"))); err != nil {
+			var ierr gohalt.ErrorInternal
+			if errors.As(err, &ierr) {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			var rerr gohalt.ErrorRetry
+			if errors.As(err, &rerr) {
+				stat.DurationUntilReset = durationpb.New(rerr.After)
+			}
+			stat.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+			resp.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		resp.Statuses = append(resp.Statuses, stat)
+	}
+	return resp, nil
+}
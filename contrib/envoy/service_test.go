@@ -0,0 +1,103 @@
+package gohaltenvoy
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	rlscommonv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServiceRLS(t *testing.T) {
+	testErr := errors.New("test")
+	descriptor := func(entries ...string) *rlscommonv3.RateLimitDescriptor {
+		var descriptor rlscommonv3.RateLimitDescriptor
+		for i := 0; i < len(entries); i += 2 {
+			descriptor.Entries = append(descriptor.Entries, &rlscommonv3.RateLimitDescriptor_Entry{
+				Key:   entries[i],
+				Value: entries[i+1],
+			})
+		}
+		return &descriptor
+	}
+	table := map[string]struct {
+		thr   gohalt.Throttler
+		req   *rlsv3.RateLimitRequest
+		code  rlsv3.RateLimitResponse_Code
+		codes []rlsv3.RateLimitResponse_Code
+		after time.Duration
+		err   codes.Code
+	}{
+		"RLS service should allow all descriptors": {
+			thr: gohalt.NewThrottlerAfter(2),
+			req: &rlsv3.RateLimitRequest{
+				Domain:      "test",
+				Descriptors: []*rlscommonv3.RateLimitDescriptor{descriptor("a", "1"), descriptor("b", "2")},
+			},
+			code:  rlsv3.RateLimitResponse_OK,
+			codes: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OK, rlsv3.RateLimitResponse_OK},
+		},
+		"RLS service should throttle descriptors by keys": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^test:a=1:b=2$"), Throttler: gohalt.NewThrottlerEcho(nil)},
+				gohalt.Pattern{Pattern: regexp.MustCompile("^test:a=1$"), Throttler: gohalt.NewThrottlerEcho(testErr)},
+			),
+			req: &rlsv3.RateLimitRequest{
+				Domain:      "test",
+				Descriptors: []*rlscommonv3.RateLimitDescriptor{descriptor("a", "1"), descriptor("a", "1", "b", "2")},
+			},
+			code:  rlsv3.RateLimitResponse_OVER_LIMIT,
+			codes: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OVER_LIMIT, rlsv3.RateLimitResponse_OK},
+		},
+		"RLS service should use hits addend as weight": {
+			thr: gohalt.NewThrottlerAfter(2),
+			req: &rlsv3.RateLimitRequest{
+				Domain:      "test",
+				Descriptors: []*rlscommonv3.RateLimitDescriptor{descriptor("a", "1")},
+				HitsAddend:  3,
+			},
+			code:  rlsv3.RateLimitResponse_OVER_LIMIT,
+			codes: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OVER_LIMIT},
+		},
+		"RLS service should propagate retry after duration": {
+			thr: gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Second}),
+			req: &rlsv3.RateLimitRequest{
+				Domain:      "test",
+				Descriptors: []*rlscommonv3.RateLimitDescriptor{descriptor("a", "1")},
+			},
+			code:  rlsv3.RateLimitResponse_OVER_LIMIT,
+			codes: []rlsv3.RateLimitResponse_Code{rlsv3.RateLimitResponse_OVER_LIMIT},
+			after: time.Second,
+		},
+		"RLS service should return internal error": {
+			thr: gohalt.NewThrottlerEcho(gohalt.ErrorInternal{Throttler: "test", Message: "test"}),
+			req: &rlsv3.RateLimitRequest{
+				Domain:      "test",
+				Descriptors: []*rlscommonv3.RateLimitDescriptor{descriptor("a", "1")},
+			},
+			err: codes.Internal,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			resp, err := NewServiceRLS(tcase.thr).ShouldRateLimit(context.TODO(), tcase.req)
+			require.Equal(t, tcase.err, status.Code(err))
+			require.Equal(t, tcase.code, resp.GetOverallCode())
+			var codes []rlsv3.RateLimitResponse_Code
+			for _, stat := range resp.GetStatuses() {
+				codes = append(codes, stat.GetCode())
+			}
+			require.Equal(t, tcase.codes, codes)
+			if tcase.after > 0 {
+				require.Equal(t, tcase.after, resp.GetStatuses()[0].GetDurationUntilReset().AsDuration())
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// Package gohaltenvoy provides envoy rate limit service v3 integration for gohalt throttlers,
+// so gohalt throttlers could either consume or serve envoy rate limit decisions.
+package gohaltenvoy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/1pkg/gohalt"
+	rlscommonv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+)
+
+type strbool bool
+
+func (b strbool) String() string {
+	return fmt.Sprintf("%t", bool(b))
+}
+
+type strpair struct {
+	current   uint64
+	threshold uint64
+}
+
+func (p strpair) String() string {
+	return fmt.Sprintf("%d out of %d", p.current, p.threshold)
+}
+
+type trls struct {
+	client      rlsv3.RateLimitServiceClient
+	domain      string
+	descriptors func(context.Context) []*rlscommonv3.RateLimitDescriptor
+}
+
+// NewThrottlerRLS creates new throttler instance that
+// throttles each call which external envoy rate limit service v3 defined by the provided gRPC client
+// decides to be over limit in the specified domain, see `NewServiceRLS`.
+// Request descriptors are built by the provided descriptors function,
+// if no function is provided then single `key` descriptor entry is built from `gohalt.WithKey` key.
+// Over limit decision duration until reset is returned as `gohalt.ErrorRetry` retry after duration.
+// Use `gohalt.WithWeight` to override context call qunatity sent as hits addend, 1 by default.
+// - could return `gohalt.ErrorThreshold`;
+// - could return `gohalt.ErrorRetry`;
+// - could return `gohalt.ErrorInternal`;
+func NewThrottlerRLS(
+	client rlsv3.RateLimitServiceClient,
+	domain string,
+	descriptors func(context.Context) []*rlscommonv3.RateLimitDescriptor,
+) gohalt.Throttler {
+	if descriptors == nil {
+		descriptors = func(ctx context.Context) []*rlscommonv3.RateLimitDescriptor {
+			return []*rlscommonv3.RateLimitDescriptor{{
+				Entries: []*rlscommonv3.RateLimitDescriptor_Entry{{Key: "key", Value: gohalt.Key(ctx)}},
+			}}
+		}
+	}
+	return trls{client: client, domain: domain, descriptors: descriptors}
+}
+
+func (thr trls) Acquire(ctx context.Context) error {
+	weight := gohalt.Weight(ctx)
+	resp, err := thr.client.ShouldRateLimit(ctx, &rlsv3.RateLimitRequest{
+		Domain:      thr.domain,
+		Descriptors: thr.descriptors(ctx),
+		HitsAddend:  uint32(weight),
+	})
+	if err != nil {
+		return gohalt.ErrorInternal{
+			Throttler: "rls",
+			Message:   err.Error(),
+		}
+	}
+	if resp.GetOverallCode() != rlsv3.RateLimitResponse_OVER_LIMIT {
+		return nil
+	}
+	for _, stat := range resp.GetStatuses() {
+		if stat.GetCode() != rlsv3.RateLimitResponse_OVER_LIMIT {
+			continue
+		}
+		var threshold fmt.Stringer = strbool(false)
+		if limit := stat.GetCurrentLimit(); limit != nil {
+			rpu, remaining := uint64(limit.GetRequestsPerUnit()), uint64(stat.GetLimitRemaining())
+			threshold = strpair{current: rpu - min(rpu, remaining) + uint64(weight), threshold: rpu}
+		}
+		err := gohalt.ErrorThreshold{Throttler: "rls", Threshold: threshold}
+		if after := stat.GetDurationUntilReset().AsDuration(); after > 0 {
+			return gohalt.ErrorRetry{
+				Throttler: "rls",
+				After:     after,
+				Err:       err,
+			}
+		}
+		return err
+	}
+	return gohalt.ErrorThreshold{Throttler: "rls", Threshold: strbool(false)}
+}
+
+func (thr trls) Release(context.Context) error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package gohaltenvoy
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestThrottlerRLS(t *testing.T) {
+	srv := grpc.NewServer()
+	rlsv3.RegisterRateLimitServiceServer(srv, NewServiceRLS(gohalt.NewThrottlerAfter(2)))
+	thr := NewThrottlerRLS(rlsv3.NewRateLimitServiceClient(testGRPC(t, srv)), "test", nil)
+	ctx := gohalt.WithKey(context.TODO(), "key")
+	require.NoError(t, thr.Acquire(ctx))
+	// non positive weights are sent as single hit
+	require.NoError(t, thr.Acquire(gohalt.WithWeight(ctx, -1)))
+	require.Equal(t, gohalt.ErrorThreshold{Throttler: "rls", Threshold: strbool(false)}, thr.Acquire(ctx))
+	require.NoError(t, thr.Release(ctx))
+	srv.Stop()
+	require.Equal(t, "rls", thr.Acquire(ctx).(gohalt.ErrorInternal).Throttler)
+}
+
+func TestThrottlerRLSLimit(t *testing.T) {
+	thr := NewThrottlerRLS(rlsmock{resp: &rlsv3.RateLimitResponse{
+		OverallCode: rlsv3.RateLimitResponse_OVER_LIMIT,
+		Statuses: []*rlsv3.RateLimitResponse_DescriptorStatus{
+			{Code: rlsv3.RateLimitResponse_OK},
+			{
+				Code:               rlsv3.RateLimitResponse_OVER_LIMIT,
+				CurrentLimit:       &rlsv3.RateLimitResponse_RateLimit{RequestsPerUnit: 10},
+				DurationUntilReset: durationpb.New(time.Second),
+			},
+		},
+	}}, "test", nil)
+	require.Equal(t, gohalt.ErrorRetry{
+		Throttler: "rls",
+		After:     time.Second,
+		Err: gohalt.ErrorThreshold{
+			Throttler: "rls",
+			Threshold: strpair{current: 12, threshold: 10},
+		},
+	}, thr.Acquire(gohalt.WithWeight(context.TODO(), 2)))
+}
+
+type rlsmock struct {
+	rlsv3.RateLimitServiceClient
+	resp *rlsv3.RateLimitResponse
+}
+
+func (rls rlsmock) ShouldRateLimit(
+	context.Context,
+	*rlsv3.RateLimitRequest,
+	...grpc.CallOption,
+) (*rlsv3.RateLimitResponse, error) {
+	return rls.resp, nil
+}
+
+func testGRPC(t *testing.T, srv *grpc.Server) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
@@ -0,0 +1,121 @@
+// Package gohaltfasthttp provides fasthttp integration for gohalt throttlers,
+// so fasthttp servers could throttle requests without net/http request conversions.
+package gohaltfasthttp
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/valyala/fasthttp"
+)
+
+// Key defines fasthttp request throttling key extractor,
+// resulted key bytes could reference request buffers as they are interned before use,
+// so key extraction itself doesn't need to allocate.
+type Key func(*fasthttp.RequestCtx) []byte
+
+// KeyPath extracts request path as throttling key.
+func KeyPath() Key {
+	return func(ctx *fasthttp.RequestCtx) []byte {
+		return ctx.Path()
+	}
+}
+
+// KeyHost extracts request host as throttling key.
+func KeyHost() Key {
+	return func(ctx *fasthttp.RequestCtx) []byte {
+		return ctx.Host()
+	}
+}
+
+// KeyHeader extracts the specified request header value as throttling key.
+func KeyHeader(name string) Key {
+	return func(ctx *fasthttp.RequestCtx) []byte {
+		return ctx.Request.Header.Peek(name)
+	}
+}
+
+// KeyRemoteIP extracts request remote ip as throttling key,
+// unlike other builtin key extractors it allocates on each call.
+func KeyRemoteIP() Key {
+	return func(ctx *fasthttp.RequestCtx) []byte {
+		return []byte(ctx.RemoteIP().String())
+	}
+}
+
+// interner defines bounded strings interning table,
+// that allows to convert repeated keys to strings without allocations.
+type interner struct {
+	lock sync.RWMutex
+	size int
+	strs map[string]string
+}
+
+func (in *interner) intern(b []byte) string {
+	in.lock.RLock()
+	// map lookup by converted bytes doesn't allocate.
+	str, ok := in.strs[string(b)]
+	in.lock.RUnlock()
+	if ok {
+		return str
+	}
+	str = string(b)
+	in.lock.Lock()
+	if len(in.strs) < in.size {
+		in.strs[str] = str
+	}
+	in.lock.Unlock()
+	return str
+}
+
+// NewHandler creates fasthttp request handler instance
+// that acquires the provided throttler before each wrapped handler call and releases it after the call.
+// Request context is stamped with `gohalt.WithKey` set to the provided key extractor result if any,
+// and with `gohalt.WithTimestamp` on arrival, so `latency` and `percentile` throttlers observe the handler latency.
+// Extracted keys are interned in table bounded by the specified size,
+// so repeated keys are converted to strings without allocations.
+// Throttled requests are passed to the provided deny handler,
+// if no deny handler is provided then `Deny` is used.
+// Release errors are only logged.
+func NewHandler(
+	handler fasthttp.RequestHandler,
+	thr gohalt.Throttler,
+	key Key,
+	size int,
+	deny func(*fasthttp.RequestCtx, error),
+) fasthttp.RequestHandler {
+	if deny == nil {
+		deny = Deny
+	}
+	in := &interner{size: size, strs: make(map[string]string, size)}
+	return func(rctx *fasthttp.RequestCtx) {
+		ctx := gohalt.WithTimestamp(rctx, time.Now().UTC())
+		if key != nil {
+			ctx = gohalt.WithKey(ctx, in.intern(key(rctx)))
+		}
+		defer func() {
+			if err := thr.Release(ctx); err != nil {
+				gohalt.Log("fasthttp handler release error happened: %v", err)
+			}
+		}()
+		if err := thr.Acquire(ctx); err != nil {
+			deny(rctx, err)
+			return
+		}
+		handler(rctx)
+	}
+}
+
+// Deny responds with `429 Too Many Requests` and the provided throttling error message
+// with `Retry-After` header set from `gohalt.ErrorRetry` retry after duration if any.
+func Deny(rctx *fasthttp.RequestCtx, err error) {
+	rctx.Error(err.Error(), fasthttp.StatusTooManyRequests)
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		rctx.Response.Header.Set(fasthttp.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(rerr.After.Seconds())), 10))
+	}
+}
@@ -0,0 +1,93 @@
+package gohaltfasthttp
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+)
+
+func TestHandler(t *testing.T) {
+	routes := func(pattern string, thr gohalt.Throttler) gohalt.Throttler {
+		return gohalt.NewThrottlerPattern(
+			gohalt.Pattern{Pattern: regexp.MustCompile(pattern), Throttler: thr},
+			gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+		)
+	}
+	table := map[string]struct {
+		thr   gohalt.Throttler
+		key   Key
+		deny  func(*fasthttp.RequestCtx, error)
+		code  int
+		retry string
+	}{
+		"Fasthttp handler should pass not throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			code: fasthttp.StatusOK,
+		},
+		"Fasthttp handler should deny throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(errors.New("test")),
+			code: fasthttp.StatusTooManyRequests,
+		},
+		"Fasthttp handler should deny throttled requests with retry after": {
+			thr:   gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond}),
+			code:  fasthttp.StatusTooManyRequests,
+			retry: "2",
+		},
+		"Fasthttp handler should use custom deny handler": {
+			thr: gohalt.NewThrottlerEcho(errors.New("test")),
+			deny: func(rctx *fasthttp.RequestCtx, err error) {
+				rctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+			},
+			code: fasthttp.StatusServiceUnavailable,
+		},
+		"Fasthttp handler should throttle by path": {
+			thr:  routes(`^/users/1$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			key:  KeyPath(),
+			code: fasthttp.StatusTooManyRequests,
+		},
+		"Fasthttp handler should throttle by host": {
+			thr:  routes(`^example\.com$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			key:  KeyHost(),
+			code: fasthttp.StatusTooManyRequests,
+		},
+		"Fasthttp handler should throttle by header": {
+			thr:  routes(`^test$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			key:  KeyHeader("X-Tenant"),
+			code: fasthttp.StatusTooManyRequests,
+		},
+		"Fasthttp handler should throttle by remote ip": {
+			thr:  routes(`^0\.0\.0\.0$`, gohalt.NewThrottlerEcho(errors.New("test"))),
+			key:  KeyRemoteIP(),
+			code: fasthttp.StatusTooManyRequests,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			handler := NewHandler(func(rctx *fasthttp.RequestCtx) {
+				rctx.SetBodyString("ok")
+			}, tcase.thr, tcase.key, 16, tcase.deny)
+			var rctx fasthttp.RequestCtx
+			rctx.Request.SetRequestURI("http://example.com/users/1")
+			rctx.Request.Header.Set("X-Tenant", "test")
+			handler(&rctx)
+			require.Equal(t, tcase.code, rctx.Response.StatusCode())
+			require.Equal(t, tcase.retry, string(rctx.Response.Header.Peek(fasthttp.HeaderRetryAfter)))
+		})
+	}
+}
+
+func TestInterner(t *testing.T) {
+	in := &interner{size: 1, strs: make(map[string]string, 1)}
+	first, second := []byte("first"), []byte("second")
+	require.Equal(t, "first", in.intern(first))
+	require.Equal(t, "second", in.intern(second))
+	require.Len(t, in.strs, 1)
+	require.Zero(t, testing.AllocsPerRun(100, func() {
+		_ = in.intern(first)
+	}))
+}
@@ -0,0 +1,101 @@
+// Package gohaltfiber provides fiber framework integration for gohalt throttlers,
+// so fiber apps could throttle requests per route despite fiber not using `context.Context` natively.
+package gohaltfiber
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Key defines fiber context throttling key extractor,
+// resulted key is stamped to request user context with `gohalt.WithKey`.
+// As fiber context values are only valid inside handler,
+// resulted key is copied before it is passed to throttler.
+type Key func(*fiber.Ctx) string
+
+// KeyIP extracts request client ip as throttling key, see `fiber.Ctx.IP`.
+func KeyIP() Key {
+	return func(c *fiber.Ctx) string {
+		return c.IP()
+	}
+}
+
+// KeyHeader extracts the specified request header value as throttling key.
+func KeyHeader(name string) Key {
+	return func(c *fiber.Ctx) string {
+		return c.Get(name)
+	}
+}
+
+// KeyParam extracts the specified route param value as throttling key.
+func KeyParam(name string) Key {
+	return func(c *fiber.Ctx) string {
+		return c.Params(name)
+	}
+}
+
+// KeyRoute extracts matched route path as throttling key, see `fiber.Ctx.Route`,
+// so `pattern` and `router` throttlers could select throttler per route.
+func KeyRoute() Key {
+	return func(c *fiber.Ctx) string {
+		return c.Route().Path
+	}
+}
+
+// NewMiddleware creates fiber middleware instance
+// that acquires the provided throttler before each next handler call and releases it after the call.
+// Middleware could be attached either to the whole app, to route group or to single route,
+// so each route could be throttled by own throttler.
+// As fiber does not use `context.Context` natively, throttling context is derived from
+// request user context, see `fiber.Ctx.UserContext`, and is stored back as request user context,
+// so next handlers could use it with `Context`.
+// Request user context is stamped with `gohalt.WithKey` set to the provided key extractor result if any,
+// and with `gohalt.WithTimestamp` on arrival, so `latency` and `percentile` throttlers observe the handler latency.
+// Throttled requests are passed to the provided abort handler and its result is returned to fiber error handler,
+// if no abort handler is provided then `Abort` is used.
+// Release errors are only logged.
+func NewMiddleware(thr gohalt.Throttler, key Key, abort func(*fiber.Ctx, error) error) fiber.Handler {
+	if abort == nil {
+		abort = Abort
+	}
+	return func(c *fiber.Ctx) error {
+		ctx := gohalt.WithTimestamp(c.UserContext(), time.Now().UTC())
+		if key != nil {
+			ctx = gohalt.WithKey(ctx, strings.Clone(key(c)))
+		}
+		c.SetUserContext(ctx)
+		defer func() {
+			if err := thr.Release(ctx); err != nil {
+				gohalt.Log("fiber middleware release error happened: %v", err)
+			}
+		}()
+		if err := thr.Acquire(ctx); err != nil {
+			return abort(c, err)
+		}
+		return c.Next()
+	}
+}
+
+// Context returns fiber request throttling context stamped by middleware,
+// see `NewMiddleware`.
+func Context(c *fiber.Ctx) context.Context {
+	return c.UserContext()
+}
+
+// Abort sets `Retry-After` header from `gohalt.ErrorRetry` retry after duration if any
+// and returns `429 Too Many Requests` fiber error with the provided throttling error message,
+// so the error is rendered by fiber error handler.
+func Abort(c *fiber.Ctx, err error) error {
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(rerr.After.Seconds())), 10))
+	}
+	return fiber.NewError(fiber.StatusTooManyRequests, err.Error())
+}
@@ -0,0 +1,104 @@
+package gohaltfiber
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	table := map[string]struct {
+		thr    gohalt.Throttler
+		key    Key
+		abort  func(*fiber.Ctx, error) error
+		req    *http.Request
+		code   int
+		header http.Header
+	}{
+		"Fiber middleware should pass not throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusOK,
+		},
+		"Fiber middleware should abort throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(errors.New("test")),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+		"Fiber middleware should abort throttled requests with retry after": {
+			thr:    gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond}),
+			req:    httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code:   http.StatusTooManyRequests,
+			header: http.Header{"Retry-After": []string{"2"}},
+		},
+		"Fiber middleware should pass custom abort handler errors to error handler": {
+			thr: gohalt.NewThrottlerEcho(errors.New("test")),
+			abort: func(c *fiber.Ctx, err error) error {
+				return fiber.NewError(fiber.StatusServiceUnavailable, err.Error())
+			},
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusServiceUnavailable,
+		},
+		"Fiber middleware should select throttler per route": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^/users/:id$`), Throttler: gohalt.NewThrottlerEcho(nil)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+			),
+			key:  KeyRoute(),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusOK,
+		},
+		"Fiber middleware should extract throttling key from params": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^1$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key:  KeyParam("id"),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+		"Fiber middleware should extract throttling key from headers": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^test$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key: KeyHeader("X-Tenant"),
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+				req.Header.Set("X-Tenant", "test")
+				return req
+			}(),
+			code: http.StatusTooManyRequests,
+		},
+		"Fiber middleware should extract throttling key from client ip": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^0\.0\.0\.0$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key:  KeyIP(),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/users/:id", NewMiddleware(tcase.thr, tcase.key, tcase.abort), func(c *fiber.Ctx) error {
+				return c.SendString("ok")
+			})
+			resp, err := app.Test(tcase.req)
+			require.NoError(t, err)
+			require.Equal(t, tcase.code, resp.StatusCode)
+			for name := range tcase.header {
+				require.Equal(t, tcase.header.Get(name), resp.Header.Get(name))
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package gohaltgin provides gin framework integration for gohalt throttlers,
+// so gin engines could throttle requests per route with gin handlers chain aborts.
+package gohaltgin
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/gin-gonic/gin"
+)
+
+// Key defines gin context throttling key extractor,
+// resulted key is stamped to request context with `gohalt.WithKey`.
+type Key func(*gin.Context) string
+
+// KeyClientIP extracts request client ip as throttling key, see `gin.Context.ClientIP`.
+func KeyClientIP() Key {
+	return func(c *gin.Context) string {
+		return c.ClientIP()
+	}
+}
+
+// KeyHeader extracts the specified request header value as throttling key.
+func KeyHeader(name string) Key {
+	return func(c *gin.Context) string {
+		return c.GetHeader(name)
+	}
+}
+
+// KeyParam extracts the specified route param value as throttling key.
+func KeyParam(name string) Key {
+	return func(c *gin.Context) string {
+		return c.Param(name)
+	}
+}
+
+// KeyRoute extracts matched route path as throttling key, see `gin.Context.FullPath`,
+// so `pattern` and `router` throttlers could select throttler per route.
+func KeyRoute() Key {
+	return func(c *gin.Context) string {
+		return c.FullPath()
+	}
+}
+
+// NewMiddleware creates gin middleware instance
+// that acquires the provided throttler before each next handlers call and releases it after the call.
+// Middleware could be attached either to the whole engine, to route group or to single route,
+// so each route could be throttled by own throttler.
+// Request context is stamped with `gohalt.WithKey` set to the provided key extractor result if any,
+// and with `gohalt.WithTimestamp` on arrival, so `latency` and `percentile` throttlers observe the handlers latency.
+// Throttled requests are passed to the provided abort handler,
+// if no abort handler is provided then request is aborted with `429 Too Many Requests`
+// and `Retry-After` header set from `gohalt.ErrorRetry` retry after duration if any.
+// Release errors are only logged.
+func NewMiddleware(thr gohalt.Throttler, key Key, abort func(*gin.Context, error)) gin.HandlerFunc {
+	if abort == nil {
+		abort = Abort
+	}
+	return func(c *gin.Context) {
+		ctx := gohalt.WithTimestamp(c.Request.Context(), time.Now().UTC())
+		if key != nil {
+			ctx = gohalt.WithKey(ctx, key(c))
+		}
+		c.Request = c.Request.WithContext(ctx)
+		defer func() {
+			if err := thr.Release(ctx); err != nil {
+				gohalt.Log("gin middleware release error happened: %v", err)
+			}
+		}()
+		if err := thr.Acquire(ctx); err != nil {
+			abort(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// Abort aborts gin request with `429 Too Many Requests`
+// and `Retry-After` header set from `gohalt.ErrorRetry` retry after duration if any,
+// the provided throttling error is attached to gin context errors.
+func Abort(c *gin.Context, err error) {
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(rerr.After.Seconds())), 10))
+	}
+	_ = c.AbortWithError(http.StatusTooManyRequests, err)
+}
@@ -0,0 +1,105 @@
+package gohaltgin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	table := map[string]struct {
+		thr    gohalt.Throttler
+		key    Key
+		abort  func(*gin.Context, error)
+		req    *http.Request
+		code   int
+		header http.Header
+	}{
+		"Gin middleware should pass not throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusOK,
+		},
+		"Gin middleware should abort throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(errors.New("test")),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+		"Gin middleware should abort throttled requests with retry after": {
+			thr:    gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond}),
+			req:    httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code:   http.StatusTooManyRequests,
+			header: http.Header{"Retry-After": []string{"2"}},
+		},
+		"Gin middleware should use custom abort handler": {
+			thr: gohalt.NewThrottlerEcho(errors.New("test")),
+			abort: func(c *gin.Context, err error) {
+				c.AbortWithStatus(http.StatusServiceUnavailable)
+			},
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusServiceUnavailable,
+		},
+		"Gin middleware should select throttler per route": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^/users/:id$`), Throttler: gohalt.NewThrottlerEcho(nil)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+			),
+			key:  KeyRoute(),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusOK,
+		},
+		"Gin middleware should extract throttling key from params": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^1$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key:  KeyParam("id"),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+		"Gin middleware should extract throttling key from headers": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^test$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key: KeyHeader("X-Tenant"),
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+				req.Header.Set("X-Tenant", "test")
+				return req
+			}(),
+			code: http.StatusTooManyRequests,
+		},
+		"Gin middleware should extract throttling key from client ip": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^192\.0\.2\.1$`), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key:  KeyClientIP(),
+			req:  httptest.NewRequest(http.MethodGet, "/users/1", nil),
+			code: http.StatusTooManyRequests,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			engine := gin.New()
+			engine.GET("/users/:id", NewMiddleware(tcase.thr, tcase.key, tcase.abort), func(c *gin.Context) {
+				c.String(http.StatusOK, "ok")
+			})
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, tcase.req)
+			require.Equal(t, tcase.code, w.Code)
+			for name := range tcase.header {
+				require.Equal(t, tcase.header.Get(name), w.Header().Get(name))
+			}
+		})
+	}
+}
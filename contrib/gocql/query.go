@@ -0,0 +1,93 @@
+// Package gohaltgocql provides cassandra gocql integration for gohalt throttlers,
+// so cassandra could be protected from client side queries stampedes.
+package gohaltgocql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/gocql/gocql"
+)
+
+// Key returns cassandra query key stamped to throttled query context with `gohalt.WithKey`,
+// the key is `{keyspace}.{table}` if the table is known or just `{keyspace}` otherwise.
+// Note that gocql only knows the query table for prepared statements after their routing info is resolved.
+func Key(keyspace string, table string) string {
+	if table == "" {
+		return keyspace
+	}
+	return keyspace + "." + table
+}
+
+// Query acquires the provided throttler before the provided gocql query call
+// and releases it after the call, e.g. `gohaltgocql.Query(q, thr, (*gocql.Query).Exec)`.
+// Query context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe cassandra queries latency,
+// and with `gohalt.WithKey` set to `Key` of the query keyspace and table,
+// so `pattern` and `router` throttlers could select throttler per keyspace or table.
+// On release query context is stamped with `gohalt.WithStatus` set to 429 for cassandra overloaded errors,
+// to 503 for cassandra unavailable and timeout errors and to 200 otherwise,
+// so `client` throttler tightens its adaptive admission quota when cassandra is overloaded.
+// Throttled queries fail with the throttling error without reaching cassandra, release errors are only logged.
+func Query(q *gocql.Query, thr gohalt.Throttler, call func(*gocql.Query) error) error {
+	return throttle(q.Context(), thr, Key(q.Keyspace(), q.Table()), 1, func(ctx context.Context) error {
+		return call(q.WithContext(ctx))
+	})
+}
+
+// Batch acquires the provided throttler before the provided gocql batch call
+// and releases it after the call the same way as `Query` does,
+// e.g. `gohaltgocql.Batch(b, thr, session.ExecuteBatch)`.
+// Batch context is additionally stamped with `gohalt.WithWeight` set to the batch statements count.
+func Batch(b *gocql.Batch, thr gohalt.Throttler, call func(*gocql.Batch) error) error {
+	weight := int64(b.Size())
+	if weight == 0 {
+		weight = 1
+	}
+	return throttle(b.Context(), thr, Key(b.Keyspace(), b.Table()), weight, func(ctx context.Context) error {
+		return call(b.WithContext(ctx))
+	})
+}
+
+func throttle(ctx context.Context, thr gohalt.Throttler, key string, weight int64, call func(context.Context) error) error {
+	ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+	ctx = gohalt.WithKey(ctx, key)
+	if weight > 1 {
+		ctx = gohalt.WithWeight(ctx, weight)
+	}
+	if err := thr.Acquire(ctx); err != nil {
+		release(thr, ctx)
+		return err
+	}
+	err := call(ctx)
+	release(thr, gohalt.WithStatus(ctx, status(err)))
+	return err
+}
+
+// status maps cassandra query error to http status reported to `client` throttler.
+func status(err error) int {
+	var rerr gocql.RequestError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.As(err, &rerr) && rerr.Code() == gocql.ErrCodeOverloaded:
+		return http.StatusTooManyRequests
+	case errors.As(err, &rerr) && (rerr.Code() == gocql.ErrCodeUnavailable ||
+		rerr.Code() == gocql.ErrCodeReadTimeout ||
+		rerr.Code() == gocql.ErrCodeWriteTimeout),
+		errors.Is(err, gocql.ErrTimeoutNoResponse),
+		errors.Is(err, gocql.ErrNoConnections):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusOK
+	}
+}
+
+func release(thr gohalt.Throttler, ctx context.Context) {
+	if err := thr.Release(ctx); err != nil {
+		gohalt.Log("gocql query release error happened: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package gohaltgocql
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/gocql/gocql"
+	"github.com/stretchr/testify/require"
+)
+
+type rerror int
+
+func (err rerror) Code() int {
+	return int(err)
+}
+
+func (err rerror) Message() string {
+	return "test"
+}
+
+func (err rerror) Error() string {
+	return "test"
+}
+
+func TestThrottle(t *testing.T) {
+	err := errors.New("test")
+	table := map[string]struct {
+		thr   gohalt.Throttler
+		calls []error
+		errs  []error
+	}{
+		"Gocql throttle should pass call on throttler pass": {
+			thr:   gohalt.NewThrottlerEcho(nil),
+			calls: []error{nil, err},
+			errs:  []error{nil, err},
+		},
+		"Gocql throttle should fail call on throttler error": {
+			thr:  gohalt.NewThrottlerEcho(err),
+			errs: []error{err},
+		},
+		"Gocql throttle should fail call on matched keyspace": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^test$"), Throttler: gohalt.NewThrottlerEcho(err)},
+			),
+			errs: []error{err},
+		},
+		"Gocql throttle should tighten client throttler on overloaded error": {
+			thr:   gohalt.NewThrottlerClient(4, time.Hour, 0.25, 1),
+			calls: []error{rerror(gocql.ErrCodeOverloaded)},
+			errs: []error{
+				rerror(gocql.ErrCodeOverloaded),
+				errors.New("throttler \"client\" has reached its threshold: 2 out of 1"),
+			},
+		},
+		"Gocql throttle should tighten client throttler on timeout error": {
+			thr:   gohalt.NewThrottlerClient(4, time.Hour, 0.25, 1),
+			calls: []error{gocql.ErrTimeoutNoResponse},
+			errs: []error{
+				gocql.ErrTimeoutNoResponse,
+				errors.New("throttler \"client\" has reached its threshold: 2 out of 1"),
+			},
+		},
+		"Gocql throttle should not tighten client throttler on other errors": {
+			thr:   gohalt.NewThrottlerClient(4, time.Hour, 0.25, 1),
+			calls: []error{err, nil},
+			errs:  []error{err, nil},
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			var calls int
+			for _, terr := range tcase.errs {
+				err := throttle(context.Background(), tcase.thr, Key("test", ""), 1, func(ctx context.Context) error {
+					require.NotEqual(t, context.Background(), ctx)
+					err := tcase.calls[calls]
+					calls++
+					return err
+				})
+				if terr != nil {
+					require.EqualError(t, err, terr.Error())
+				} else {
+					require.NoError(t, err)
+				}
+			}
+			require.Equal(t, len(tcase.calls), calls)
+		})
+	}
+}
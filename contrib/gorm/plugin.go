@@ -0,0 +1,78 @@
+// Package gohaltgorm provides gorm integration for gohalt throttlers,
+// see `gohaltsql` package for plain database/sql integration.
+package gohaltgorm
+
+import (
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"gorm.io/gorm"
+)
+
+// Operations keys stamped to throttled operations context with `gohalt.WithKey`.
+const (
+	KeyCreate = "create"
+	KeyQuery  = "query"
+	KeyUpdate = "update"
+	KeyDelete = "delete"
+)
+
+const acquired = "gohalt:acquired"
+
+type plugin struct {
+	thr gohalt.Throttler
+}
+
+// NewPlugin creates gorm plugin instance
+// that acquires the provided throttler before each create, query, update and delete operation
+// and releases it after the operation, use it with `gorm.DB.Use`.
+// Operation statement context is stamped with `gohalt.WithKey` set to `KeyCreate`, `KeyQuery`, `KeyUpdate`
+// or `KeyDelete`, so `pattern` and `router` throttlers could enforce throttler per operation type,
+// and with `gohalt.WithTimestamp` on operation, so `latency` and `percentile` throttlers observe the operation latency.
+// Throttling errors are added to operation errors, release errors are only logged.
+func NewPlugin(thr gohalt.Throttler) gorm.Plugin {
+	return plugin{thr: thr}
+}
+
+func (p plugin) Name() string {
+	return "gohalt"
+}
+
+func (p plugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register("gohalt:before_create", p.before(KeyCreate)),
+		callbacks.Create().After("*").Register("gohalt:after_create", p.after),
+		callbacks.Query().Before("*").Register("gohalt:before_query", p.before(KeyQuery)),
+		callbacks.Query().After("*").Register("gohalt:after_query", p.after),
+		callbacks.Update().Before("*").Register("gohalt:before_update", p.before(KeyUpdate)),
+		callbacks.Update().After("*").Register("gohalt:after_update", p.after),
+		callbacks.Delete().Before("*").Register("gohalt:before_delete", p.before(KeyDelete)),
+		callbacks.Delete().After("*").Register("gohalt:after_delete", p.after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p plugin) before(key string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := gohalt.WithTimestamp(gohalt.WithKey(db.Statement.Context, key), time.Now().UTC())
+		db.Statement.Context = ctx
+		db.InstanceSet(acquired, true)
+		if err := p.thr.Acquire(ctx); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+}
+
+func (p plugin) after(db *gorm.DB) {
+	if _, ok := db.InstanceGet(acquired); !ok {
+		return
+	}
+	if err := p.thr.Release(db.Statement.Context); err != nil {
+		gohalt.Log("gorm plugin release error happened: %v", err)
+	}
+}
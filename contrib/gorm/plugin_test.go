@@ -0,0 +1,110 @@
+package gohaltgorm
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// dialector defines minimal dry run gorm dialector.
+type dialector struct{}
+
+func (dialector) Name() string {
+	return "test"
+}
+
+func (dialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{})
+	return nil
+}
+
+func (dialector) Migrator(*gorm.DB) gorm.Migrator {
+	return nil
+}
+
+func (dialector) DataTypeOf(*schema.Field) string {
+	return ""
+}
+
+func (dialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (dialector) BindVarTo(w clause.Writer, _ *gorm.Statement, _ interface{}) {
+	_ = w.WriteByte('?')
+}
+
+func (dialector) QuoteTo(w clause.Writer, str string) {
+	_, _ = w.WriteString(str)
+}
+
+func (dialector) Explain(sql string, _ ...interface{}) string {
+	return sql
+}
+
+type user struct {
+	ID   uint
+	Name string
+}
+
+func TestPlugin(t *testing.T) {
+	throttled := errors.New("throttled")
+	table := map[string]struct {
+		thr    gohalt.Throttler
+		create error
+		query  error
+		update error
+		delete error
+	}{
+		"GORM plugin should pass not throttled operations": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"GORM plugin should throttle all operations": {
+			thr:    gohalt.NewThrottlerEcho(throttled),
+			create: throttled,
+			query:  throttled,
+			update: throttled,
+			delete: throttled,
+		},
+		"GORM plugin should throttle operations per type": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^(` + KeyUpdate + `|` + KeyDelete + `)$`), Throttler: gohalt.NewThrottlerEcho(throttled)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			update: throttled,
+			delete: throttled,
+		},
+		"GORM plugin should release throttler after operations": {
+			thr: gohalt.NewThrottlerRunning(1),
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			db, err := gorm.Open(dialector{}, &gorm.Config{DryRun: true})
+			require.NoError(t, err)
+			require.NoError(t, db.Use(NewPlugin(tcase.thr)))
+			require.ErrorIs(t, db.Create(&user{Name: "test"}).Error, tcase.create)
+			require.ErrorIs(t, db.First(&user{}).Error, tcase.query)
+			require.ErrorIs(t, db.Model(&user{ID: 1}).Update("name", "test").Error, tcase.update)
+			require.ErrorIs(t, db.Delete(&user{ID: 1}).Error, tcase.delete)
+		})
+	}
+}
+
+func TestPluginLatency(t *testing.T) {
+	db, err := gorm.Open(dialector{}, &gorm.Config{DryRun: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(NewPlugin(gohalt.NewThrottlerLatency(time.Nanosecond, time.Hour))))
+	require.NoError(t, db.First(&user{}).Error)
+	var terr gohalt.ErrorThreshold
+	require.True(t, errors.As(db.First(&user{}).Error, &terr))
+	require.Equal(t, "latency", terr.Throttler)
+}
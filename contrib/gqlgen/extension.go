@@ -0,0 +1,87 @@
+// Package gohaltgqlgen provides gqlgen integration for gohalt throttlers,
+// so graphql operations could be throttled proportionally to their complexity.
+package gohaltgqlgen
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const errThrottled = "THROTTLED"
+
+type extension struct {
+	thr gohalt.Throttler
+	es  graphql.ExecutableSchema
+}
+
+// NewExtension creates gqlgen handler extension instance
+// that acquires the provided throttler before each operation and releases it after the operation,
+// for subscriptions throttler is released once subscription is finished.
+// Operation context is stamped with `gohalt.WithWeight` set to the operation complexity,
+// see `complexity.Calculate`, so expensive nested queries consume proportionally more
+// of `before`, `after`, `timed`, `adaptive`, `semaphore`, `cellrate` and `bucket` throttlers quota,
+// and with `gohalt.WithTimestamp` on operation, so `latency` and `percentile` throttlers observe the operation latency.
+// Use `gohalt.WithKey` in upstream http middleware to throttle each client by own budget.
+// Throttled operations are responded with "THROTTLED" error code error
+// with "complexity" and "retryAfter" error extensions set from `gohalt.ErrorRetry` retry after duration if any.
+// Release errors are only logged.
+func NewExtension(thr gohalt.Throttler) graphql.HandlerExtension {
+	return &extension{thr: thr}
+}
+
+func (ext *extension) ExtensionName() string {
+	return "GohaltThrottler"
+}
+
+func (ext *extension) Validate(schema graphql.ExecutableSchema) error {
+	ext.es = schema
+	return nil
+}
+
+func (ext *extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	rc := graphql.GetOperationContext(ctx)
+	cost := complexity.Calculate(ext.es, rc.Operation, rc.Variables)
+	ctx = gohalt.WithTimestamp(gohalt.WithWeight(ctx, int64(cost)), time.Now().UTC())
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if err := ext.thr.Release(ctx); err != nil {
+				gohalt.Log("gqlgen extension release error happened: %v", err)
+			}
+		})
+	}
+	if err := ext.thr.Acquire(ctx); err != nil {
+		release()
+		return graphql.OneShot(&graphql.Response{Errors: gqlerror.List{deny(err, cost)}})
+	}
+	handler := next(ctx)
+	subscription := rc.Operation != nil && rc.Operation.Operation == ast.Subscription
+	return func(ctx context.Context) *graphql.Response {
+		resp := handler(ctx)
+		if !subscription || resp == nil {
+			release()
+		}
+		return resp
+	}
+}
+
+func deny(err error, cost int) *gqlerror.Error {
+	gerr := gqlerror.Errorf("operation with complexity %d has been throttled: %v", cost, err)
+	errcode.Set(gerr, errThrottled)
+	gerr.Extensions["complexity"] = cost
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		gerr.Extensions["retryAfter"] = int64(math.Ceil(rerr.After.Seconds()))
+	}
+	return gerr
+}
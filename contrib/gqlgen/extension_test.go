@@ -0,0 +1,92 @@
+package gohaltgqlgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func TestExtension(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		type Query { user: User }
+		type User { name: String, friends: [User] }
+	`})
+	table := map[string]struct {
+		thr   gohalt.Throttler
+		query string
+		errs  []map[string]interface{}
+	}{
+		"GQLGen extension should pass not throttled operations": {
+			thr:   gohalt.NewThrottlerAfter(3),
+			query: `{ user { friends { name } } }`,
+		},
+		"GQLGen extension should throttle operations by complexity": {
+			thr:   gohalt.NewThrottlerAfter(3),
+			query: `{ user { friends { friends { name } } } }`,
+			errs: []map[string]interface{}{
+				{
+					"message": `operation with complexity 4 has been throttled: throttler "after" has reached its threshold: 4 out of 3`,
+					"extensions": map[string]interface{}{
+						"code":       "THROTTLED",
+						"complexity": float64(4),
+					},
+				},
+			},
+		},
+		"GQLGen extension should throttle operations with retry after": {
+			thr:   gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond, Err: errors.New("test")}),
+			query: `{ user { name } }`,
+			errs: []map[string]interface{}{
+				{
+					"message": `operation with complexity 2 has been throttled: throttler "test" has rejected call, retry after 1.5s: test`,
+					"extensions": map[string]interface{}{
+						"code":       "THROTTLED",
+						"complexity": float64(2),
+						"retryAfter": float64(2),
+					},
+				},
+			},
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			srv := handler.New(&graphql.ExecutableSchemaMock{
+				ComplexityFunc: func(string, string, int, map[string]interface{}) (int, bool) {
+					return 0, false
+				},
+				ExecFunc: func(context.Context) graphql.ResponseHandler {
+					return graphql.OneShot(&graphql.Response{Data: []byte(`{"user":null}`)})
+				},
+				SchemaFunc: func() *ast.Schema {
+					return schema
+				},
+			})
+			srv.AddTransport(transport.POST{})
+			srv.Use(NewExtension(tcase.thr))
+			body, err := json.Marshal(map[string]string{"query": tcase.query})
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+			var resp struct {
+				Errors []map[string]interface{} `json:"errors"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Equal(t, tcase.errs, resp.Errors)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Package gohaltgraphite provides graphite metrics integration for gohalt throttlers,
+// so services monitored by legacy graphite stacks could throttle on their existing metrics.
+package gohaltgraphite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+)
+
+type metric struct {
+	url       string
+	target    string
+	window    time.Duration
+	threshold float64
+	cache     time.Duration
+	client    *http.Client
+	lock      sync.Mutex
+	value     bool
+	ts        time.Time
+}
+
+// NewMetric creates graphite metric querier instance
+// with cache interval defined by the provided duration
+// that queries graphite render api at the provided url with the provided target over the provided time window ending now
+// and checks if the last not null datapoint value of any rendered series exceeds the provided threshold.
+// Only successful metric results are cached.
+func NewMetric(url string, target string, window time.Duration, threshold float64, cache time.Duration) gohalt.Metric {
+	return &metric{
+		url:       strings.TrimSuffix(url, "/"),
+		target:    target,
+		window:    window,
+		threshold: threshold,
+		cache:     cache,
+		client:    http.DefaultClient,
+	}
+}
+
+func (mtc *metric) Query(ctx context.Context) (bool, error) {
+	mtc.lock.Lock()
+	defer mtc.lock.Unlock()
+	now := time.Now()
+	if !mtc.ts.IsZero() && now.Sub(mtc.ts) < mtc.cache {
+		return mtc.value, nil
+	}
+	value, err := mtc.pull(ctx)
+	if err != nil {
+		return mtc.value, err
+	}
+	mtc.value, mtc.ts = value, now
+	return mtc.value, nil
+}
+
+type series struct {
+	Target     string        `json:"target"`
+	Datapoints [][2]*float64 `json:"datapoints"`
+}
+
+func (mtc *metric) pull(ctx context.Context) (bool, error) {
+	params := url.Values{}
+	params.Set("target", mtc.target)
+	params.Set("from", "-"+strconv.FormatInt(int64(mtc.window.Seconds()), 10)+"s")
+	params.Set("format", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mtc.url+"/render?"+params.Encode(), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := mtc.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("graphite render failed with %d status", resp.StatusCode)
+	}
+	var body []series
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return false, err
+	}
+	var found bool
+	for _, s := range body {
+		for i := len(s.Datapoints) - 1; i >= 0; i-- {
+			if value := s.Datapoints[i][0]; value != nil {
+				if *value > mtc.threshold {
+					return true, nil
+				}
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return false, fmt.Errorf("graphite target %q rendered no datapoints", mtc.target)
+	}
+	return false, nil
+}
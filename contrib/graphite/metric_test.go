@@ -0,0 +1,75 @@
+package gohaltgraphite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetric(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.URL.Path != "/render" || r.URL.Query().Get("format") != "json" || r.URL.Query().Get("from") != "-300s" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Query().Get("target") {
+		case "high":
+			_, _ = w.Write([]byte(`[{"target":"a","datapoints":[[10,1],[20,2]]},{"target":"b","datapoints":[[10,1],[90,2],[null,3]]}]`))
+		case "low":
+			_, _ = w.Write([]byte(`[{"target":"a","datapoints":[[90,1],[20,2],[null,3]]}]`))
+		case "empty":
+			_, _ = w.Write([]byte(`[{"target":"a","datapoints":[[null,1]]}]`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	table := map[string]struct {
+		target string
+		metric bool
+		err    string
+	}{
+		"Graphite metric should be reached if any series last datapoint exceeds threshold": {
+			target: "high",
+			metric: true,
+		},
+		"Graphite metric should not be reached if series last datapoint is below threshold": {
+			target: "low",
+		},
+		"Graphite metric should fail on null datapoints": {
+			target: "empty",
+			err:    `graphite target "empty" rendered no datapoints`,
+		},
+		"Graphite metric should fail on render errors": {
+			target: "invalid",
+			err:    "graphite render failed with 500 status",
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			metric, err := NewMetric(srv.URL+"/", tcase.target, 5*time.Minute, 50, time.Minute).Query(context.Background())
+			if tcase.err != "" {
+				require.EqualError(t, err, tcase.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tcase.metric, metric)
+		})
+	}
+	t.Run("Graphite metric should cache successful results", func(t *testing.T) {
+		thr := gohalt.NewThrottlerMetric(NewMetric(srv.URL, "high", 5*time.Minute, 50, time.Hour))
+		atomic.StoreInt32(&calls, 0)
+		for i := 0; i < 3; i++ {
+			require.Error(t, thr.Acquire(context.Background()))
+		}
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+}
@@ -0,0 +1,373 @@
+// Package gohaltgrpc provides grpc integration for gohalt throttlers,
+// so grpc servers and clients could throttle rpcs and stream messages per method.
+package gohaltgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/tap"
+)
+
+// NewInterceptorUnary creates grpc unary server interceptor instance
+// that acquires the provided throttler before each wrapped handler call and releases it after the call.
+// Request context is stamped with `gohalt.WithKey` set to the full method name, so `pattern` and `router` throttlers
+// could select throttler per method, and with `gohalt.WithTimestamp` on arrival,
+// so `latency` and `percentile` throttlers observe the wrapped handler latency.
+// Throttled requests are responded with `ResourceExhausted` status code
+// and `grpc-retry-pushback-ms` trailer set from `gohalt.ErrorRetry` retry after duration if any,
+// internal throttling errors are responded with `Internal` status code.
+// Release errors are only logged.
+func NewInterceptorUnary(thr gohalt.Throttler) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		ctx = gohalt.WithTimestamp(gohalt.WithKey(ctx, info.FullMethod), time.Now().UTC())
+		defer func() {
+			if err := thr.Release(ctx); err != nil {
+				gohalt.Log("grpc interceptor release error happened: %v", err)
+			}
+		}()
+		if err := thr.Acquire(ctx); err != nil {
+			return nil, deny(ctx, err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// NewTap creates grpc server tap handle instance, use it with `grpc.InTapHandle`,
+// that acquires the provided throttler before each rpc is accepted and releases it right after the acquire,
+// so rpcs are rejected before handler goroutines are spawned and request messages are decoded,
+// which is significantly cheaper than interceptors rejection under attack.
+// As tap handle can't observe rpc completion only rate throttlers like `timed` or `bucket` are meaningful here.
+// Tap context is stamped with `gohalt.WithKey` set to the full method name, so `pattern` and `router` throttlers
+// could select throttler per method.
+// Throttled rpcs are responded with `ResourceExhausted` status code,
+// internal throttling errors are responded with `Internal` status code.
+// Release errors are only logged.
+func NewTap(thr gohalt.Throttler) tap.ServerInHandle {
+	return func(ctx context.Context, info *tap.Info) (context.Context, error) {
+		tctx := gohalt.WithKey(ctx, info.FullMethodName)
+		err := thr.Acquire(tctx)
+		if err := thr.Release(tctx); err != nil {
+			gohalt.Log("grpc tap release error happened: %v", err)
+		}
+		if err == nil {
+			return ctx, nil
+		}
+		var ierr gohalt.ErrorInternal
+		if errors.As(err, &ierr) {
+			return ctx, status.Error(codes.Internal, err.Error())
+		}
+		return ctx, status.Error(codes.ResourceExhausted, err.Error())
+	}
+}
+
+type ssthrottled struct {
+	grpc.ServerStream
+	ctx context.Context
+	thr gohalt.Throttler
+}
+
+// NewInterceptorStream creates grpc stream server interceptor instance
+// that acquires the provided stream throttler before each wrapped handler call and releases it after the call,
+// and acquires the provided message throttler before each stream message send and receive and releases it after,
+// if no message throttler is provided then stream messages are not throttled.
+// Stream context is stamped with `gohalt.WithKey` set to the full method name, so `pattern` and `router` throttlers
+// could select throttler per method, and with `gohalt.WithTimestamp` on stream arrival and on each stream message,
+// so `latency` and `percentile` throttlers observe the wrapped handler and the stream message latency.
+// Throttled streams and stream messages are responded with `ResourceExhausted` status code
+// and `grpc-retry-pushback-ms` trailer set from `gohalt.ErrorRetry` retry after duration if any,
+// internal throttling errors are responded with `Internal` status code.
+// Release errors are only logged.
+func NewInterceptorStream(thr gohalt.Throttler, msg gohalt.Throttler) grpc.StreamServerInterceptor {
+	if msg == nil {
+		msg = gohalt.NewThrottlerEcho(nil)
+	}
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx := gohalt.WithTimestamp(gohalt.WithKey(ss.Context(), info.FullMethod), time.Now().UTC())
+		defer func() {
+			if err := thr.Release(ctx); err != nil {
+				gohalt.Log("grpc interceptor release error happened: %v", err)
+			}
+		}()
+		if err := thr.Acquire(ctx); err != nil {
+			return deny(ctx, err)
+		}
+		return handler(srv, ssthrottled{ServerStream: ss, ctx: ctx, thr: msg})
+	}
+}
+
+func (ss ssthrottled) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss ssthrottled) SendMsg(m interface{}) error {
+	return message(ss.ctx, ss.thr, deny, func() error {
+		return ss.ServerStream.SendMsg(m)
+	})
+}
+
+func (ss ssthrottled) RecvMsg(m interface{}) error {
+	return message(ss.ctx, ss.thr, deny, func() error {
+		return ss.ServerStream.RecvMsg(m)
+	})
+}
+
+// NewInterceptorClientUnary creates grpc unary client interceptor instance
+// that acquires the provided throttler before each outbound call and releases it after the call.
+// Call context is stamped with `gohalt.WithKey` set to the full method name, so `pattern` and `router` throttlers
+// could select throttler per method, and with `gohalt.WithTimestamp` on sending,
+// so `latency` and `percentile` throttlers observe the call latency.
+// Call status is reported on release with `gohalt.WithStatus`, `ResourceExhausted` status code is reported as
+// `429 Too Many Requests`, `Unavailable` status code is reported as `503 Service Unavailable`
+// and other status codes are reported as `200 OK`, so adaptive `client` throttler backs off on overloaded servers.
+// Once failed call returns `grpc-retry-pushback-ms` trailer, following calls to the same method
+// are rejected with `gohalt.ErrorRetry` without acquiring throttler until the pushback duration passes.
+// Throttling errors are returned from call as is, release errors are only logged.
+func NewInterceptorClientUnary(thr gohalt.Throttler) grpc.UnaryClientInterceptor {
+	pbs := &pushbacks{}
+	return func(
+		ctx context.Context,
+		method string,
+		req interface{},
+		reply interface{},
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if err := pbs.check(method); err != nil {
+			return err
+		}
+		ctx = gohalt.WithTimestamp(gohalt.WithKey(ctx, method), time.Now().UTC())
+		if err := thr.Acquire(ctx); err != nil {
+			if err := thr.Release(ctx); err != nil {
+				gohalt.Log("grpc interceptor release error happened: %v", err)
+			}
+			return err
+		}
+		var trailer metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Trailer(&trailer))...)
+		pbs.report(method, err, trailer)
+		if err := thr.Release(gohalt.WithStatus(ctx, httpstatus(err))); err != nil {
+			gohalt.Log("grpc interceptor release error happened: %v", err)
+		}
+		return err
+	}
+}
+
+type csthrottled struct {
+	grpc.ClientStream
+	ctx    context.Context
+	thr    gohalt.Throttler
+	server bool
+	finish func(error)
+}
+
+// NewInterceptorClientStream creates grpc stream client interceptor instance
+// that acquires the provided stream throttler before each outbound stream establishment and releases it
+// once the stream is finished either by receive error or by stream context cancelation,
+// or by the single response receive for client streaming streams,
+// and acquires the provided message throttler before each stream message send and receive and releases it after,
+// if no message throttler is provided then stream messages are not throttled.
+// Stream context is stamped with `gohalt.WithKey` set to the full method name, so `pattern` and `router` throttlers
+// could select throttler per method, and with `gohalt.WithTimestamp` on stream establishment and on each stream message,
+// so `latency` and `percentile` throttlers observe the stream establishment and the stream message latency.
+// Finished stream status is reported on stream throttler release with `gohalt.WithStatus`
+// the same way as for `NewInterceptorClientUnary`, as well as `grpc-retry-pushback-ms` trailer
+// rejects following streams of the same method with `gohalt.ErrorRetry` until the pushback duration passes.
+// Throttling errors are returned from stream establishment and stream messages as is, release errors are only logged.
+func NewInterceptorClientStream(thr gohalt.Throttler, msg gohalt.Throttler) grpc.StreamClientInterceptor {
+	if msg == nil {
+		msg = gohalt.NewThrottlerEcho(nil)
+	}
+	pbs := &pushbacks{}
+	return func(
+		ctx context.Context,
+		desc *grpc.StreamDesc,
+		cc *grpc.ClientConn,
+		method string,
+		streamer grpc.Streamer,
+		opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		if err := pbs.check(method); err != nil {
+			return nil, err
+		}
+		ctx = gohalt.WithTimestamp(gohalt.WithKey(ctx, method), time.Now().UTC())
+		release := func(ctx context.Context) {
+			if err := thr.Release(ctx); err != nil {
+				gohalt.Log("grpc interceptor release error happened: %v", err)
+			}
+		}
+		if err := thr.Acquire(ctx); err != nil {
+			release(ctx)
+			return nil, err
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			pbs.report(method, err, nil)
+			release(gohalt.WithStatus(ctx, httpstatus(err)))
+			return nil, err
+		}
+		finished := make(chan struct{})
+		var once sync.Once
+		go func() {
+			select {
+			case <-ctx.Done():
+				once.Do(func() { release(ctx) })
+			case <-finished:
+			}
+		}()
+		finish := func(err error) {
+			once.Do(func() {
+				close(finished)
+				if errors.Is(err, io.EOF) {
+					err = nil
+				}
+				pbs.report(method, err, cs.Trailer())
+				release(gohalt.WithStatus(ctx, httpstatus(err)))
+			})
+		}
+		return csthrottled{ClientStream: cs, ctx: ctx, thr: msg, server: desc.ServerStreams, finish: finish}, nil
+	}
+}
+
+func (cs csthrottled) Context() context.Context {
+	return cs.ctx
+}
+
+func (cs csthrottled) SendMsg(m interface{}) error {
+	return message(cs.ctx, cs.thr, pass, func() error {
+		return cs.ClientStream.SendMsg(m)
+	})
+}
+
+func (cs csthrottled) RecvMsg(m interface{}) error {
+	return message(cs.ctx, cs.thr, pass, func() error {
+		err := cs.ClientStream.RecvMsg(m)
+		// client streaming streams are finished by their single response.
+		if err != nil || !cs.server {
+			cs.finish(err)
+		}
+		return err
+	})
+}
+
+type pushback struct {
+	deadline time.Time
+	err      error
+}
+
+// pushbacks tracks grpc retry pushbacks returned by servers per method.
+type pushbacks struct {
+	lock      sync.Mutex
+	pushbacks map[string]pushback
+}
+
+func (pbs *pushbacks) check(method string) error {
+	pbs.lock.Lock()
+	defer pbs.lock.Unlock()
+	pb, ok := pbs.pushbacks[method]
+	if !ok {
+		return nil
+	}
+	if after := time.Until(pb.deadline); after > 0 {
+		return gohalt.ErrorRetry{
+			Throttler: "pushback",
+			After:     after,
+			Err:       pb.err,
+		}
+	}
+	delete(pbs.pushbacks, method)
+	return nil
+}
+
+func (pbs *pushbacks) report(method string, err error, trailer metadata.MD) {
+	if err == nil {
+		return
+	}
+	values := trailer.Get("grpc-retry-pushback-ms")
+	if len(values) == 0 {
+		return
+	}
+	// negative or malformed pushback means no retry hint, so it is ignored.
+	ms, perr := strconv.ParseInt(values[0], 10, 64)
+	if perr != nil || ms <= 0 {
+		return
+	}
+	pbs.lock.Lock()
+	defer pbs.lock.Unlock()
+	if pbs.pushbacks == nil {
+		pbs.pushbacks = make(map[string]pushback)
+	}
+	pbs.pushbacks[method] = pushback{
+		deadline: time.Now().Add(time.Duration(ms) * time.Millisecond),
+		err:      err,
+	}
+}
+
+// httpstatus maps grpc call error to http response status reported to throttlers.
+func httpstatus(err error) int {
+	switch status.Code(err) {
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusOK
+	}
+}
+
+// message acquires the provided throttler before single stream message call and releases it after.
+func message(
+	ctx context.Context,
+	thr gohalt.Throttler,
+	deny func(context.Context, error) error,
+	call func() error,
+) error {
+	ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+	defer func() {
+		if err := thr.Release(ctx); err != nil {
+			gohalt.Log("grpc interceptor message release error happened: %v", err)
+		}
+	}()
+	if err := thr.Acquire(ctx); err != nil {
+		return deny(ctx, err)
+	}
+	return call()
+}
+
+func pass(_ context.Context, err error) error {
+	return err
+}
+
+func deny(ctx context.Context, err error) error {
+	var ierr gohalt.ErrorInternal
+	if errors.As(err, &ierr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		pushback := strconv.FormatInt(rerr.After.Milliseconds(), 10)
+		_ = grpc.SetTrailer(ctx, metadata.Pairs("grpc-retry-pushback-ms", pushback))
+	}
+	return status.Error(codes.ResourceExhausted, err.Error())
+}
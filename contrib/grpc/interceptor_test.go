@@ -0,0 +1,301 @@
+package gohaltgrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/1pkg/gohalt/quotapb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestInterceptorUnary(t *testing.T) {
+	table := map[string]struct {
+		thr      gohalt.Throttler
+		code     codes.Code
+		pushback []string
+	}{
+		"GRPC unary interceptor should pass not throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			code: codes.OK,
+		},
+		"GRPC unary interceptor should deny throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(errors.New("test")),
+			code: codes.ResourceExhausted,
+		},
+		"GRPC unary interceptor should deny throttled requests with retry pushback": {
+			thr:      gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond}),
+			code:     codes.ResourceExhausted,
+			pushback: []string{"1500"},
+		},
+		"GRPC unary interceptor should fail on internal throttling errors": {
+			thr:  gohalt.NewThrottlerEcho(gohalt.ErrorInternal{Throttler: "test", Message: "test"}),
+			code: codes.Internal,
+		},
+		"GRPC unary interceptor should select throttler per method": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(regexp.QuoteMeta(quotapb.Quota_Grant_FullMethodName)), Throttler: gohalt.NewThrottlerEcho(nil)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+			),
+			code: codes.OK,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			srv := grpc.NewServer(grpc.UnaryInterceptor(NewInterceptorUnary(tcase.thr)))
+			quotapb.RegisterQuotaServer(srv, gohalt.NewServiceQuota(gohalt.NewThrottlerEcho(nil), 0, 16))
+			client := quotapb.NewQuotaClient(testGRPC(t, srv))
+			var trailer metadata.MD
+			_, err := client.Grant(context.Background(), &quotapb.GrantRequest{Key: "test", Tokens: 1}, grpc.Trailer(&trailer))
+			require.Equal(t, tcase.code, status.Code(err))
+			require.Equal(t, tcase.pushback, trailer.Get("grpc-retry-pushback-ms"))
+		})
+	}
+}
+
+func TestTap(t *testing.T) {
+	table := map[string]struct {
+		thr  gohalt.Throttler
+		code codes.Code
+	}{
+		"GRPC tap should pass not throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			code: codes.OK,
+		},
+		"GRPC tap should deny throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(errors.New("test")),
+			code: codes.ResourceExhausted,
+		},
+		"GRPC tap should fail on internal throttling errors": {
+			thr:  gohalt.NewThrottlerEcho(gohalt.ErrorInternal{Throttler: "test", Message: "test"}),
+			code: codes.Internal,
+		},
+		"GRPC tap should select throttler per method": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(regexp.QuoteMeta(quotapb.Quota_Grant_FullMethodName)), Throttler: gohalt.NewThrottlerEcho(nil)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+			),
+			code: codes.OK,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			srv := grpc.NewServer(grpc.InTapHandle(NewTap(tcase.thr)))
+			quotapb.RegisterQuotaServer(srv, gohalt.NewServiceQuota(gohalt.NewThrottlerEcho(nil), 0, 16))
+			client := quotapb.NewQuotaClient(testGRPC(t, srv))
+			_, err := client.Grant(context.Background(), &quotapb.GrantRequest{Key: "test", Tokens: 1})
+			require.Equal(t, tcase.code, status.Code(err))
+		})
+	}
+}
+
+func TestInterceptorStream(t *testing.T) {
+	table := map[string]struct {
+		thr  gohalt.Throttler
+		msg  gohalt.Throttler
+		recv int
+		code codes.Code
+	}{
+		"GRPC stream interceptor should pass not throttled streams": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			recv: 2,
+			code: codes.OK,
+		},
+		"GRPC stream interceptor should deny throttled streams": {
+			thr:  gohalt.NewThrottlerEcho(errors.New("test")),
+			code: codes.ResourceExhausted,
+		},
+		"GRPC stream interceptor should fail on internal throttling errors": {
+			thr:  gohalt.NewThrottlerEcho(gohalt.ErrorInternal{Throttler: "test", Message: "test"}),
+			code: codes.Internal,
+		},
+		"GRPC stream interceptor should deny throttled stream messages": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			msg:  gohalt.NewThrottlerEcho(errors.New("test")),
+			code: codes.ResourceExhausted,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			srv := grpc.NewServer(grpc.StreamInterceptor(NewInterceptorStream(tcase.thr, tcase.msg)))
+			hsrv := health.NewServer()
+			grpc_health_v1.RegisterHealthServer(srv, hsrv)
+			client := grpc_health_v1.NewHealthClient(testGRPC(t, srv))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+			require.NoError(t, err)
+			for i := 0; i < tcase.recv; i++ {
+				_, err := stream.Recv()
+				require.NoError(t, err)
+				hsrv.SetServingStatus("", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+			}
+			if tcase.code != codes.OK {
+				_, err = stream.Recv()
+				require.Equal(t, tcase.code, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestInterceptorClientStream(t *testing.T) {
+	srv := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := grpc_health_v1.NewHealthClient(testGRPC(
+		t,
+		srv,
+		grpc.WithStreamInterceptor(NewInterceptorClientStream(gohalt.NewThrottlerEcho(nil), gohalt.NewThrottlerAfter(2))),
+	))
+	stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	var terr gohalt.ErrorThreshold
+	require.True(t, errors.As(err, &terr))
+	require.EqualError(t, terr, `throttler "after" has reached its threshold: 3 out of 2`)
+	srv = grpc.NewServer(grpc.StreamInterceptor(NewInterceptorStream(
+		gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Hour}),
+		nil,
+	)))
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	client = grpc_health_v1.NewHealthClient(testGRPC(
+		t,
+		srv,
+		grpc.WithStreamInterceptor(NewInterceptorClientStream(gohalt.NewThrottlerEcho(nil), nil)),
+	))
+	stream, err = client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	var rerr gohalt.ErrorRetry
+	require.True(t, errors.As(err, &rerr))
+	require.Equal(t, "pushback", rerr.Throttler)
+	thr := gohalt.NewThrottlerRunning(1)
+	client = grpc_health_v1.NewHealthClient(testGRPC(
+		t,
+		srv,
+		grpc.WithStreamInterceptor(NewInterceptorClientStream(thr, nil)),
+	))
+	sctx, scancel := context.WithCancel(ctx)
+	_, err = client.Watch(sctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, "running", terr.Throttler)
+	scancel()
+	require.Eventually(t, func() bool {
+		_, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+		return err == nil
+	}, time.Second, time.Millisecond)
+}
+
+type tinputs struct {
+	grpc_testing.UnimplementedTestServiceServer
+}
+
+func (tinputs) StreamingInputCall(stream grpc_testing.TestService_StreamingInputCallServer) error {
+	var size int32
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&grpc_testing.StreamingInputCallResponse{AggregatedPayloadSize: size})
+		}
+		if err != nil {
+			return err
+		}
+		size += int32(len(req.GetPayload().GetBody()))
+	}
+}
+
+func TestInterceptorClientStreamClientStreaming(t *testing.T) {
+	srv := grpc.NewServer()
+	grpc_testing.RegisterTestServiceServer(srv, tinputs{})
+	client := grpc_testing.NewTestServiceClient(testGRPC(
+		t,
+		srv,
+		grpc.WithStreamInterceptor(NewInterceptorClientStream(gohalt.NewThrottlerRunning(1), nil)),
+	))
+	// client streaming streams are released on their response without context cancelation
+	for i := 0; i < 3; i++ {
+		stream, err := client.StreamingInputCall(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&grpc_testing.StreamingInputCallRequest{
+			Payload: &grpc_testing.Payload{Body: []byte("test")},
+		}))
+		resp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		require.Equal(t, int32(4), resp.GetAggregatedPayloadSize())
+	}
+}
+
+func TestInterceptorClientUnary(t *testing.T) {
+	grant := func(t *testing.T, srvthr gohalt.Throttler, thr gohalt.Throttler) func() error {
+		srv := grpc.NewServer(grpc.UnaryInterceptor(NewInterceptorUnary(srvthr)))
+		quotapb.RegisterQuotaServer(srv, gohalt.NewServiceQuota(gohalt.NewThrottlerEcho(nil), 0, 16))
+		client := quotapb.NewQuotaClient(testGRPC(t, srv, grpc.WithUnaryInterceptor(NewInterceptorClientUnary(thr))))
+		return func() error {
+			_, err := client.Grant(context.Background(), &quotapb.GrantRequest{Key: "test", Tokens: 1})
+			return err
+		}
+	}
+	t.Run("GRPC client unary interceptor should back off on exhausted servers", func(t *testing.T) {
+		call := grant(t, gohalt.NewThrottlerEcho(errors.New("test")), gohalt.NewThrottlerClient(2, time.Hour, 0.5, 0))
+		require.Equal(t, codes.ResourceExhausted, status.Code(call()))
+		var terr gohalt.ErrorThreshold
+		require.True(t, errors.As(call(), &terr))
+		require.EqualError(t, terr, `throttler "client" has reached its threshold: 2 out of 1`)
+	})
+	t.Run("GRPC client unary interceptor should respect server retry pushback", func(t *testing.T) {
+		call := grant(t, gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Hour}), gohalt.NewThrottlerEcho(nil))
+		require.Equal(t, codes.ResourceExhausted, status.Code(call()))
+		err := call()
+		var rerr gohalt.ErrorRetry
+		require.True(t, errors.As(err, &rerr))
+		require.Equal(t, "pushback", rerr.Throttler)
+		require.Greater(t, rerr.After, time.Duration(0))
+		require.LessOrEqual(t, rerr.After, time.Hour)
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+	t.Run("GRPC client unary interceptor should ignore elapsed server retry pushback", func(t *testing.T) {
+		call := grant(t, gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Millisecond}), gohalt.NewThrottlerEcho(nil))
+		require.Equal(t, codes.ResourceExhausted, status.Code(call()))
+		time.Sleep(10 * time.Millisecond)
+		var rerr gohalt.ErrorRetry
+		require.False(t, errors.As(call(), &rerr))
+	})
+}
+
+func testGRPC(t *testing.T, srv *grpc.Server, opts ...grpc.DialOption) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	opts = append(
+		opts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
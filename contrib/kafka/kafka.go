@@ -0,0 +1,130 @@
+// Package gohaltkafka provides segmentio kafka-go integration for gohalt throttlers,
+// see `gohaltsarama` package for sarama kafka client integration.
+package gohaltkafka
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Reader defines kafka-go reader wrapper that throttles messages consumption,
+// all not throttled methods are delegated to the wrapped kafka-go reader.
+type Reader struct {
+	*kafka.Reader
+	thr    gohalt.Throttler
+	poll   time.Duration
+	paused int32
+}
+
+// NewReader creates kafka-go reader wrapper instance that acquires the provided throttler
+// before each message is fetched or read and releases it right after the acquire.
+// Throttled reader pauses consumption, it waits for the specified poll interval
+// or for `gohalt.ErrorRetry` retry after duration if any before the next throttler acquire
+// until the throttler passes and reader resumes consumption or the call context is done,
+// so consumption could be paused while downstream is hot, e.g. with `monitor` throttler.
+// Throttler context is stamped with `gohalt.WithKey` set to the reader topic,
+// so `pattern` and `router` throttlers could select throttler per topic.
+// Release errors are only logged.
+func NewReader(r *kafka.Reader, thr gohalt.Throttler, poll time.Duration) *Reader {
+	return &Reader{Reader: r, thr: thr, poll: poll}
+}
+
+// FetchMessage fetches the next message from the wrapped reader after reader is resumed,
+// see `kafka.Reader.FetchMessage`.
+func (r *Reader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if err := r.wait(ctx); err != nil {
+		return kafka.Message{}, err
+	}
+	return r.Reader.FetchMessage(ctx)
+}
+
+// ReadMessage reads the next message from the wrapped reader after reader is resumed,
+// see `kafka.Reader.ReadMessage`.
+func (r *Reader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	if err := r.wait(ctx); err != nil {
+		return kafka.Message{}, err
+	}
+	return r.Reader.ReadMessage(ctx)
+}
+
+// Paused returns whether reader consumption is currently paused by the throttler.
+func (r *Reader) Paused() bool {
+	return atomic.LoadInt32(&r.paused) == 1
+}
+
+func (r *Reader) wait(ctx context.Context) error {
+	ctx = gohalt.WithKey(ctx, r.Reader.Config().Topic)
+	for {
+		err := r.thr.Acquire(ctx)
+		release(r.thr, ctx)
+		if err == nil {
+			if atomic.CompareAndSwapInt32(&r.paused, 1, 0) {
+				gohalt.Log("kafka reader consumption is resumed")
+			}
+			return nil
+		}
+		if atomic.CompareAndSwapInt32(&r.paused, 0, 1) {
+			gohalt.Log("kafka reader consumption is paused: %v", err)
+		}
+		wait := r.poll
+		var rerr gohalt.ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			wait = rerr.After
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Writer defines kafka-go writer wrapper that throttles messages publishing,
+// all not throttled methods are delegated to the wrapped kafka-go writer.
+type Writer struct {
+	*kafka.Writer
+	thr gohalt.Throttler
+}
+
+// NewWriter creates kafka-go writer wrapper instance that acquires the provided throttler
+// before each messages write and releases it after the write.
+// Throttler context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe writes latency,
+// with `gohalt.WithWeight` set to the written messages count
+// and with `gohalt.WithKey` set to the writer topic or the first message topic if writer topic is not set.
+// Throttled writes fail with the throttling error without reaching kafka, release errors are only logged.
+func NewWriter(w *kafka.Writer, thr gohalt.Throttler) *Writer {
+	return &Writer{Writer: w, thr: thr}
+}
+
+// WriteMessages writes the provided messages with the wrapped writer unless throttled,
+// see `kafka.Writer.WriteMessages`.
+func (w *Writer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	topic := w.Writer.Topic
+	if topic == "" && len(msgs) > 0 {
+		topic = msgs[0].Topic
+	}
+	ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+	ctx = gohalt.WithKey(ctx, topic)
+	if len(msgs) > 1 {
+		ctx = gohalt.WithWeight(ctx, int64(len(msgs)))
+	}
+	defer release(w.thr, ctx)
+	if err := w.thr.Acquire(ctx); err != nil {
+		return err
+	}
+	return w.Writer.WriteMessages(ctx, msgs...)
+}
+
+func release(thr gohalt.Throttler, ctx context.Context) {
+	if err := thr.Release(ctx); err != nil {
+		gohalt.Log("kafka release error happened: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package gohaltkafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	kafka "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReader(t *testing.T) {
+	table := map[string]struct {
+		thr    gohalt.Throttler
+		paused bool
+	}{
+		"Kafka reader should fetch message on throttler pass": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"Kafka reader should resume consumption after throttler pass": {
+			thr: gohalt.NewThrottlerBefore(3),
+		},
+		"Kafka reader should pause consumption until context is done": {
+			thr:    gohalt.NewThrottlerEcho(errors.New("test")),
+			paused: true,
+		},
+		"Kafka reader should pause consumption for retry after duration": {
+			thr: gohalt.NewThrottlerEcho(gohalt.ErrorRetry{
+				Throttler: "test",
+				After:     time.Hour,
+				Err:       errors.New("test"),
+			}),
+			paused: true,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			r := NewReader(
+				kafka.NewReader(kafka.ReaderConfig{Brokers: []string{"127.0.0.1:1"}, Topic: "test"}),
+				tcase.thr,
+				time.Millisecond,
+			)
+			defer r.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := r.FetchMessage(ctx)
+			require.Equal(t, context.DeadlineExceeded, err)
+			require.Less(t, time.Since(start), time.Second)
+			require.Equal(t, tcase.paused, r.Paused())
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	table := map[string]struct {
+		thr gohalt.Throttler
+		err error
+	}{
+		"Kafka writer should write messages on throttler pass": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"Kafka writer should fail messages on throttler error": {
+			thr: gohalt.NewThrottlerEcho(errors.New("test")),
+			err: errors.New("test"),
+		},
+		"Kafka writer should fail messages on weighted throttler threshold": {
+			thr: gohalt.NewThrottlerSemaphore(1),
+			err: errors.New(`throttler "semaphore" has reached its threshold: false`),
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			w := NewWriter(&kafka.Writer{Addr: kafka.TCP("127.0.0.1:1"), Topic: "test", MaxAttempts: 1}, tcase.thr)
+			defer w.Close()
+			err := w.WriteMessages(context.Background(), kafka.Message{Value: []byte("test")}, kafka.Message{Value: []byte("test")})
+			require.Error(t, err)
+			if tcase.err != nil {
+				require.EqualError(t, err, tcase.err.Error())
+			} else {
+				require.NotEqual(t, "test", err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+// Package gohaltkubernetes provides kubernetes client-go integration for gohalt throttlers,
+// so operators and controllers could use adaptive gohalt policies where client-go expects its own rate limiters.
+package gohaltkubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/workqueue"
+)
+
+type wqlimiter struct {
+	thr      gohalt.Throttler
+	backoff  gohalt.Backoff
+	lock     sync.Mutex
+	requeues map[interface{}]int
+}
+
+// NewWorkqueueRateLimiter creates client-go workqueue rate limiter instance
+// that acquires the provided throttler on each item rate limited requeue and releases it right after the acquire.
+// Throttler context is stamped with `gohalt.WithTimestamp`
+// and with `gohalt.WithKey` set to the item string representation,
+// so keyed throttlers could limit requeues per item.
+// Not throttled items are requeued immediately, throttled items are requeued
+// after `gohalt.ErrorRetry` retry after duration if any or after the provided backoff delay
+// for the item requeues count otherwise, requeues are tracked until the item is forgotten.
+// Combine it with `workqueue.NewMaxOfRateLimiter` to keep per item failure backoff, release errors are only logged.
+func NewWorkqueueRateLimiter(thr gohalt.Throttler, backoff gohalt.Backoff) workqueue.RateLimiter {
+	return &wqlimiter{thr: thr, backoff: backoff, requeues: make(map[interface{}]int)}
+}
+
+func (l *wqlimiter) When(item interface{}) time.Duration {
+	l.lock.Lock()
+	l.requeues[item]++
+	attempt := l.requeues[item]
+	l.lock.Unlock()
+	ctx := context.Background()
+	ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+	ctx = gohalt.WithKey(ctx, fmt.Sprint(item))
+	err := l.thr.Acquire(ctx)
+	release(l.thr, ctx)
+	if err == nil {
+		return 0
+	}
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		return rerr.After
+	}
+	return l.backoff(uint64(attempt))
+}
+
+func (l *wqlimiter) Forget(item interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	delete(l.requeues, item)
+}
+
+func (l *wqlimiter) NumRequeues(item interface{}) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.requeues[item]
+}
+
+type fclimiter struct {
+	thr     gohalt.Throttler
+	qps     float32
+	poll    time.Duration
+	stopped int32
+}
+
+// NewFlowControlRateLimiter creates client-go flowcontrol rate limiter instance
+// that acquires the provided throttler on each token take and releases it right after the acquire,
+// so it could be used as rest config rate limiter for api server requests.
+// Throttler context is stamped with `gohalt.WithTimestamp`.
+// Blocking token takes wait for the specified poll interval or for `gohalt.ErrorRetry` retry after duration if any
+// before the next throttler acquire until the throttler passes or the context is done.
+// The provided qps is only reported back by `QPS` as gohalt throttlers don't expose their rate,
+// after `Stop` non blocking token takes always fail, release errors are only logged.
+func NewFlowControlRateLimiter(thr gohalt.Throttler, qps float32, poll time.Duration) flowcontrol.RateLimiter {
+	return &fclimiter{thr: thr, qps: qps, poll: poll}
+}
+
+func (l *fclimiter) TryAccept() bool {
+	if atomic.LoadInt32(&l.stopped) == 1 {
+		return false
+	}
+	return l.try(context.Background()) == nil
+}
+
+func (l *fclimiter) Accept() {
+	_ = l.Wait(context.Background())
+}
+
+func (l *fclimiter) Wait(ctx context.Context) error {
+	for {
+		err := l.try(ctx)
+		if err == nil {
+			return nil
+		}
+		wait := l.poll
+		var rerr gohalt.ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			wait = rerr.After
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *fclimiter) Stop() {
+	atomic.StoreInt32(&l.stopped, 1)
+}
+
+func (l *fclimiter) QPS() float32 {
+	return l.qps
+}
+
+func (l *fclimiter) try(ctx context.Context) error {
+	ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+	err := l.thr.Acquire(ctx)
+	release(l.thr, ctx)
+	return err
+}
+
+func release(thr gohalt.Throttler, ctx context.Context) {
+	if err := thr.Release(ctx); err != nil {
+		gohalt.Log("kubernetes rate limiter release error happened: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package gohaltkubernetes
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestWorkqueueRateLimiter(t *testing.T) {
+	err := errors.New("test")
+	table := map[string]struct {
+		thr    gohalt.Throttler
+		item   interface{}
+		delays []time.Duration
+	}{
+		"Workqueue rate limiter should requeue not throttled items immediately": {
+			thr:    gohalt.NewThrottlerEcho(nil),
+			item:   "test",
+			delays: []time.Duration{0, 0, 0},
+		},
+		"Workqueue rate limiter should backoff throttled items": {
+			thr:    gohalt.NewThrottlerEcho(err),
+			item:   "test",
+			delays: []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond},
+		},
+		"Workqueue rate limiter should delay throttled items with retry after": {
+			thr:    gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Second, Err: err}),
+			item:   "test",
+			delays: []time.Duration{time.Second, time.Second, time.Second},
+		},
+		"Workqueue rate limiter should throttle items by key": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^namespace/test$"), Throttler: gohalt.NewThrottlerAfter(1)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			item:   "namespace/test",
+			delays: []time.Duration{0, 2 * time.Millisecond, 3 * time.Millisecond},
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			limiter := NewWorkqueueRateLimiter(tcase.thr, func(attempt uint64) time.Duration {
+				return time.Duration(attempt) * time.Millisecond
+			})
+			delays := make([]time.Duration, 0, len(tcase.delays))
+			for range tcase.delays {
+				delays = append(delays, limiter.When(tcase.item))
+			}
+			require.Equal(t, tcase.delays, delays)
+			require.Equal(t, len(tcase.delays), limiter.NumRequeues(tcase.item))
+			require.Equal(t, 0, limiter.NumRequeues("other"))
+			limiter.Forget(tcase.item)
+			require.Equal(t, 0, limiter.NumRequeues(tcase.item))
+		})
+	}
+	t.Run("Workqueue rate limiter should be usable with workqueue", func(t *testing.T) {
+		queue := workqueue.NewRateLimitingQueue(NewWorkqueueRateLimiter(
+			gohalt.NewThrottlerEcho(nil),
+			gohalt.NewBackoffConstant(time.Hour),
+		))
+		defer queue.ShutDown()
+		queue.AddRateLimited("test")
+		item, shutdown := queue.Get()
+		require.False(t, shutdown)
+		require.Equal(t, "test", item)
+		queue.Forget(item)
+		queue.Done(item)
+		require.Equal(t, 0, queue.NumRequeues(item))
+	})
+}
+
+func TestFlowControlRateLimiter(t *testing.T) {
+	t.Run("Flow control rate limiter should accept tokens on throttler pass", func(t *testing.T) {
+		limiter := NewFlowControlRateLimiter(gohalt.NewThrottlerAfter(2), 10, time.Millisecond)
+		require.Equal(t, float32(10), limiter.QPS())
+		require.True(t, limiter.TryAccept())
+		limiter.Accept()
+		require.False(t, limiter.TryAccept())
+		limiter.Stop()
+		require.False(t, limiter.TryAccept())
+	})
+	t.Run("Flow control rate limiter should wait until throttler pass", func(t *testing.T) {
+		limiter := NewFlowControlRateLimiter(gohalt.NewThrottlerBefore(3), 10, time.Millisecond)
+		ts := time.Now()
+		require.NoError(t, limiter.Wait(context.Background()))
+		require.GreaterOrEqual(t, time.Since(ts), 3*time.Millisecond)
+	})
+	t.Run("Flow control rate limiter should stop waiting on context cancel", func(t *testing.T) {
+		limiter := NewFlowControlRateLimiter(gohalt.NewThrottlerEcho(gohalt.ErrorRetry{
+			Throttler: "test",
+			After:     time.Millisecond,
+			Err:       errors.New("test"),
+		}), 10, time.Hour)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.Equal(t, context.DeadlineExceeded, limiter.Wait(ctx))
+	})
+}
@@ -0,0 +1,222 @@
+// Package gohaltmemberlist provides hashicorp memberlist integration for gohalt throttlers,
+// so quota could be shared across replicas joined into single gossip cluster without any central store.
+package gohaltmemberlist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/hashicorp/memberlist"
+)
+
+type strpair struct {
+	current   uint64
+	threshold uint64
+}
+
+func (p strpair) String() string {
+	return fmt.Sprintf("%d out of %d", p.current, p.threshold)
+}
+
+type state struct {
+	Node   string `json:"node"`
+	Window int64  `json:"window"`
+	Count  uint64 `json:"count"`
+}
+
+type broadcast []byte
+
+func (broadcast) Invalidates(memberlist.Broadcast) bool {
+	return true
+}
+
+func (b broadcast) Message() []byte {
+	return b
+}
+
+func (broadcast) Finished() {}
+
+type tgossip struct {
+	clock     gohalt.Clock
+	cfg       memberlist.Config
+	peers     []string
+	list      *memberlist.Memberlist
+	queue     *memberlist.TransmitLimitedQueue
+	name      string
+	threshold uint64
+	interval  time.Duration
+	join      sync.Mutex
+	lock      sync.Mutex
+	local     state
+	remote    map[string]state
+}
+
+// NewThrottlerGossip creates new throttler instance that
+// throttles each call which exeeds the quota q defined by the specified threshold in the specified interval
+// approximately across all replicas joined into single gossip cluster via memberlist with the provided config and peers.
+// Quota is counted in fixed interval windows aligned to unix epoch,
+// zero interval means that quota is counted in single never expiring window.
+// each replica enforces the quota locally against its own consumption
+// and the latest consumption gossiped by other replicas, so no central store is involved.
+// Replica consumption is piggybacked on memberlist gossip messages and fully exchanged on memberlist push pull,
+// so the quota converges within few gossip intervals and could be slightly exceeded meanwhile.
+// Memberlist is created and joined to the provided peers on first acquire,
+// only successful memberlist creations are kept and join failures are only logged.
+// Use `gohalt.WithWeight` to override context call qunatity, 1 by default.
+// - could return `gohalt.ErrorThreshold`;
+// - could return `gohalt.ErrorInternal`;
+func NewThrottlerGossip(
+	cfg *memberlist.Config,
+	peers []string,
+	threshold uint64,
+	interval time.Duration,
+) gohalt.Throttler {
+	thr := &tgossip{
+		cfg:       *cfg,
+		peers:     peers,
+		name:      cfg.Name,
+		threshold: threshold,
+		interval:  interval,
+		remote:    make(map[string]state),
+	}
+	thr.local.Node = cfg.Name
+	thr.cfg.Delegate = thr
+	thr.queue = &memberlist.TransmitLimitedQueue{
+		NumNodes: func() int {
+			thr.lock.Lock()
+			defer thr.lock.Unlock()
+			if thr.list == nil {
+				return 1
+			}
+			return thr.list.NumMembers()
+		},
+		RetransmitMult: cfg.RetransmitMult,
+	}
+	return thr
+}
+
+func (thr *tgossip) Acquire(ctx context.Context) error {
+	if err := thr.connect(); err != nil {
+		return gohalt.ErrorInternal{
+			Throttler: "gossip",
+			Message:   err.Error(),
+		}
+	}
+	weight := uint64(gohalt.Weight(ctx))
+	var window int64
+	if thr.interval > 0 {
+		// gossip windows are aligned to wall time shared across replicas, so clock jumps need no resynchronization.
+		now, _ := thr.clock.Now("gossip")
+		window = now.UnixNano() / int64(thr.interval)
+	}
+	thr.lock.Lock()
+	if thr.local.Window != window {
+		thr.local.Window, thr.local.Count = window, 0
+	}
+	current := thr.local.Count + weight
+	for _, state := range thr.remote {
+		if state.Window == window {
+			current += state.Count
+		}
+	}
+	if current > thr.threshold {
+		thr.lock.Unlock()
+		return gohalt.ErrorThreshold{
+			Throttler: "gossip",
+			Threshold: strpair{current: current, threshold: thr.threshold},
+		}
+	}
+	thr.local.Count += weight
+	local := thr.local
+	thr.lock.Unlock()
+	if msg, err := json.Marshal(local); err == nil {
+		thr.queue.QueueBroadcast(broadcast(msg))
+	}
+	return nil
+}
+
+func (thr *tgossip) Release(context.Context) error {
+	return nil
+}
+
+func (thr *tgossip) NodeMeta(int) []byte {
+	return nil
+}
+
+func (thr *tgossip) NotifyMsg(msg []byte) {
+	var state state
+	if err := json.Unmarshal(msg, &state); err != nil {
+		gohalt.Log("gossip throttler message error happened: %v", err)
+		return
+	}
+	thr.merge(state)
+}
+
+func (thr *tgossip) GetBroadcasts(overhead int, limit int) [][]byte {
+	return thr.queue.GetBroadcasts(overhead, limit)
+}
+
+func (thr *tgossip) LocalState(bool) []byte {
+	thr.lock.Lock()
+	states := make([]state, 0, len(thr.remote)+1)
+	states = append(states, thr.local)
+	for _, state := range thr.remote {
+		states = append(states, state)
+	}
+	thr.lock.Unlock()
+	msg, _ := json.Marshal(states)
+	return msg
+}
+
+func (thr *tgossip) MergeRemoteState(msg []byte, _ bool) {
+	var states []state
+	if err := json.Unmarshal(msg, &states); err != nil {
+		gohalt.Log("gossip throttler state error happened: %v", err)
+		return
+	}
+	for _, state := range states {
+		thr.merge(state)
+	}
+}
+
+// connect creates memberlist and joins it to the peers unless memberlist is already created.
+func (thr *tgossip) connect() error {
+	thr.join.Lock()
+	defer thr.join.Unlock()
+	thr.lock.Lock()
+	created := thr.list != nil
+	thr.lock.Unlock()
+	if created {
+		return nil
+	}
+	list, err := memberlist.Create(&thr.cfg)
+	if err != nil {
+		return err
+	}
+	thr.lock.Lock()
+	thr.list = list
+	thr.lock.Unlock()
+	if len(thr.peers) > 0 {
+		if _, err := list.Join(thr.peers); err != nil {
+			gohalt.Log("gossip throttler join error happened: %v", err)
+		}
+	}
+	return nil
+}
+
+// merge keeps only the latest known consumption of other replicas.
+func (thr *tgossip) merge(state state) {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	if state.Node == thr.name {
+		return
+	}
+	prev, ok := thr.remote[state.Node]
+	if !ok || state.Window > prev.Window || (state.Window == prev.Window && state.Count > prev.Count) {
+		thr.remote[state.Node] = state
+	}
+}
@@ -0,0 +1,62 @@
+package gohaltmemberlist
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottlerGossip(t *testing.T) {
+	config := func(name string) *memberlist.Config {
+		cfg := memberlist.DefaultLocalConfig()
+		cfg.Name = name
+		cfg.BindAddr = "127.0.0.1"
+		cfg.BindPort = 0
+		cfg.GossipInterval = time.Millisecond
+		cfg.LogOutput = io.Discard
+		return cfg
+	}
+	ctx := context.TODO()
+	first := NewThrottlerGossip(config("first"), nil, 3, time.Hour)
+	require.NoError(t, first.Acquire(ctx))
+	list := first.(*tgossip).list
+	defer func() { _ = list.Shutdown() }()
+	second := NewThrottlerGossip(config("second"), []string{list.LocalNode().Address()}, 3, time.Hour)
+	require.NoError(t, second.Acquire(ctx))
+	defer func() { _ = second.(*tgossip).list.Shutdown() }()
+	remote := func(thr gohalt.Throttler, node string) uint64 {
+		thr.(*tgossip).lock.Lock()
+		defer thr.(*tgossip).lock.Unlock()
+		return thr.(*tgossip).remote[node].Count
+	}
+	// non positive weights are counted as single call
+	require.NoError(t, first.Acquire(gohalt.WithWeight(ctx, -1)))
+	require.Eventually(t, func() bool {
+		return remote(first, "second") == 1 && remote(second, "first") == 2
+	}, time.Second, time.Millisecond)
+	err := gohalt.ErrorThreshold{
+		Throttler: "gossip",
+		Threshold: strpair{current: 4, threshold: 3},
+	}
+	require.Equal(t, err, first.Acquire(ctx))
+	require.Equal(t, err, second.Acquire(ctx))
+	require.NoError(t, first.Release(ctx))
+	cfg := config("third")
+	cfg.BindPort = int(list.LocalNode().Port)
+	third := NewThrottlerGossip(cfg, nil, 1, time.Hour)
+	require.Equal(t, "gossip", third.Acquire(ctx).(gohalt.ErrorInternal).Throttler)
+	require.Nil(t, third.(*tgossip).list)
+	// zero interval quota is counted in single window.
+	single := NewThrottlerGossip(config("single"), nil, 1, 0)
+	require.NoError(t, single.Acquire(ctx))
+	defer func() { _ = single.(*tgossip).list.Shutdown() }()
+	require.Equal(t, gohalt.ErrorThreshold{
+		Throttler: "gossip",
+		Threshold: strpair{current: 2, threshold: 1},
+	}, single.Acquire(ctx))
+}
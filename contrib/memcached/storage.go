@@ -0,0 +1,148 @@
+// Package gohaltmemcached provides memcached integration for gohalt throttlers,
+// so existing memcached fleets could keep shared state of gohalt storage throttlers.
+package gohaltmemcached
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+type storage struct {
+	client *memcache.Client
+}
+
+// NewStorage creates memcached storage instance
+// which keeps all keys in memcached reached by the provided client.
+// All updates are done via memcached check and set operations,
+// keys expiration is kept as absolute unix timestamp rounded up to the next second,
+// so check and set counters updates keep the expiration defined on the key creation
+// and counters windows expire aligned to the throttler quantum.
+// Use `gohalt.NewStorageRetried` to retry failed storage operations.
+func NewStorage(client *memcache.Client) gohalt.Storage {
+	return storage{client: client}
+}
+
+func (stg storage) Get(_ context.Context, key string) ([]byte, bool, error) {
+	item, err := stg.client.Get(key)
+	switch {
+	case errors.Is(err, memcache.ErrCacheMiss):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	default:
+		return item.Value, true, nil
+	}
+}
+
+func (stg storage) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	return stg.client.Set(stg.item(key, value, ttl))
+}
+
+func (stg storage) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		item, err := stg.client.Get(key)
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			err := stg.client.Add(stg.item(key, []byte(strconv.FormatInt(delta, 10)), ttl))
+			if errors.Is(err, memcache.ErrNotStored) {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			return delta, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		current, err := strconv.ParseInt(string(item.Value), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		// keep expiration defined on the key creation.
+		item.Value = []byte(strconv.FormatInt(current+delta, 10))
+		item.Expiration = int32(item.Flags)
+		err = stg.client.CompareAndSwap(item)
+		if errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrNotStored) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return current + delta, nil
+	}
+}
+
+func (stg storage) CompareAndSwap(
+	_ context.Context,
+	key string,
+	old []byte,
+	new []byte,
+	ttl time.Duration,
+) (bool, error) {
+	if old == nil {
+		if new == nil {
+			_, err := stg.client.Get(key)
+			if errors.Is(err, memcache.ErrCacheMiss) {
+				return true, nil
+			}
+			return false, err
+		}
+		err := stg.client.Add(stg.item(key, new, ttl))
+		if errors.Is(err, memcache.ErrNotStored) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	item, err := stg.client.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(old, item.Value) {
+		return false, nil
+	}
+	if new == nil {
+		// negative expiration atomically expires the key.
+		item.Expiration, item.Flags = -1, 0
+	} else {
+		next := stg.item(key, new, ttl)
+		item.Value, item.Expiration, item.Flags = next.Value, next.Expiration, next.Flags
+	}
+	err = stg.client.CompareAndSwap(item)
+	if errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrNotStored) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (stg storage) Delete(_ context.Context, key string) error {
+	if err := stg.client.Delete(key); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return err
+	}
+	return nil
+}
+
+// item creates memcached item with absolute expiration kept in item flags.
+func (stg storage) item(key string, value []byte, ttl time.Duration) *memcache.Item {
+	item := &memcache.Item{Key: key, Value: value}
+	if ttl > 0 {
+		deadline := time.Now().UTC().Add(ttl)
+		expiration := deadline.Unix()
+		if deadline.Nanosecond() > 0 {
+			expiration++
+		}
+		item.Expiration, item.Flags = int32(expiration), uint32(expiration)
+	}
+	return item
+}
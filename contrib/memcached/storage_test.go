@@ -0,0 +1,244 @@
+package gohaltmemcached
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/stretchr/testify/require"
+)
+
+type titem struct {
+	value    []byte
+	flags    uint32
+	cas      uint64
+	deadline int64
+}
+
+// tmemcached defines in process memcached server fake
+// that serves text protocol commands used by the storage.
+type tmemcached struct {
+	lock     sync.Mutex
+	items    map[string]titem
+	cas      uint64
+	offset   int64
+	conflict bool
+}
+
+func (mc *tmemcached) serve(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go mc.handle(conn)
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func (mc *tmemcached) handle(conn net.Conn) {
+	defer conn.Close()
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	for {
+		line, err := rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return
+		}
+		var value []byte
+		if cmd := fields[0]; cmd == "set" || cmd == "add" || cmd == "cas" {
+			size, _ := strconv.Atoi(fields[4])
+			value = make([]byte, size+2)
+			if _, err := io.ReadFull(rw, value); err != nil {
+				return
+			}
+			value = value[:size]
+		}
+		mc.exec(rw, fields, value)
+		if err := rw.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (mc *tmemcached) exec(w io.Writer, fields []string, value []byte) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	now := time.Now().Unix() + mc.offset
+	for key, item := range mc.items {
+		if item.deadline != 0 && item.deadline <= now {
+			delete(mc.items, key)
+		}
+	}
+	switch cmd, key := fields[0], fields[1]; cmd {
+	case "gets":
+		for _, key := range fields[1:] {
+			if item, ok := mc.items[key]; ok {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n%s\r\n", key, item.flags, len(item.value), item.cas, item.value)
+			}
+		}
+		fmt.Fprint(w, "END\r\n")
+	case "delete":
+		if _, ok := mc.items[key]; !ok {
+			fmt.Fprint(w, "NOT_FOUND\r\n")
+			return
+		}
+		delete(mc.items, key)
+		fmt.Fprint(w, "DELETED\r\n")
+	default:
+		current, ok := mc.items[key]
+		switch {
+		case cmd == "add" && ok:
+			fmt.Fprint(w, "NOT_STORED\r\n")
+			return
+		case cmd == "cas" && !ok:
+			fmt.Fprint(w, "NOT_FOUND\r\n")
+			return
+		case cmd == "cas" && (mc.conflict || fields[5] != strconv.FormatUint(current.cas, 10)):
+			// inject single concurrent update conflict.
+			mc.conflict = false
+			mc.cas++
+			current.cas = mc.cas
+			mc.items[key] = current
+			fmt.Fprint(w, "EXISTS\r\n")
+			return
+		}
+		flags, _ := strconv.ParseUint(fields[2], 10, 32)
+		exp, _ := strconv.ParseInt(fields[3], 10, 64)
+		mc.cas++
+		item := titem{value: value, flags: uint32(flags), cas: mc.cas}
+		switch {
+		case exp < 0:
+			item.deadline = now
+		case exp > 30*24*60*60:
+			item.deadline = exp
+		case exp > 0:
+			item.deadline = now + exp
+		}
+		mc.items[key] = item
+		fmt.Fprint(w, "STORED\r\n")
+	}
+}
+
+func (mc *tmemcached) item(key string) (titem, bool) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	item, ok := mc.items[key]
+	return item, ok
+}
+
+func (mc *tmemcached) forward(dur time.Duration) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	mc.offset += int64(dur / time.Second)
+}
+
+func TestStorage(t *testing.T) {
+	server := &tmemcached{items: make(map[string]titem)}
+	stg := NewStorage(memcache.New(server.serve(t)))
+	ctx := context.TODO()
+	t.Run("Memcached storage should get set and delete keys", func(t *testing.T) {
+		_, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, stg.Set(ctx, "key", []byte("val"), 0))
+		val, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("val"), val)
+		require.NoError(t, stg.Delete(ctx, "key"))
+		_, ok, _ = stg.Get(ctx, "key")
+		require.False(t, ok)
+		require.NoError(t, stg.Delete(ctx, "key"))
+	})
+	t.Run("Memcached storage should increment counters with check and set", func(t *testing.T) {
+		cnt, err := stg.Incr(ctx, "cnt", 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cnt)
+		// concurrent update conflict is retried with fresh counter.
+		server.lock.Lock()
+		server.conflict = true
+		server.lock.Unlock()
+		cnt, err = stg.Incr(ctx, "cnt", -3, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(-1), cnt)
+		require.NoError(t, stg.Set(ctx, "cnt", []byte("nan"), 0))
+		_, err = stg.Incr(ctx, "cnt", 1, 0)
+		require.Error(t, err)
+		cctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = stg.Incr(cctx, "cnt", 1, 0)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+	t.Run("Memcached storage should compare and swap keys", func(t *testing.T) {
+		swapped, err := stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.NoError(t, err)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, nil, 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("old"), 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, nil, 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.True(t, swapped)
+		val, _, _ := stg.Get(ctx, "cas")
+		require.Equal(t, []byte("new"), val)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), nil, 0)
+		require.True(t, swapped)
+		_, ok, _ := stg.Get(ctx, "cas")
+		require.False(t, ok)
+	})
+	t.Run("Memcached storage should expire keys at absolute deadlines", func(t *testing.T) {
+		require.NoError(t, stg.Set(ctx, "ttl", []byte("val"), time.Second))
+		_, _ = stg.Incr(ctx, "ttlcnt", 1, time.Second)
+		created, _ := server.item("ttlcnt")
+		require.Greater(t, created.deadline, time.Now().Unix())
+		require.Equal(t, uint32(created.deadline), created.flags)
+		cnt, _ := stg.Incr(ctx, "ttlcnt", 1, time.Hour)
+		require.Equal(t, int64(2), cnt)
+		updated, _ := server.item("ttlcnt")
+		require.Equal(t, created.deadline, updated.deadline)
+		swapped, _ := stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("val"), time.Second)
+		require.True(t, swapped)
+		server.forward(3 * time.Second)
+		_, ok, _ := stg.Get(ctx, "ttl")
+		require.False(t, ok)
+		_, ok, _ = stg.Get(ctx, "ttlcas")
+		require.False(t, ok)
+		cnt, _ = stg.Incr(ctx, "ttlcnt", 1, 0)
+		require.Equal(t, int64(1), cnt)
+	})
+	t.Run("Memcached storage should fail on unreachable server", func(t *testing.T) {
+		stg := gohalt.NewStorageRetried(NewStorage(memcache.New("127.0.0.1:1")), 1)
+		_, _, err := stg.Get(ctx, "key")
+		require.Error(t, err)
+		require.Error(t, stg.Set(ctx, "key", nil, 0))
+		_, err = stg.Incr(ctx, "key", 1, 0)
+		require.Error(t, err)
+		_, err = stg.CompareAndSwap(ctx, "key", nil, nil, 0)
+		require.Error(t, err)
+		require.Error(t, stg.Delete(ctx, "key"))
+	})
+}
@@ -0,0 +1,93 @@
+// Package gohaltnats provides nats jetstream integration for gohalt throttlers,
+// so jetstream consumers could delay throttled messages instead of failing them
+// and jetstream key value buckets could keep shared state of gohalt storage throttlers.
+package gohaltnats
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// Handler defines jetstream consumer messages handler wrapper
+// that throttles messages handling and provides pull consumer batch size hint.
+type Handler struct {
+	handler jetstream.MessageHandler
+	thr     gohalt.Throttler
+	delay   time.Duration
+	max     int64
+	batch   int64
+}
+
+// NewHandler creates jetstream consumer messages handler wrapper instance
+// that acquires the provided throttler before each message is handled by the provided handler
+// and releases it after the message is handled, use `Handler.Handle` with `jetstream.Consumer.Consume`.
+// Throttled messages are not handled, instead they are naked with the specified delay
+// or with `gohalt.ErrorRetry` retry after duration if any, so jetstream redelivers them later.
+// Throttler context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe messages handling latency,
+// and with `gohalt.WithKey` set to the message subject,
+// so `pattern` and `router` throttlers could select throttler per subject.
+// Specified max batch size is used as upper bound for `Handler.Batch` pull consumer batch size hint.
+// Nak and release errors are only logged.
+func NewHandler(handler jetstream.MessageHandler, thr gohalt.Throttler, delay time.Duration, batch int) *Handler {
+	if batch < 1 {
+		batch = 1
+	}
+	return &Handler{handler: handler, thr: thr, delay: delay, max: int64(batch), batch: int64(batch)}
+}
+
+// Handle handles the provided jetstream message unless throttled.
+func (h *Handler) Handle(msg jetstream.Msg) {
+	ctx := gohalt.WithTimestamp(context.Background(), time.Now().UTC())
+	ctx = gohalt.WithKey(ctx, msg.Subject())
+	defer func() {
+		if err := h.thr.Release(ctx); err != nil {
+			gohalt.Log("nats handler release error happened: %v", err)
+		}
+	}()
+	if err := h.thr.Acquire(ctx); err != nil {
+		h.adjust(false)
+		delay := h.delay
+		var rerr gohalt.ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			delay = rerr.After
+		}
+		if err := msg.NakWithDelay(delay); err != nil {
+			gohalt.Log("nats handler nak error happened: %v", err)
+		}
+		return
+	}
+	h.adjust(true)
+	h.handler(msg)
+}
+
+// Batch returns pull consumer batch size hint for `jetstream.Consumer.Fetch`,
+// batch size is halved on each throttled message and ramped back up by one
+// on each handled message until it reaches the max batch size.
+func (h *Handler) Batch() int {
+	return int(atomic.LoadInt64(&h.batch))
+}
+
+func (h *Handler) adjust(pass bool) {
+	for {
+		batch := atomic.LoadInt64(&h.batch)
+		next := batch / 2
+		if pass {
+			next = batch + 1
+		}
+		if next < 1 {
+			next = 1
+		}
+		if next > h.max {
+			next = h.max
+		}
+		if next == batch || atomic.CompareAndSwapInt64(&h.batch, batch, next) {
+			return
+		}
+	}
+}
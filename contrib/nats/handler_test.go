@@ -0,0 +1,59 @@
+package gohaltnats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	require.NoError(t, err)
+	ns.Start()
+	t.Cleanup(ns.Shutdown)
+	require.True(t, ns.ReadyForConnections(time.Second))
+	conn, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = js.CreateStream(ctx, jetstream.StreamConfig{Name: "test", Subjects: []string{"test.>"}})
+	require.NoError(t, err)
+	cons, err := js.CreateConsumer(ctx, "test", jetstream.ConsumerConfig{Durable: "test", AckPolicy: jetstream.AckExplicitPolicy})
+	require.NoError(t, err)
+	_, err = js.Publish(ctx, "test.a", []byte("test"))
+	require.NoError(t, err)
+	var delivered []uint64
+	h := NewHandler(func(msg jetstream.Msg) {
+		meta, err := msg.Metadata()
+		require.NoError(t, err)
+		delivered = append(delivered, meta.NumDelivered)
+		require.NoError(t, msg.Ack())
+	}, gohalt.NewThrottlerBefore(1), 10*time.Millisecond, 4)
+	require.Equal(t, 4, h.Batch())
+	fetch := func() int {
+		batch, err := cons.FetchNoWait(h.Batch())
+		require.NoError(t, err)
+		var count int
+		for msg := range batch.Messages() {
+			h.Handle(msg)
+			count++
+		}
+		return count
+	}
+	require.Equal(t, 1, fetch())
+	require.Empty(t, delivered)
+	require.Equal(t, 2, h.Batch())
+	require.Equal(t, 0, fetch())
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 1, fetch())
+	require.Equal(t, []uint64{2}, delivered)
+	require.Equal(t, 3, h.Batch())
+}
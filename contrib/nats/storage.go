@@ -0,0 +1,156 @@
+package gohaltnats
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+type storage struct {
+	kv jetstream.KeyValue
+}
+
+// NewStorage creates nats storage instance
+// which keeps all keys in jetstream key value bucket reached by the provided key value handle,
+// bucket is expected to keep single history entry, e.g. created with `jetstream.KeyValueConfig{History: 1}`.
+// All updates are done via bucket revision checks, keys are base64 encoded to fit bucket keys charset.
+// Key values are prefixed with their expiration timestamp, expired keys are ignored and deleted on access,
+// so bucket max age could be configured to purge never accessed expired keys.
+// Use `gohalt.NewStorageRetried` to retry failed storage operations.
+func NewStorage(kv jetstream.KeyValue) gohalt.Storage {
+	return storage{kv: kv}
+}
+
+func (stg storage) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	raw, _, ok, err := stg.current(ctx, key)
+	if !ok {
+		return nil, false, err
+	}
+	return raw[8:], true, nil
+}
+
+func (stg storage) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := stg.kv.Put(ctx, stg.key(key), stg.value(value, ttl))
+	return err
+}
+
+func (stg storage) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	for {
+		raw, revision, ok, err := stg.current(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		count := delta
+		value := stg.value([]byte(strconv.FormatInt(count, 10)), ttl)
+		if ok {
+			current, err := strconv.ParseInt(string(raw[8:]), 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			// ttl is applied only on the key creation.
+			count = current + delta
+			value = append(raw[:8:8], strconv.FormatInt(count, 10)...)
+		}
+		swapped, err := stg.swap(ctx, key, value, revision)
+		if err != nil {
+			return 0, err
+		}
+		if swapped {
+			return count, nil
+		}
+	}
+}
+
+func (stg storage) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	old []byte,
+	new []byte,
+	ttl time.Duration,
+) (bool, error) {
+	raw, revision, ok, err := stg.current(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if ok != (old != nil) || (ok && !bytes.Equal(raw[8:], old)) {
+		return false, nil
+	}
+	switch {
+	case old == nil && new == nil:
+		return true, nil
+	case new == nil:
+		err := stg.kv.Delete(ctx, stg.key(key), jetstream.LastRevision(revision))
+		if errors.Is(err, jetstream.ErrKeyExists) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return stg.swap(ctx, key, stg.value(new, ttl), revision)
+	}
+}
+
+func (stg storage) Delete(ctx context.Context, key string) error {
+	return stg.kv.Delete(ctx, stg.key(key))
+}
+
+// current returns the key raw value with its expiration prefix and revision
+// and whether the key exists and is not expired yet, expired key is deleted
+// and its revision is reset as for missing key.
+func (stg storage) current(ctx context.Context, key string) ([]byte, uint64, bool, error) {
+	entry, err := stg.kv.Get(ctx, stg.key(key))
+	switch {
+	case errors.Is(err, jetstream.ErrKeyNotFound):
+		return nil, 0, false, nil
+	case err != nil:
+		return nil, 0, false, err
+	}
+	raw := entry.Value()
+	if len(raw) < 8 {
+		return nil, 0, false, fmt.Errorf("nats key %q value is malformed", key)
+	}
+	if deadline := int64(binary.BigEndian.Uint64(raw)); deadline > 0 && deadline <= time.Now().UTC().UnixNano() {
+		err := stg.kv.Delete(ctx, stg.key(key), jetstream.LastRevision(entry.Revision()))
+		if err != nil && !errors.Is(err, jetstream.ErrKeyExists) {
+			return nil, 0, false, err
+		}
+		return nil, 0, false, nil
+	}
+	return raw, entry.Revision(), true, nil
+}
+
+// swap writes the key raw value only if the key revision is still the same,
+// zero revision means that the key is expected to be missing.
+func (stg storage) swap(ctx context.Context, key string, value []byte, revision uint64) (bool, error) {
+	var err error
+	if revision == 0 {
+		_, err = stg.kv.Create(ctx, stg.key(key), value)
+	} else {
+		_, err = stg.kv.Update(ctx, stg.key(key), value, revision)
+	}
+	if errors.Is(err, jetstream.ErrKeyExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (stg storage) key(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// value returns the key raw value prefixed with its expiration unix nano timestamp,
+// zero timestamp means that the key never expires.
+func (stg storage) value(value []byte, ttl time.Duration) []byte {
+	raw := make([]byte, 8, 8+len(value))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(raw, uint64(time.Now().UTC().Add(ttl).UnixNano()))
+	}
+	return append(raw, value...)
+}
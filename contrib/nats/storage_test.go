@@ -0,0 +1,113 @@
+package gohaltnats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	ns, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	require.NoError(t, err)
+	ns.Start()
+	t.Cleanup(ns.Shutdown)
+	require.True(t, ns.ReadyForConnections(time.Second))
+	conn, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	defer conn.Close()
+	js, err := jetstream.New(conn)
+	require.NoError(t, err)
+	ctx := context.TODO()
+	kv, err := js.CreateKeyValue(ctx, jetstream.KeyValueConfig{Bucket: "gohalt", History: 1})
+	require.NoError(t, err)
+	stg := NewStorage(kv)
+	t.Run("NATS storage should get set and delete keys", func(t *testing.T) {
+		_, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, stg.Set(ctx, "key", []byte("val"), 0))
+		val, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("val"), val)
+		require.NoError(t, stg.Delete(ctx, "key"))
+		_, ok, _ = stg.Get(ctx, "key")
+		require.False(t, ok)
+	})
+	t.Run("NATS storage should encode keys to fit bucket keys charset", func(t *testing.T) {
+		require.NoError(t, stg.Set(ctx, "gohalt_after:some key/*", []byte("val"), 0))
+		val, ok, err := stg.Get(ctx, "gohalt_after:some key/*")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("val"), val)
+	})
+	t.Run("NATS storage should increment counters with revision checks", func(t *testing.T) {
+		cnt, err := stg.Incr(ctx, "cnt", 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cnt)
+		cnt, err = stg.Incr(ctx, "cnt", -3, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(-1), cnt)
+		require.NoError(t, stg.Set(ctx, "cnt", []byte("nan"), 0))
+		_, err = stg.Incr(ctx, "cnt", 1, 0)
+		require.Error(t, err)
+	})
+	t.Run("NATS storage should compare and swap keys with revision checks", func(t *testing.T) {
+		swapped, err := stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.NoError(t, err)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, nil, 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("old"), 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.True(t, swapped)
+		val, _, _ := stg.Get(ctx, "cas")
+		require.Equal(t, []byte("new"), val)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), nil, 0)
+		require.True(t, swapped)
+		_, ok, _ := stg.Get(ctx, "cas")
+		require.False(t, ok)
+	})
+	t.Run("NATS storage should expire keys by value deadlines", func(t *testing.T) {
+		require.NoError(t, stg.Set(ctx, "ttl", []byte("val"), time.Millisecond))
+		_, _ = stg.Incr(ctx, "ttlcnt", 1, time.Millisecond)
+		swapped, _ := stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("val"), time.Millisecond)
+		require.True(t, swapped)
+		time.Sleep(2 * time.Millisecond)
+		_, ok, _ := stg.Get(ctx, "ttl")
+		require.False(t, ok)
+		swapped, _ = stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("new"), 0)
+		require.True(t, swapped)
+		cnt, _ := stg.Incr(ctx, "ttlcnt", 1, 0)
+		require.Equal(t, int64(1), cnt)
+	})
+	t.Run("NATS storage should fail on closed connection", func(t *testing.T) {
+		conn, err := nats.Connect(ns.ClientURL())
+		require.NoError(t, err)
+		js, err := jetstream.New(conn)
+		require.NoError(t, err)
+		kv, err := js.KeyValue(ctx, "gohalt")
+		require.NoError(t, err)
+		conn.Close()
+		stg := gohalt.NewStorageRetried(NewStorage(kv), 1)
+		_, _, err = stg.Get(ctx, "key")
+		require.Error(t, err)
+		require.Error(t, stg.Set(ctx, "key", nil, 0))
+		_, err = stg.Incr(ctx, "key", 1, 0)
+		require.Error(t, err)
+		_, err = stg.CompareAndSwap(ctx, "key", nil, nil, 0)
+		require.Error(t, err)
+		require.Error(t, stg.Delete(ctx, "key"))
+	})
+}
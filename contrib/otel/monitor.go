@@ -0,0 +1,120 @@
+// Package gohaltotel provides opentelemetry metrics integration for gohalt throttlers,
+// so services already instrumented with opentelemetry could drive monitor throttlers without a second stats pipeline.
+package gohaltotel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// Setter defines stats field setter that assigns the provided instrument value to the stats.
+type Setter func(*gohalt.Stats, float64)
+
+type monitor struct {
+	reader  metric.Reader
+	setters map[string]Setter
+	cache   time.Duration
+	lock    sync.Mutex
+	stats   gohalt.Stats
+	ts      time.Time
+}
+
+// NewMonitor creates opentelemetry monitor instance
+// with cache interval defined by the provided duration
+// that collects metrics from the provided in-process reader, e.g. `metric.NewManualReader`
+// registered with the service meter provider alongside its exporters,
+// and assigns instruments values to the stats with the provided setters keyed by instrument names.
+// Gauge instruments value is the max value among data points,
+// sum instruments value is the sum of data points values
+// and histogram instruments value is the mean of data points observations,
+// so use delta temporality reader for histograms to observe the mean since the previous collect.
+// Instruments without setters are ignored and instruments with setters that are not collected
+// leave the related stats fields zero valued, so they don't affect stats comparison.
+// Only successful stats results are cached.
+func NewMonitor(reader metric.Reader, setters map[string]Setter, cache time.Duration) gohalt.Monitor {
+	return &monitor{reader: reader, setters: setters, cache: cache}
+}
+
+func (mnt *monitor) Stats(ctx context.Context) (gohalt.Stats, error) {
+	mnt.lock.Lock()
+	defer mnt.lock.Unlock()
+	if !mnt.ts.IsZero() && time.Since(mnt.ts) < mnt.cache {
+		return mnt.stats, nil
+	}
+	var rm metricdata.ResourceMetrics
+	if err := mnt.reader.Collect(ctx, &rm); err != nil {
+		return mnt.stats, err
+	}
+	var stats gohalt.Stats
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			set, ok := mnt.setters[m.Name]
+			if !ok {
+				continue
+			}
+			value, err := aggregate(m.Data)
+			if err != nil {
+				return mnt.stats, fmt.Errorf("instrument %q: %w", m.Name, err)
+			}
+			set(&stats, value)
+		}
+	}
+	mnt.stats, mnt.ts = stats, time.Now()
+	return mnt.stats, nil
+}
+
+func aggregate(data metricdata.Aggregation) (float64, error) {
+	switch data := data.(type) {
+	case metricdata.Gauge[int64]:
+		return gauge(data.DataPoints), nil
+	case metricdata.Gauge[float64]:
+		return gauge(data.DataPoints), nil
+	case metricdata.Sum[int64]:
+		return sum(data.DataPoints), nil
+	case metricdata.Sum[float64]:
+		return sum(data.DataPoints), nil
+	case metricdata.Histogram[int64]:
+		return histogram(data.DataPoints), nil
+	case metricdata.Histogram[float64]:
+		return histogram(data.DataPoints), nil
+	default:
+		return 0, fmt.Errorf("unsupported aggregation %T", data)
+	}
+}
+
+func gauge[N int64 | float64](points []metricdata.DataPoint[N]) float64 {
+	var value float64
+	for i, point := range points {
+		if v := float64(point.Value); i == 0 || v > value {
+			value = v
+		}
+	}
+	return value
+}
+
+func sum[N int64 | float64](points []metricdata.DataPoint[N]) float64 {
+	var value float64
+	for _, point := range points {
+		value += float64(point.Value)
+	}
+	return value
+}
+
+func histogram[N int64 | float64](points []metricdata.HistogramDataPoint[N]) float64 {
+	var total float64
+	var count uint64
+	for _, point := range points {
+		total += float64(point.Sum)
+		count += point.Count
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
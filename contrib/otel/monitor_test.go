@@ -0,0 +1,63 @@
+package gohaltotel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestMonitor(t *testing.T) {
+	ctx := context.Background()
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+	defer func() {
+		_ = provider.Shutdown(ctx)
+	}()
+	meter := provider.Meter("test")
+	inflight, err := meter.Int64UpDownCounter("inflight")
+	require.NoError(t, err)
+	latency, err := meter.Float64Histogram("latency")
+	require.NoError(t, err)
+	_, err = meter.Float64ObservableGauge("cpu", otelmetric.WithFloat64Callback(
+		func(_ context.Context, obs otelmetric.Float64Observer) error {
+			obs.Observe(0.4, otelmetric.WithAttributes(attribute.String("core", "0")))
+			obs.Observe(0.8, otelmetric.WithAttributes(attribute.String("core", "1")))
+			return nil
+		},
+	))
+	require.NoError(t, err)
+	ignored, err := meter.Int64Counter("ignored")
+	require.NoError(t, err)
+	inflight.Add(ctx, 5, otelmetric.WithAttributes(attribute.String("route", "a")))
+	inflight.Add(ctx, 3, otelmetric.WithAttributes(attribute.String("route", "b")))
+	latency.Record(ctx, 10)
+	latency.Record(ctx, 30)
+	ignored.Add(ctx, 100)
+	mnt := NewMonitor(reader, map[string]Setter{
+		"inflight": func(stats *gohalt.Stats, value float64) { stats.Goroutines = uint64(value) },
+		"latency":  func(stats *gohalt.Stats, value float64) { stats.CPUPause = uint64(value) },
+		"cpu":      func(stats *gohalt.Stats, value float64) { stats.CPUUsage = value },
+		"missing":  func(stats *gohalt.Stats, value float64) { stats.MEMAlloc = uint64(value) },
+	}, time.Hour)
+	stats, err := mnt.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, gohalt.Stats{Goroutines: 8, CPUPause: 20, CPUUsage: 0.8}, stats)
+	inflight.Add(ctx, 10)
+	stats, err = mnt.Stats(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(8), stats.Goroutines)
+	thr := gohalt.NewThrottlerMonitor(mnt, gohalt.Stats{CPUUsage: 0.5})
+	require.Error(t, thr.Acquire(ctx))
+	thr = gohalt.NewThrottlerMonitor(mnt, gohalt.Stats{CPUUsage: 0.9})
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, provider.Shutdown(ctx))
+	stats, err = NewMonitor(reader, nil, time.Hour).Stats(ctx)
+	require.Error(t, err)
+	require.Equal(t, gohalt.Stats{}, stats)
+}
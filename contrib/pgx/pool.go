@@ -0,0 +1,195 @@
+// Package gohaltpgx provides pgx connection pool integration for gohalt throttlers,
+// see `gohaltsql` package for plain database/sql integration.
+package gohaltpgx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Client defines pgx pool subset used by `Pool`, it is implemented by `*pgxpool.Pool`.
+type Client interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	AcquireFunc(ctx context.Context, f func(*pgxpool.Conn) error) error
+}
+
+// Pool defines throttled pgx pool that acquires the throttler before pool connection checkout,
+// see `NewPool`.
+type Pool struct {
+	client Client
+	thr    gohalt.Throttler
+	poll   time.Duration
+}
+
+// NewPool creates throttled pgx pool instance that wraps the provided pool client
+// and acquires the provided throttler before each pool call checks out a connection
+// and releases it after the call is done, so in-flight queries could be capped with `running` throttler
+// and pool could back off with `latency` and `percentile` throttlers when query latency degrades.
+// Rows are released on rows close or exhaustion, row is released on scan and transaction on commit or rollback.
+// Call context is stamped with `gohalt.WithTimestamp` on call,
+// so `latency` and `percentile` throttlers observe the call latency.
+// Throttled calls wait for the specified poll interval, 10ms by default,
+// or for `gohalt.ErrorRetry` retry after duration if any before the next throttler acquire
+// until the call context is done, in which case the call fails with the context error,
+// as no pool connection is checked out meanwhile, throttled calls never hold pool connections.
+// Internal throttling errors are returned from calls as is, release errors are only logged.
+func NewPool(client Client, thr gohalt.Throttler, poll time.Duration) *Pool {
+	if poll <= 0 {
+		poll = 10 * time.Millisecond
+	}
+	return &Pool{client: client, thr: thr, poll: poll}
+}
+
+func (p *Pool) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	ctx, err := p.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer p.release(ctx)
+	return p.client.Exec(ctx, sql, args...)
+}
+
+func (p *Pool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	ctx, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.client.Query(ctx, sql, args...)
+	if err != nil {
+		p.release(ctx)
+		return nil, err
+	}
+	return &trows{Rows: rows, done: p.done(ctx)}, nil
+}
+
+func (p *Pool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	ctx, err := p.acquire(ctx)
+	if err != nil {
+		return trow{err: err}
+	}
+	return trow{Row: p.client.QueryRow(ctx, sql, args...), done: p.done(ctx)}
+}
+
+func (p *Pool) Begin(ctx context.Context) (pgx.Tx, error) {
+	ctx, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := p.client.Begin(ctx)
+	if err != nil {
+		p.release(ctx)
+		return nil, err
+	}
+	return &ttx{Tx: tx, done: p.done(ctx)}, nil
+}
+
+func (p *Pool) AcquireFunc(ctx context.Context, f func(*pgxpool.Conn) error) error {
+	ctx, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.release(ctx)
+	return p.client.AcquireFunc(ctx, f)
+}
+
+// acquire waits until the throttler is acquired or the context is done.
+func (p *Pool) acquire(ctx context.Context) (context.Context, error) {
+	for {
+		tctx := gohalt.WithTimestamp(ctx, time.Now().UTC())
+		err := p.thr.Acquire(tctx)
+		if err == nil {
+			return tctx, nil
+		}
+		p.release(tctx)
+		var ierr gohalt.ErrorInternal
+		if errors.As(err, &ierr) {
+			return nil, err
+		}
+		wait := p.poll
+		var rerr gohalt.ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			wait = rerr.After
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *Pool) release(ctx context.Context) {
+	if err := p.thr.Release(ctx); err != nil {
+		gohalt.Log("pgx pool release error happened: %v", err)
+	}
+}
+
+// done returns release func that releases the throttler only once.
+func (p *Pool) done(ctx context.Context) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.release(ctx)
+		})
+	}
+}
+
+type trows struct {
+	pgx.Rows
+	done func()
+}
+
+func (r *trows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	// rows are closed by pgx once exhausted.
+	r.done()
+	return false
+}
+
+func (r *trows) Close() {
+	r.Rows.Close()
+	r.done()
+}
+
+type trow struct {
+	pgx.Row
+	done func()
+	err  error
+}
+
+func (r trow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.done()
+	return r.Row.Scan(dest...)
+}
+
+type ttx struct {
+	pgx.Tx
+	done func()
+}
+
+func (tx *ttx) Commit(ctx context.Context) error {
+	defer tx.done()
+	return tx.Tx.Commit(ctx)
+}
+
+func (tx *ttx) Rollback(ctx context.Context) error {
+	defer tx.done()
+	return tx.Tx.Rollback(ctx)
+}
@@ -0,0 +1,147 @@
+package gohaltpgx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+var _ Client = (*pgxpool.Pool)(nil)
+
+// tclient defines pgx pool client fake that counts checked out connections.
+type tclient struct {
+	checkouts int
+	err       error
+}
+
+func (c *tclient) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	c.checkouts++
+	return pgconn.NewCommandTag("INSERT 0 1"), c.err
+}
+
+func (c *tclient) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	c.checkouts++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &trowsmock{rows: 1}, nil
+}
+
+func (c *tclient) QueryRow(context.Context, string, ...any) pgx.Row {
+	c.checkouts++
+	return &trowsmock{rows: 1}
+}
+
+func (c *tclient) Begin(context.Context) (pgx.Tx, error) {
+	c.checkouts++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return ttxmock{}, nil
+}
+
+func (c *tclient) AcquireFunc(_ context.Context, f func(*pgxpool.Conn) error) error {
+	c.checkouts++
+	return f(nil)
+}
+
+type trowsmock struct {
+	pgx.Rows
+	rows int
+}
+
+func (r *trowsmock) Next() bool {
+	r.rows--
+	return r.rows >= 0
+}
+
+func (r *trowsmock) Scan(...any) error {
+	return nil
+}
+
+func (r *trowsmock) Close() {}
+
+type ttxmock struct {
+	pgx.Tx
+}
+
+func (ttxmock) Commit(context.Context) error {
+	return nil
+}
+
+func (ttxmock) Rollback(context.Context) error {
+	return nil
+}
+
+func TestPool(t *testing.T) {
+	ctx := context.Background()
+	t.Run("Pool should throttle calls before connection checkout", func(t *testing.T) {
+		client := &tclient{}
+		pool := NewPool(client, gohalt.NewThrottlerRunning(1), time.Millisecond)
+		rows, err := pool.Query(ctx, "SELECT 1")
+		require.NoError(t, err)
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = pool.Exec(tctx, "INSERT")
+		require.Equal(t, context.DeadlineExceeded, err)
+		require.Equal(t, 1, client.checkouts)
+		// rows are released once exhausted.
+		require.True(t, rows.Next())
+		require.False(t, rows.Next())
+		rows.Close()
+		tag, err := pool.Exec(ctx, "INSERT")
+		require.NoError(t, err)
+		require.Equal(t, "INSERT 0 1", tag.String())
+		require.NoError(t, pool.QueryRow(ctx, "SELECT 1").Scan())
+		tx, err := pool.Begin(ctx)
+		require.NoError(t, err)
+		require.Equal(t, context.DeadlineExceeded, pool.QueryRow(tctx, "SELECT 1").Scan())
+		require.NoError(t, tx.Commit(ctx))
+		require.NoError(t, tx.Rollback(ctx))
+		require.NoError(t, pool.AcquireFunc(ctx, func(*pgxpool.Conn) error {
+			return nil
+		}))
+		require.Equal(t, 5, client.checkouts)
+	})
+	t.Run("Pool should release throttler on call errors", func(t *testing.T) {
+		client := &tclient{err: errors.New("test")}
+		pool := NewPool(client, gohalt.NewThrottlerRunning(1), 0)
+		_, err := pool.Query(ctx, "SELECT 1")
+		require.EqualError(t, err, "test")
+		_, err = pool.Begin(ctx)
+		require.EqualError(t, err, "test")
+		_, err = pool.Exec(ctx, "INSERT")
+		require.EqualError(t, err, "test")
+		require.Equal(t, 3, client.checkouts)
+	})
+	t.Run("Pool should return internal throttling errors without waiting", func(t *testing.T) {
+		client := &tclient{}
+		err := gohalt.ErrorInternal{Throttler: "test", Message: "test"}
+		pool := NewPool(client, gohalt.NewThrottlerEcho(err), time.Hour)
+		_, perr := pool.Exec(ctx, "INSERT")
+		require.Equal(t, err, perr)
+		require.Zero(t, client.checkouts)
+	})
+	t.Run("Pool should wait for retry after duration", func(t *testing.T) {
+		client := &tclient{}
+		pool := NewPool(
+			client,
+			gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Hour, Err: errors.New("test")}),
+			time.Millisecond,
+		)
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := pool.Exec(tctx, "INSERT")
+		require.Equal(t, context.DeadlineExceeded, err)
+		require.Less(t, time.Since(start), time.Second)
+		require.Zero(t, client.checkouts)
+	})
+}
@@ -0,0 +1,201 @@
+// Package gohaltpostgres provides postgres integration for gohalt throttlers,
+// so services already backed by postgres could keep shared state of gohalt storage throttlers in single table.
+package gohaltpostgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/jackc/pgx/v5"
+)
+
+// Schema returns postgres storage schema migration
+// for the specified table, see `NewStorage`.
+// It could be applied by any external migration tool or via `Migrate`.
+func Schema(table string) string {
+	ident := pgx.Identifier(strings.Split(table, ".")).Sanitize()
+	index := pgx.Identifier{strings.ReplaceAll(table, ".", "_") + "_deadline"}.Sanitize()
+	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	key TEXT PRIMARY KEY,
+	value BYTEA NOT NULL,
+	deadline TIMESTAMPTZ NULL
+);
+CREATE INDEX IF NOT EXISTS %s ON %s (deadline);`, ident, index, ident)
+}
+
+// Migrate applies postgres storage schema migration
+// for the specified table via the provided database, see `Schema`.
+// Migration is idempotent and could be safely applied on every start.
+func Migrate(ctx context.Context, db *sql.DB, table string) error {
+	_, err := db.ExecContext(ctx, Schema(table))
+	return err
+}
+
+type storage struct {
+	db     *sql.DB
+	table  string
+	lock   sync.Mutex
+	purged time.Time
+}
+
+// NewStorage creates postgres storage instance
+// which keeps all keys in the specified table of postgres reached by the provided database,
+// the database could be opened with any postgres database/sql driver, e.g. `pgx` driver from `github.com/jackc/pgx/v5/stdlib`.
+// Table is expected to be migrated beforehand, see `Migrate`.
+// Incr is implemented via single atomic counter upsert
+// and CompareAndSwap is serialized per key via transaction level advisory locks.
+// Expired keys are ignored and then purged from the table at most once a minute.
+// Use `gohalt.NewStorageRetried` to retry failed storage operations.
+func NewStorage(db *sql.DB, table string) gohalt.Storage {
+	return &storage{db: db, table: pgx.Identifier(strings.Split(table, ".")).Sanitize()}
+}
+
+func (stg *storage) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return stg.get(ctx, stg.db, key, false)
+}
+
+func (stg *storage) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := stg.db.ExecContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (key, value, deadline) VALUES ($1, $2, %s)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, deadline = EXCLUDED.deadline`,
+		stg.table, stg.deadline("$3"),
+	), key, value, ttl.Microseconds())
+	return err
+}
+
+func (stg *storage) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var val int64
+	// expired key is replaced with fresh counter,
+	// otherwise counter is incremented and its deadline is kept intact.
+	if err := stg.db.QueryRowContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s AS s (key, value, deadline)
+		VALUES ($1, convert_to($2::bigint::text, 'UTF8'), %s)
+		ON CONFLICT (key) DO UPDATE SET
+			value = CASE WHEN s.deadline <= now() THEN EXCLUDED.value
+				ELSE convert_to((convert_from(s.value, 'UTF8')::bigint + $2::bigint)::text, 'UTF8') END,
+			deadline = CASE WHEN s.deadline <= now() THEN EXCLUDED.deadline ELSE s.deadline END
+		RETURNING convert_from(value, 'UTF8')::bigint`,
+		stg.table, stg.deadline("$3"),
+	), key, delta, ttl.Microseconds()).Scan(&val); err != nil {
+		return 0, err
+	}
+	if err := stg.purge(ctx); err != nil {
+		gohalt.Log("postgres storage purge error happened: %v", err)
+	}
+	return val, nil
+}
+
+func (stg *storage) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	old []byte,
+	new []byte,
+	ttl time.Duration,
+) (bool, error) {
+	tx, err := stg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	// missing keys can't be locked by row locks,
+	// so all swaps of the key are serialized by advisory lock instead.
+	if _, err := tx.ExecContext(
+		ctx,
+		`SELECT pg_advisory_xact_lock(hashtext($1))`,
+		stg.table+":"+key,
+	); err != nil {
+		return false, err
+	}
+	val, ok, err := stg.get(ctx, tx, key, true)
+	if err != nil {
+		return false, err
+	}
+	if ok != (old != nil) || !bytes.Equal(val, old) {
+		return false, nil
+	}
+	switch {
+	case old == nil && new == nil:
+	case new == nil:
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = $1`, stg.table), key)
+	default:
+		// expired key is still kept in the table and needs to be replaced.
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %s (key, value, deadline) VALUES ($1, $2, %s)
+			ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, deadline = EXCLUDED.deadline`,
+			stg.table, stg.deadline("$3"),
+		), key, new, ttl.Microseconds())
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (stg *storage) Delete(ctx context.Context, key string) error {
+	_, err := stg.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE key = $1`, stg.table), key)
+	return err
+}
+
+// get returns the key value and whether the key exists and is not expired yet,
+// optionally locking the key row until the end of the transaction.
+func (stg *storage) get(
+	ctx context.Context,
+	querier interface {
+		QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+	},
+	key string,
+	lock bool,
+) ([]byte, bool, error) {
+	query := fmt.Sprintf(
+		`SELECT value FROM %s WHERE key = $1 AND (deadline IS NULL OR deadline > now())`,
+		stg.table,
+	)
+	if lock {
+		query += " FOR UPDATE"
+	}
+	var val []byte
+	err := querier.QueryRowContext(ctx, query, key).Scan(&val)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	default:
+		return val, true, nil
+	}
+}
+
+// purge deletes expired keys from the table at most once a minute.
+func (stg *storage) purge(ctx context.Context) error {
+	now := time.Now()
+	stg.lock.Lock()
+	if !stg.purged.IsZero() && now.Sub(stg.purged) < time.Minute {
+		stg.lock.Unlock()
+		return nil
+	}
+	stg.purged = now
+	stg.lock.Unlock()
+	_, err := stg.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE deadline <= now()`, stg.table))
+	return err
+}
+
+// deadline returns key deadline sql expression from the provided ttl microseconds parameter,
+// zero ttl means that the key never expires.
+func (stg *storage) deadline(param string) string {
+	return fmt.Sprintf(
+		`CASE WHEN %s::bigint > 0 THEN now() + %s::bigint * interval '1 microsecond' END`,
+		param, param,
+	)
+}
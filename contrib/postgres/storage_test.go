@@ -0,0 +1,287 @@
+package gohaltpostgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+)
+
+type trow struct {
+	value    []byte
+	deadline time.Time
+}
+
+// tpostgres defines in process postgres fake database/sql connector
+// that interprets statements used by the storage over in memory table with controlled now.
+// Statements are applied right away, so transactions rollbacks are not supported.
+type tpostgres struct {
+	lock  sync.Mutex
+	rows  map[string]trow
+	now   time.Time
+	stmts []string
+	err   error
+}
+
+func (pg *tpostgres) Connect(context.Context) (driver.Conn, error) {
+	if pg.err != nil {
+		return nil, pg.err
+	}
+	return tconn{pg: pg}, nil
+}
+
+func (pg *tpostgres) Driver() driver.Driver {
+	return pg
+}
+
+func (pg *tpostgres) Open(string) (driver.Conn, error) {
+	return pg.Connect(context.TODO())
+}
+
+func (pg *tpostgres) exec(query string, args []driver.NamedValue) ([]driver.Value, error) {
+	pg.lock.Lock()
+	defer pg.lock.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+	pg.stmts = append(pg.stmts, query)
+	alive := func(row trow) bool {
+		return row.deadline.IsZero() || row.deadline.After(pg.now)
+	}
+	deadline := func(arg driver.NamedValue) time.Time {
+		if ttl := arg.Value.(int64); ttl > 0 {
+			return pg.now.Add(time.Duration(ttl) * time.Microsecond)
+		}
+		return time.Time{}
+	}
+	switch {
+	case query == "BEGIN", query == "COMMIT", query == "ROLLBACK":
+		return nil, nil
+	case strings.HasPrefix(query, "CREATE TABLE"), strings.HasPrefix(query, "SELECT pg_advisory_xact_lock"):
+		return nil, nil
+	case strings.HasPrefix(query, "SELECT value FROM"):
+		if row, ok := pg.rows[args[0].Value.(string)]; ok && alive(row) {
+			return []driver.Value{row.value}, nil
+		}
+		return nil, nil
+	case strings.HasPrefix(query, "INSERT INTO") && strings.Contains(query, "RETURNING"):
+		key, delta := args[0].Value.(string), args[1].Value.(int64)
+		row, ok := pg.rows[key]
+		if !ok || !alive(row) {
+			row = trow{value: []byte(strconv.FormatInt(delta, 10)), deadline: deadline(args[2])}
+			pg.rows[key] = row
+			return []driver.Value{delta}, nil
+		}
+		current, err := strconv.ParseInt(string(row.value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid input syntax for type bigint: %q", row.value)
+		}
+		row.value = []byte(strconv.FormatInt(current+delta, 10))
+		pg.rows[key] = row
+		return []driver.Value{current + delta}, nil
+	case strings.HasPrefix(query, "INSERT INTO"):
+		pg.rows[args[0].Value.(string)] = trow{value: args[1].Value.([]byte), deadline: deadline(args[2])}
+		return nil, nil
+	case strings.HasPrefix(query, "DELETE FROM") && strings.HasSuffix(query, "WHERE key = $1"):
+		delete(pg.rows, args[0].Value.(string))
+		return nil, nil
+	case strings.HasPrefix(query, "DELETE FROM") && strings.HasSuffix(query, "WHERE deadline <= now()"):
+		for key, row := range pg.rows {
+			if !alive(row) {
+				delete(pg.rows, key)
+			}
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported statement %q", query)
+	}
+}
+
+func (pg *tpostgres) count(prefix string) int {
+	pg.lock.Lock()
+	defer pg.lock.Unlock()
+	var count int
+	for _, stmt := range pg.stmts {
+		if strings.HasPrefix(stmt, prefix) {
+			count++
+		}
+	}
+	return count
+}
+
+func (pg *tpostgres) forward(dur time.Duration) {
+	pg.lock.Lock()
+	defer pg.lock.Unlock()
+	pg.now = pg.now.Add(dur)
+}
+
+type tconn struct {
+	pg *tpostgres
+}
+
+func (c tconn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("unsupported prepare")
+}
+
+func (c tconn) Close() error {
+	return nil
+}
+
+func (c tconn) Begin() (driver.Tx, error) {
+	_, _ = c.pg.exec("BEGIN", nil)
+	return c, nil
+}
+
+func (c tconn) Commit() error {
+	_, err := c.pg.exec("COMMIT", nil)
+	return err
+}
+
+func (c tconn) Rollback() error {
+	_, err := c.pg.exec("ROLLBACK", nil)
+	return err
+}
+
+func (c tconn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.pg.exec(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c tconn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	values, err := c.pg.exec(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &trows{values: values}, nil
+}
+
+type trows struct {
+	values []driver.Value
+}
+
+func (r *trows) Columns() []string {
+	return []string{"value"}
+}
+
+func (r *trows) Close() error {
+	return nil
+}
+
+func (r *trows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func TestStorage(t *testing.T) {
+	pg := &tpostgres{rows: make(map[string]trow), now: time.Now()}
+	db := sql.OpenDB(pg)
+	defer db.Close()
+	stg := NewStorage(db, "gohalt")
+	ctx := context.TODO()
+	t.Run("Postgres storage should migrate table schema", func(t *testing.T) {
+		schema := Schema("public.gohalt")
+		require.Contains(t, schema, `CREATE TABLE IF NOT EXISTS "public"."gohalt"`)
+		require.Contains(t, schema, `CREATE INDEX IF NOT EXISTS "public_gohalt_deadline" ON "public"."gohalt" (deadline)`)
+		require.NoError(t, Migrate(ctx, db, "public.gohalt"))
+		require.Equal(t, 1, pg.count(`CREATE TABLE IF NOT EXISTS "public"."gohalt"`))
+	})
+	t.Run("Postgres storage should get upsert and delete keys", func(t *testing.T) {
+		_, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, stg.Set(ctx, "key", []byte("old"), 0))
+		require.NoError(t, stg.Set(ctx, "key", []byte("val"), 0))
+		val, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("val"), val)
+		require.NoError(t, stg.Delete(ctx, "key"))
+		_, ok, _ = stg.Get(ctx, "key")
+		require.False(t, ok)
+	})
+	t.Run("Postgres storage should increment counters with single upsert", func(t *testing.T) {
+		cnt, err := stg.Incr(ctx, "cnt", 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cnt)
+		cnt, err = stg.Incr(ctx, "cnt", -3, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(-1), cnt)
+		require.Equal(t, 2, pg.count(`INSERT INTO "gohalt" AS s`))
+		// expired keys are purged at most once a minute.
+		require.Equal(t, 1, pg.count(`DELETE FROM "gohalt" WHERE deadline <= now()`))
+		require.NoError(t, stg.Set(ctx, "cnt", []byte("nan"), 0))
+		_, err = stg.Incr(ctx, "cnt", 1, 0)
+		require.Error(t, err)
+	})
+	t.Run("Postgres storage should compare and swap keys under advisory locks", func(t *testing.T) {
+		swapped, err := stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.NoError(t, err)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, nil, 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("old"), 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.True(t, swapped)
+		val, _, _ := stg.Get(ctx, "cas")
+		require.Equal(t, []byte("new"), val)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), nil, 0)
+		require.True(t, swapped)
+		_, ok, _ := stg.Get(ctx, "cas")
+		require.False(t, ok)
+		require.Equal(t, 6, pg.count("SELECT pg_advisory_xact_lock"))
+		require.Equal(t, 6, pg.count(`SELECT value FROM "gohalt" WHERE key = $1 AND (deadline IS NULL OR deadline > now()) FOR UPDATE`))
+		require.Equal(t, 4, pg.count("COMMIT"))
+	})
+	t.Run("Postgres storage should expire keys with deadlines", func(t *testing.T) {
+		require.NoError(t, stg.Set(ctx, "ttl", []byte("val"), time.Second))
+		_, _ = stg.Incr(ctx, "ttlcnt", 1, time.Second)
+		cnt, _ := stg.Incr(ctx, "ttlcnt", 1, time.Hour)
+		require.Equal(t, int64(2), cnt)
+		swapped, _ := stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("val"), time.Second)
+		require.True(t, swapped)
+		pg.forward(2 * time.Second)
+		_, ok, _ := stg.Get(ctx, "ttl")
+		require.False(t, ok)
+		swapped, _ = stg.CompareAndSwap(ctx, "ttlcas", []byte("val"), nil, 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("new"), 0)
+		require.True(t, swapped)
+		val, _, _ := stg.Get(ctx, "ttlcas")
+		require.Equal(t, []byte("new"), val)
+		cnt, _ = stg.Incr(ctx, "ttlcnt", 1, 0)
+		require.Equal(t, int64(1), cnt)
+		pg.forward(time.Hour)
+		_, ok, _ = stg.Get(ctx, "ttlcnt")
+		require.True(t, ok)
+	})
+	t.Run("Postgres storage should fail on unreachable server", func(t *testing.T) {
+		db := sql.OpenDB(&tpostgres{err: errors.New("test")})
+		defer db.Close()
+		stg := gohalt.NewStorageRetried(NewStorage(db, "gohalt"), 1)
+		_, _, err := stg.Get(ctx, "key")
+		require.Error(t, err)
+		require.Error(t, stg.Set(ctx, "key", nil, 0))
+		_, err = stg.Incr(ctx, "key", 1, 0)
+		require.Error(t, err)
+		_, err = stg.CompareAndSwap(ctx, "key", nil, nil, 0)
+		require.Error(t, err)
+		require.Error(t, stg.Delete(ctx, "key"))
+		require.Error(t, Migrate(ctx, db, "gohalt"))
+	})
+}
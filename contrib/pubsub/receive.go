@@ -0,0 +1,118 @@
+// Package gohaltpubsub provides gcp pubsub integration for gohalt throttlers,
+// so subscriber flow control could track downstream health instead of static settings.
+package gohaltpubsub
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/1pkg/gohalt"
+)
+
+// Receive receives the provided subscription messages with the provided handler
+// the same way as `pubsub.Subscription.Receive` does until the provided context is done,
+// while subscription receive settings max outstanding messages and bytes track the provided throttler allowance.
+// Provided throttler is acquired before each message is handled and released after the message is handled,
+// throttled messages are not handled, instead they are nacked, so pubsub redelivers them later.
+// Each specified interval subscription allowance is halved if any message was throttled during the interval
+// or doubled otherwise until it reaches the initial subscription receive settings,
+// when allowance changes subscription receive is restarted with the adjusted receive settings
+// as pubsub applies receive settings only on receive start.
+// Throttler context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe messages handling latency,
+// and with `gohalt.WithKey` set to the subscription id,
+// so `pattern` and `router` throttlers could select throttler per subscription.
+// Receive errors are returned as is, release errors are only logged.
+func Receive(
+	ctx context.Context,
+	sub *pubsub.Subscription,
+	thr gohalt.Throttler,
+	handler func(context.Context, *pubsub.Message),
+	interval time.Duration,
+) error {
+	messages, bytes := sub.ReceiveSettings.MaxOutstandingMessages, sub.ReceiveSettings.MaxOutstandingBytes
+	if messages <= 0 {
+		messages = pubsub.DefaultReceiveSettings.MaxOutstandingMessages
+	}
+	if bytes <= 0 {
+		bytes = pubsub.DefaultReceiveSettings.MaxOutstandingBytes
+	}
+	defer func() {
+		sub.ReceiveSettings.MaxOutstandingMessages = messages
+		sub.ReceiveSettings.MaxOutstandingBytes = bytes
+	}()
+	var throttled int32
+	receive := func(ctx context.Context, msg *pubsub.Message) {
+		ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+		ctx = gohalt.WithKey(ctx, sub.ID())
+		defer func() {
+			if err := thr.Release(ctx); err != nil {
+				gohalt.Log("pubsub receive release error happened: %v", err)
+			}
+		}()
+		if err := thr.Acquire(ctx); err != nil {
+			atomic.StoreInt32(&throttled, 1)
+			msg.Nack()
+			return
+		}
+		handler(ctx, msg)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	current := messages
+	for {
+		sub.ReceiveSettings.MaxOutstandingMessages = current
+		sub.ReceiveSettings.MaxOutstandingBytes = scale(bytes, current, messages)
+		rctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- sub.Receive(rctx, receive)
+		}()
+		for adjusted := false; !adjusted; {
+			select {
+			case err := <-done:
+				cancel()
+				if err == nil {
+					err = ctx.Err()
+				}
+				return err
+			case <-ticker.C:
+				next := current * 2
+				if atomic.SwapInt32(&throttled, 0) == 1 {
+					next = current / 2
+				}
+				if next = bound(next, messages); next != current {
+					gohalt.Log("pubsub receive allowance is adjusted from %d to %d", current, next)
+					current, adjusted = next, true
+				}
+			}
+		}
+		cancel()
+		if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+func bound(current int, max int) int {
+	if current < 1 {
+		return 1
+	}
+	if current > max {
+		return max
+	}
+	return current
+}
+
+func scale(bytes int, current int, max int) int {
+	if scaled := int(int64(bytes) * int64(current) / int64(max)); scaled > 0 {
+		return scaled
+	}
+	return 1
+}
@@ -0,0 +1,85 @@
+package gohaltpubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type tswitch struct {
+	deny int32
+}
+
+func (thr *tswitch) Acquire(context.Context) error {
+	if atomic.LoadInt32(&thr.deny) == 1 {
+		return errors.New("test")
+	}
+	return nil
+}
+
+func (thr *tswitch) Release(context.Context) error {
+	return nil
+}
+
+func TestReceive(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+	conn, err := grpc.NewClient(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	ctx := context.Background()
+	client, err := pubsub.NewClient(ctx, "test", option.WithGRPCConn(conn))
+	require.NoError(t, err)
+	defer client.Close()
+	topic, err := client.CreateTopic(ctx, "test")
+	require.NoError(t, err)
+	sub, err := client.CreateSubscription(ctx, "test", pubsub.SubscriptionConfig{Topic: topic})
+	require.NoError(t, err)
+	sub.ReceiveSettings.MaxOutstandingMessages = 8
+	sub.ReceiveSettings.MaxOutstandingBytes = 800
+	thr := &tswitch{deny: 1}
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var lock sync.Mutex
+	var handled []string
+	var settings []int
+	done := make(chan error, 1)
+	go func() {
+		done <- Receive(rctx, sub, thr, func(ctx context.Context, msg *pubsub.Message) {
+			lock.Lock()
+			defer lock.Unlock()
+			handled = append(handled, string(msg.Data))
+			settings = append(settings, sub.ReceiveSettings.MaxOutstandingMessages, sub.ReceiveSettings.MaxOutstandingBytes)
+			msg.Ack()
+			cancel()
+		}, 20*time.Millisecond)
+	}()
+	for i := 0; i < 10; i++ {
+		_ = srv.Publish("projects/test/topics/test", []byte("throttled"), nil)
+		time.Sleep(10 * time.Millisecond)
+	}
+	atomic.StoreInt32(&thr.deny, 0)
+	_ = srv.Publish("projects/test/topics/test", []byte("test"), nil)
+	select {
+	case err := <-done:
+		require.Equal(t, context.Canceled, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "pubsub receive should handle message after throttler pass")
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	require.GreaterOrEqual(t, len(settings), 2)
+	require.Less(t, settings[0], 8)
+	require.Equal(t, settings[0]*100, settings[1])
+	require.Equal(t, 8, sub.ReceiveSettings.MaxOutstandingMessages)
+	require.Equal(t, 800, sub.ReceiveSettings.MaxOutstandingBytes)
+}
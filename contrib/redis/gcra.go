@@ -0,0 +1,101 @@
+package gohaltredis
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraEpoch defines epoch used by distributed generic cell rate algorithm state,
+// state timestamps are kept relative to Jan 1 2017 00:00:00 UTC in seconds
+// to be compatible with go-redis/redis_rate state.
+const gcraEpoch int64 = 1483228800
+
+// gcraKey defines distributed generic cell rate algorithm state key prefix
+// compatible with go-redis/redis_rate state.
+const gcraKey = "rate:"
+
+type gcrastate struct {
+	allowed   bool
+	tat       float64
+	remaining int64
+	retry     float64
+	reset     float64
+}
+
+// gcra implements single generic cell rate algorithm state transition
+// step by step equivalent to go-redis/redis_rate lua script and redis-cell `CL.THROTTLE` command
+// where redis-cell max burst b is equivalent to b+1 burst here,
+// so the same stored state produces the same decisions across implementations.
+// Provided theoretical arrival time and now are in seconds relative to `gcraEpoch`,
+// zero theoretical arrival time is treated as missing state.
+func gcra(tat float64, now float64, burst uint64, rate uint64, period time.Duration, cost uint64) gcrastate {
+	emission := period.Seconds() / float64(rate)
+	increment := emission * float64(cost)
+	offset := emission * float64(burst)
+	if tat < now {
+		tat = now
+	}
+	ntat := tat + increment
+	diff := now - (ntat - offset)
+	remaining := diff / emission
+	if remaining < 0 {
+		return gcrastate{tat: tat, retry: -diff, reset: tat - now}
+	}
+	return gcrastate{allowed: true, tat: ntat, remaining: int64(remaining), retry: -1, reset: ntat - now}
+}
+
+func gcranow(ts time.Time) float64 {
+	return float64(ts.Unix()-gcraEpoch) + float64(ts.Nanosecond()/1000)/1000000
+}
+
+// gcraEncode encodes theoretical arrival time state
+// the same way redis 7+ encodes lua numbers.
+func gcraEncode(tat float64) string {
+	return strconv.FormatFloat(tat, 'f', -1, 64)
+}
+
+func gcraDecode(state string) (float64, error) {
+	if state == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(state, 64)
+}
+
+// gcraScript defines redis lua script that implements single generic cell rate algorithm state transition
+// step by step equivalent to go-redis/redis_rate lua script and `gcra` function,
+// it uses redis server time as now, so all replicas share the same clock.
+// Script accepts burst, rate, period in seconds and cost and returns
+// allowed cost, remaining, retry after and reset after decision.
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local period = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local emission = period / rate
+local increment = emission * cost
+local offset = emission * burst
+local time = redis.call("TIME")
+local now = (time[1] - 1483228800) + (time[2] / 1000000)
+local tat = redis.call("GET", key)
+if not tat then
+	tat = now
+else
+	tat = tonumber(tat)
+end
+tat = math.max(tat, now)
+local ntat = tat + increment
+local diff = now - (ntat - offset)
+local remaining = diff / emission
+if remaining < 0 then
+	return {0, 0, tostring(-diff), tostring(tat - now)}
+end
+local reset = ntat - now
+if reset > 0 then
+	redis.call("SET", key, ntat, "EX", math.ceil(reset))
+end
+return {cost, remaining, tostring(-1), tostring(reset)}
+`)
@@ -0,0 +1,96 @@
+package gohaltredis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gcrastep defines single conformance test vector step:
+// provided stored state and now in seconds relative to `gcraEpoch`
+// with expected decision and expected stored state result.
+type gcrastep struct {
+	now       float64
+	cost      uint64
+	state     string
+	allowed   bool
+	remaining int64
+	retry     float64
+	reset     float64
+	result    string
+}
+
+func TestGCRAConformance(t *testing.T) {
+	table := map[string]struct {
+		burst  uint64
+		rate   uint64
+		period time.Duration
+		steps  []gcrastep
+	}{
+		"Generic cell rate algorithm should match state and decisions on burst": {
+			burst:  5,
+			rate:   10,
+			period: time.Second,
+			steps: []gcrastep{
+				{now: 100.0, cost: 1, state: "", allowed: true, remaining: 4, retry: -1.0, reset: 0.09999999999999432, result: "100.1"},
+				{now: 100.0, cost: 1, state: "100.1", allowed: true, remaining: 3, retry: -1.0, reset: 0.19999999999998863, result: "100.19999999999999"},
+				{now: 100.0, cost: 1, state: "100.19999999999999", allowed: true, remaining: 2, retry: -1.0, reset: 0.29999999999998295, result: "100.29999999999998"},
+				{now: 100.0, cost: 1, state: "100.29999999999998", allowed: true, remaining: 1, retry: -1.0, reset: 0.39999999999997726, result: "100.39999999999998"},
+				{now: 100.0, cost: 1, state: "100.39999999999998", allowed: true, remaining: 0, retry: -1.0, reset: 0.4999999999999716, result: "100.49999999999997"},
+				{now: 100.0, cost: 1, state: "100.49999999999997", allowed: false, remaining: 0, retry: 0.0999999999999659, reset: 0.4999999999999716, result: "100.49999999999997"},
+				{now: 100.05, cost: 1, state: "100.49999999999997", allowed: false, remaining: 0, retry: 0.049999999999968736, reset: 0.4499999999999744, result: "100.49999999999997"},
+				{now: 100.2, cost: 2, state: "100.49999999999997", allowed: true, remaining: 0, retry: -1.0, reset: 0.4999999999999716, result: "100.69999999999997"},
+				{now: 101.0, cost: 5, state: "100.69999999999997", allowed: true, remaining: 0, retry: -1.0, reset: 0.5, result: "101.5"},
+				{now: 101.0, cost: 1, state: "101.5", allowed: false, remaining: 0, retry: 0.09999999999999432, reset: 0.5, result: "101.5"},
+			},
+		},
+		"Generic cell rate algorithm should match state and decisions on slow rate": {
+			burst:  1,
+			rate:   1,
+			period: time.Minute,
+			steps: []gcrastep{
+				{now: 3600.5, cost: 1, state: "", allowed: true, remaining: 0, retry: -1.0, reset: 60.0, result: "3660.5"},
+				{now: 3601.0, cost: 1, state: "3660.5", allowed: false, remaining: 0, retry: 59.5, reset: 59.5, result: "3660.5"},
+				{now: 3660.5, cost: 1, state: "3660.5", allowed: true, remaining: 0, retry: -1.0, reset: 60.0, result: "3720.5"},
+				{now: 3660.5, cost: 1, state: "3720.5", allowed: false, remaining: 0, retry: 60.0, reset: 60.0, result: "3720.5"},
+				{now: 3800.0, cost: 1, state: "3720.5", allowed: true, remaining: 0, retry: -1.0, reset: 60.0, result: "3860"},
+			},
+		},
+		"Generic cell rate algorithm should match state and decisions on oversized cost": {
+			burst:  2,
+			rate:   4,
+			period: time.Second,
+			steps: []gcrastep{
+				{now: 10.0, cost: 3, state: "", allowed: false, remaining: 0, retry: 0.25, reset: 0.0, result: ""},
+				{now: 10.0, cost: 2, state: "", allowed: true, remaining: 0, retry: -1.0, reset: 0.5, result: "10.5"},
+				{now: 10.25, cost: 1, state: "10.5", allowed: true, remaining: 0, retry: -1.0, reset: 0.5, result: "10.75"},
+				{now: 10.5, cost: 1, state: "10.75", allowed: true, remaining: 0, retry: -1.0, reset: 0.5, result: "11"},
+			},
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			state := ""
+			for _, step := range tcase.steps {
+				require.Equal(t, step.state, state)
+				tat, err := gcraDecode(state)
+				require.NoError(t, err)
+				res := gcra(tat, step.now, tcase.burst, tcase.rate, tcase.period, step.cost)
+				require.Equal(t, step.allowed, res.allowed)
+				require.Equal(t, step.remaining, res.remaining)
+				require.InDelta(t, step.retry, res.retry, 1e-9)
+				require.InDelta(t, step.reset, res.reset, 1e-9)
+				if res.allowed {
+					state = gcraEncode(res.tat)
+				}
+				require.Equal(t, step.result, state)
+			}
+		})
+	}
+}
+
+func TestGCRANow(t *testing.T) {
+	ts := time.Date(2017, 1, 1, 0, 1, 40, 500000000, time.UTC)
+	require.Equal(t, 100.5, gcranow(ts))
+}
@@ -0,0 +1,109 @@
+// Package gohaltredis provides go-redis client integration for gohalt throttlers,
+// so redis could be protected from client side commands stampedes,
+// could keep shared state of gohalt storage throttlers and could share generic cell rate algorithm limits.
+package gohaltredis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/redis/go-redis/v9"
+)
+
+// Key defines redis command key extractor
+// that is stamped to throttled command context with `gohalt.WithKey`.
+type Key func(redis.Cmder) string
+
+// KeyCommand returns key extractor that uses redis command name, e.g. `get` or `hset`.
+func KeyCommand() Key {
+	return func(cmd redis.Cmder) string {
+		return cmd.Name()
+	}
+}
+
+// KeyPrefix returns key extractor that uses redis command first key argument
+// up to the first occurrence of the specified separator, e.g. `user` for `user:42` with `:` separator.
+// Commands without key arguments fall back to redis command name.
+func KeyPrefix(sep string) Key {
+	return func(cmd redis.Cmder) string {
+		args := cmd.Args()
+		if len(args) < 2 {
+			return cmd.Name()
+		}
+		key, ok := args[1].(string)
+		if !ok {
+			return cmd.Name()
+		}
+		if i := strings.Index(key, sep); i >= 0 {
+			return key[:i]
+		}
+		return key
+	}
+}
+
+type hook struct {
+	thr gohalt.Throttler
+	key Key
+}
+
+// NewHook creates go-redis hook instance that acquires the provided throttler
+// before each redis command and releases it after the command is processed, use it with `redis.Client.AddHook`.
+// Command context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe redis commands latency,
+// and if key extractor is provided with `gohalt.WithKey` set to the extracted key,
+// so `pattern` and `router` throttlers could select throttler per command name or key prefix.
+// Pipelines acquire the provided throttler once with `gohalt.WithWeight` set to the pipeline commands count
+// and the key extracted from the first pipeline command.
+// Throttled commands fail with the throttling error without reaching redis, release errors are only logged.
+func NewHook(thr gohalt.Throttler, key Key) redis.Hook {
+	return hook{thr: thr, key: key}
+}
+
+func (h hook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h hook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx = h.context(ctx, cmd)
+		defer h.release(ctx)
+		if err := h.thr.Acquire(ctx); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h hook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if len(cmds) == 0 {
+			return next(ctx, cmds)
+		}
+		ctx = gohalt.WithWeight(h.context(ctx, cmds[0]), int64(len(cmds)))
+		defer h.release(ctx)
+		if err := h.thr.Acquire(ctx); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func (h hook) context(ctx context.Context, cmd redis.Cmder) context.Context {
+	ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+	if h.key != nil {
+		ctx = gohalt.WithKey(ctx, h.key(cmd))
+	}
+	return ctx
+}
+
+func (h hook) release(ctx context.Context) {
+	if err := h.thr.Release(ctx); err != nil {
+		gohalt.Log("redis hook release error happened: %v", err)
+	}
+}
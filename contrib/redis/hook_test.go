@@ -0,0 +1,92 @@
+package gohaltredis
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/1pkg/gohalt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHook(t *testing.T) {
+	err := errors.New("test")
+	table := map[string]struct {
+		thr  gohalt.Throttler
+		key  Key
+		pipe bool
+		err  error
+	}{
+		"Redis hook should pass command on throttler pass": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"Redis hook should fail command on throttler error": {
+			thr: gohalt.NewThrottlerEcho(err),
+			err: err,
+		},
+		"Redis hook should fail command on matched command name": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^set$"), Throttler: gohalt.NewThrottlerEcho(err)},
+			),
+			key: KeyCommand(),
+			err: err,
+		},
+		"Redis hook should pass command on unmatched key prefix": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^order$"), Throttler: gohalt.NewThrottlerEcho(err)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			key: KeyPrefix(":"),
+		},
+		"Redis hook should fail command on matched key prefix": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^user$"), Throttler: gohalt.NewThrottlerEcho(err)},
+			),
+			key: KeyPrefix(":"),
+			err: err,
+		},
+		"Redis hook should pass pipeline on throttler pass": {
+			thr:  gohalt.NewThrottlerEcho(nil),
+			pipe: true,
+		},
+		"Redis hook should fail pipeline on throttler error": {
+			thr:  gohalt.NewThrottlerEcho(err),
+			pipe: true,
+			err:  err,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			srv := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+			defer client.Close()
+			client.AddHook(NewHook(tcase.thr, tcase.key))
+			ctx := context.Background()
+			var cmd *redis.StatusCmd
+			if tcase.pipe {
+				var cmds []redis.Cmder
+				cmds, _ = client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+					pipe.Set(ctx, "user:1", "test", 0)
+					pipe.Get(ctx, "user:1")
+					return nil
+				})
+				require.Len(t, cmds, 2)
+				cmd = cmds[0].(*redis.StatusCmd)
+				require.Equal(t, tcase.err, cmds[1].Err())
+			} else {
+				cmd = client.Set(ctx, "user:1", "test", 0)
+			}
+			require.Equal(t, tcase.err, cmd.Err())
+			if tcase.err != nil {
+				require.False(t, srv.Exists("user:1"))
+			} else {
+				val, err := srv.Get("user:1")
+				require.NoError(t, err)
+				require.Equal(t, "test", val)
+			}
+		})
+	}
+}
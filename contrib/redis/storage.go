@@ -0,0 +1,107 @@
+package gohaltredis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/redis/go-redis/v9"
+)
+
+// scriptCAS defines redis compare and swap lua script,
+// it accepts old value existence flag, old value, new value existence flag, new value and ttl in milliseconds.
+var scriptCAS = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if ARGV[1] == "0" then
+	if current then
+		return 0
+	end
+elseif not current or current ~= ARGV[2] then
+	return 0
+end
+if ARGV[3] == "0" then
+	redis.call("DEL", KEYS[1])
+elseif tonumber(ARGV[5]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[4], "PX", ARGV[5])
+else
+	redis.call("SET", KEYS[1], ARGV[4])
+end
+return 1
+`)
+
+type storage struct {
+	client redis.UniversalClient
+}
+
+// NewStorage creates redis storage instance
+// which keeps all keys in redis reached by the provided client,
+// so gohalt storage throttlers could share their state across replicas.
+// Incr is pipelined with key expiration in single transaction round trip
+// and CompareAndSwap is implemented via lua script.
+// Use `gohalt.NewStorageRetried` to retry failed storage operations.
+func NewStorage(client redis.UniversalClient) gohalt.Storage {
+	return storage{client: client}
+}
+
+func (stg storage) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	val, err := stg.client.Get(ctx, key).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	default:
+		return val, true, nil
+	}
+}
+
+func (stg storage) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return stg.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (stg storage) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	pipe := stg.client.TxPipeline()
+	// create zero counter with expiration only if key is missing.
+	if ttl > 0 {
+		pipe.SetNX(ctx, key, 0, ttl)
+	}
+	incr := pipe.IncrBy(ctx, key, delta)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+func (stg storage) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	old []byte,
+	new []byte,
+	ttl time.Duration,
+) (bool, error) {
+	flag := func(val []byte) string {
+		if val == nil {
+			return "0"
+		}
+		return "1"
+	}
+	res, err := scriptCAS.Run(
+		ctx,
+		stg.client,
+		[]string{key},
+		flag(old),
+		old,
+		flag(new),
+		new,
+		ttl.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
+
+func (stg storage) Delete(ctx context.Context, key string) error {
+	return stg.client.Del(ctx, key).Err()
+}
@@ -0,0 +1,85 @@
+package gohaltredis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	mr := miniredis.RunT(t)
+	stg := NewStorage(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.TODO()
+	t.Run("Redis storage should get set and delete keys", func(t *testing.T) {
+		_, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.NoError(t, stg.Set(ctx, "key", []byte("val"), 0))
+		val, ok, err := stg.Get(ctx, "key")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, []byte("val"), val)
+		require.NoError(t, stg.Delete(ctx, "key"))
+		_, ok, _ = stg.Get(ctx, "key")
+		require.False(t, ok)
+	})
+	t.Run("Redis storage should increment counters", func(t *testing.T) {
+		cnt, err := stg.Incr(ctx, "cnt", 2, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), cnt)
+		cnt, err = stg.Incr(ctx, "cnt", -3, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(-1), cnt)
+		require.NoError(t, stg.Set(ctx, "cnt", []byte("nan"), 0))
+		_, err = stg.Incr(ctx, "cnt", 1, 0)
+		require.Error(t, err)
+	})
+	t.Run("Redis storage should compare and swap keys", func(t *testing.T) {
+		swapped, err := stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.NoError(t, err)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("old"), 0)
+		require.True(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("new"), 0)
+		require.False(t, swapped)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+		require.True(t, swapped)
+		val, _, _ := stg.Get(ctx, "cas")
+		require.Equal(t, []byte("new"), val)
+		swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("new"), nil, 0)
+		require.True(t, swapped)
+		_, ok, _ := stg.Get(ctx, "cas")
+		require.False(t, ok)
+	})
+	t.Run("Redis storage should expire keys", func(t *testing.T) {
+		require.NoError(t, stg.Set(ctx, "ttl", []byte("val"), time.Second))
+		_, _ = stg.Incr(ctx, "ttlcnt", 1, time.Second)
+		cnt, _ := stg.Incr(ctx, "ttlcnt", 1, time.Second)
+		require.Equal(t, int64(2), cnt)
+		swapped, _ := stg.CompareAndSwap(ctx, "ttlcas", nil, []byte("val"), time.Second)
+		require.True(t, swapped)
+		mr.FastForward(2 * time.Second)
+		_, ok, _ := stg.Get(ctx, "ttl")
+		require.False(t, ok)
+		_, ok, _ = stg.Get(ctx, "ttlcas")
+		require.False(t, ok)
+		cnt, _ = stg.Incr(ctx, "ttlcnt", 1, 0)
+		require.Equal(t, int64(1), cnt)
+	})
+	t.Run("Redis storage should fail on unreachable server", func(t *testing.T) {
+		stg := gohalt.NewStorageRetried(NewStorage(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})), 1)
+		_, _, err := stg.Get(ctx, "key")
+		require.Error(t, err)
+		require.Error(t, stg.Set(ctx, "key", nil, 0))
+		_, err = stg.Incr(ctx, "key", 1, 0)
+		require.Error(t, err)
+		_, err = stg.CompareAndSwap(ctx, "key", nil, nil, 0)
+		require.Error(t, err)
+		require.Error(t, stg.Delete(ctx, "key"))
+	})
+}
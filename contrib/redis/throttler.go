@@ -0,0 +1,88 @@
+package gohaltredis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/redis/go-redis/v9"
+)
+
+type strpair struct {
+	current   uint64
+	threshold uint64
+}
+
+func (p strpair) String() string {
+	return fmt.Sprintf("%d out of %d", p.current, p.threshold)
+}
+
+type tgcra struct {
+	client  redis.UniversalClient
+	burst   uint64
+	rate    uint64
+	period  float64
+	quantum time.Duration
+}
+
+// NewThrottlerGCRA creates new throttler instance that
+// uses generic cell rate algorithm to throttles call within provided rate spec sustained rate and independent burst
+// shared precisely across all replicas via single lua script call per acquire on redis reached by the provided client.
+// Lua script is called via `EVALSHA`, it is reloaded on `NOSCRIPT` error.
+// Throttler state is kept compatible with go-redis/redis_rate, see Distributed State Compatibility.
+// Rejected calls are returned as `gohalt.ErrorRetry` with retry after duration defined by the algorithm.
+// Use `gohalt.WithKey` to specify key for rate state, state key is defined as `rate:{{key}}`.
+// Use `gohalt.WithWeight` to override context call qunatity, 1 by default.
+// Use `gohalt.NewThrottlerRetried` to retry failed calls.
+// - could return `gohalt.ErrorRetry`;
+// - could return `gohalt.ErrorInternal`;
+func NewThrottlerGCRA(client redis.UniversalClient, spec gohalt.RateSpec) gohalt.Throttler {
+	burst := spec.Burst
+	if burst == 0 {
+		burst = spec.Rate
+	}
+	return tgcra{
+		client:  client,
+		burst:   burst,
+		rate:    spec.Rate,
+		period:  spec.Interval.Seconds(),
+		quantum: time.Duration(math.Ceil(float64(spec.Interval) / float64(spec.Rate))),
+	}
+}
+
+func (thr tgcra) Acquire(ctx context.Context) error {
+	key := gcraKey + gohalt.Key(ctx)
+	res, err := gcraScript.Run(ctx, thr.client, []string{key}, thr.burst, thr.rate, thr.period, gohalt.Weight(ctx)).Slice()
+	if err == nil && len(res) != 4 {
+		err = fmt.Errorf("unexpected script result %v", res)
+	}
+	if err != nil {
+		return gohalt.ErrorInternal{
+			Throttler: "gcra",
+			Message:   err.Error(),
+		}
+	}
+	if allowed, _ := res[0].(int64); allowed > 0 {
+		return nil
+	}
+	retry, _ := strconv.ParseFloat(fmt.Sprint(res[2]), 64)
+	after := time.Duration(retry * float64(time.Second))
+	return gohalt.ErrorRetry{
+		Throttler: "gcra",
+		After:     after,
+		Err: gohalt.ErrorThreshold{
+			Throttler: "gcra",
+			Threshold: strpair{
+				current:   thr.burst + uint64(math.Ceil(float64(after)/float64(thr.quantum))),
+				threshold: thr.burst,
+			},
+		},
+	}
+}
+
+func (thr tgcra) Release(context.Context) error {
+	return nil
+}
@@ -0,0 +1,42 @@
+package gohaltredis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottlerGCRA(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(gcraEpoch+100, 0))
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	thr := NewThrottlerGCRA(client, gohalt.RateSpec{Rate: 10, Interval: time.Second, Burst: 5})
+	ctx := gohalt.WithKey(context.TODO(), "test")
+	// non positive weights are counted as single call
+	require.NoError(t, thr.Acquire(gohalt.WithWeight(ctx, -1)))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, thr.Acquire(ctx))
+	}
+	state, err := mr.Get("rate:test")
+	require.NoError(t, err)
+	tat, err := gcraDecode(state)
+	require.NoError(t, err)
+	require.InDelta(t, 100.5, tat, 0.0001)
+	err = thr.Acquire(ctx)
+	var rerr gohalt.ErrorRetry
+	require.True(t, errors.As(err, &rerr))
+	require.InDelta(t, float64(100*time.Millisecond), float64(rerr.After), float64(time.Millisecond))
+	require.Equal(t, gohalt.ErrorThreshold{
+		Throttler: "gcra",
+		Threshold: strpair{current: 6, threshold: 5},
+	}, rerr.Err)
+	require.NoError(t, thr.Acquire(gohalt.WithKey(context.TODO(), "other")))
+	mr.Close()
+	require.Equal(t, "gcra", thr.Acquire(ctx).(gohalt.ErrorInternal).Throttler)
+}
@@ -0,0 +1,74 @@
+// Package gohaltsarama provides sarama kafka client integration for gohalt throttlers,
+// so kafka publishing and consumption rates could be governed by throttlers.
+package gohaltsarama
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/IBM/sarama"
+)
+
+type interceptor struct {
+	ctx  context.Context
+	thr  gohalt.Throttler
+	poll time.Duration
+}
+
+// NewProducerInterceptor creates sarama producer interceptor instance
+// that acquires the provided throttler before each produced message is sent
+// and releases it right after the acquire, use it with `sarama.Config.Producer.Interceptors`.
+// As sarama interceptors can't reject messages, throttled messages wait for the specified poll interval
+// or for `gohalt.ErrorRetry` retry after duration if any before the next throttler acquire
+// until the provided context is done, in which case the message is sent as is,
+// so the producer is slowed down to the throttler rate instead of failing messages.
+// Throttler context is stamped with `gohalt.WithKey` set to the message topic,
+// so `pattern` and `router` throttlers could select throttler per topic.
+// Release errors are only logged.
+func NewProducerInterceptor(ctx context.Context, thr gohalt.Throttler, poll time.Duration) sarama.ProducerInterceptor {
+	return interceptor{ctx: ctx, thr: thr, poll: poll}
+}
+
+// NewConsumerInterceptor creates sarama consumer interceptor instance
+// that acquires the provided throttler before each consumed message is delivered
+// the same way as `NewProducerInterceptor` does, use it with `sarama.Config.Consumer.Interceptors`,
+// so consumption could be slowed down, e.g. with `monitor` or `latency` throttlers while downstream is hot.
+func NewConsumerInterceptor(ctx context.Context, thr gohalt.Throttler, poll time.Duration) sarama.ConsumerInterceptor {
+	return interceptor{ctx: ctx, thr: thr, poll: poll}
+}
+
+func (i interceptor) OnSend(msg *sarama.ProducerMessage) {
+	i.wait(msg.Topic)
+}
+
+func (i interceptor) OnConsume(msg *sarama.ConsumerMessage) {
+	i.wait(msg.Topic)
+}
+
+func (i interceptor) wait(topic string) {
+	ctx := gohalt.WithKey(i.ctx, topic)
+	for {
+		err := i.thr.Acquire(ctx)
+		if rerr := i.thr.Release(ctx); rerr != nil {
+			gohalt.Log("sarama interceptor release error happened: %v", rerr)
+		}
+		if err == nil {
+			return
+		}
+		wait := i.poll
+		var rerr gohalt.ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			wait = rerr.After
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			gohalt.Log("sarama interceptor throttling is interrupted: %v", ctx.Err())
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package gohaltsarama
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptor(t *testing.T) {
+	table := map[string]struct {
+		thr      gohalt.Throttler
+		timeout  time.Duration
+		duration time.Duration
+	}{
+		"Sarama interceptor should pass message on throttler pass": {
+			thr:     gohalt.NewThrottlerEcho(nil),
+			timeout: time.Hour,
+		},
+		"Sarama interceptor should wait message until throttler pass": {
+			thr:      gohalt.NewThrottlerBefore(3),
+			timeout:  time.Hour,
+			duration: 3 * time.Millisecond,
+		},
+		"Sarama interceptor should wait message until context is done": {
+			thr:      gohalt.NewThrottlerEcho(errors.New("test")),
+			timeout:  20 * time.Millisecond,
+			duration: 20 * time.Millisecond,
+		},
+		"Sarama interceptor should wait message for retry after duration": {
+			thr: gohalt.NewThrottlerEcho(gohalt.ErrorRetry{
+				Throttler: "test",
+				After:     time.Hour,
+				Err:       errors.New("test"),
+			}),
+			timeout:  20 * time.Millisecond,
+			duration: 20 * time.Millisecond,
+		},
+		"Sarama interceptor should pass message on unmatched topic": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^other$"), Throttler: gohalt.NewThrottlerEcho(errors.New("test"))},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			timeout: time.Hour,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tcase.timeout)
+			defer cancel()
+			start := time.Now()
+			NewProducerInterceptor(ctx, tcase.thr, time.Millisecond).OnSend(&sarama.ProducerMessage{Topic: "test"})
+			NewConsumerInterceptor(ctx, tcase.thr, time.Millisecond).OnConsume(&sarama.ConsumerMessage{Topic: "test"})
+			require.GreaterOrEqual(t, time.Since(start), tcase.duration)
+			require.Less(t, time.Since(start), time.Second)
+		})
+	}
+}
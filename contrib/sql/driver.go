@@ -0,0 +1,256 @@
+// Package gohaltsql provides database/sql integration for gohalt throttlers,
+// so database overload protection could be installed without touching call sites.
+package gohaltsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"github.com/1pkg/gohalt"
+)
+
+// Operations keys stamped to throttled calls context with `gohalt.WithKey`.
+const (
+	KeyQuery = "query"
+	KeyExec  = "exec"
+	KeyBegin = "begin"
+)
+
+type connector struct {
+	conn driver.Connector
+	thr  gohalt.Throttler
+}
+
+// NewConnector creates database/sql connector instance that wraps the provided connector
+// and acquires the provided throttler before each query, exec and begin call
+// and releases it after the call, use it with `sql.OpenDB`.
+// Call context is stamped with `gohalt.WithKey` set to `KeyQuery`, `KeyExec` or `KeyBegin`,
+// so `pattern` and `router` throttlers could select throttler per operation,
+// and with `gohalt.WithTimestamp` on call, so `latency` and `percentile` throttlers observe the call latency.
+// Throttling errors are returned from calls as is, release errors are only logged.
+func NewConnector(conn driver.Connector, thr gohalt.Throttler) driver.Connector {
+	return connector{conn: conn, thr: thr}
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.conn.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tconn{Conn: conn, thr: c.thr}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return tdriver{Driver: c.conn.Driver(), thr: c.thr}
+}
+
+type tdriver struct {
+	driver.Driver
+	thr gohalt.Throttler
+}
+
+// NewDriver creates database/sql driver instance that wraps the provided driver
+// the same way as `NewConnector` wraps connector, use it with `sql.Register`.
+func NewDriver(drv driver.Driver, thr gohalt.Throttler) driver.Driver {
+	return tdriver{Driver: drv, thr: thr}
+}
+
+func (d tdriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return tconn{Conn: conn, thr: d.thr}, nil
+}
+
+func (d tdriver) OpenConnector(name string) (driver.Connector, error) {
+	if drv, ok := d.Driver.(driver.DriverContext); ok {
+		conn, err := drv.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return NewConnector(conn, d.thr), nil
+	}
+	return dsnconnector{name: name, drv: d}, nil
+}
+
+// dsnconnector connects drivers that don't implement `driver.DriverContext`.
+type dsnconnector struct {
+	name string
+	drv  tdriver
+}
+
+func (c dsnconnector) Connect(context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.name)
+}
+
+func (c dsnconnector) Driver() driver.Driver {
+	return c.drv
+}
+
+type tconn struct {
+	driver.Conn
+	thr gohalt.Throttler
+}
+
+func (c tconn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c tconn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if conn, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = conn.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tstmt{Stmt: stmt, thr: c.thr}, nil
+}
+
+func (c tconn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c tconn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	err = throttle(ctx, c.thr, KeyBegin, func(ctx context.Context) (err error) {
+		if conn, ok := c.Conn.(driver.ConnBeginTx); ok {
+			tx, err = conn.BeginTx(ctx, opts)
+			return err
+		}
+		if opts.Isolation != driver.IsolationLevel(0) || opts.ReadOnly {
+			return errors.New("gohaltsql: driver doesn't support non default transaction options")
+		}
+		tx, err = c.Conn.Begin()
+		return err
+	})
+	return tx, err
+}
+
+func (c tconn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (res driver.Result, err error) {
+	conn, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		// database/sql falls back to prepared statement which is throttled as well.
+		return nil, driver.ErrSkip
+	}
+	err = throttle(ctx, c.thr, KeyExec, func(ctx context.Context) (err error) {
+		res, err = conn.ExecContext(ctx, query, args)
+		return err
+	})
+	return res, err
+}
+
+func (c tconn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	conn, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		// database/sql falls back to prepared statement which is throttled as well.
+		return nil, driver.ErrSkip
+	}
+	err = throttle(ctx, c.thr, KeyQuery, func(ctx context.Context) (err error) {
+		rows, err = conn.QueryContext(ctx, query, args)
+		return err
+	})
+	return rows, err
+}
+
+func (c tconn) Ping(ctx context.Context) error {
+	if conn, ok := c.Conn.(driver.Pinger); ok {
+		return conn.Ping(ctx)
+	}
+	return nil
+}
+
+func (c tconn) ResetSession(ctx context.Context) error {
+	if conn, ok := c.Conn.(driver.SessionResetter); ok {
+		return conn.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c tconn) IsValid() bool {
+	if conn, ok := c.Conn.(driver.Validator); ok {
+		return conn.IsValid()
+	}
+	return true
+}
+
+func (c tconn) CheckNamedValue(nv *driver.NamedValue) error {
+	if conn, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return conn.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type tstmt struct {
+	driver.Stmt
+	thr gohalt.Throttler
+}
+
+func (s tstmt) ExecContext(ctx context.Context, args []driver.NamedValue) (res driver.Result, err error) {
+	err = throttle(ctx, s.thr, KeyExec, func(ctx context.Context) (err error) {
+		if stmt, ok := s.Stmt.(driver.StmtExecContext); ok {
+			res, err = stmt.ExecContext(ctx, args)
+			return err
+		}
+		values, err := values(args)
+		if err != nil {
+			return err
+		}
+		res, err = s.Stmt.Exec(values)
+		return err
+	})
+	return res, err
+}
+
+func (s tstmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	err = throttle(ctx, s.thr, KeyQuery, func(ctx context.Context) (err error) {
+		if stmt, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			rows, err = stmt.QueryContext(ctx, args)
+			return err
+		}
+		values, err := values(args)
+		if err != nil {
+			return err
+		}
+		rows, err = s.Stmt.Query(values)
+		return err
+	})
+	return rows, err
+}
+
+func (s tstmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if stmt, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return stmt.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func values(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("gohaltsql: driver doesn't support named values")
+		}
+		values = append(values, arg.Value)
+	}
+	return values, nil
+}
+
+// throttle acquires the provided throttler before the call and releases it after.
+func throttle(ctx context.Context, thr gohalt.Throttler, key string, call func(context.Context) error) error {
+	ctx = gohalt.WithTimestamp(gohalt.WithKey(ctx, key), time.Now().UTC())
+	defer func() {
+		if err := thr.Release(ctx); err != nil {
+			gohalt.Log("sql driver release error happened: %v", err)
+		}
+	}()
+	if err := thr.Acquire(ctx); err != nil {
+		return err
+	}
+	return call(ctx)
+}
@@ -0,0 +1,158 @@
+package gohaltsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+)
+
+type fakedriver struct{}
+
+func (fakedriver) Open(string) (driver.Conn, error) {
+	return fakeconn{}, nil
+}
+
+type fakeconnector struct{}
+
+func (fakeconnector) Connect(context.Context) (driver.Conn, error) {
+	return fakeconn{}, nil
+}
+
+func (fakeconnector) Driver() driver.Driver {
+	return fakedriver{}
+}
+
+// fakeconn implements only mandatory driver interfaces,
+// so all calls go through prepared statements.
+type fakeconn struct{}
+
+func (fakeconn) Prepare(query string) (driver.Stmt, error) {
+	return fakestmt{query: query}, nil
+}
+
+func (fakeconn) Close() error {
+	return nil
+}
+
+func (fakeconn) Begin() (driver.Tx, error) {
+	return fakeconn{}, nil
+}
+
+func (fakeconn) Commit() error {
+	return nil
+}
+
+func (fakeconn) Rollback() error {
+	return nil
+}
+
+type fakestmt struct {
+	query string
+}
+
+func (fakestmt) Close() error {
+	return nil
+}
+
+func (fakestmt) NumInput() int {
+	return -1
+}
+
+func (s fakestmt) Exec([]driver.Value) (driver.Result, error) {
+	if s.query == "slow" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakestmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.query == "slow" {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fakerows{}, nil
+}
+
+type fakerows struct{}
+
+func (fakerows) Columns() []string {
+	return nil
+}
+
+func (fakerows) Close() error {
+	return nil
+}
+
+func (fakerows) Next([]driver.Value) error {
+	return io.EOF
+}
+
+func TestDriver(t *testing.T) {
+	throttled := errors.New("throttled")
+	table := map[string]struct {
+		thr   gohalt.Throttler
+		query error
+		exec  error
+		begin error
+	}{
+		"SQL driver should pass not throttled calls": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"SQL driver should throttle all calls": {
+			thr:   gohalt.NewThrottlerEcho(throttled),
+			query: throttled,
+			exec:  throttled,
+			begin: throttled,
+		},
+		"SQL driver should throttle calls per operation": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile(`^` + KeyExec + `$`), Throttler: gohalt.NewThrottlerEcho(throttled)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			exec: throttled,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			drv := NewDriver(fakedriver{}, tcase.thr).(driver.DriverContext)
+			conn, err := drv.OpenConnector("test")
+			require.NoError(t, err)
+			db := sql.OpenDB(conn)
+			defer db.Close()
+			ctx := context.Background()
+			rows, err := db.QueryContext(ctx, "test")
+			require.ErrorIs(t, err, tcase.query)
+			if err == nil {
+				require.NoError(t, rows.Close())
+			}
+			_, err = db.ExecContext(ctx, "test")
+			require.ErrorIs(t, err, tcase.exec)
+			tx, err := db.BeginTx(ctx, nil)
+			require.ErrorIs(t, err, tcase.begin)
+			if err == nil {
+				require.NoError(t, tx.Rollback())
+			}
+		})
+	}
+}
+
+func TestConnectorLatency(t *testing.T) {
+	db := sql.OpenDB(NewConnector(fakeconnector{}, gohalt.NewThrottlerLatency(time.Millisecond, time.Hour)))
+	defer db.Close()
+	ctx := context.Background()
+	_, err := db.ExecContext(ctx, "test")
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "slow")
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, "test")
+	var terr gohalt.ErrorThreshold
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, "latency", terr.Throttler)
+}
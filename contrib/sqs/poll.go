@@ -0,0 +1,140 @@
+// Package gohaltsqs provides aws sqs integration for gohalt throttlers,
+// so sqs consumers could modulate messages polling and processing with throttlers.
+package gohaltsqs
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Operations keys stamped to throttled calls context with `gohalt.WithKey`.
+const (
+	KeyReceive = "receive"
+	KeyProcess = "process"
+)
+
+// Client defines sqs client abstraction used by `Poll`, e.g. `*sqs.Client`.
+type Client interface {
+	ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	ChangeMessageVisibility(
+		context.Context,
+		*sqs.ChangeMessageVisibilityInput,
+		...func(*sqs.Options),
+	) (*sqs.ChangeMessageVisibilityOutput, error)
+	DeleteMessage(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// Handler defines sqs message handler, message is deleted from the queue
+// if handler returns no error and is left for redelivery after its visibility timeout otherwise.
+type Handler func(context.Context, types.Message) error
+
+// Poll polls sqs queue defined by the provided receive input with the provided client
+// and handles received messages concurrently with the provided handler until the provided context is done.
+// Provided throttler is acquired with `gohalt.WithKey` set to `KeyReceive` before each receive call
+// and with `gohalt.WithKey` set to `KeyProcess` before each message is handled,
+// so `pattern` and `router` throttlers could modulate receive frequency and processing concurrency separately,
+// e.g. with `timed` throttler for receive calls and `running` throttler for messages processing.
+// Throttled receive calls wait for the specified poll interval
+// or for `gohalt.ErrorRetry` retry after duration if any before the next throttler acquire.
+// Throttled messages are not handled, instead their visibility timeout is changed to the specified visibility
+// or to `gohalt.ErrorRetry` retry after duration if any, so sqs redelivers them later.
+// Processing context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe messages processing latency.
+// Poll waits for all messages in processing before returning the context error,
+// receive errors are returned as is, visibility, delete and release errors are only logged.
+func Poll(
+	ctx context.Context,
+	client Client,
+	input *sqs.ReceiveMessageInput,
+	thr gohalt.Throttler,
+	handler Handler,
+	poll time.Duration,
+	visibility time.Duration,
+) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		rctx := gohalt.WithKey(ctx, KeyReceive)
+		if err := thr.Acquire(rctx); err != nil {
+			release(thr, rctx)
+			if err := wait(ctx, after(err, poll)); err != nil {
+				return err
+			}
+			continue
+		}
+		out, err := client.ReceiveMessage(ctx, input)
+		release(thr, rctx)
+		if err != nil {
+			if cerr := ctx.Err(); cerr != nil {
+				return cerr
+			}
+			return err
+		}
+		for _, msg := range out.Messages {
+			pctx := gohalt.WithTimestamp(ctx, time.Now().UTC())
+			pctx = gohalt.WithKey(pctx, KeyProcess)
+			if err := thr.Acquire(pctx); err != nil {
+				release(thr, pctx)
+				timeout := int32(math.Ceil(after(err, visibility).Seconds()))
+				if _, err := client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          input.QueueUrl,
+					ReceiptHandle:     msg.ReceiptHandle,
+					VisibilityTimeout: timeout,
+				}); err != nil {
+					gohalt.Log("sqs poll visibility error happened: %v", err)
+				}
+				continue
+			}
+			wg.Add(1)
+			go func(msg types.Message) {
+				defer wg.Done()
+				defer release(thr, pctx)
+				if err := handler(pctx, msg); err != nil {
+					gohalt.Log("sqs poll handler error happened: %v", err)
+					return
+				}
+				if _, err := client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+					QueueUrl:      input.QueueUrl,
+					ReceiptHandle: msg.ReceiptHandle,
+				}); err != nil {
+					gohalt.Log("sqs poll delete error happened: %v", err)
+				}
+			}(msg)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+func after(err error, def time.Duration) time.Duration {
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		return rerr.After
+	}
+	return def
+}
+
+func wait(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func release(thr gohalt.Throttler, ctx context.Context) {
+	if err := thr.Release(ctx); err != nil {
+		gohalt.Log("sqs poll release error happened: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package gohaltsqs
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/require"
+)
+
+type client struct {
+	lock       sync.Mutex
+	messages   []types.Message
+	err        error
+	receives   int
+	visibility map[string]int32
+	deleted    []string
+}
+
+func (c *client) ReceiveMessage(
+	ctx context.Context,
+	_ *sqs.ReceiveMessageInput,
+	_ ...func(*sqs.Options),
+) (*sqs.ReceiveMessageOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.receives++
+	if c.err != nil {
+		return nil, c.err
+	}
+	msgs := c.messages
+	c.messages = nil
+	return &sqs.ReceiveMessageOutput{Messages: msgs}, nil
+}
+
+func (c *client) ChangeMessageVisibility(
+	ctx context.Context,
+	input *sqs.ChangeMessageVisibilityInput,
+	_ ...func(*sqs.Options),
+) (*sqs.ChangeMessageVisibilityOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.visibility[*input.ReceiptHandle] = input.VisibilityTimeout
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+func (c *client) DeleteMessage(
+	ctx context.Context,
+	input *sqs.DeleteMessageInput,
+	_ ...func(*sqs.Options),
+) (*sqs.DeleteMessageOutput, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deleted = append(c.deleted, *input.ReceiptHandle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func TestPoll(t *testing.T) {
+	err := errors.New("test")
+	messages := []types.Message{
+		{ReceiptHandle: aws.String("1")},
+		{ReceiptHandle: aws.String("2")},
+		{ReceiptHandle: aws.String("3")},
+	}
+	table := map[string]struct {
+		thr        gohalt.Throttler
+		err        error
+		rerr       error
+		receives   bool
+		visibility map[string]int32
+		deleted    []string
+	}{
+		"SQS poll should handle and delete messages on throttler pass": {
+			thr:      gohalt.NewThrottlerEcho(nil),
+			err:      context.DeadlineExceeded,
+			receives: true,
+			deleted:  []string{"1", "2"},
+		},
+		"SQS poll should change visibility of throttled messages": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^process$"), Throttler: gohalt.NewThrottlerBefore(1)},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			err:        context.DeadlineExceeded,
+			receives:   true,
+			visibility: map[string]int32{"1": 5},
+			deleted:    []string{"2"},
+		},
+		"SQS poll should change visibility of throttled messages with retry after duration": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{
+					Pattern:   regexp.MustCompile("^process$"),
+					Throttler: gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond, Err: err}),
+				},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			err:        context.DeadlineExceeded,
+			receives:   true,
+			visibility: map[string]int32{"1": 2, "2": 2, "3": 2},
+		},
+		"SQS poll should not receive messages on throttled receive": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{
+					Pattern:   regexp.MustCompile("^receive$"),
+					Throttler: gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Hour, Err: err}),
+				},
+			),
+			err: context.DeadlineExceeded,
+		},
+		"SQS poll should return receive error": {
+			thr:      gohalt.NewThrottlerEcho(nil),
+			rerr:     err,
+			err:      err,
+			receives: true,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			c := &client{
+				messages:   append([]types.Message(nil), messages...),
+				err:        tcase.rerr,
+				visibility: make(map[string]int32),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			perr := Poll(ctx, c, &sqs.ReceiveMessageInput{QueueUrl: aws.String("test")}, tcase.thr,
+				func(ctx context.Context, msg types.Message) error {
+					if *msg.ReceiptHandle == "3" {
+						return err
+					}
+					return nil
+				},
+				time.Millisecond,
+				5*time.Second,
+			)
+			require.Equal(t, tcase.err, perr)
+			require.Equal(t, tcase.receives, c.receives > 0)
+			if tcase.visibility == nil {
+				tcase.visibility = map[string]int32{}
+			}
+			require.Equal(t, tcase.visibility, c.visibility)
+			require.ElementsMatch(t, tcase.deleted, c.deleted)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package gohalttemporal provides temporal worker integration for gohalt throttlers,
+// so workflows calls to third parties could be rate limited at activity level.
+package gohalttemporal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+)
+
+// ErrorType defines temporal application error type of throttled activities,
+// add it to `temporal.RetryPolicy.NonRetryableErrorTypes` to fail throttled activities without retries.
+const ErrorType = "gohalt.Throttled"
+
+type tworker struct {
+	interceptor.WorkerInterceptorBase
+	thr   gohalt.Throttler
+	delay time.Duration
+}
+
+// NewInterceptor creates temporal worker interceptor instance that acquires the provided throttler
+// before each activity execution and releases it after the activity execution, use it with `worker.Options.Interceptors`.
+// Throttler context is stamped with `gohalt.WithTimestamp`,
+// so `latency` and `percentile` throttlers observe activities execution latency,
+// and with `gohalt.WithKey` set to the activity type name,
+// so `pattern` and `router` throttlers could select throttler per activity type.
+// Throttled activities are not executed, instead they fail with retryable temporal application error of `ErrorType` type
+// with next retry delay hint equal to `gohalt.ErrorRetry` retry after duration if any or to the specified delay,
+// so temporal retries them later according to the activity retry policy, release errors are only logged.
+func NewInterceptor(thr gohalt.Throttler, delay time.Duration) interceptor.WorkerInterceptor {
+	return &tworker{thr: thr, delay: delay}
+}
+
+func (w *tworker) InterceptActivity(
+	ctx context.Context,
+	next interceptor.ActivityInboundInterceptor,
+) interceptor.ActivityInboundInterceptor {
+	i := &inbound{thr: w.thr, delay: w.delay}
+	i.Next = next
+	return i
+}
+
+type inbound struct {
+	interceptor.ActivityInboundInterceptorBase
+	thr   gohalt.Throttler
+	delay time.Duration
+}
+
+func (i *inbound) ExecuteActivity(ctx context.Context, in *interceptor.ExecuteActivityInput) (interface{}, error) {
+	ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+	ctx = gohalt.WithKey(ctx, activity.GetInfo(ctx).ActivityType.Name)
+	defer func() {
+		if err := i.thr.Release(ctx); err != nil {
+			gohalt.Log("temporal interceptor release error happened: %v", err)
+		}
+	}()
+	if err := i.thr.Acquire(ctx); err != nil {
+		delay := i.delay
+		var rerr gohalt.ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			delay = rerr.After
+		}
+		return nil, temporal.NewApplicationErrorWithOptions("activity is throttled", ErrorType, temporal.ApplicationErrorOptions{
+			Cause:          err,
+			NextRetryDelay: delay,
+		})
+	}
+	return i.Next.ExecuteActivity(ctx, in)
+}
@@ -0,0 +1,75 @@
+package gohalttemporal
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+)
+
+func test(context.Context) (string, error) {
+	return "test", nil
+}
+
+func TestInterceptor(t *testing.T) {
+	err := errors.New("test")
+	table := map[string]struct {
+		thr   gohalt.Throttler
+		err   error
+		delay time.Duration
+	}{
+		"Temporal interceptor should execute activity on throttler pass": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"Temporal interceptor should fail activity with default delay on throttler error": {
+			thr:   gohalt.NewThrottlerEcho(err),
+			err:   err,
+			delay: time.Minute,
+		},
+		"Temporal interceptor should fail activity with retry after delay on throttler retry error": {
+			thr:   gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: time.Hour, Err: err}),
+			err:   gohalt.ErrorRetry{Throttler: "test", After: time.Hour, Err: err},
+			delay: time.Hour,
+		},
+		"Temporal interceptor should fail activity on matched activity type": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{Pattern: regexp.MustCompile("^test$"), Throttler: gohalt.NewThrottlerEcho(err)},
+			),
+			err:   err,
+			delay: time.Minute,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			var suite testsuite.WorkflowTestSuite
+			env := suite.NewTestActivityEnvironment()
+			env.SetWorkerOptions(worker.Options{
+				Interceptors: []interceptor.WorkerInterceptor{NewInterceptor(tcase.thr, time.Minute)},
+			})
+			env.RegisterActivityWithOptions(test, activity.RegisterOptions{Name: "test"})
+			val, aerr := env.ExecuteActivity("test")
+			if tcase.err == nil {
+				require.NoError(t, aerr)
+				var result string
+				require.NoError(t, val.Get(&result))
+				require.Equal(t, "test", result)
+				return
+			}
+			var apperr *temporal.ApplicationError
+			require.ErrorAs(t, aerr, &apperr)
+			require.Equal(t, ErrorType, apperr.Type())
+			require.False(t, apperr.NonRetryable())
+			require.Equal(t, tcase.delay, apperr.NextRetryDelay())
+			require.ErrorContains(t, apperr, tcase.err.Error())
+		})
+	}
+}
@@ -0,0 +1,94 @@
+// Package gohalttwirp provides twirp integration for gohalt throttlers,
+// so twirp services could throttle each rpc method with twirp native errors.
+package gohalttwirp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/twitchtv/twirp"
+)
+
+type ctxkey struct{}
+
+// acquisition tracks throttler acquisition of single request,
+// so throttler is released only once and only if it was acquired.
+type acquisition struct {
+	once sync.Once
+	ctx  context.Context
+}
+
+// NewServerHooks creates twirp server hooks instance
+// that acquires the provided throttler once request is routed and releases it once response is sent or failed.
+// Request context is stamped with `gohalt.WithTimestamp` once request is received,
+// so `latency` and `percentile` throttlers observe the whole request latency,
+// and with `gohalt.WithKey` set to "{package}.{service}/{method}" once request is routed,
+// so `pattern` and `router` throttlers could select throttler per endpoint.
+// Throttled requests are failed with `twirp.ResourceExhausted` error with "retry_after" error meta
+// and `Retry-After` header set from `gohalt.ErrorRetry` retry after duration if any,
+// internal throttling errors are failed with `twirp.Internal` error.
+// Release errors are only logged.
+func NewServerHooks(thr gohalt.Throttler) *twirp.ServerHooks {
+	release := func(ctx context.Context) {
+		if acq, ok := ctx.Value(ctxkey{}).(*acquisition); ok {
+			acq.once.Do(func() {
+				if acq.ctx == nil {
+					return
+				}
+				if err := thr.Release(acq.ctx); err != nil {
+					gohalt.Log("twirp hooks release error happened: %v", err)
+				}
+			})
+		}
+	}
+	return &twirp.ServerHooks{
+		RequestReceived: func(ctx context.Context) (context.Context, error) {
+			ctx = gohalt.WithTimestamp(ctx, time.Now().UTC())
+			return context.WithValue(ctx, ctxkey{}, &acquisition{}), nil
+		},
+		RequestRouted: func(ctx context.Context) (context.Context, error) {
+			ctx = gohalt.WithKey(ctx, endpoint(ctx))
+			if acq, ok := ctx.Value(ctxkey{}).(*acquisition); ok {
+				acq.ctx = ctx
+			}
+			if err := thr.Acquire(ctx); err != nil {
+				return ctx, deny(ctx, err)
+			}
+			return ctx, nil
+		},
+		ResponseSent: release,
+		Error: func(ctx context.Context, _ twirp.Error) context.Context {
+			release(ctx)
+			return ctx
+		},
+	}
+}
+
+func endpoint(ctx context.Context) string {
+	service, _ := twirp.ServiceName(ctx)
+	method, _ := twirp.MethodName(ctx)
+	if pkg, ok := twirp.PackageName(ctx); ok && pkg != "" {
+		service = pkg + "." + service
+	}
+	return service + "/" + method
+}
+
+func deny(ctx context.Context, err error) error {
+	var ierr gohalt.ErrorInternal
+	if errors.As(err, &ierr) {
+		return twirp.InternalErrorWith(err)
+	}
+	terr := twirp.NewError(twirp.ResourceExhausted, err.Error())
+	var rerr gohalt.ErrorRetry
+	if errors.As(err, &rerr) && rerr.After > 0 {
+		after := strconv.FormatInt(int64(math.Ceil(rerr.After.Seconds())), 10)
+		_ = twirp.SetHTTPResponseHeader(ctx, "Retry-After", after)
+		terr = terr.WithMeta("retry_after", after)
+	}
+	return terr
+}
@@ -0,0 +1,87 @@
+package gohalttwirp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/stretchr/testify/require"
+	"github.com/twitchtv/twirp"
+	"github.com/twitchtv/twirp/example"
+)
+
+type haberdasher struct {
+	err error
+}
+
+func (h haberdasher) MakeHat(context.Context, *example.Size) (*example.Hat, error) {
+	return &example.Hat{Color: "black"}, h.err
+}
+
+func TestServerHooks(t *testing.T) {
+	table := map[string]struct {
+		thr   gohalt.Throttler
+		err   error
+		code  twirp.ErrorCode
+		retry string
+	}{
+		"Twirp hooks should pass not throttled requests": {
+			thr: gohalt.NewThrottlerEcho(nil),
+		},
+		"Twirp hooks should deny throttled requests": {
+			thr:  gohalt.NewThrottlerEcho(errors.New("test")),
+			code: twirp.ResourceExhausted,
+		},
+		"Twirp hooks should deny throttled requests with retry after": {
+			thr:   gohalt.NewThrottlerEcho(gohalt.ErrorRetry{Throttler: "test", After: 1500 * time.Millisecond}),
+			code:  twirp.ResourceExhausted,
+			retry: "2",
+		},
+		"Twirp hooks should fail on internal throttling errors": {
+			thr:  gohalt.NewThrottlerEcho(gohalt.ErrorInternal{Throttler: "test", Message: "test"}),
+			code: twirp.Internal,
+		},
+		"Twirp hooks should select throttler per endpoint": {
+			thr: gohalt.NewThrottlerPattern(
+				gohalt.Pattern{
+					Pattern:   regexp.MustCompile(`^twitch\.twirp\.example\.Haberdasher/MakeHat$`),
+					Throttler: gohalt.NewThrottlerEcho(errors.New("test")),
+				},
+				gohalt.Pattern{Throttler: gohalt.NewThrottlerEcho(nil)},
+			),
+			code: twirp.ResourceExhausted,
+		},
+		"Twirp hooks should release throttler on handler errors": {
+			thr:  gohalt.NewThrottlerRunning(1),
+			err:  twirp.NewError(twirp.Unavailable, "test"),
+			code: twirp.Unavailable,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			srv := httptest.NewServer(example.NewHaberdasherServer(
+				haberdasher{err: tcase.err},
+				twirp.WithServerHooks(NewServerHooks(tcase.thr)),
+			))
+			defer srv.Close()
+			client := example.NewHaberdasherProtobufClient(srv.URL, http.DefaultClient)
+			// run twice to ensure that throttler is released after each request.
+			for i := 0; i < 2; i++ {
+				_, err := client.MakeHat(context.Background(), &example.Size{Inches: 1})
+				if tcase.code == twirp.NoError {
+					require.NoError(t, err)
+					continue
+				}
+				var terr twirp.Error
+				require.True(t, errors.As(err, &terr))
+				require.Equal(t, tcase.code, terr.Code())
+				require.Equal(t, tcase.retry, terr.Meta("retry_after"))
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Package gohaltwebsocket provides gorilla websocket integration for gohalt throttlers,
+// so flooding websocket clients could be throttled per connection.
+package gohaltwebsocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/1pkg/gohalt"
+	"github.com/gorilla/websocket"
+)
+
+// Policy defines throttled websocket messages handling policy.
+type Policy uint8
+
+const (
+	// PolicyDrop drops throttled messages and keeps reading the connection.
+	PolicyDrop Policy = iota
+	// PolicyClose closes the connection with policy violation close code on throttled message.
+	PolicyClose
+)
+
+// Notify defines throttled websocket messages hook
+// that could be used to notify the client about throttling, e.g. by writing a message back.
+type Notify func(*websocket.Conn, error)
+
+// Conn defines gorilla websocket connection wrapper that throttles messages reading,
+// all not throttled methods are delegated to the wrapped connection.
+type Conn struct {
+	*websocket.Conn
+	thr    gohalt.Throttler
+	key    string
+	policy Policy
+	notify Notify
+}
+
+// NewConn creates gorilla websocket connection wrapper instance that acquires the provided throttler
+// for each read message and releases it right after the acquire,
+// so messages rate could be limited per connection, e.g. with `bucket` or `timed` throttler.
+// Throttler context is stamped with `gohalt.WithKey` set to the specified key
+// or to the connection remote address if the key is empty,
+// so keyed throttlers could throttle each connection separately.
+// Throttled messages are handled according to the specified policy,
+// the provided notify hook is called for each throttled message before the policy is applied if it's not nil.
+// Release errors are only logged.
+func NewConn(conn *websocket.Conn, thr gohalt.Throttler, key string, policy Policy, notify Notify) *Conn {
+	if key == "" {
+		key = conn.RemoteAddr().String()
+	}
+	return &Conn{Conn: conn, thr: thr, key: key, policy: policy, notify: notify}
+}
+
+// ReadMessage reads the next not throttled message from the wrapped connection,
+// with `PolicyClose` policy throttled message closes the connection and its throttling error is returned.
+// See `websocket.Conn.ReadMessage`.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	for {
+		mt, msg, err := c.Conn.ReadMessage()
+		if err != nil {
+			return mt, msg, err
+		}
+		ctx := gohalt.WithKey(context.Background(), c.key)
+		err = c.thr.Acquire(ctx)
+		if rerr := c.thr.Release(ctx); rerr != nil {
+			gohalt.Log("websocket conn release error happened: %v", rerr)
+		}
+		if err == nil {
+			return mt, msg, nil
+		}
+		if c.notify != nil {
+			c.notify(c.Conn, err)
+		}
+		switch c.policy {
+		case PolicyClose:
+			msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "throttled")
+			if werr := c.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second)); werr != nil {
+				gohalt.Log("websocket conn close error happened: %v", werr)
+			}
+			_ = c.Conn.Close()
+			return mt, nil, err
+		default:
+			gohalt.Log("websocket conn message is dropped: %v", err)
+		}
+	}
+}
+
+// ReadJSON reads the next not throttled message from the wrapped connection
+// and stores it in the value pointed to by the provided value, see `Conn.ReadMessage`.
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, msg, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(msg, v)
+}
@@ -0,0 +1,86 @@
+package gohaltwebsocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/1pkg/gohalt"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConn(t *testing.T) {
+	table := map[string]struct {
+		thr      gohalt.Throttler
+		policy   Policy
+		messages []string
+		notified int32
+		code     int
+	}{
+		"Websocket conn should read messages on throttler pass": {
+			thr:      gohalt.NewThrottlerEcho(nil),
+			messages: []string{"1", "2", "3"},
+			code:     websocket.CloseNormalClosure,
+		},
+		"Websocket conn should drop messages on throttler error": {
+			thr:      gohalt.NewThrottlerEach(2),
+			policy:   PolicyDrop,
+			messages: []string{"1", "3"},
+			notified: 1,
+			code:     websocket.CloseNormalClosure,
+		},
+		"Websocket conn should close connection on throttler error": {
+			thr:      gohalt.NewThrottlerAfter(1),
+			policy:   PolicyClose,
+			messages: []string{"1"},
+			notified: 1,
+			code:     websocket.ClosePolicyViolation,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			var notified int32
+			messages := make(chan []string, 1)
+			var upgrader websocket.Upgrader
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ws, err := upgrader.Upgrade(w, r, nil)
+				require.NoError(t, err)
+				conn := NewConn(ws, tcase.thr, "", tcase.policy, func(ws *websocket.Conn, err error) {
+					atomic.AddInt32(&notified, 1)
+					require.Error(t, err)
+				})
+				defer conn.Close()
+				var read []string
+				for {
+					var msg string
+					if err := conn.ReadJSON(&msg); err != nil {
+						messages <- read
+						return
+					}
+					read = append(read, msg)
+				}
+			}))
+			defer srv.Close()
+			client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+			require.NoError(t, err)
+			defer client.Close()
+			for _, msg := range []string{"1", "2", "3"} {
+				require.NoError(t, client.WriteJSON(msg))
+			}
+			if tcase.code == websocket.CloseNormalClosure {
+				msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+				require.NoError(t, client.WriteMessage(websocket.CloseMessage, msg))
+			}
+			_, _, err = client.ReadMessage()
+			var cerr *websocket.CloseError
+			require.True(t, errors.As(err, &cerr))
+			require.Equal(t, tcase.code, cerr.Code)
+			require.Equal(t, tcase.messages, <-messages)
+			require.Equal(t, tcase.notified, atomic.LoadInt32(&notified))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Package gohaltzookeeper provides zookeeper integration for gohalt throttlers,
+// so running quota could be shared across replicas via zookeeper ephemeral nodes.
+package gohaltzookeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/1pkg/gohalt"
+	"github.com/go-zookeeper/zk"
+)
+
+// Client defines zookeeper client abstraction used by `NewThrottlerRunning`, e.g. `*zk.Conn`.
+type Client interface {
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	CreateProtectedEphemeralSequential(path string, data []byte, acl []zk.ACL) (string, error)
+	Children(path string) ([]string, *zk.Stat, error)
+	Delete(path string, version int32) error
+}
+
+type strpair struct {
+	current   uint64
+	threshold uint64
+}
+
+func (p strpair) String() string {
+	return fmt.Sprintf("%d out of %d", p.current, p.threshold)
+}
+
+type trunning struct {
+	client    Client
+	path      string
+	threshold uint64
+	lock      sync.Mutex
+	nodes     []string
+}
+
+// NewThrottlerRunning creates new throttler instance that
+// throttles each call which exeeds the running quota acquired - release
+// q defined by the specified threshold shared across all replicas
+// via zookeeper ephemeral sequential permit nodes under the specified path on zookeeper reached by the provided client.
+// Call is admitted only if its permit node is among the threshold lowest sequential nodes, otherwise the node is deleted,
+// so concurrent acquires could be throttled spuriously but the running quota is never exceeded.
+// Permit nodes are ephemeral, so permits of crashed replicas are released on their zookeeper session expiration.
+// Client connection and session renewal is left to the provided client, e.g. `*zk.Conn` created with `zk.Connect`.
+// - could return `gohalt.ErrorThreshold`;
+// - could return `gohalt.ErrorInternal`;
+func NewThrottlerRunning(client Client, path string, threshold uint64) gohalt.Throttler {
+	return &trunning{client: client, path: strings.TrimSuffix(path, "/"), threshold: threshold}
+}
+
+func (thr *trunning) Acquire(context.Context) error {
+	node, position, err := thr.position()
+	if err != nil {
+		return gohalt.ErrorInternal{
+			Throttler: "zookeeper",
+			Message:   err.Error(),
+		}
+	}
+	if position >= thr.threshold {
+		if err := thr.client.Delete(node, -1); err != nil && !errors.Is(err, zk.ErrNoNode) {
+			gohalt.Log("zookeeper running throttler permit node deletion error happened: %v", err)
+		}
+		return gohalt.ErrorThreshold{
+			Throttler: "zookeeper",
+			Threshold: strpair{current: position + 1, threshold: thr.threshold},
+		}
+	}
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	thr.nodes = append(thr.nodes, node)
+	return nil
+}
+
+func (thr *trunning) Release(context.Context) error {
+	thr.lock.Lock()
+	if len(thr.nodes) == 0 {
+		thr.lock.Unlock()
+		return nil
+	}
+	node := thr.nodes[0]
+	thr.nodes = thr.nodes[1:]
+	thr.lock.Unlock()
+	if err := thr.client.Delete(node, -1); err != nil && !errors.Is(err, zk.ErrNoNode) {
+		return gohalt.ErrorInternal{
+			Throttler: "zookeeper",
+			Message:   err.Error(),
+		}
+	}
+	return nil
+}
+
+// position creates permit node and returns it along with number of permit nodes preceding it.
+func (thr *trunning) position() (string, uint64, error) {
+	node, err := thr.create()
+	if err != nil {
+		return "", 0, err
+	}
+	children, _, err := thr.client.Children(thr.path)
+	if err != nil {
+		_ = thr.client.Delete(node, -1)
+		return "", 0, err
+	}
+	// sequence suffix is zero padded so lexicographic order matches sequence order
+	sequence := thr.sequence(node)
+	var position uint64
+	for _, child := range children {
+		if thr.sequence(child) < sequence {
+			position++
+		}
+	}
+	return node, position, nil
+}
+
+// create creates protected ephemeral sequential permit node creating all missing parent nodes.
+func (thr *trunning) create() (string, error) {
+	acl := zk.WorldACL(zk.PermAll)
+	node, err := thr.client.CreateProtectedEphemeralSequential(thr.path+"/permit-", nil, acl)
+	if !errors.Is(err, zk.ErrNoNode) {
+		return node, err
+	}
+	parent := ""
+	for _, name := range strings.Split(strings.Trim(thr.path, "/"), "/") {
+		parent += "/" + name
+		if _, err := thr.client.Create(parent, nil, 0, acl); err != nil && !errors.Is(err, zk.ErrNodeExists) {
+			return "", err
+		}
+	}
+	return thr.client.CreateProtectedEphemeralSequential(thr.path+"/permit-", nil, acl)
+}
+
+// sequence returns zero padded zookeeper sequence suffix of the node.
+func (thr *trunning) sequence(node string) string {
+	if len(node) < 10 {
+		return node
+	}
+	return node[len(node)-10:]
+}
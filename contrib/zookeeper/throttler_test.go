@@ -0,0 +1,140 @@
+package gohaltzookeeper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/1pkg/gohalt"
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/require"
+)
+
+// tzookeeper defines in memory zookeeper client fake
+// that keeps nodes tree and assigns sequential node suffixes.
+type tzookeeper struct {
+	lock     sync.Mutex
+	nodes    map[string]bool
+	sequence int
+	err      error
+}
+
+func (zkc *tzookeeper) Create(node string, _ []byte, _ int32, _ []zk.ACL) (string, error) {
+	zkc.lock.Lock()
+	defer zkc.lock.Unlock()
+	if zkc.err != nil {
+		return "", zkc.err
+	}
+	if zkc.nodes[node] {
+		return "", zk.ErrNodeExists
+	}
+	if parent := path.Dir(node); parent != "/" && !zkc.nodes[parent] {
+		return "", zk.ErrNoNode
+	}
+	zkc.nodes[node] = true
+	return node, nil
+}
+
+func (zkc *tzookeeper) CreateProtectedEphemeralSequential(prefix string, _ []byte, _ []zk.ACL) (string, error) {
+	zkc.lock.Lock()
+	defer zkc.lock.Unlock()
+	if zkc.err != nil {
+		return "", zkc.err
+	}
+	parent, name := path.Split(prefix)
+	if !zkc.nodes[strings.TrimSuffix(parent, "/")] {
+		return "", zk.ErrNoNode
+	}
+	node := fmt.Sprintf("%s_c_uuid-%s%010d", parent, name, zkc.sequence)
+	zkc.sequence++
+	zkc.nodes[node] = true
+	return node, nil
+}
+
+func (zkc *tzookeeper) Children(node string) ([]string, *zk.Stat, error) {
+	zkc.lock.Lock()
+	defer zkc.lock.Unlock()
+	if zkc.err != nil {
+		return nil, nil, zkc.err
+	}
+	var children []string
+	for child := range zkc.nodes {
+		if path.Dir(child) == node {
+			children = append(children, path.Base(child))
+		}
+	}
+	return children, &zk.Stat{}, nil
+}
+
+func (zkc *tzookeeper) Delete(node string, _ int32) error {
+	zkc.lock.Lock()
+	defer zkc.lock.Unlock()
+	if zkc.err != nil {
+		return zkc.err
+	}
+	if !zkc.nodes[node] {
+		return zk.ErrNoNode
+	}
+	delete(zkc.nodes, node)
+	return nil
+}
+
+// expire deletes all permit nodes as on session expiration.
+func (zkc *tzookeeper) expire() {
+	zkc.lock.Lock()
+	defer zkc.lock.Unlock()
+	for node := range zkc.nodes {
+		if strings.Contains(node, "permit-") {
+			delete(zkc.nodes, node)
+		}
+	}
+}
+
+func TestThrottlerRunning(t *testing.T) {
+	ctx := context.TODO()
+	t.Run("ZooKeeper running throttler should share running quota via permit nodes", func(t *testing.T) {
+		client := &tzookeeper{nodes: make(map[string]bool)}
+		first := NewThrottlerRunning(client, "/gohalt/running/", 2)
+		second := NewThrottlerRunning(client, "/gohalt/running", 2)
+		require.NoError(t, first.Acquire(ctx))
+		require.True(t, client.nodes["/gohalt"])
+		require.True(t, client.nodes["/gohalt/running"])
+		require.NoError(t, second.Acquire(ctx))
+		require.Equal(t, gohalt.ErrorThreshold{
+			Throttler: "zookeeper",
+			Threshold: strpair{current: 3, threshold: 2},
+		}, first.Acquire(ctx))
+		children, _, _ := client.Children("/gohalt/running")
+		require.Len(t, children, 2)
+		require.NoError(t, first.Release(ctx))
+		require.NoError(t, first.Release(ctx))
+		require.NoError(t, second.Acquire(ctx))
+		client.expire()
+		require.NoError(t, second.Release(ctx))
+		require.NoError(t, second.Release(ctx))
+		require.NoError(t, first.Acquire(ctx))
+	})
+	t.Run("ZooKeeper running throttler should fail on client errors", func(t *testing.T) {
+		client := &tzookeeper{nodes: make(map[string]bool)}
+		thr := NewThrottlerRunning(client, "/gohalt/running", 1)
+		require.NoError(t, thr.Acquire(ctx))
+		client.err = errors.New("test")
+		require.Equal(t, gohalt.ErrorInternal{
+			Throttler: "zookeeper",
+			Message:   "test",
+		}, thr.Acquire(ctx))
+		require.Equal(t, gohalt.ErrorInternal{
+			Throttler: "zookeeper",
+			Message:   "test",
+		}, thr.Release(ctx))
+	})
+	t.Run("ZooKeeper running throttler should order permit nodes by sequence suffix", func(t *testing.T) {
+		thr := NewThrottlerRunning(nil, "/gohalt/running", 1).(*trunning)
+		require.Equal(t, "00000012", thr.sequence("00000012"))
+		require.Equal(t, "0000000012", thr.sequence("/gohalt/running/_c_uuid-permit-0000000012"))
+	})
+}
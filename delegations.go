@@ -0,0 +1,91 @@
+package gohalt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Delegation defines quota delegation token claims:
+// - ID shows unique delegation token identifier.
+// - Quota shows the slice of caller quota delegated to downstream service.
+// - Expires shows UTC time after which delegation token is no longer valid.
+type Delegation struct {
+	ID      string    `json:"id"`
+	Quota   uint64    `json:"quota"`
+	Expires time.Time `json:"expires"`
+}
+
+// MintDelegation acquires the provided quota slice from the provided throttler
+// and mints new short lived delegation token signed with the provided secret
+// that could be passed to downstream service, see `NewThrottlerDelegation`.
+// New unique delegation id `gohalt_delegation_{{uuid}}` is created for each new token.
+// Use `WithWeight` semantic to acquire the quota slice from the provided throttler,
+// so the provided throttler is expected to be weight aware.
+// Acquired quota slice is released back to the provided throttler if the token can't be signed.
+func MintDelegation(
+	ctx context.Context,
+	thr Throttler,
+	secret []byte,
+	quota uint64,
+	ttl time.Duration,
+) (string, error) {
+	ctx = WithWeight(ctx, int64(quota))
+	if err := thr.Acquire(ctx); err != nil {
+		return "", err
+	}
+	token, err := signDelegation(secret, Delegation{
+		ID:      fmt.Sprintf("gohalt_delegation_%s", uuid.NewV4()),
+		Quota:   quota,
+		Expires: time.Now().UTC().Add(ttl),
+	})
+	if err != nil {
+		_ = thr.Release(ctx)
+		return "", err
+	}
+	return token, nil
+}
+
+func signDelegation(secret []byte, dlg Delegation) (string, error) {
+	claims, err := json.Marshal(dlg)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(payload))
+	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	return payload + "." + signature, nil
+}
+
+func verifyDelegation(secret []byte, token string) (dlg Delegation, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return dlg, errors.New("delegation token is malformed")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return dlg, errors.New("delegation token is malformed")
+	}
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(parts[0]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return dlg, errors.New("delegation token signature is invalid")
+	}
+	claims, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return dlg, errors.New("delegation token is malformed")
+	}
+	if err := json.Unmarshal(claims, &dlg); err != nil {
+		return dlg, errors.New("delegation token is malformed")
+	}
+	return dlg, nil
+}
@@ -2,6 +2,8 @@ package gohalt
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -26,6 +28,15 @@ func (p strpercent) String() string {
 	return fmt.Sprintf("%.4f%%", float64(p)*100)
 }
 
+type strpercents struct {
+	current   float64
+	threshold float64
+}
+
+func (p strpercents) String() string {
+	return fmt.Sprintf("%s out of %s", strpercent(p.current), strpercent(p.threshold))
+}
+
 type strdurations struct {
 	current   time.Duration
 	threshold time.Duration
@@ -60,6 +71,13 @@ func (s strstats) String() string {
 			%d out of %d bytes
 			%d out of %d ns
 			%.4f out of %.4f %%
+			%d out of %d goroutines
+			%.4f out of %.4f %% fds
+			%d out of %d disk bytes/s
+			%d out of %d disk iops
+			%d out of %d network bytes/s
+			%.4f out of %.4f %% memory
+			%.2f %.2f %.2f out of %.2f %.2f %.2f load average
 		`,
 		s.current.MEMAlloc,
 		s.threshold.MEMAlloc,
@@ -69,6 +87,24 @@ func (s strstats) String() string {
 		s.threshold.CPUPause,
 		s.current.CPUUsage*100,
 		s.threshold.CPUUsage*100,
+		s.current.Goroutines,
+		s.threshold.Goroutines,
+		s.current.FDUsage,
+		s.threshold.FDUsage,
+		s.current.DISKThroughput,
+		s.threshold.DISKThroughput,
+		s.current.DISKIOPS,
+		s.threshold.DISKIOPS,
+		s.current.NETBandwidth,
+		s.threshold.NETBandwidth,
+		s.current.MEMUsage,
+		s.threshold.MEMUsage,
+		s.current.LOADAvg1,
+		s.current.LOADAvg5,
+		s.current.LOADAvg15,
+		s.threshold.LOADAvg1,
+		s.threshold.LOADAvg5,
+		s.threshold.LOADAvg15,
 	)
 }
 
@@ -87,11 +123,50 @@ func (err ErrorThreshold) Error() string {
 	)
 }
 
+// ErrorRetry defines error type
+// that occurs if throttler rejects call that could be retried after specified duration.
+type ErrorRetry struct {
+	Throttler string
+	After     time.Duration
+	Err       error
+}
+
+func (err ErrorRetry) Error() string {
+	return fmt.Sprintf(
+		"throttler %q has rejected call, retry after %s: %v",
+		err.Throttler,
+		err.After,
+		err.Err,
+	)
+}
+
+// Unwrap returns underlying rejection error.
+func (err ErrorRetry) Unwrap() error {
+	return err.Err
+}
+
+// ErrorTimeout defines error type
+// that occurs if throttler acquire exceeds specified timeout.
+type ErrorTimeout struct {
+	Throttler string
+	Timeout   time.Duration
+}
+
+func (err ErrorTimeout) Error() string {
+	return fmt.Sprintf(
+		"throttler %q acquire has exceeded its timeout: %s",
+		err.Throttler,
+		err.Timeout,
+	)
+}
+
 // ErrorInternal defines error type
 // that occurs if throttler internal error happens.
+// Err optionally carries the underlying error, e.g. `ErrorComposite` for `all` and `any` throttlers.
 type ErrorInternal struct {
 	Throttler string
 	Message   string
+	Err       error
 }
 
 func (err ErrorInternal) Error() string {
@@ -101,3 +176,46 @@ func (err ErrorInternal) Error() string {
 		err.Message,
 	)
 }
+
+// Unwrap returns underlying internal error if any.
+func (err ErrorInternal) Unwrap() error {
+	return err.Err
+}
+
+// ErrorComposite defines error type
+// that occurs if composed throttler throttles because of its children throttlers errors.
+// Errors are keyed by throttling children throttlers indexes in composed throttlers list.
+type ErrorComposite struct {
+	Throttler string
+	Errors    map[int]error
+}
+
+func (err ErrorComposite) Error() string {
+	reasons := make([]string, 0, len(err.Errors))
+	for _, index := range err.indexes() {
+		reasons = append(reasons, fmt.Sprintf("[%d] %v", index, err.Errors[index]))
+	}
+	return fmt.Sprintf(
+		"throttler %q children throttlers have throttled: %s",
+		err.Throttler,
+		strings.Join(reasons, "; "),
+	)
+}
+
+// Unwrap returns underlying children throttlers errors ordered by indexes.
+func (err ErrorComposite) Unwrap() []error {
+	errs := make([]error, 0, len(err.Errors))
+	for _, index := range err.indexes() {
+		errs = append(errs, err.Errors[index])
+	}
+	return errs
+}
+
+func (err ErrorComposite) indexes() []int {
+	indexes := make([]int, 0, len(err.Errors))
+	for index := range err.Errors {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
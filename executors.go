@@ -104,6 +104,16 @@ func retried(retries uint64, run Runnable) Runnable {
 	}
 }
 
+func eager(retries uint64, run Runnable) Runnable {
+	return func(ctx context.Context) error {
+		// don't delay the first attempt as retried does
+		if err := run(ctx); err == nil || retries == 0 {
+			return err
+		}
+		return retried(retries-1, run)(ctx)
+	}
+}
+
 func once(run Runnable) Runnable {
 	var once sync.Once
 	return func(ctx context.Context) (err error) {
@@ -142,6 +152,26 @@ func all(runs ...Runnable) Runnable {
 	}
 }
 
+func first(match func(error) bool, runs ...Runnable) Runnable {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		results := make(chan error, len(runs))
+		for _, run := range runs {
+			go func(run Runnable) {
+				results <- run(ctx)
+			}(run)
+		}
+		var result error
+		for range runs {
+			if result = <-results; match(result) {
+				return result
+			}
+		}
+		return result
+	}
+}
+
 func gorun(ctx context.Context, r Runnable) {
 	go func() {
 		_ = r(ctx)
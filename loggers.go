@@ -10,8 +10,14 @@ type Logger func(string, ...interface{})
 // Loggign can be completely disabled by setting DefaultLogger to nil.
 var DefaultLogger Logger = stdlog.Printf
 
-func log(format string, v ...interface{}) {
+// Log logs the provided format and values with `DefaultLogger` unless logging is disabled,
+// it is intended for gohalt integrations that need to follow gohalt logging settings.
+func Log(format string, v ...interface{}) {
 	if DefaultLogger != nil {
 		DefaultLogger(format, v...)
 	}
 }
+
+func log(format string, v ...interface{}) {
+	Log(format, v...)
+}
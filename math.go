@@ -2,6 +2,7 @@ package gohalt
 
 import (
 	"crypto/rand"
+	"hash/fnv"
 	"math"
 	"math/big"
 )
@@ -13,3 +14,18 @@ func rndf64(fallback float64) float64 {
 	}
 	return float64(rnd.Int64()) / math.MaxInt64
 }
+
+// jump implements jump consistent hash algorithm
+// by Lamping and Veach on top of fnv hash of the provided key.
+func jump(key string, buckets int) int32 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	hash := h.Sum64()
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		hash = hash*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((hash>>33)+1)))
+	}
+	return int32(b)
+}
@@ -0,0 +1,176 @@
+package gohalt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Membership defines cluster membership interface that returns the number of live instances.
+type Membership interface {
+	// Members returns the number of live instances or internal error if any happened.
+	Members(context.Context) (uint64, error)
+}
+
+type mbstatic uint64
+
+// NewMembershipStatic creates static membership instance
+// which always returns the specified number of live instances.
+func NewMembershipStatic(members uint64) Membership {
+	return mbstatic(members)
+}
+
+func (mb mbstatic) Members(context.Context) (uint64, error) {
+	return uint64(mb), nil
+}
+
+type mbstorage struct {
+	clock    clock
+	stg      Storage
+	key      string
+	interval time.Duration
+	lock     sync.Mutex
+	window   int64
+}
+
+// NewMembershipStorage creates heartbeat membership instance
+// which counts live instances sharing the provided storage under the specified key,
+// e.g. Redis heartbeat membership could be created with `gohaltredis.NewStorage`.
+// Each instance heartbeats once per fixed interval window, 10s by default, aligned to unix epoch
+// by incrementing the window counter on members call,
+// so the number of live instances is the max of previous and current window counters.
+// Storage key is defined as `gohalt_members:{{key}}:{{window}}`.
+func NewMembershipStorage(stg Storage, key string, interval time.Duration) Membership {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &mbstorage{stg: stg, key: key, interval: interval}
+}
+
+func (mb *mbstorage) Members(ctx context.Context) (uint64, error) {
+	// membership windows are aligned to wall time shared across instances, so clock jumps need no resynchronization.
+	now, _ := mb.clock.now("membership")
+	window := now.UnixNano() / int64(mb.interval)
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+	// heartbeat only once per window.
+	var delta int64
+	if mb.window != window {
+		delta = 1
+	}
+	key := fmt.Sprintf("gohalt_members:%s:%d", mb.key, window)
+	current, err := mb.stg.Incr(ctx, key, delta, 2*mb.interval)
+	if err != nil {
+		return 0, err
+	}
+	mb.window = window
+	prev, ok, err := mb.stg.Get(ctx, fmt.Sprintf("gohalt_members:%s:%d", mb.key, window-1))
+	if err != nil {
+		return 0, err
+	}
+	members := uint64(current)
+	if ok {
+		if prev, err := strconv.ParseUint(string(prev), 10, 64); err == nil && prev > members {
+			members = prev
+		}
+	}
+	return members, nil
+}
+
+const mbkubernetesAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+type mbkubernetes struct {
+	connect Runnable
+	client  *http.Client
+	url     string
+	account string
+}
+
+// NewMembershipKubernetes creates Kubernetes membership instance
+// which counts ready addresses of the specified service endpoints in the specified namespace
+// via Kubernetes API using in cluster service account config.
+// Service account token is reread on each members call, so rotated tokens are picked up.
+// Only successful in cluster configs are cached.
+func NewMembershipKubernetes(namespace string, service string) Membership {
+	mb := &mbkubernetes{account: mbkubernetesAccount}
+	var lock sync.Mutex
+	memconnect, _ := cached(0, func(ctx context.Context) error {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return errors.New("kubernetes in cluster config is not found")
+		}
+		ca, err := os.ReadFile(mb.account + "/ca.crt")
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return errors.New("kubernetes in cluster ca certificate is malformed")
+		}
+		mb.client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+		mb.url = fmt.Sprintf("https://%s/api/v1/namespaces/%s/endpoints/%s", net.JoinHostPort(host, port), namespace, service)
+		return nil
+	})
+	mb.connect = func(ctx context.Context) error {
+		lock.Lock()
+		defer lock.Unlock()
+		return memconnect(ctx)
+	}
+	return mb
+}
+
+func (mb *mbkubernetes) Members(ctx context.Context) (uint64, error) {
+	if err := mb.connect(ctx); err != nil {
+		return 0, err
+	}
+	token, err := os.ReadFile(mb.account + "/token")
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mb.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	resp, err := mb.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("kubernetes endpoints request has failed with status %q", resp.Status)
+	}
+	var endpoints struct {
+		Subsets []struct {
+			Addresses []json.RawMessage `json:"addresses"`
+		} `json:"subsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&endpoints); err != nil {
+		return 0, err
+	}
+	var members uint64
+	for _, subset := range endpoints.Subsets {
+		members += uint64(len(subset.Addresses))
+	}
+	return members, nil
+}
+
+type mbmock struct {
+	members uint64
+	err     error
+}
+
+func (mb mbmock) Members(context.Context) (uint64, error) {
+	return mb.members, mb.err
+}
@@ -0,0 +1,69 @@
+package gohalt
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMembershipStorage(t *testing.T) {
+	stg := NewStorageMemory()
+	first := NewMembershipStorage(stg, "test", time.Hour)
+	second := NewMembershipStorage(stg, "test", time.Hour)
+	ctx := context.TODO()
+	members, err := first.Members(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), members)
+	members, err = second.Members(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), members)
+	members, err = first.Members(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), members)
+	_, err = NewMembershipStorage(stgmock{err: errors.New("test")}, "test", time.Hour).Members(ctx)
+	require.Error(t, err)
+	// zero interval falls back to default heartbeat interval.
+	members, err = NewMembershipStorage(NewStorageMemory(), "test", 0).Members(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), members)
+}
+
+func TestMembershipKubernetes(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/endpoints/test" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"subsets":[{"addresses":[{"ip":"10.0.0.1"},{"ip":"10.0.0.2"}]},{"addresses":[{"ip":"10.0.0.3"}]}]}`))
+	}))
+	defer srv.Close()
+	account := t.TempDir()
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(filepath.Join(account, "ca.crt"), ca, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(account, "token"), []byte("token\n"), 0o644))
+	host, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	ctx := context.TODO()
+	_, err = NewMembershipKubernetes("default", "test").Members(ctx)
+	require.Error(t, err)
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+	mb := NewMembershipKubernetes("default", "test")
+	mb.(*mbkubernetes).account = account
+	members, err := mb.Members(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), members)
+	mb = NewMembershipKubernetes("default", "unknown")
+	mb.(*mbkubernetes).account = account
+	_, err = mb.Members(ctx)
+	require.Error(t, err)
+}
@@ -22,6 +22,7 @@ type mtcv func(context.Context) (bool, error)
 
 type mtcprometheus struct {
 	mtcv  mtcv
+	eval  func(model.SampleValue) (bool, error)
 	value bool
 }
 
@@ -30,7 +31,33 @@ type mtcprometheus struct {
 // which executes provided prometheus boolean metric query and cache it.
 // Only successful metric results are cached.
 func NewMetricPrometheus(url string, query string, cache time.Duration) Metric {
-	mtc := &mtcprometheus{}
+	return newMetricPrometheus(url, query, cache, func(value model.SampleValue) (bool, error) {
+		if value != 0 && value != 1 {
+			return false, fmt.Errorf("boolean metric value expected instead of %v", value)
+		}
+		return value == 1, nil
+	})
+}
+
+// NewMetricPrometheusThreshold creates prometheus metric querier instance
+// with cache interval defined by the provided duration
+// which executes provided arbitrary prometheus instant query,
+// e.g. downstream p99 latency from the service mesh,
+// and checks if its single sample or scalar value exceeds the provided threshold and cache it.
+// Only successful metric results are cached.
+func NewMetricPrometheusThreshold(url string, query string, threshold float64, cache time.Duration) Metric {
+	return newMetricPrometheus(url, query, cache, func(value model.SampleValue) (bool, error) {
+		return float64(value) > threshold, nil
+	})
+}
+
+func newMetricPrometheus(
+	url string,
+	query string,
+	cache time.Duration,
+	eval func(model.SampleValue) (bool, error),
+) Metric {
+	mtc := &mtcprometheus{eval: eval}
 	var api prometheus.API
 	mempull, _ := cached(cache, func(ctx context.Context) (err error) {
 		if api == nil {
@@ -79,15 +106,23 @@ func (mtc *mtcprometheus) pull(ctx context.Context, api prometheus.API, query st
 	for _, warn := range warns {
 		log("prometheus warning happened: %s", warn)
 	}
-	vec, ok := val.(model.Vector)
-	if !ok || vec.Len() != 1 {
+	var value model.SampleValue
+	switch val := val.(type) {
+	case model.Vector:
+		if val.Len() != 1 {
+			return fmt.Errorf("vector metric with single sample expected instead of %v", val)
+		}
+		value = val[0].Value
+	case *model.Scalar:
+		value = val.Value
+	default:
 		return fmt.Errorf("vector metric with single sample expected instead of %v", val)
 	}
-	value := vec[0].Value
-	if value != 0 && value != 1 {
-		return fmt.Errorf("boolean metric value expected instead of %v", value)
+	result, err := mtc.eval(value)
+	if err != nil {
+		return err
 	}
-	mtc.value = value == 1
+	mtc.value = result
 	return nil
 }
 
@@ -0,0 +1,66 @@
+package gohalt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricPrometheus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Form.Get("query") {
+		case "up":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"1"]}]}}`))
+		case "latency":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.25"]}]}}`))
+		case "scalar(latency)":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000,"0.75"]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		}
+	}))
+	defer srv.Close()
+	table := map[string]struct {
+		mtc    Metric
+		metric bool
+		err    bool
+	}{
+		"Prometheus metric should return boolean metric value": {
+			mtc:    NewMetricPrometheus(srv.URL, "up", time.Minute),
+			metric: true,
+		},
+		"Prometheus metric should fail on non boolean metric value": {
+			mtc: NewMetricPrometheus(srv.URL, "latency", time.Minute),
+			err: true,
+		},
+		"Prometheus metric should fail on empty vector": {
+			mtc: NewMetricPrometheusThreshold(srv.URL, "empty", 0.5, time.Minute),
+			err: true,
+		},
+		"Prometheus threshold metric should not be reached below threshold": {
+			mtc:    NewMetricPrometheusThreshold(srv.URL, "latency", 0.5, time.Minute),
+			metric: false,
+		},
+		"Prometheus threshold metric should be reached above threshold": {
+			mtc:    NewMetricPrometheusThreshold(srv.URL, "scalar(latency)", 0.5, time.Minute),
+			metric: true,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			metric, err := tcase.mtc.Query(context.Background())
+			if tcase.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tcase.metric, metric)
+		})
+	}
+}
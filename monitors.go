@@ -2,23 +2,47 @@ package gohalt
 
 import (
 	"context"
+	"os"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/mem"
+	psnet "github.com/shirou/gopsutil/net"
+	"github.com/shirou/gopsutil/process"
 )
 
 // Stats defines typical set of metrics returned by system monitor:
 // - MEMAlloc shows how many bytes are allocated by heap objects.
 // - MEMSystem shows how many bytes are obtained from the OS.
 // - CPUPause shows average GC stop-the-world pause in nanoseconds.
-// - CPUUsage shows average CPU utilization in percents.
+// - CPUUsage shows average CPU utilization in percents,
+// relative to container CPU quota if it is limited by cgroup.
+// - Goroutines shows number of goroutines that currently exist.
+// - FDUsage shows open file descriptors utilization relative to soft limit in percents.
+// - DISKThroughput shows disks read and write throughput in bytes per second.
+// - DISKIOPS shows disks read and write operations per second.
+// - NETBandwidth shows network interfaces sent and received bandwidth in bytes per second.
+// - MEMUsage shows memory utilization in percents,
+// relative to container memory limit if it is limited by cgroup.
+// - LOADAvg1, LOADAvg5, LOADAvg15 show OS load average for 1, 5 and 15 minutes.
 type Stats struct {
-	MEMAlloc  uint64
-	MEMSystem uint64
-	CPUPause  uint64
-	CPUUsage  float64
+	MEMAlloc       uint64
+	MEMSystem      uint64
+	CPUPause       uint64
+	CPUUsage       float64
+	Goroutines     uint64
+	FDUsage        float64
+	DISKThroughput uint64
+	DISKIOPS       uint64
+	NETBandwidth   uint64
+	MEMUsage       float64
+	LOADAvg1       float64
+	LOADAvg5       float64
+	LOADAvg15      float64
 }
 
 // Compare checks if provided stats is below current stats.
@@ -26,7 +50,16 @@ func (s Stats) Compare(stats Stats) bool {
 	return (s.MEMAlloc > 0 && stats.MEMAlloc >= s.MEMAlloc) ||
 		(s.MEMSystem > 0 && stats.MEMSystem >= s.MEMSystem) ||
 		(s.CPUPause > 0 && stats.CPUPause >= s.CPUPause) ||
-		(s.CPUUsage > 0 && stats.CPUUsage >= s.CPUUsage)
+		(s.CPUUsage > 0 && stats.CPUUsage >= s.CPUUsage) ||
+		(s.Goroutines > 0 && stats.Goroutines >= s.Goroutines) ||
+		(s.FDUsage > 0 && stats.FDUsage >= s.FDUsage) ||
+		(s.DISKThroughput > 0 && stats.DISKThroughput >= s.DISKThroughput) ||
+		(s.DISKIOPS > 0 && stats.DISKIOPS >= s.DISKIOPS) ||
+		(s.NETBandwidth > 0 && stats.NETBandwidth >= s.NETBandwidth) ||
+		(s.MEMUsage > 0 && stats.MEMUsage >= s.MEMUsage) ||
+		(s.LOADAvg1 > 0 && stats.LOADAvg1 >= s.LOADAvg1) ||
+		(s.LOADAvg5 > 0 && stats.LOADAvg5 >= s.LOADAvg5) ||
+		(s.LOADAvg15 > 0 && stats.LOADAvg15 >= s.LOADAvg15)
 }
 
 // Monitor defines system monitor interface that returns the system stats.
@@ -39,16 +72,31 @@ type Monitor interface {
 type mnts func(context.Context) (Stats, error)
 
 type mntsys struct {
-	mnts  mnts
-	stats Stats
+	mnts   mnts
+	stats  Stats
+	io     mntio
+	root   string
+	cgroup cgroup
+	cgts   time.Time
+}
+
+// mntio defines inner cumulative io counters snapshot
+// used to derive io rates between consecutive syncs.
+type mntio struct {
+	ts        time.Time
+	diskBytes uint64
+	diskOps   uint64
+	netBytes  uint64
 }
 
 // NewMonitorSystem creates system monitor instance
 // with cache interval defined by the provided duration
 // and time to process CPU utilization.
+// Inside containers CPU and memory utilization are calculated
+// relative to cgroup v1 or v2 CPU quota and memory limit instead of host values.
 // Only successful stats results are cached.
 func NewMonitorSystem(cache time.Duration, tp time.Duration) Monitor {
-	mnt := &mntsys{}
+	mnt := &mntsys{root: cgroupRoot}
 	memsync, _ := cached(cache, func(ctx context.Context) error {
 		return mnt.sync(ctx, tp)
 	})
@@ -73,19 +121,88 @@ func (mnt *mntsys) sync(_ context.Context, tp time.Duration) error {
 	runtime.ReadMemStats(&memstats)
 	mnt.stats.MEMAlloc = memstats.Alloc
 	mnt.stats.MEMSystem = memstats.Sys
+	mnt.stats.Goroutines = uint64(runtime.NumGoroutine())
+	mnt.stats.CPUPause = 0
 	for _, p := range memstats.PauseNs {
 		mnt.stats.CPUPause += p
 	}
 	mnt.stats.CPUPause /= 256
-	if percents, err := cpu.Percent(tp, true); err == nil {
+	if percents, err := cpu.Percent(tp, true); err == nil && len(percents) > 0 {
+		mnt.stats.CPUUsage = 0
 		for _, p := range percents {
 			mnt.stats.CPUUsage += p
 		}
 		mnt.stats.CPUUsage /= float64(len(percents))
 	}
+	if vmem, err := mem.VirtualMemory(); err == nil {
+		mnt.stats.MEMUsage = vmem.UsedPercent
+	}
+	if avg, err := load.Avg(); err == nil {
+		mnt.stats.LOADAvg1 = avg.Load1
+		mnt.stats.LOADAvg5 = avg.Load5
+		mnt.stats.LOADAvg15 = avg.Load15
+	}
+	mnt.syncCgroup()
+	if proc, err := process.NewProcess(int32(os.Getpid())); err == nil {
+		fds, ferr := proc.NumFDs()
+		limits, lerr := proc.Rlimit()
+		if ferr == nil && lerr == nil {
+			for _, limit := range limits {
+				if limit.Resource == process.RLIMIT_NOFILE && limit.Soft > 0 {
+					mnt.stats.FDUsage = float64(fds) / float64(limit.Soft) * 100
+				}
+			}
+		}
+	}
+	var io mntio
+	io.ts = time.Now()
+	if counters, err := disk.IOCounters(); err == nil {
+		for _, counter := range counters {
+			io.diskBytes += counter.ReadBytes + counter.WriteBytes
+			io.diskOps += counter.ReadCount + counter.WriteCount
+		}
+	}
+	if counters, err := psnet.IOCounters(false); err == nil {
+		for _, counter := range counters {
+			io.netBytes += counter.BytesSent + counter.BytesRecv
+		}
+	}
+	if elapsed := io.ts.Sub(mnt.io.ts).Seconds(); !mnt.io.ts.IsZero() && elapsed > 0 {
+		mnt.stats.DISKThroughput = iorate(mnt.io.diskBytes, io.diskBytes, elapsed)
+		mnt.stats.DISKIOPS = iorate(mnt.io.diskOps, io.diskOps, elapsed)
+		mnt.stats.NETBandwidth = iorate(mnt.io.netBytes, io.netBytes, elapsed)
+	}
+	mnt.io = io
 	return nil
 }
 
+// syncCgroup overrides host CPU and memory utilization
+// with container cgroup utilization if container is limited by cgroup.
+func (mnt *mntsys) syncCgroup() {
+	cg, ok := cgroupRead(mnt.root)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if cg.memLimit > 0 {
+		mnt.stats.MEMUsage = float64(cg.memUsage) / float64(cg.memLimit) * 100
+	}
+	if elapsed := now.Sub(mnt.cgts); cg.cpuQuota > 0 && !mnt.cgts.IsZero() && elapsed > 0 {
+		used := float64(iorate(mnt.cgroup.cpuUsage, cg.cpuUsage, 1))
+		mnt.stats.CPUUsage = used / (float64(elapsed) * cg.cpuQuota) * 100
+	}
+	mnt.cgroup, mnt.cgts = cg, now
+}
+
+// iorate returns per second rate between two cumulative counters snapshots
+// or zero if counters were reset in between.
+func iorate(prev uint64, next uint64, elapsed float64) uint64 {
+	if next < prev {
+		return 0
+	}
+	return uint64(float64(next-prev) / elapsed)
+}
+
 type mntmock struct {
 	stats Stats
 	err   error
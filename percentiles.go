@@ -44,3 +44,20 @@ func (p *percentiles) Prune() {
 	defer p.lock.Unlock()
 	p.buf = make([]uint64, 0, p.cap)
 }
+
+func (p *percentiles) Deviation() (mean float64, std float64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.buf) == 0 {
+		return
+	}
+	for _, dim := range p.buf {
+		mean += float64(dim)
+	}
+	mean /= float64(len(p.buf))
+	for _, dim := range p.buf {
+		std += (float64(dim) - mean) * (float64(dim) - mean)
+	}
+	std = math.Sqrt(std / float64(len(p.buf)))
+	return
+}
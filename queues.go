@@ -0,0 +1,74 @@
+package gohalt
+
+import (
+	"sync"
+	"time"
+)
+
+// Queueing defines waiter queue state reported by queueing throttlers:
+// - Position shows waiter position in the queue starting from 1.
+// - ETA shows estimated waiter admission duration.
+type Queueing struct {
+	Position uint64
+	ETA      time.Duration
+}
+
+type waiter struct {
+	observer func(Queueing)
+}
+
+type queue struct {
+	lock     sync.Mutex
+	waiters  []*waiter
+	interval time.Duration
+	lastTs   time.Time
+}
+
+func (q *queue) push(observer func(Queueing)) *waiter {
+	w := &waiter{observer: observer}
+	q.lock.Lock()
+	q.waiters = append(q.waiters, w)
+	position, interval := uint64(len(q.waiters)), q.interval
+	q.lock.Unlock()
+	if observer != nil {
+		observer(Queueing{Position: position, ETA: time.Duration(position) * interval})
+	}
+	return w
+}
+
+func (q *queue) pop(w *waiter) {
+	q.lock.Lock()
+	for i, qw := range q.waiters {
+		if qw == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			break
+		}
+	}
+	waiters := make([]*waiter, len(q.waiters))
+	_ = copy(waiters, q.waiters)
+	interval := q.interval
+	q.lock.Unlock()
+	// notify all remaining waiters about their new positions.
+	for i, qw := range waiters {
+		if qw.observer != nil {
+			position := uint64(i + 1)
+			qw.observer(Queueing{Position: position, ETA: time.Duration(position) * interval})
+		}
+	}
+}
+
+func (q *queue) tick() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	now := time.Now().UTC()
+	if !q.lastTs.IsZero() {
+		// keep exponentially weighted moving average of admission interval.
+		delta := now.Sub(q.lastTs)
+		if q.interval == 0 {
+			q.interval = delta
+		} else {
+			q.interval = (q.interval*7 + delta) / 8
+		}
+	}
+	q.lastTs = now
+}
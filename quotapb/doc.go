@@ -0,0 +1,5 @@
+// Package quotapb defines gohalt central quota coordination gRPC service protocol,
+// see `gohalt.NewServiceQuota` and `gohalt.NewThrottlerQuota`.
+package quotapb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative quota.proto
@@ -0,0 +1,118 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: quota.proto
+
+package quotapb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Quota_Grant_FullMethodName = "/gohalt.quota.v1.Quota/Grant"
+)
+
+// QuotaClient is the client API for Quota service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Quota defines central quota coordination service
+// that grants token batches to throttling instances.
+type QuotaClient interface {
+	// Grant grants up to the requested number of tokens for the key.
+	Grant(ctx context.Context, in *GrantRequest, opts ...grpc.CallOption) (*GrantResponse, error)
+}
+
+type quotaClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewQuotaClient(cc grpc.ClientConnInterface) QuotaClient {
+	return &quotaClient{cc}
+}
+
+func (c *quotaClient) Grant(ctx context.Context, in *GrantRequest, opts ...grpc.CallOption) (*GrantResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GrantResponse)
+	err := c.cc.Invoke(ctx, Quota_Grant_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// QuotaServer is the server API for Quota service.
+// All implementations must embed UnimplementedQuotaServer
+// for forward compatibility
+//
+// Quota defines central quota coordination service
+// that grants token batches to throttling instances.
+type QuotaServer interface {
+	// Grant grants up to the requested number of tokens for the key.
+	Grant(context.Context, *GrantRequest) (*GrantResponse, error)
+	mustEmbedUnimplementedQuotaServer()
+}
+
+// UnimplementedQuotaServer must be embedded to have forward compatible implementations.
+type UnimplementedQuotaServer struct {
+}
+
+func (UnimplementedQuotaServer) Grant(context.Context, *GrantRequest) (*GrantResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Grant not implemented")
+}
+func (UnimplementedQuotaServer) mustEmbedUnimplementedQuotaServer() {}
+
+// UnsafeQuotaServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to QuotaServer will
+// result in compilation errors.
+type UnsafeQuotaServer interface {
+	mustEmbedUnimplementedQuotaServer()
+}
+
+func RegisterQuotaServer(s grpc.ServiceRegistrar, srv QuotaServer) {
+	s.RegisterService(&Quota_ServiceDesc, srv)
+}
+
+func _Quota_Grant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GrantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QuotaServer).Grant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Quota_Grant_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QuotaServer).Grant(ctx, req.(*GrantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Quota_ServiceDesc is the grpc.ServiceDesc for Quota service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Quota_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gohalt.quota.v1.Quota",
+	HandlerType: (*QuotaServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Grant",
+			Handler:    _Quota_Grant_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "quota.proto",
+}
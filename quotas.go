@@ -0,0 +1,36 @@
+package gohalt
+
+import "context"
+
+// QuotaProvider defines tenant quota provider interface that returns the tenant quota.
+type QuotaProvider interface {
+	// Quota returns the tenant quota and whether tenant is known or internal error if any happened.
+	Quota(context.Context, string) (uint64, bool, error)
+}
+
+type qpstatic map[string]uint64
+
+// NewQuotaProviderStatic creates static quota provider instance
+// which returns the tenant quota from the provided tenant quotas map.
+func NewQuotaProviderStatic(quotas map[string]uint64) QuotaProvider {
+	qp := make(qpstatic, len(quotas))
+	for tenant, quota := range quotas {
+		qp[tenant] = quota
+	}
+	return qp
+}
+
+func (qp qpstatic) Quota(_ context.Context, tenant string) (uint64, bool, error) {
+	quota, ok := qp[tenant]
+	return quota, ok, nil
+}
+
+type qpmock struct {
+	quota uint64
+	ok    bool
+	err   error
+}
+
+func (qp qpmock) Quota(context.Context, string) (uint64, bool, error) {
+	return qp.quota, qp.ok, qp.err
+}
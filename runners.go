@@ -2,7 +2,11 @@ package gohalt
 
 import (
 	"context"
+	"errors"
+	"math"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Runner defines abstraction to execute a set of `Runnable`
@@ -75,11 +79,13 @@ func (r *rsync) Result() error {
 }
 
 type rasync struct {
-	thr    Throttler
-	ctx    context.Context
-	wg     sync.WaitGroup
-	err    error
-	report func(error)
+	thr      Throttler
+	ctx      context.Context
+	wg       sync.WaitGroup
+	err      error
+	report   func(error)
+	skip     func(error)
+	failfast bool
 }
 
 // NewRunnerAsync creates asynchronous runner instance
@@ -87,18 +93,42 @@ type rasync struct {
 // with regard to the provided context and throttler.
 // First occurred error is returned from result.
 func NewRunnerAsync(ctx context.Context, thr Throttler) Runner {
+	return NewRunnerGroup(ctx, thr, true)
+}
+
+// NewRunnerGroup creates asynchronous runner group instance
+// that runs a set of `Runnable` simultaneously
+// with regard to the provided context and throttler.
+// Any `Runnable` error cancels the whole group context,
+// if failfast flag is set then first throttling error also cancels the whole group context,
+// otherwise throttled `Runnable` is skipped and the rest of the group continues.
+// First occurred error is returned from result.
+func NewRunnerGroup(ctx context.Context, thr Throttler, failfast bool) Runner {
 	ctx, cancel := context.WithCancel(ctx)
-	r := rasync{thr: thr, ctx: ctx}
+	r := rasync{thr: thr, ctx: ctx, failfast: failfast}
 	var once sync.Once
+	var lock sync.Mutex
 	r.report = func(err error) {
 		if err != nil {
 			once.Do(func() {
-				r.err = err
+				lock.Lock()
+				defer lock.Unlock()
+				if r.err == nil {
+					r.err = err
+				}
 				cancel()
 			})
 			log("async runner error happened: %v", err)
 		}
 	}
+	r.skip = func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.err == nil {
+			r.err = err
+		}
+		log("async runner throttling error is skipped: %v", err)
+	}
 	return &r
 }
 
@@ -118,7 +148,11 @@ func (r *rasync) Run(run Runnable) {
 			}
 		}()
 		if err := r.thr.Acquire(r.ctx); err != nil {
-			r.report(err)
+			if r.failfast {
+				r.report(err)
+			} else {
+				r.skip(err)
+			}
 			return
 		}
 		select {
@@ -138,3 +172,427 @@ func (r *rasync) Result() error {
 	r.wg.Wait()
 	return r.err
 }
+
+type rpool struct {
+	thr     Throttler
+	ctx     context.Context
+	workers uint64
+	stealer Stealer
+	lock    sync.Mutex
+	tasks   []Runnable
+	active  uint64
+	wg      sync.WaitGroup
+	err     error
+	report  func(error)
+}
+
+// NewRunnerPool creates asynchronous runner pool instance
+// that runs a set of `Runnable` on at most the specified number of workers
+// with regard to the provided context and throttler.
+// Workers are started lazily and stopped as soon as there is no queued `Runnable` left.
+// If stealer is provided then idle pools sharing the same stealer
+// execute queued `Runnable` from saturated pools, see `Stealer`,
+// pool is unregistered from the stealer as soon as the pool context is done.
+// Any `Runnable` error cancels the whole pool context.
+// First occurred error is returned from result.
+func NewRunnerPool(ctx context.Context, thr Throttler, workers uint64, stealer Stealer) Runner {
+	if workers == 0 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	r := rpool{thr: thr, ctx: ctx, workers: workers, stealer: stealer}
+	var once sync.Once
+	r.report = func(err error) {
+		if err != nil {
+			once.Do(func() {
+				r.lock.Lock()
+				defer r.lock.Unlock()
+				r.err = err
+				cancel()
+			})
+			log("pool runner error happened: %v", err)
+		}
+	}
+	if stealer != nil {
+		stealer.register(&r)
+		context.AfterFunc(ctx, func() {
+			stealer.unregister(&r)
+		})
+	}
+	return &r
+}
+
+func (r *rpool) Run(run Runnable) {
+	r.wg.Add(1)
+	r.lock.Lock()
+	r.tasks = append(r.tasks, run)
+	spawned := r.spawn()
+	r.lock.Unlock()
+	// pool is saturated so offer its queued runnables to idle pools.
+	if !spawned && r.stealer != nil {
+		r.stealer.offer(r)
+	}
+}
+
+func (r *rpool) Result() error {
+	r.wg.Wait()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.err
+}
+
+// spawn starts new worker if pool is not saturated,
+// it needs to be called under pool lock.
+func (r *rpool) spawn() bool {
+	if r.active >= r.workers {
+		return false
+	}
+	r.active++
+	go r.work()
+	return true
+}
+
+// work executes own queued runnables and then steals runnables from other pools
+// until there is nothing left to execute.
+func (r *rpool) work() {
+	for {
+		if run, ok := r.pop(); ok {
+			r.exec(run)
+			continue
+		}
+		if r.stealer != nil {
+			if pool, run, ok := r.stealer.steal(r); ok {
+				pool.exec(run)
+				continue
+			}
+		}
+		r.lock.Lock()
+		if len(r.tasks) == 0 {
+			r.active--
+			r.lock.Unlock()
+			return
+		}
+		r.lock.Unlock()
+	}
+}
+
+func (r *rpool) pop() (Runnable, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.tasks) == 0 {
+		return nil, false
+	}
+	run := r.tasks[0]
+	r.tasks[0] = nil
+	r.tasks = r.tasks[1:]
+	return run, true
+}
+
+func (r *rpool) exec(run Runnable) {
+	defer r.wg.Done()
+	select {
+	case <-r.ctx.Done():
+		r.report(r.ctx.Err())
+		return
+	default:
+	}
+	defer func() {
+		if err := r.thr.Release(r.ctx); err != nil {
+			r.report(err)
+		}
+	}()
+	if err := r.thr.Acquire(r.ctx); err != nil {
+		r.report(err)
+		return
+	}
+	select {
+	case <-r.ctx.Done():
+		r.report(r.ctx.Err())
+		return
+	default:
+	}
+	if err := run(r.ctx); err != nil {
+		r.report(err)
+		return
+	}
+}
+
+// Stealer defines work stealing coordinator shared between runner pools,
+// so idle pools could execute queued `Runnable` from saturated pools.
+// Stolen `Runnable` is still executed with regard to its original pool context and throttler.
+type Stealer interface {
+	// Pools returns number of runner pools currently sharing the stealer.
+	Pools() int
+	register(pool *rpool)
+	unregister(pool *rpool)
+	offer(pool *rpool)
+	steal(pool *rpool) (*rpool, Runnable, bool)
+}
+
+type stealer struct {
+	lock  sync.Mutex
+	pools []*rpool
+}
+
+// NewStealer creates new work stealing coordinator instance
+// that could be shared between multiple runner pools, see `NewRunnerPool`.
+func NewStealer() Stealer {
+	return &stealer{}
+}
+
+func (s *stealer) Pools() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.pools)
+}
+
+func (s *stealer) register(pool *rpool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pools = append(s.pools, pool)
+}
+
+func (s *stealer) unregister(pool *rpool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, p := range s.pools {
+		if p == pool {
+			s.pools = append(s.pools[:i], s.pools[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *stealer) others(pool *rpool) []*rpool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	pools := make([]*rpool, 0, len(s.pools))
+	for _, p := range s.pools {
+		if p != pool {
+			pools = append(pools, p)
+		}
+	}
+	return pools
+}
+
+// offer spawns single worker on first idle pool which will steal from saturated pool.
+func (s *stealer) offer(pool *rpool) {
+	for _, p := range s.others(pool) {
+		p.lock.Lock()
+		spawned := p.spawn()
+		p.lock.Unlock()
+		if spawned {
+			return
+		}
+	}
+}
+
+// steal pops the last queued runnable from the first other pool with queued runnables.
+func (s *stealer) steal(pool *rpool) (*rpool, Runnable, bool) {
+	for _, p := range s.others(pool) {
+		p.lock.Lock()
+		if length := len(p.tasks); length > 0 {
+			run := p.tasks[length-1]
+			p.tasks[length-1] = nil
+			p.tasks = p.tasks[:length-1]
+			p.lock.Unlock()
+			return p, run, true
+		}
+		p.lock.Unlock()
+	}
+	return nil, nil, false
+}
+
+// WorkerPool defines long living throttled worker pool that executes submitted `Runnable`
+// on a fixed number of workers from a bounded priority queue,
+// each worker acquires the pool throttler before `Runnable` execution and releases it after.
+// Unlike runner pool, see `NewRunnerPool`, worker pool keeps its workers running until it is shut down.
+type WorkerPool interface {
+	// Submit enqueues the provided `Runnable` to be executed with the provided context.
+	// Use `WithPriority` to override `Runnable` priority, 1 by default.
+	// - could return `ErrorThreshold` if the pool queue is full;
+	// - could return `ErrorInternal` if the pool is shut down;
+	Submit(ctx context.Context, run Runnable) error
+	// Shutdown gracefully stops the pool, new `Runnable` are not accepted anymore
+	// and already queued `Runnable` are executed before workers are stopped.
+	// If the provided context is done before that then the pool context is canceled
+	// and the rest of queued `Runnable` are dropped.
+	// First occurred `Runnable` error or the provided context error is returned.
+	Shutdown(ctx context.Context) error
+}
+
+type wpool struct {
+	thr      Throttler
+	ctx      context.Context
+	cancel   context.CancelFunc
+	poll     time.Duration
+	capacity uint64
+	lock     sync.Mutex
+	cond     *sync.Cond
+	tasks    []wtask
+	closed   bool
+	wg       sync.WaitGroup
+	err      error
+}
+
+type wtask struct {
+	ctx      context.Context
+	run      Runnable
+	priority uint8
+}
+
+// NewWorkerPool creates new throttled worker pool instance
+// that runs submitted `Runnable` on the specified number of workers
+// with regard to the provided context and throttler.
+// Submitted `Runnable` are queued in the queue bounded by the specified capacity,
+// if capacity is 0 then the queue is unbounded.
+// Queued `Runnable` with higher priority are executed first, `Runnable` with the same priority are executed in submit order.
+// Throttled `Runnable` wait for `ErrorRetry` retry after duration if any
+// or for the specified poll interval, 10ms by default, otherwise before the next throttler acquire
+// until the throttler passes, internal throttling errors fail `Runnable` right away.
+func NewWorkerPool(
+	ctx context.Context,
+	thr Throttler,
+	workers uint64,
+	capacity uint64,
+	poll time.Duration,
+) WorkerPool {
+	if workers == 0 {
+		workers = 1
+	}
+	if capacity == 0 {
+		capacity = math.MaxUint64
+	}
+	if poll <= 0 {
+		poll = 10 * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	p := &wpool{thr: thr, ctx: ctx, cancel: cancel, poll: poll, capacity: capacity}
+	p.cond = sync.NewCond(&p.lock)
+	p.wg.Add(int(workers))
+	for i := uint64(0); i < workers; i++ {
+		go p.work()
+	}
+	// wake up idle workers on pool context cancel.
+	context.AfterFunc(ctx, func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		p.cond.Broadcast()
+	})
+	return p
+}
+
+func (p *wpool) Submit(ctx context.Context, run Runnable) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed || p.ctx.Err() != nil {
+		return ErrorInternal{Throttler: "pool", Message: "pool is shut down"}
+	}
+	if length := uint64(len(p.tasks)); length >= p.capacity {
+		return ErrorThreshold{
+			Throttler: "pool",
+			Threshold: strpair{current: length + 1, threshold: p.capacity},
+		}
+	}
+	task := wtask{ctx: ctx, run: run, priority: ctxPriority(ctx, math.MaxUint8)}
+	// keep queue sorted by priority and by submit order within the same priority.
+	index := sort.Search(len(p.tasks), func(i int) bool {
+		return p.tasks[i].priority < task.priority
+	})
+	p.tasks = append(p.tasks, wtask{})
+	copy(p.tasks[index+1:], p.tasks[index:])
+	p.tasks[index] = task
+	p.cond.Signal()
+	return nil
+}
+
+func (p *wpool) Shutdown(ctx context.Context) error {
+	p.lock.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.lock.Unlock()
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+	case <-ctx.Done():
+		p.report(ctx.Err())
+		p.cancel()
+		<-done
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.err
+}
+
+func (p *wpool) work() {
+	defer p.wg.Done()
+	for {
+		p.lock.Lock()
+		for len(p.tasks) == 0 && !p.closed && p.ctx.Err() == nil {
+			p.cond.Wait()
+		}
+		if len(p.tasks) == 0 || p.ctx.Err() != nil {
+			p.lock.Unlock()
+			return
+		}
+		task := p.tasks[0]
+		p.tasks[0] = wtask{}
+		p.tasks = p.tasks[1:]
+		p.lock.Unlock()
+		p.report(p.exec(task))
+	}
+}
+
+func (p *wpool) exec(task wtask) error {
+	ctx, cancel := context.WithCancel(task.ctx)
+	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+	for {
+		err := p.thr.Acquire(ctx)
+		if err == nil {
+			break
+		}
+		if err := p.thr.Release(ctx); err != nil {
+			return err
+		}
+		var ierr ErrorInternal
+		if errors.As(err, &ierr) {
+			return err
+		}
+		delay := p.poll
+		var rerr ErrorRetry
+		if errors.As(err, &rerr) && rerr.After > 0 {
+			delay = rerr.After
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	defer func() {
+		if err := p.thr.Release(ctx); err != nil {
+			p.report(err)
+		}
+	}()
+	return task.run(ctx)
+}
+
+func (p *wpool) report(err error) {
+	if err != nil {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if p.err == nil {
+			p.err = err
+		}
+		log("pool error happened: %v", err)
+	}
+}
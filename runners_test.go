@@ -3,7 +3,9 @@ package gohalt
 import (
 	"context"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -57,6 +59,41 @@ func TestRunners(t *testing.T) {
 			run: nope,
 			err: cctx.Err(),
 		},
+		"Runner group should return error on throttling": {
+			r:   NewRunnerGroup(context.Background(), tmock{aerr: testerr}, false),
+			run: nope,
+			err: testerr,
+		},
+		"Runner group should return error on runnable error": {
+			r:   NewRunnerGroup(context.Background(), tmock{}, false),
+			run: use(testerr),
+			err: testerr,
+		},
+		"Runner group failfast should return error on throttling": {
+			r:   NewRunnerGroup(context.Background(), tmock{aerr: testerr}, true),
+			run: nope,
+			err: testerr,
+		},
+		"Runner pool should return error on throttling": {
+			r:   NewRunnerPool(context.Background(), tmock{aerr: testerr}, 2, nil),
+			run: nope,
+			err: testerr,
+		},
+		"Runner pool should return error on realising error": {
+			r:   NewRunnerPool(context.Background(), tmock{rerr: testerr}, 2, nil),
+			run: nope,
+			err: testerr,
+		},
+		"Runner pool should return error on runnable error": {
+			r:   NewRunnerPool(context.Background(), tmock{}, 2, NewStealer()),
+			run: use(testerr),
+			err: testerr,
+		},
+		"Runner pool should return error on canceled context": {
+			r:   NewRunnerPool(cctx, tmock{}, 0, nil),
+			run: nope,
+			err: cctx.Err(),
+		},
 	}
 	for tname, tcase := range table {
 		t.Run(tname, func(t *testing.T) {
@@ -66,3 +103,149 @@ func TestRunners(t *testing.T) {
 		})
 	}
 }
+
+func TestRunnerGroupContinueOnThrottling(t *testing.T) {
+	testerr := errors.New("test")
+	r := NewRunnerGroup(
+		context.Background(),
+		NewThrottlerRing(NewThrottlerEcho(testerr), NewThrottlerEcho(nil)),
+		false,
+	)
+	var runs uint64
+	for i := 0; i < 2; i++ {
+		r.Run(func(ctx context.Context) error {
+			atomicIncr(&runs)
+			return ctx.Err()
+		})
+	}
+	assert.Equal(t, testerr, r.Result())
+	assert.Equal(t, uint64(1), atomicGet(&runs))
+}
+
+func TestRunnerPoolStealing(t *testing.T) {
+	testerr := errors.New("test")
+	stealer := NewStealer()
+	saturated := NewRunnerPool(context.Background(), NewThrottlerAfter(3), 1, stealer)
+	idle := NewRunnerPool(context.Background(), tmock{aerr: testerr}, 2, stealer)
+	var running, runs uint64
+	wait := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		saturated.Run(func(context.Context) error {
+			if atomicIncr(&runs) == 3 {
+				close(wait)
+			}
+			atomicIncr(&running)
+			<-wait
+			return nil
+		})
+	}
+	assert.Equal(t, ErrorThreshold{
+		Throttler: "after",
+		Threshold: strpair{current: 4, threshold: 3},
+	}, saturated.Result())
+	assert.Equal(t, uint64(3), atomicGet(&running))
+	assert.NoError(t, idle.Result())
+	// saturated pool context is canceled by its error, so it leaves the stealer.
+	assert.Eventually(t, func() bool {
+		return stealer.Pools() == 1
+	}, time.Second, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	_ = NewRunnerPool(ctx, tmock{}, 1, stealer)
+	assert.Equal(t, 2, stealer.Pools())
+	cancel()
+	assert.Eventually(t, func() bool {
+		return stealer.Pools() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestWorkerPool(t *testing.T) {
+	t.Run("Worker pool should execute queued runnables by priority", func(t *testing.T) {
+		p := NewWorkerPool(context.Background(), NewThrottlerEcho(nil), 1, 0, time.Millisecond)
+		wait := make(chan struct{})
+		assert.NoError(t, p.Submit(context.Background(), func(context.Context) error {
+			<-wait
+			return nil
+		}))
+		var lock sync.Mutex
+		var order []string
+		for _, task := range []struct {
+			name     string
+			priority uint8
+		}{{"low", 1}, {"high", 3}, {"mid", 2}, {"default", 0}} {
+			name := task.name
+			assert.NoError(t, p.Submit(WithPriority(context.Background(), task.priority), func(context.Context) error {
+				lock.Lock()
+				defer lock.Unlock()
+				order = append(order, name)
+				return nil
+			}))
+		}
+		close(wait)
+		assert.NoError(t, p.Shutdown(context.Background()))
+		assert.Equal(t, []string{"high", "mid", "low", "default"}, order)
+	})
+	t.Run("Worker pool should reject runnables on full queue and after shutdown", func(t *testing.T) {
+		p := NewWorkerPool(context.Background(), NewThrottlerEcho(nil), 1, 1, time.Millisecond)
+		wait := make(chan struct{})
+		started := make(chan struct{})
+		assert.NoError(t, p.Submit(context.Background(), func(context.Context) error {
+			close(started)
+			<-wait
+			return nil
+		}))
+		<-started
+		assert.NoError(t, p.Submit(context.Background(), nope))
+		assert.Equal(t, ErrorThreshold{
+			Throttler: "pool",
+			Threshold: strpair{current: 2, threshold: 1},
+		}, p.Submit(context.Background(), nope))
+		close(wait)
+		assert.NoError(t, p.Shutdown(context.Background()))
+		assert.Equal(t, ErrorInternal{Throttler: "pool", Message: "pool is shut down"}, p.Submit(context.Background(), nope))
+	})
+	t.Run("Worker pool should wait for throttler before execution", func(t *testing.T) {
+		p := NewWorkerPool(context.Background(), NewThrottlerBefore(3), 2, 0, time.Millisecond)
+		var runs uint64
+		for i := 0; i < 2; i++ {
+			assert.NoError(t, p.Submit(context.Background(), func(context.Context) error {
+				atomicIncr(&runs)
+				return nil
+			}))
+		}
+		assert.NoError(t, p.Shutdown(context.Background()))
+		assert.Equal(t, uint64(2), atomicGet(&runs))
+	})
+	t.Run("Worker pool should poll throttler with default interval on zero poll", func(t *testing.T) {
+		p := NewWorkerPool(context.Background(), NewThrottlerBefore(2), 1, 0, 0)
+		assert.Equal(t, 10*time.Millisecond, p.(*wpool).poll)
+		var runs uint64
+		assert.NoError(t, p.Submit(context.Background(), func(context.Context) error {
+			atomicIncr(&runs)
+			return nil
+		}))
+		assert.NoError(t, p.Shutdown(context.Background()))
+		assert.Equal(t, uint64(1), atomicGet(&runs))
+	})
+	t.Run("Worker pool should fail runnables on internal throttling errors", func(t *testing.T) {
+		ierr := ErrorInternal{Throttler: "test", Message: "test"}
+		p := NewWorkerPool(context.Background(), NewThrottlerEcho(ierr), 1, 0, time.Hour)
+		assert.NoError(t, p.Submit(context.Background(), nope))
+		assert.Equal(t, ierr, p.Shutdown(context.Background()))
+	})
+	t.Run("Worker pool should cancel runnables on shutdown context done", func(t *testing.T) {
+		p := NewWorkerPool(context.Background(), NewThrottlerEcho(nil), 1, 0, time.Millisecond)
+		assert.NoError(t, p.Submit(context.Background(), func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}))
+		var runs uint64
+		assert.NoError(t, p.Submit(context.Background(), func(context.Context) error {
+			atomicIncr(&runs)
+			return nil
+		}))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, p.Shutdown(ctx))
+		assert.Equal(t, uint64(0), atomicGet(&runs))
+	})
+}
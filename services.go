@@ -0,0 +1,65 @@
+package gohalt
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/1pkg/gohalt/quotapb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+type svcquota struct {
+	quotapb.UnimplementedQuotaServer
+	thr   Throttler
+	ttl   time.Duration
+	limit uint64
+}
+
+// NewServiceQuota creates central quota coordination gRPC service instance
+// that grants token batches to throttling instances, see `NewThrottlerQuota`.
+// Each granted token is acquired from the provided throttler with requested key provided via `WithKey`,
+// so the batch is granted partially up until the first throttled acquire.
+// Granted tokens are never released back to the throttler, so counting throttlers should not be used.
+// Granted tokens are valid for the specified ttl, zero ttl means tokens never expire.
+// Requests for more tokens than the specified limit are rejected with gRPC invalid argument error.
+// Throttler `ErrorRetry` is propagated as retry after duration if no tokens were granted,
+// throttler `ErrorInternal` is returned as gRPC internal error.
+func NewServiceQuota(thr Throttler, ttl time.Duration, limit uint64) quotapb.QuotaServer {
+	return &svcquota{thr: thr, ttl: ttl, limit: limit}
+}
+
+func (svc *svcquota) Grant(ctx context.Context, req *quotapb.GrantRequest) (*quotapb.GrantResponse, error) {
+	if req.GetTokens() > svc.limit {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"requested %d tokens exceed %d tokens grant limit",
+			req.GetTokens(),
+			svc.limit,
+		)
+	}
+	ctx = WithKey(ctx, req.GetKey())
+	resp := &quotapb.GrantResponse{Ttl: durationpb.New(svc.ttl)}
+	for resp.Tokens < req.GetTokens() {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		err := svc.thr.Acquire(ctx)
+		if err == nil {
+			resp.Tokens++
+			continue
+		}
+		var ierr ErrorInternal
+		if errors.As(err, &ierr) {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		var rerr ErrorRetry
+		if resp.Tokens == 0 && errors.As(err, &rerr) {
+			resp.RetryAfter = durationpb.New(rerr.After)
+		}
+		break
+	}
+	return resp, nil
+}
@@ -0,0 +1,123 @@
+package gohalt
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1pkg/gohalt/quotapb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestServiceQuota(t *testing.T) {
+	table := map[string]struct {
+		thr  Throttler
+		req  *quotapb.GrantRequest
+		resp *quotapb.GrantResponse
+		code codes.Code
+	}{
+		"Quota service should grant all requested tokens": {
+			thr: NewThrottlerAfter(5),
+			req: &quotapb.GrantRequest{Key: "key", Tokens: 3},
+			resp: &quotapb.GrantResponse{
+				Tokens: 3,
+				Ttl:    durationpb.New(time.Minute),
+			},
+		},
+		"Quota service should grant tokens partially": {
+			thr: NewThrottlerAfter(2),
+			req: &quotapb.GrantRequest{Key: "key", Tokens: 3},
+			resp: &quotapb.GrantResponse{
+				Tokens: 2,
+				Ttl:    durationpb.New(time.Minute),
+			},
+		},
+		"Quota service should propagate retry after duration": {
+			thr: NewThrottlerEcho(ErrorRetry{Throttler: "test", After: time.Second}),
+			req: &quotapb.GrantRequest{Key: "key", Tokens: 3},
+			resp: &quotapb.GrantResponse{
+				Ttl:        durationpb.New(time.Minute),
+				RetryAfter: durationpb.New(time.Second),
+			},
+		},
+		"Quota service should reject requests exceeding grant limit": {
+			thr:  NewThrottlerEcho(nil),
+			req:  &quotapb.GrantRequest{Key: "key", Tokens: 5},
+			code: codes.InvalidArgument,
+		},
+		"Quota service should return internal error": {
+			thr:  NewThrottlerEcho(ErrorInternal{Throttler: "test", Message: "test"}),
+			req:  &quotapb.GrantRequest{Key: "key", Tokens: 3},
+			code: codes.Internal,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			resp, err := NewServiceQuota(tcase.thr, time.Minute, 4).Grant(context.TODO(), tcase.req)
+			require.Equal(t, tcase.code, status.Code(err))
+			require.Equal(t, tcase.resp.GetTokens(), resp.GetTokens())
+			require.Equal(t, tcase.resp.GetTtl().AsDuration(), resp.GetTtl().AsDuration())
+			require.Equal(t, tcase.resp.GetRetryAfter().AsDuration(), resp.GetRetryAfter().AsDuration())
+		})
+	}
+}
+
+func TestThrottlerQuota(t *testing.T) {
+	srv := grpc.NewServer()
+	quotapb.RegisterQuotaServer(srv, NewServiceQuota(NewThrottlerAfter(3), time.Hour, 16))
+	thr := NewThrottlerQuota(quotapb.NewQuotaClient(testGRPC(t, srv)), 2)
+	ctx := context.TODO()
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(WithWeight(ctx, -1)))
+	require.NoError(t, thr.Acquire(ctx))
+	require.Equal(t, ErrorThreshold{
+		Throttler: "quota",
+		Threshold: strpair{current: 1, threshold: 0},
+	}, thr.Acquire(ctx))
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- thr.Acquire(WithKey(ctx, "other"))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	var passed int
+	for err := range errs {
+		if err == nil {
+			passed++
+		}
+	}
+	require.Zero(t, passed)
+	require.NoError(t, thr.Release(ctx))
+	srv.Stop()
+	require.Equal(t, "quota", thr.Acquire(ctx).(ErrorInternal).Throttler)
+}
+
+func testGRPC(t *testing.T, srv *grpc.Server, opts ...grpc.DialOption) *grpc.ClientConn {
+	lis := bufconn.Listen(1024 * 1024)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	opts = append(
+		opts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
@@ -0,0 +1,207 @@
+package gohalt
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Storage defines abstract key value storage interface used to persist throttling state.
+// Provided ttl specifies key expiration duration, zero ttl means key never expires.
+type Storage interface {
+	// Get returns the key value and whether key exists or internal error if any happened.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set sets the key value or returns internal error if any happened.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Incr atomically increments the key decimal counter by the provided delta
+	// and returns its new value or internal error if any happened.
+	// Missing key is treated as zero counter, ttl is applied only on key creation.
+	Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// CompareAndSwap atomically sets the key value only if current key value is equal to old value
+	// and returns whether swap happened or internal error if any happened.
+	// Nil old value means that the key is expected to be missing,
+	// nil new value means that the key is deleted on swap.
+	CompareAndSwap(ctx context.Context, key string, old []byte, new []byte, ttl time.Duration) (bool, error)
+	// Delete deletes the key or returns internal error if any happened.
+	Delete(ctx context.Context, key string) error
+}
+
+type stgitem struct {
+	value    []byte
+	deadline time.Time
+}
+
+type stgmemory struct {
+	lock  sync.Mutex
+	items map[string]stgitem
+}
+
+// NewStorageMemory creates in memory storage instance
+// that keeps all keys in process memory and lazily evicts expired keys.
+func NewStorageMemory() Storage {
+	return &stgmemory{items: make(map[string]stgitem)}
+}
+
+func (stg *stgmemory) Get(_ context.Context, key string) ([]byte, bool, error) {
+	stg.lock.Lock()
+	defer stg.lock.Unlock()
+	item, ok := stg.get(key)
+	return item.value, ok, nil
+}
+
+func (stg *stgmemory) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	stg.lock.Lock()
+	defer stg.lock.Unlock()
+	stg.set(key, value, ttl)
+	return nil
+}
+
+func (stg *stgmemory) Incr(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	stg.lock.Lock()
+	defer stg.lock.Unlock()
+	item, ok := stg.get(key)
+	if !ok {
+		stg.set(key, []byte(strconv.FormatInt(delta, 10)), ttl)
+		return delta, nil
+	}
+	val, err := strconv.ParseInt(string(item.value), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	val += delta
+	item.value = []byte(strconv.FormatInt(val, 10))
+	stg.items[key] = item
+	return val, nil
+}
+
+func (stg *stgmemory) CompareAndSwap(
+	_ context.Context,
+	key string,
+	old []byte,
+	new []byte,
+	ttl time.Duration,
+) (bool, error) {
+	stg.lock.Lock()
+	defer stg.lock.Unlock()
+	item, ok := stg.get(key)
+	if (old == nil && ok) || (old != nil && (!ok || !bytes.Equal(old, item.value))) {
+		return false, nil
+	}
+	if new == nil {
+		delete(stg.items, key)
+		return true, nil
+	}
+	stg.set(key, new, ttl)
+	return true, nil
+}
+
+func (stg *stgmemory) Delete(_ context.Context, key string) error {
+	stg.lock.Lock()
+	defer stg.lock.Unlock()
+	delete(stg.items, key)
+	return nil
+}
+
+func (stg *stgmemory) get(key string) (stgitem, bool) {
+	item, ok := stg.items[key]
+	if ok && !item.deadline.IsZero() && !time.Now().UTC().Before(item.deadline) {
+		delete(stg.items, key)
+		return stgitem{}, false
+	}
+	return item, ok
+}
+
+func (stg *stgmemory) set(key string, value []byte, ttl time.Duration) {
+	item := stgitem{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		item.deadline = time.Now().UTC().Add(ttl)
+	}
+	stg.items[key] = item
+}
+
+type stgretried struct {
+	stg     Storage
+	retries uint64
+}
+
+// NewStorageRetried creates retried storage instance
+// that retries each failed provided storage operation up to the specified number of retries,
+// the first retry is done right away and next retries are delayed by square backoff,
+// e.g. to wrap storages from gohalt contrib packages.
+// Note that retried incr and compare and swap operations might be applied more than once
+// if storage failure happened after the operation was already applied.
+func NewStorageRetried(stg Storage, retries uint64) Storage {
+	return stgretried{stg: stg, retries: retries}
+}
+
+func (stg stgretried) Get(ctx context.Context, key string) (val []byte, ok bool, err error) {
+	err = stg.run(ctx, func(ctx context.Context) (err error) {
+		val, ok, err = stg.stg.Get(ctx, key)
+		return
+	})
+	return
+}
+
+func (stg stgretried) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return stg.run(ctx, func(ctx context.Context) error {
+		return stg.stg.Set(ctx, key, value, ttl)
+	})
+}
+
+func (stg stgretried) Incr(ctx context.Context, key string, delta int64, ttl time.Duration) (val int64, err error) {
+	err = stg.run(ctx, func(ctx context.Context) (err error) {
+		val, err = stg.stg.Incr(ctx, key, delta, ttl)
+		return
+	})
+	return
+}
+
+func (stg stgretried) CompareAndSwap(
+	ctx context.Context,
+	key string,
+	old []byte,
+	new []byte,
+	ttl time.Duration,
+) (swapped bool, err error) {
+	err = stg.run(ctx, func(ctx context.Context) (err error) {
+		swapped, err = stg.stg.CompareAndSwap(ctx, key, old, new, ttl)
+		return
+	})
+	return
+}
+
+func (stg stgretried) Delete(ctx context.Context, key string) error {
+	return stg.run(ctx, func(ctx context.Context) error {
+		return stg.stg.Delete(ctx, key)
+	})
+}
+
+func (stg stgretried) run(ctx context.Context, run Runnable) error {
+	return eager(stg.retries, run)(ctx)
+}
+
+type stgmock struct {
+	err error
+}
+
+func (stg stgmock) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, stg.err
+}
+
+func (stg stgmock) Set(context.Context, string, []byte, time.Duration) error {
+	return stg.err
+}
+
+func (stg stgmock) Incr(context.Context, string, int64, time.Duration) (int64, error) {
+	return 0, stg.err
+}
+
+func (stg stgmock) CompareAndSwap(context.Context, string, []byte, []byte, time.Duration) (bool, error) {
+	return false, stg.err
+}
+
+func (stg stgmock) Delete(context.Context, string) error {
+	return stg.err
+}
@@ -0,0 +1,96 @@
+package gohalt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorages(t *testing.T) {
+	table := map[string]struct {
+		stg    Storage
+		expire func(time.Duration)
+	}{
+		"Memory storage should keep keys in memory": {
+			stg:    NewStorageMemory(),
+			expire: time.Sleep,
+		},
+		"Retried storage should keep keys in underlying storage": {
+			stg:    NewStorageRetried(NewStorageMemory(), 1),
+			expire: time.Sleep,
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			testStorage(t, tcase.stg, tcase.expire)
+		})
+	}
+}
+
+func TestStorageFailures(t *testing.T) {
+	table := map[string]Storage{
+		"Retried storage should fail on underlying storage failure": NewStorageRetried(stgmock{err: errors.New("test")}, 1),
+	}
+	for tname, stg := range table {
+		t.Run(tname, func(t *testing.T) {
+			ctx := context.TODO()
+			_, _, err := stg.Get(ctx, "key")
+			require.Error(t, err)
+			require.Error(t, stg.Set(ctx, "key", nil, 0))
+			_, err = stg.Incr(ctx, "key", 1, 0)
+			require.Error(t, err)
+			_, err = stg.CompareAndSwap(ctx, "key", nil, nil, 0)
+			require.Error(t, err)
+			require.Error(t, stg.Delete(ctx, "key"))
+		})
+	}
+}
+
+func testStorage(t *testing.T, stg Storage, expire func(time.Duration)) {
+	ctx := context.TODO()
+	// get set delete
+	_, ok, err := stg.Get(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, stg.Set(ctx, "key", []byte("val"), 0))
+	val, ok, err := stg.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte("val"), val)
+	require.NoError(t, stg.Delete(ctx, "key"))
+	_, ok, _ = stg.Get(ctx, "key")
+	require.False(t, ok)
+	// incr
+	cnt, err := stg.Incr(ctx, "cnt", 2, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), cnt)
+	cnt, err = stg.Incr(ctx, "cnt", -3, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(-1), cnt)
+	require.NoError(t, stg.Set(ctx, "cnt", []byte("nan"), 0))
+	_, err = stg.Incr(ctx, "cnt", 1, 0)
+	require.Error(t, err)
+	// compare and swap
+	swapped, err := stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+	require.NoError(t, err)
+	require.False(t, swapped)
+	swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("old"), 0)
+	require.True(t, swapped)
+	swapped, _ = stg.CompareAndSwap(ctx, "cas", nil, []byte("new"), 0)
+	require.False(t, swapped)
+	swapped, _ = stg.CompareAndSwap(ctx, "cas", []byte("old"), []byte("new"), 0)
+	require.True(t, swapped)
+	val, _, _ = stg.Get(ctx, "cas")
+	require.Equal(t, []byte("new"), val)
+	// expiration
+	require.NoError(t, stg.Set(ctx, "ttl", []byte("val"), time.Millisecond))
+	_, _ = stg.Incr(ctx, "ttlcnt", 1, time.Millisecond)
+	expire(2 * time.Millisecond)
+	_, ok, _ = stg.Get(ctx, "ttl")
+	require.False(t, ok)
+	cnt, _ = stg.Incr(ctx, "ttlcnt", 1, 0)
+	require.Equal(t, int64(1), cnt)
+}
@@ -2,12 +2,25 @@ package gohalt
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"math/bits"
+	"net/http"
+	"reflect"
 	"regexp"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/1pkg/gohalt/quotapb"
+	uuid "github.com/satori/go.uuid"
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
 )
 
 // Throttler defines core gohalt throttler abstraction and exposes pair of counterpart methods: `Acquire` and `Release`.
@@ -377,23 +390,33 @@ func (thr *trunning) Release(context.Context) error {
 
 type tbuffered struct {
 	running chan struct{}
+	queue   *queue
 }
 
 // NewThrottlerBuffered creates new throttler instance that
 // waits on call which exeeds the running quota acquired - release
 // q defined by the specified threshold until the running quota is available again.
+// Use `WithQueueing` to observe waiting call queue position and estimated admission duration.
 func NewThrottlerBuffered(threshold uint64) Throttler {
-	return &tbuffered{running: make(chan struct{}, threshold)}
+	return &tbuffered{running: make(chan struct{}, threshold), queue: &queue{}}
 }
 
-func (thr *tbuffered) Acquire(context.Context) error {
+func (thr *tbuffered) Acquire(ctx context.Context) error {
+	select {
+	case thr.running <- struct{}{}:
+		return nil
+	default:
+	}
+	w := thr.queue.push(ctxQueueing(ctx))
 	thr.running <- struct{}{}
+	thr.queue.pop(w)
 	return nil
 }
 
 func (thr *tbuffered) Release(ctx context.Context) error {
 	select {
 	case <-thr.running:
+		thr.queue.tick()
 		return nil
 	default:
 		return nil
@@ -402,6 +425,7 @@ func (thr *tbuffered) Release(ctx context.Context) error {
 
 type tpriority struct {
 	running   *sync.Map
+	queues    *sync.Map
 	threshold uint64
 	levels    uint8
 }
@@ -412,24 +436,35 @@ type tpriority struct {
 // Running quota is not equally distributed between n levels of priority
 // defined by the specified levels.
 // Use `WithPriority` to override context call priority, 1 by default.
+// Use `WithQueueing` to observe waiting call queue position and estimated admission duration.
 func NewThrottlerPriority(threshold uint64, levels uint8) Throttler {
 	if levels == 0 {
 		levels = 1
 	}
-	running := &sync.Map{}
+	running, queues := &sync.Map{}, &sync.Map{}
 	koef := float64(threshold) / (float64(levels) / 2 * float64((2 + (levels - 1))))
 	for i := uint8(1); i <= levels; i++ {
 		slots := uint64(math.Round(float64(i) * koef))
 		running.Store(i, make(chan struct{}, slots))
+		queues.Store(i, &queue{})
 	}
-	return tpriority{running: running, threshold: threshold, levels: levels}
+	return tpriority{running: running, queues: queues, threshold: threshold, levels: levels}
 }
 
 func (thr tpriority) Acquire(ctx context.Context) error {
 	priority := ctxPriority(ctx, thr.levels)
 	val, _ := thr.running.Load(priority)
 	running := val.(chan struct{})
+	select {
+	case running <- struct{}{}:
+		return nil
+	default:
+	}
+	val, _ = thr.queues.Load(priority)
+	queue := val.(*queue)
+	w := queue.push(ctxQueueing(ctx))
 	running <- struct{}{}
+	queue.pop(w)
 	return nil
 }
 
@@ -439,6 +474,8 @@ func (thr tpriority) Release(ctx context.Context) error {
 	running := val.(chan struct{})
 	select {
 	case <-running:
+		val, _ = thr.queues.Load(priority)
+		val.(*queue).tick()
 		return nil
 	default:
 		return nil
@@ -458,10 +495,21 @@ type ttimed struct {
 // Use `WithWeight` to override context call qunatity, 1 by default.
 // - could return `ErrorThreshold`;
 func NewThrottlerTimed(threshold uint64, interval time.Duration, quantum time.Duration) Throttler {
-	tafter := NewThrottlerAfter(threshold).(*tafter)
-	delta, window := threshold, interval
-	if quantum > 0 && interval > quantum {
-		delta = uint64(math.Ceil(float64(threshold) / (float64(interval) / float64(quantum))))
+	return NewThrottlerTimedSpec(RateSpec{Rate: threshold, Interval: interval}, quantum)
+}
+
+// NewThrottlerTimedSpec creates new throttler instance that
+// throttles each call which exeeds the running quota acquired - release
+// q defined by the provided rate spec burst.
+// Periodically each rate spec interval the running quota number is decreased by the rate spec sustained rate.
+// If quantum is set then quantum will be used instead of interval to provide the running quota delta updates.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerTimedSpec(spec RateSpec, quantum time.Duration) Throttler {
+	tafter := NewThrottlerAfter(spec.burst()).(*tafter)
+	delta, window := spec.Rate, spec.Interval
+	if quantum > 0 && spec.Interval > quantum {
+		delta = uint64(math.Ceil(float64(spec.Rate) / (float64(spec.Interval) / float64(quantum))))
 		window = quantum
 	}
 	thr := ttimed{tafter: tafter}
@@ -492,6 +540,7 @@ func (thr ttimed) Release(ctx context.Context) error {
 }
 
 type tlatency struct {
+	clock     clock
 	reset     Runnable
 	latency   uint64
 	threshold time.Duration
@@ -522,7 +571,12 @@ func (thr *tlatency) Acquire(context.Context) error {
 }
 
 func (thr *tlatency) Release(ctx context.Context) error {
-	nowTs := time.Now().UTC().UnixNano()
+	now, jump := thr.clock.now("latency")
+	// skip latency sample on clock jump as it is not reliable.
+	if jump != 0 {
+		return nil
+	}
+	nowTs := now.UnixNano()
 	ctxTs := ctxTimestamp(ctx).UnixNano()
 	latency := uint64(nowTs - ctxTs)
 	if latency >= uint64(thr.threshold) && atomicGet(&thr.latency) == 0 {
@@ -533,6 +587,7 @@ func (thr *tlatency) Release(ctx context.Context) error {
 }
 
 type tpercentile struct {
+	clock      *clock
 	reset      Runnable
 	latencies  *percentiles
 	threshold  time.Duration
@@ -556,7 +611,7 @@ func NewThrottlerPercentile(
 	if percentile > 1.0 {
 		percentile = 1.0
 	}
-	thr := tpercentile{threshold: threshold, percentile: percentile}
+	thr := tpercentile{clock: &clock{}, threshold: threshold, percentile: percentile}
 	thr.latencies = &percentiles{cap: capacity}
 	thr.latencies.Prune()
 	thr.reset = locked(
@@ -582,7 +637,12 @@ func (thr tpercentile) Acquire(ctx context.Context) error {
 }
 
 func (thr tpercentile) Release(ctx context.Context) error {
-	nowTs := time.Now().UTC().UnixNano()
+	now, jump := thr.clock.now("percentile")
+	// skip latency sample on clock jump as it is not reliable.
+	if jump != 0 {
+		return nil
+	}
+	nowTs := now.UnixNano()
 	ctxTs := ctxTimestamp(ctx).UnixNano()
 	latency := uint64(nowTs - ctxTs)
 	thr.latencies.Push(latency)
@@ -634,7 +694,7 @@ type tmetric struct {
 // throttles call ifboolean  metric defined by the specified
 // boolean metric is reached or if any internal error occurred.
 // Builtin `Metric` implementations come with boolean metric caching by default.
-// Use builtin `NewMetricPrometheus` to create Prometheus metric instance.
+// Use builtin `NewMetricPrometheus` or `NewMetricPrometheusThreshold` to create Prometheus metric instance.
 // - could return `ErrorInternal`;
 // - could return `ErrorThreshold`;
 func NewThrottlerMetric(mtc Metric) Throttler {
@@ -737,8 +797,20 @@ func NewThrottlerAdaptive(
 	step uint64,
 	thr Throttler,
 ) Throttler {
+	return NewThrottlerAdaptiveSpec(RateSpec{Rate: threshold, Interval: interval}, quantum, step, thr)
+}
+
+// NewThrottlerAdaptiveSpec creates new throttler instance that
+// throttles each call which exeeds the running quota acquired - release q
+// defined by the provided rate spec burst, see `NewThrottlerTimedSpec`.
+// Provided adapted throttler adjusts the running quota of adapter throttler by changing the value by d
+// defined by the specified step, it subtracts *d^2* from the running quota
+// if adapted throttler throttles or adds *d* to the running quota if it doesn't.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerAdaptiveSpec(spec RateSpec, quantum time.Duration, step uint64, thr Throttler) Throttler {
 	tadaptive := &tadaptive{step: step, thr: thr}
-	tadaptive.ttimed = NewThrottlerTimed(threshold, interval, quantum).(ttimed)
+	tadaptive.ttimed = NewThrottlerTimedSpec(spec, quantum).(ttimed)
 	return tadaptive
 }
 
@@ -758,16 +830,47 @@ func (thr tadaptive) Release(ctx context.Context) error {
 }
 
 // Pattern defines a pair of regexp and related throttler.
+// Pattern with nil regexp matches any key and could be used as default pattern.
 type Pattern struct {
 	Pattern   *regexp.Regexp
 	Throttler Throttler
 }
 
+// Glob compiles the provided glob pattern to the anchored regexp that could be used in `Pattern`.
+// Glob `*` matches any sequence of characters except `/`, `**` matches any sequence of characters
+// and `?` matches any single character except `/`, all other characters are matched literally.
+func Glob(glob string) *regexp.Regexp {
+	var expr strings.Builder
+	_, _ = expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			_, _ = expr.WriteString(".*")
+			i++
+		case c == '*':
+			_, _ = expr.WriteString("[^/]*")
+		case c == '?':
+			_, _ = expr.WriteString("[^/]")
+		default:
+			_, _ = expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	_, _ = expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+func (p Pattern) match(key string) bool {
+	return p.Pattern == nil || p.Pattern.MatchString(key)
+}
+
 type tpattern []Pattern
 
 // NewThrottlerPattern creates new throttler instance that
 // throttles if matching throttler from provided patterns throttles.
+// Patterns are matched in the provided order, so pattern with nil regexp
+// should be provided last to be used as default throttler when nothing else matches.
 // Use `WithKey` to specify key for regexp pattern throttler matching.
+// Use `Glob` to compile glob pattern to regexp pattern.
 // See `Pattern` which defines a pair of regexp and related throttler.
 // - could return `ErrorInternal`;
 // - could return any underlying throttler error;
@@ -777,7 +880,7 @@ func NewThrottlerPattern(patterns ...Pattern) Throttler {
 
 func (thr tpattern) Acquire(ctx context.Context) error {
 	for _, pattern := range thr {
-		if key := ctxKey(ctx); pattern.Pattern.MatchString(key) {
+		if key := ctxKey(ctx); pattern.match(key) {
 			return pattern.Throttler.Acquire(ctx)
 		}
 	}
@@ -789,7 +892,7 @@ func (thr tpattern) Acquire(ctx context.Context) error {
 
 func (thr tpattern) Release(ctx context.Context) error {
 	for _, pattern := range thr {
-		if key := ctxKey(ctx); pattern.Pattern.MatchString(key) {
+		if key := ctxKey(ctx); pattern.match(key) {
 			_ = pattern.Throttler.Release(ctx)
 			return nil
 		}
@@ -832,10 +935,22 @@ func (thr *tring) Release(ctx context.Context) error {
 	return nil
 }
 
+// composite wraps children throttlers errors into `ErrorInternal`,
+// so composed throttlers keep returning `ErrorInternal` as before `ErrorComposite` was introduced.
+func composite(throttler string, errs map[int]error) error {
+	err := ErrorComposite{Throttler: throttler, Errors: errs}
+	return ErrorInternal{
+		Throttler: throttler,
+		Message:   err.Error(),
+		Err:       err,
+	}
+}
+
 type tall []Throttler
 
 // NewThrottlerAll creates new throttler instance that
 // throttles call if all provided throttlers throttle.
+// Returned `ErrorInternal` error wraps `ErrorComposite` error that carries all children throttlers errors.
 // - could return `ErrorInternal`;
 func NewThrottlerAll(thrs ...Throttler) Throttler {
 	return tall(thrs)
@@ -843,16 +958,15 @@ func NewThrottlerAll(thrs ...Throttler) Throttler {
 
 func (thrs tall) Acquire(ctx context.Context) error {
 	if length := len(thrs); length > 0 {
-		var err error
-		for _, thr := range thrs {
-			if err = thr.Acquire(ctx); err == nil {
+		errs := make(map[int]error, length)
+		for i, thr := range thrs {
+			err := thr.Acquire(ctx)
+			if err == nil {
 				return nil
 			}
+			errs[i] = err
 		}
-		return ErrorInternal{
-			Throttler: "all",
-			Message:   err.Error(),
-		}
+		return composite("all", errs)
 	}
 	return nil
 }
@@ -870,26 +984,32 @@ type tany []Throttler
 
 // NewThrottlerAny creates new throttler instance that
 // throttles call if any of provided throttlers throttle.
+// Returned `ErrorInternal` error wraps `ErrorComposite` error that carries all throttling children throttlers errors.
 // - could return `ErrorInternal`;
 func NewThrottlerAny(thrs ...Throttler) Throttler {
 	return tany(thrs)
 }
 
 func (thrs tany) Acquire(ctx context.Context) error {
+	var lock sync.Mutex
+	errs := make(map[int]error)
 	runs := make([]Runnable, 0, len(thrs))
-	for _, thr := range thrs {
-		thr := thr
+	for i, thr := range thrs {
+		i, thr := i, thr
 		runs = append(runs, func(ctx context.Context) error {
 			if err := thr.Acquire(ctx); err != nil {
-				return ErrorInternal{
-					Throttler: "any",
-					Message:   err.Error(),
-				}
+				lock.Lock()
+				errs[i] = err
+				lock.Unlock()
+				return err
 			}
 			return nil
 		})
 	}
-	return all(runs...)(ctx)
+	if err := all(runs...)(ctx); err != nil {
+		return composite("any", errs)
+	}
+	return nil
 }
 
 func (thrs tany) Release(ctx context.Context) error {
@@ -909,7 +1029,8 @@ type tnot struct {
 }
 
 // NewThrottlerNot creates new throttler instance that
-// throttles call if provided throttler doesn't throttle.
+// throttles call if provided throttler doesn't throttle and vice versa,
+// e.g. not throttler over time window throttlers allows calls only outside of the window.
 // - could return `ErrorInternal`;
 func NewThrottlerNot(thr Throttler) Throttler {
 	return tnot{thr: thr}
@@ -1111,7 +1232,33 @@ func (thr tsemaphore) Release(ctx context.Context) error {
 	return nil
 }
 
+// RateSpec defines common rate throttlers configuration:
+// - Rate shows sustained number of calls per interval.
+// - Interval shows sustained rate interval.
+// - Burst shows max number of calls that could be admitted at once, equals to rate if not set.
+// RateSpec is accepted by rate throttlers that replenish quota gradually:
+// `cellrate`, `bucket`, `timed`, `adaptive` and `gcra`.
+// Fixed window `storage timed` and `storage hybrid` throttlers admit whole window quota at once,
+// so their burst always equals to rate, while `pacing` and `spacing` throttlers define their own burst models.
+type RateSpec struct {
+	Rate     uint64
+	Interval time.Duration
+	Burst    uint64
+}
+
+func (spec RateSpec) quantum() time.Duration {
+	return time.Duration(math.Ceil(float64(spec.Interval) / float64(spec.Rate)))
+}
+
+func (spec RateSpec) burst() uint64 {
+	if spec.Burst == 0 {
+		return spec.Rate
+	}
+	return spec.Burst
+}
+
 type tcellrate struct {
+	clock     clock
 	current   uint64
 	threshold uint64
 	quantum   time.Duration
@@ -1124,12 +1271,26 @@ type tcellrate struct {
 // Use `WithWeight` to override context call qunatity, 1 by default.
 // - could return `ErrorThreshold`;
 func NewThrottlerCellRate(threshold uint64, interval time.Duration, monotone bool) Throttler {
-	quantum := time.Duration(math.Ceil(float64(interval) / float64(threshold)))
-	return &tcellrate{threshold: threshold, quantum: quantum, monotone: monotone}
+	return NewThrottlerCellRateSpec(RateSpec{Rate: threshold, Interval: interval}, monotone)
+}
+
+// NewThrottlerCellRateSpec creates new throttler instance that
+// uses generic cell rate algorithm to throttles call within provided rate spec
+// sustained rate and independent burst.
+// If provided monotone flag is set class to release will have no effect on throttler.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerCellRateSpec(spec RateSpec, monotone bool) Throttler {
+	return &tcellrate{threshold: spec.burst(), quantum: spec.quantum(), monotone: monotone}
 }
 
 func (thr *tcellrate) Acquire(ctx context.Context) error {
-	nowTs := uint64(time.Now().UTC().UnixNano())
+	now, jump := thr.clock.now("cellrate")
+	// resynchronize theoretical arrival time on clock jump.
+	if jump != 0 {
+		atomicSet(&thr.current, 0)
+	}
+	nowTs := uint64(now.UnixNano())
 	delta := (uint64(thr.quantum) * uint64(ctxWeightMod(ctx)))
 	if current := atomicGet(&thr.current); current < nowTs {
 		delta += nowTs - current
@@ -1156,10 +1317,11 @@ func (thr *tcellrate) Release(ctx context.Context) error {
 }
 
 type tbucket struct {
+	clock     clock
 	current   uint64
 	lastTs    uint64
 	threshold uint64
-	quantum   time.Duration
+	quantum   uint64
 	monotone  bool
 }
 
@@ -1169,23 +1331,57 @@ type tbucket struct {
 // Use `WithWeight` to override context call qunatity, 1 by default.
 // - could return `ErrorThreshold`;
 func NewThrottlerBucket(threshold uint64, interval time.Duration, monotone bool) Throttler {
-	quantum := time.Duration(math.Ceil(float64(interval) / float64(threshold)))
-	return &tbucket{threshold: threshold, quantum: quantum, monotone: monotone}
+	return NewThrottlerBucketSpec(RateSpec{Rate: threshold, Interval: interval}, monotone)
+}
+
+// NewThrottlerBucketSpec creates new throttler instance that
+// uses leaky bucket algorithm to throttles call within provided rate spec
+// sustained leak rate and independent bucket burst capacity.
+// If provided monotone flag is set class to release will have no effect on throttler.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerBucketSpec(spec RateSpec, monotone bool) Throttler {
+	return NewThrottlerBucketLimiter(spec, monotone)
+}
+
+// Limiter defines throttler which rate could be adjusted at runtime.
+type Limiter interface {
+	Throttler
+	// SetRate sets new rate spec without dropping already acquired quota.
+	SetRate(RateSpec)
+}
+
+// NewThrottlerBucketLimiter creates new throttler instance that
+// uses leaky bucket algorithm to throttles call within provided rate spec
+// sustained leak rate and independent bucket burst capacity.
+// Rate spec could be adjusted at runtime via `SetRate`,
+// already acquired quota is then leaked with the new rate.
+// If provided monotone flag is set class to release will have no effect on throttler.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerBucketLimiter(spec RateSpec, monotone bool) Limiter {
+	return &tbucket{threshold: spec.burst(), quantum: uint64(spec.quantum()), monotone: monotone}
 }
 
 func (thr *tbucket) Acquire(ctx context.Context) error {
-	nowTs := uint64(time.Now().UTC().UnixNano())
+	now, jump := thr.clock.now("bucket")
+	// resynchronize leak timestamp on clock jump.
+	if jump != 0 {
+		atomicSet(&thr.lastTs, 0)
+	}
+	nowTs := uint64(now.UnixNano())
+	quantum, threshold := atomicGet(&thr.quantum), atomicGet(&thr.threshold)
 	var delta int64
 	if lastTs := atomicGet(&thr.lastTs); lastTs > 0 {
-		delta = int64(float64(nowTs-lastTs) / float64(thr.quantum))
-		nowTs = uint64(delta) * uint64(thr.quantum)
+		delta = int64(float64(nowTs-lastTs) / float64(quantum))
+		nowTs = uint64(delta) * quantum
 	}
 	diff := ctxWeightMod(ctx) - delta
-	if current := atomicBSingAdd(&thr.current, diff); current > thr.threshold {
+	if current := atomicBSingAdd(&thr.current, diff); current > threshold {
 		atomicBSingAdd(&thr.current, -diff)
 		return ErrorThreshold{
 			Throttler: "bucket",
-			Threshold: strpair{current: current, threshold: thr.threshold},
+			Threshold: strpair{current: current, threshold: threshold},
 		}
 	}
 	atomicBAdd(&thr.lastTs, nowTs)
@@ -1200,3 +1396,2776 @@ func (thr *tbucket) Release(ctx context.Context) error {
 	atomicBSub(&thr.current, uint64(ctxWeightMod(ctx)))
 	return nil
 }
+
+func (thr *tbucket) SetRate(spec RateSpec) {
+	atomicSet(&thr.quantum, uint64(spec.quantum()))
+	atomicSet(&thr.threshold, spec.burst())
+}
+
+type tdelegation struct {
+	clock    clock
+	secret   []byte
+	report   func(context.Context, Delegation, uint64)
+	consumed sync.Map
+	sweep    Runnable
+}
+
+type delegated struct {
+	dlg      Delegation
+	consumed uint64
+}
+
+// NewThrottlerDelegation creates new throttler instance that
+// throttles call if quota slice delegated by the context delegation token is exhausted
+// or if delegation token is not valid either by the specified secret signature or by expiration.
+// Each delegation token consumption is debited locally and reported back through the provided report callback
+// so it could be propagated back to upstream service to provide end-to-end quota accounting.
+// Expired delegation tokens consumption is periodically removed on new tokens arrival.
+// Use `MintDelegation` to mint new delegation token on upstream service.
+// Use `WithDelegation` to specify context delegation token.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorInternal`;
+// - could return `ErrorThreshold`;
+func NewThrottlerDelegation(secret []byte, report func(context.Context, Delegation, uint64)) Throttler {
+	thr := &tdelegation{secret: secret, report: report}
+	thr.sweep = locked(func(context.Context) error {
+		now, _ := thr.clock.now("delegation")
+		thr.consumed.Range(func(key interface{}, val interface{}) bool {
+			if val.(*delegated).dlg.Expires.Before(now) {
+				thr.consumed.Delete(key)
+			}
+			return true
+		})
+		return nil
+	})
+	return thr
+}
+
+func (thr *tdelegation) Acquire(ctx context.Context) error {
+	token := ctxDelegation(ctx)
+	if token == "" {
+		return ErrorInternal{
+			Throttler: "delegation",
+			Message:   "context doesn't contain required delegation token",
+		}
+	}
+	dlg, err := verifyDelegation(thr.secret, token)
+	if err != nil {
+		return ErrorInternal{
+			Throttler: "delegation",
+			Message:   err.Error(),
+		}
+	}
+	// delegation token expiration is absolute wall time, so clock jumps need no resynchronization.
+	if now, _ := thr.clock.now("delegation"); dlg.Expires.Before(now) {
+		thr.consumed.Delete(dlg.ID)
+		return ErrorInternal{
+			Throttler: "delegation",
+			Message:   "delegation token has expired",
+		}
+	}
+	val, loaded := thr.consumed.LoadOrStore(dlg.ID, &delegated{dlg: dlg})
+	if !loaded {
+		gorun(ctx, thr.sweep)
+	}
+	entry := val.(*delegated)
+	weight := uint64(ctxWeightMod(ctx))
+	if consumed := atomicBAdd(&entry.consumed, weight); consumed > dlg.Quota {
+		atomicBSub(&entry.consumed, weight)
+		return ErrorThreshold{
+			Throttler: "delegation",
+			Threshold: strpair{current: consumed, threshold: dlg.Quota},
+		}
+	}
+	if thr.report != nil {
+		thr.report(ctx, dlg, atomicGet(&entry.consumed))
+	}
+	return nil
+}
+
+func (thr *tdelegation) Release(context.Context) error {
+	return nil
+}
+
+type tmigration struct {
+	clock     clock
+	prev      Throttler
+	next      Throttler
+	agreement float64
+	period    time.Duration
+	start     uint64
+	total     uint64
+	disagree  uint64
+	flipped   uint64
+}
+
+// NewThrottlerMigration creates new throttler instance that
+// runs both provided previous and next throttlers side by side
+// while enforcing previous throttler decisions and recording disagreement rate with next throttler.
+// After each specified period the agreement rate between throttlers is evaluated,
+// and if it reaches the specified agreement threshold enforcement is flipped to next throttler,
+// otherwise agreement rate evaluation starts over in new period.
+// Agreement value is normalized to [0.0, 1.0] range.
+// Both throttlers are always acquired and released, so previous throttler state still advances after flip.
+// - could return any underlying throttler error;
+func NewThrottlerMigration(prev Throttler, next Throttler, agreement float64, period time.Duration) Throttler {
+	agreement = math.Abs(agreement)
+	if agreement > 1.0 {
+		agreement = 1.0
+	}
+	thr := &tmigration{
+		prev:      prev,
+		next:      next,
+		agreement: agreement,
+		period:    period,
+	}
+	now, _ := thr.clock.now("migration")
+	thr.start = uint64(now.UnixNano())
+	return thr
+}
+
+func (thr *tmigration) Acquire(ctx context.Context) error {
+	perr := thr.prev.Acquire(ctx)
+	nerr := thr.next.Acquire(ctx)
+	if atomicGet(&thr.flipped) > 0 {
+		return nerr
+	}
+	total := atomicBIncr(&thr.total)
+	disagree := atomicGet(&thr.disagree)
+	if (perr == nil) != (nerr == nil) {
+		disagree = atomicBIncr(&thr.disagree)
+	}
+	now, jump := thr.clock.now("migration")
+	nowTs := uint64(now.UnixNano())
+	// start agreement period over on clock jump.
+	if jump != 0 {
+		atomicSet(&thr.total, 0)
+		atomicSet(&thr.disagree, 0)
+		atomicSet(&thr.start, nowTs)
+		return perr
+	}
+	if start := atomicGet(&thr.start); nowTs-start >= uint64(thr.period) {
+		if agreement := 1.0 - float64(disagree)/float64(total); agreement >= thr.agreement {
+			atomicSet(&thr.flipped, 1)
+			log("migration throttler is flipped with agreement: %s", strpercent(agreement))
+		} else {
+			atomicSet(&thr.total, 0)
+			atomicSet(&thr.disagree, 0)
+			atomicSet(&thr.start, nowTs)
+		}
+	}
+	return perr
+}
+
+func (thr *tmigration) Release(ctx context.Context) error {
+	_ = thr.prev.Release(ctx)
+	_ = thr.next.Release(ctx)
+	return nil
+}
+
+type ttenant struct {
+	clock    clock
+	qp       QuotaProvider
+	def      uint64
+	interval time.Duration
+	tenants  sync.Map
+}
+
+type tenanted struct {
+	lock    sync.Mutex
+	current uint64
+	window  int64
+}
+
+// NewThrottlerTenant creates new throttler instance that
+// throttles each call which exeeds the tenant quota in the specified interval,
+// the tenant quota is loaded from the provided quota provider on each call
+// or defined by the specified default quota for unknown tenants.
+// Periodically each specified interval the tenant quota usage is reseted.
+// Use `WithTenant` to specify context tenant, empty tenant by default.
+// Use `NewQuotaProviderStatic` to create static quota provider instance.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorInternal`;
+// - could return `ErrorThreshold`;
+func NewThrottlerTenant(qp QuotaProvider, def uint64, interval time.Duration) Throttler {
+	return &ttenant{qp: qp, def: def, interval: interval}
+}
+
+func (thr *ttenant) Acquire(ctx context.Context) error {
+	tenant := ctxTenant(ctx)
+	quota, ok, err := thr.qp.Quota(ctx, tenant)
+	if err != nil {
+		return ErrorInternal{
+			Throttler: "tenant",
+			Message:   err.Error(),
+		}
+	}
+	if !ok {
+		quota = thr.def
+	}
+	val, _ := thr.tenants.LoadOrStore(tenant, &tenanted{})
+	entry := val.(*tenanted)
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+	if thr.interval > 0 {
+		// tenant windows are aligned to wall time, so clock jumps need no resynchronization.
+		now, _ := thr.clock.now("tenant")
+		if window := now.UnixNano() / int64(thr.interval); window != entry.window {
+			entry.current, entry.window = 0, window
+		}
+	}
+	current := entry.current + uint64(ctxWeightMod(ctx))
+	if current > quota {
+		return ErrorThreshold{
+			Throttler: "tenant",
+			Threshold: strpair{current: current, threshold: quota},
+		}
+	}
+	entry.current = current
+	return nil
+}
+
+func (thr *ttenant) Release(context.Context) error {
+	return nil
+}
+
+type tsharded struct {
+	gen    Generator
+	shards []sharded
+}
+
+type sharded struct {
+	lock sync.Mutex
+	thr  Throttler
+}
+
+// NewThrottlerSharded creates new throttler instance that
+// throttles if found key matching shard throttler throttles.
+// Keys are distributed between fixed number of shard throttlers defined by the specified shards
+// using jump consistent hash, trading per key precision for bounded memory and lock contention.
+// Shard throttlers are lazily created by the provided generator see `Generator` with shard index as a key.
+// Use `WithKey` to specify key for shard throttler matching.
+// - could return `ErrorInternal`;
+// - could return any underlying throttler error;
+func NewThrottlerSharded(gen Generator, shards uint64) Throttler {
+	if shards == 0 {
+		shards = 1
+	}
+	return &tsharded{gen: gen, shards: make([]sharded, shards)}
+}
+
+func (thr *tsharded) Acquire(ctx context.Context) error {
+	index := jump(ctxKey(ctx), len(thr.shards))
+	shard := &thr.shards[index]
+	shard.lock.Lock()
+	if shard.thr == nil {
+		sthr, err := thr.gen(strconv.Itoa(int(index)))
+		if err != nil {
+			shard.lock.Unlock()
+			return ErrorInternal{
+				Throttler: "sharded",
+				Message:   err.Error(),
+			}
+		}
+		shard.thr = sthr
+	}
+	sthr := shard.thr
+	shard.lock.Unlock()
+	return sthr.Acquire(ctx)
+}
+
+func (thr *tsharded) Release(ctx context.Context) error {
+	shard := &thr.shards[jump(ctxKey(ctx), len(thr.shards))]
+	shard.lock.Lock()
+	sthr := shard.thr
+	shard.lock.Unlock()
+	if sthr != nil {
+		return sthr.Release(ctx)
+	}
+	return nil
+}
+
+// Leaser defines throttler that keeps held running quota slots as leases
+// which need to be periodically renewed by holders.
+type Leaser interface {
+	Throttler
+	// Heartbeat renews held slot lease or returns error if lease has been already reclaimed.
+	Heartbeat(context.Context) error
+}
+
+type tlease struct {
+	clock     clock
+	lock      sync.Mutex
+	leases    map[string]time.Time
+	threshold uint64
+	ttl       time.Duration
+}
+
+// NewThrottlerLease creates new throttler instance that
+// throttles each call which exeeds the running quota acquired - release
+// q defined by the specified threshold.
+// Each held running quota slot is kept as a lease that expires after the specified ttl
+// unless it is renewed by `Heartbeat`, expired leases are reclaimed
+// so running quota is not permanently lost when holder disappears without release.
+// Use `WithLease` to specify context lease identifier for acquire, release and heartbeat.
+// - could return `ErrorInternal`;
+// - could return `ErrorThreshold`;
+func NewThrottlerLease(threshold uint64, ttl time.Duration) Leaser {
+	return &tlease{leases: make(map[string]time.Time), threshold: threshold, ttl: ttl}
+}
+
+func (thr *tlease) Acquire(ctx context.Context) error {
+	lease := ctxLease(ctx)
+	if lease == "" {
+		return ErrorInternal{
+			Throttler: "lease",
+			Message:   "context doesn't contain required lease",
+		}
+	}
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	now := thr.now()
+	for id, deadline := range thr.leases {
+		if deadline.Before(now) {
+			delete(thr.leases, id)
+			log("lease %q is reclaimed after expiration", id)
+		}
+	}
+	if _, ok := thr.leases[lease]; !ok {
+		if running := uint64(len(thr.leases)) + 1; running > thr.threshold {
+			return ErrorThreshold{
+				Throttler: "lease",
+				Threshold: strpair{current: running, threshold: thr.threshold},
+			}
+		}
+	}
+	thr.leases[lease] = now.Add(thr.ttl)
+	return nil
+}
+
+func (thr *tlease) Release(ctx context.Context) error {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	delete(thr.leases, ctxLease(ctx))
+	return nil
+}
+
+func (thr *tlease) Heartbeat(ctx context.Context) error {
+	lease := ctxLease(ctx)
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	now := thr.now()
+	if deadline, ok := thr.leases[lease]; !ok || deadline.Before(now) {
+		delete(thr.leases, lease)
+		return ErrorInternal{
+			Throttler: "lease",
+			Message:   "lease is not found",
+		}
+	}
+	thr.leases[lease] = now.Add(thr.ttl)
+	return nil
+}
+
+// now returns current time and shifts all lease deadlines on clock jump
+// so leases are neither mass reclaimed nor held longer after clock jump.
+func (thr *tlease) now() time.Time {
+	now, jump := thr.clock.now("lease")
+	if jump != 0 {
+		for id, deadline := range thr.leases {
+			thr.leases[id] = deadline.Add(jump)
+		}
+	}
+	return now
+}
+
+// Resizer defines throttler which running quota capacity could be adjusted at runtime.
+type Resizer interface {
+	Throttler
+	// SetCapacity sets new running quota capacity without dropping already acquired quota.
+	SetCapacity(uint64)
+}
+
+type tresizable struct {
+	current  uint64
+	capacity uint64
+}
+
+// NewThrottlerResizable creates new throttler instance that
+// throttles call which exeeds the running quota acquired - release
+// q defined by the specified capacity similar to semaphore throttler.
+// Running quota capacity could be grown or shrunk at runtime via `SetCapacity`
+// without dropping already acquired quota, after shrinking new calls are throttled
+// until enough acquired quota is released.
+// Use `WithWeight` to override context call weight, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerResizable(capacity uint64) Resizer {
+	return &tresizable{capacity: capacity}
+}
+
+func (thr *tresizable) Acquire(ctx context.Context) error {
+	weight := uint64(ctxWeightMod(ctx))
+	capacity := atomicGet(&thr.capacity)
+	if current := atomicBAdd(&thr.current, weight); current > capacity {
+		atomicBSub(&thr.current, weight)
+		return ErrorThreshold{
+			Throttler: "resizable",
+			Threshold: strpair{current: current, threshold: capacity},
+		}
+	}
+	return nil
+}
+
+func (thr *tresizable) Release(ctx context.Context) error {
+	atomicBSub(&thr.current, uint64(ctxWeightMod(ctx)))
+	return nil
+}
+
+func (thr *tresizable) SetCapacity(capacity uint64) {
+	atomicSet(&thr.capacity, capacity)
+}
+
+type tmemo struct {
+	clock   clock
+	thr     Throttler
+	ttl     time.Duration
+	window  time.Duration
+	lock    sync.Mutex
+	current int64
+	swept   time.Time
+	memo    map[string]memoized
+}
+
+type memoized struct {
+	err      error
+	deadline time.Time
+}
+
+// NewThrottlerMemo creates new throttler instance that
+// memoizes provided throttler rejections for identical decision inputs for the provided ttl duration.
+// Decision inputs are defined by context key, context weight power of two bucket and the specified window,
+// all memoized rejections are explicitly invalidated on each window rollover.
+// Expired memoized rejections are periodically removed on new rejections arrival, so zero window is safe to use.
+// Only throttling calls are memoized, non throttling calls are never memoized.
+// Use `WithKey` to specify key for memoized decision inputs.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return any underlying throttler error;
+func NewThrottlerMemo(thr Throttler, ttl time.Duration, window time.Duration) Throttler {
+	return &tmemo{thr: thr, ttl: ttl, window: window, memo: make(map[string]memoized)}
+}
+
+func (thr *tmemo) Acquire(ctx context.Context) error {
+	now, jump := thr.clock.now("memo")
+	var window int64
+	if thr.window > 0 {
+		window = now.UnixNano() / int64(thr.window)
+	}
+	key := fmt.Sprintf("%s_%d", ctxKey(ctx), bits.Len64(uint64(ctxWeightMod(ctx))))
+	thr.lock.Lock()
+	// invalidate all memoized rejections on clock jump as their deadlines are not reliable.
+	if window != thr.current || jump != 0 {
+		thr.current, thr.memo = window, make(map[string]memoized)
+	}
+	if memo, ok := thr.memo[key]; ok {
+		if now.Before(memo.deadline) {
+			thr.lock.Unlock()
+			return memo.err
+		}
+		delete(thr.memo, key)
+	}
+	thr.lock.Unlock()
+	err := thr.thr.Acquire(ctx)
+	if err != nil {
+		thr.lock.Lock()
+		if window == thr.current {
+			thr.sweep(now)
+			thr.memo[key] = memoized{err: err, deadline: now.Add(thr.ttl)}
+		}
+		thr.lock.Unlock()
+	}
+	return err
+}
+
+func (thr *tmemo) Release(ctx context.Context) error {
+	_ = thr.thr.Release(ctx)
+	return nil
+}
+
+// sweep removes expired memoized rejections at most once per ttl,
+// it needs to be called under memo lock.
+func (thr *tmemo) sweep(now time.Time) {
+	if now.Before(thr.swept.Add(thr.ttl)) {
+		return
+	}
+	thr.swept = now
+	for key, memo := range thr.memo {
+		if !now.Before(memo.deadline) {
+			delete(thr.memo, key)
+		}
+	}
+}
+
+// Drainer defines throttler that could be drained for graceful shutdown coordination.
+type Drainer interface {
+	Throttler
+	// Drain switches throttler to draining mode, so no new calls are allowed.
+	Drain()
+	// Done returns channel that is closed when draining throttler has no calls in flight.
+	Done() <-chan struct{}
+}
+
+type tdrain struct {
+	thr      Throttler
+	inflight uint64
+	draining uint64
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewThrottlerDrain creates new throttler instance that
+// throttles if provided throttler throttles or if throttler is draining.
+// Once `Drain` is called no new calls are allowed but existing calls releases are still accounted,
+// and `Done` channel is closed when number of calls in flight reaches zero.
+// Calls in flight are counted as acquires minus releases regardless of acquire result.
+// - could return `ErrorInternal`;
+// - could return any underlying throttler error;
+func NewThrottlerDrain(thr Throttler) Drainer {
+	return &tdrain{thr: thr, done: make(chan struct{})}
+}
+
+func (thr *tdrain) Acquire(ctx context.Context) error {
+	atomicBIncr(&thr.inflight)
+	if atomicGet(&thr.draining) > 0 {
+		return ErrorInternal{
+			Throttler: "drain",
+			Message:   "throttler is draining",
+		}
+	}
+	return thr.thr.Acquire(ctx)
+}
+
+func (thr *tdrain) Release(ctx context.Context) error {
+	_ = thr.thr.Release(ctx)
+	if inflight := atomicBDecr(&thr.inflight); inflight == 0 && atomicGet(&thr.draining) > 0 {
+		thr.close()
+	}
+	return nil
+}
+
+func (thr *tdrain) Drain() {
+	atomicSet(&thr.draining, 1)
+	if atomicGet(&thr.inflight) == 0 {
+		thr.close()
+	}
+}
+
+func (thr *tdrain) Done() <-chan struct{} {
+	return thr.done
+}
+
+func (thr *tdrain) close() {
+	thr.once.Do(func() {
+		close(thr.done)
+	})
+}
+
+type trandom struct {
+	clock    clock
+	min      time.Duration
+	max      time.Duration
+	lock     sync.Mutex
+	last     time.Time
+	interval time.Duration
+}
+
+// NewThrottlerRandom creates new throttler instance that
+// throttles each call which exeeds single call per randomly chosen interval
+// within the specified [min, max] durations range, new interval is chosen after each allowed call.
+// Useful to jitter polling across a fleet of agents so they don't synchronize against central server.
+// Implementation uses secure `crypto/rand` as PRNG function.
+// - could return `ErrorThreshold`;
+func NewThrottlerRandom(min time.Duration, max time.Duration) Throttler {
+	if max < min {
+		min, max = max, min
+	}
+	return &trandom{min: min, max: max}
+}
+
+func (thr *trandom) Acquire(context.Context) error {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	now, jump := thr.clock.now("random")
+	// shift last call time by clock jump to keep elapsed duration monotonic.
+	if jump != 0 && !thr.last.IsZero() {
+		thr.last = thr.last.Add(jump)
+	}
+	if elapsed := now.Sub(thr.last); !thr.last.IsZero() && elapsed < thr.interval {
+		return ErrorThreshold{
+			Throttler: "random",
+			Threshold: strdurations{current: elapsed, threshold: thr.interval},
+		}
+	}
+	thr.last = now
+	thr.interval = thr.min + time.Duration(float64(thr.max-thr.min)*rndf64(0.5))
+	return nil
+}
+
+func (thr *trandom) Release(context.Context) error {
+	return nil
+}
+
+type toutlier struct {
+	clock     clock
+	reset     Runnable
+	latencies *percentiles
+	deviation float64
+	lock      sync.Mutex
+	latency   time.Duration
+	threshold time.Duration
+}
+
+// NewThrottlerOutlier creates new throttler instance that
+// throttles each call after the call latency l was detected as statistical outlier
+// in the rolling latencies distribution, so the call latency l is above
+// *mean + k * stddev* of the distribution where k is defined by the specified deviation.
+// Latencies values are kept in bounded buffer with capacity c defined by the specified capacity,
+// at least two latencies values are required to detect an outlier.
+// If retention is set then throttler state will be reseted after retention duration.
+// Use `WithTimestamp` to specify running duration between throttler acquire and release.
+// - could return `ErrorThreshold`;
+func NewThrottlerOutlier(capacity uint8, deviation float64, retention time.Duration) Throttler {
+	thr := &toutlier{deviation: math.Abs(deviation)}
+	thr.latencies = &percentiles{cap: capacity}
+	thr.latencies.Prune()
+	thr.reset = delayed(retention, func(context.Context) error {
+		thr.lock.Lock()
+		defer thr.lock.Unlock()
+		thr.latency, thr.threshold = 0, 0
+		return nil
+	})
+	return thr
+}
+
+func (thr *toutlier) Acquire(context.Context) error {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	if thr.latency > 0 {
+		return ErrorThreshold{
+			Throttler: "outlier",
+			Threshold: strdurations{current: thr.latency, threshold: thr.threshold},
+		}
+	}
+	return nil
+}
+
+func (thr *toutlier) Release(ctx context.Context) error {
+	now, jump := thr.clock.now("outlier")
+	// skip latency sample on clock jump as it is not reliable.
+	if jump != 0 {
+		return nil
+	}
+	nowTs := now.UnixNano()
+	ctxTs := ctxTimestamp(ctx).UnixNano()
+	latency := time.Duration(nowTs - ctxTs)
+	if thr.latencies.Len() >= 2 {
+		mean, std := thr.latencies.Deviation()
+		threshold := time.Duration(mean + thr.deviation*std)
+		thr.lock.Lock()
+		if latency > threshold && thr.latency == 0 {
+			thr.latency, thr.threshold = latency, threshold
+			gorun(ctx, thr.reset)
+		}
+		thr.lock.Unlock()
+	}
+	thr.latencies.Push(uint64(latency))
+	return nil
+}
+
+// Aggregate defines hourly throttling decisions aggregate for a single key:
+// - Key shows the aggregated context key.
+// - Hour shows UTC hour start of the aggregate.
+// - Admitted shows number of admitted calls.
+// - Rejected shows number of rejected calls.
+// - Cost shows total weight of admitted calls.
+type Aggregate struct {
+	Key      string
+	Hour     time.Time
+	Admitted uint64
+	Rejected uint64
+	Cost     uint64
+}
+
+// Aggregator defines throttler that persists hourly throttling decisions aggregates.
+type Aggregator interface {
+	Throttler
+	// Aggregates returns non empty hourly aggregates for the key in the provided time range
+	// ordered by hour or internal error if any happened.
+	Aggregates(ctx context.Context, key string, from time.Time, to time.Time) ([]Aggregate, error)
+}
+
+type taggregate struct {
+	clock     *clock
+	thr       Throttler
+	stg       Storage
+	retention time.Duration
+}
+
+// NewThrottlerAggregate creates new throttler instance that
+// throttles if provided throttler throttles and rolls up hourly admit, reject and cost
+// statistics per context key persisted in the provided storage for the specified retention.
+// Aggregates could be queried via `Aggregates` to feed capacity planning with historical data.
+// Storage failures are only logged and never affect throttling decisions.
+// Use `WithKey` to specify key for aggregated decisions.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return any underlying throttler error;
+func NewThrottlerAggregate(thr Throttler, stg Storage, retention time.Duration) Aggregator {
+	return taggregate{clock: &clock{}, thr: thr, stg: stg, retention: retention}
+}
+
+func (thr taggregate) Acquire(ctx context.Context) error {
+	now, _ := thr.clock.now("aggregate")
+	hour := now.Truncate(time.Hour)
+	key := ctxKey(ctx)
+	err := thr.thr.Acquire(ctx)
+	if err != nil {
+		thr.incr(ctx, key, hour, "reject", 1)
+		return err
+	}
+	thr.incr(ctx, key, hour, "admit", 1)
+	thr.incr(ctx, key, hour, "cost", ctxWeightMod(ctx))
+	return nil
+}
+
+func (thr taggregate) Release(ctx context.Context) error {
+	_ = thr.thr.Release(ctx)
+	return nil
+}
+
+func (thr taggregate) Aggregates(
+	ctx context.Context,
+	key string,
+	from time.Time,
+	to time.Time,
+) ([]Aggregate, error) {
+	var aggs []Aggregate
+	for hour := from.UTC().Truncate(time.Hour); !hour.After(to.UTC()); hour = hour.Add(time.Hour) {
+		agg := Aggregate{Key: key, Hour: hour}
+		var found bool
+		for metric, val := range map[string]*uint64{
+			"admit":  &agg.Admitted,
+			"reject": &agg.Rejected,
+			"cost":   &agg.Cost,
+		} {
+			bval, ok, err := thr.stg.Get(ctx, thr.key(key, hour, metric))
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			if *val, err = strconv.ParseUint(string(bval), 10, 64); err != nil {
+				return nil, err
+			}
+			found = true
+		}
+		if found {
+			aggs = append(aggs, agg)
+		}
+	}
+	return aggs, nil
+}
+
+func (thr taggregate) incr(ctx context.Context, key string, hour time.Time, metric string, delta int64) {
+	if _, err := thr.stg.Incr(ctx, thr.key(key, hour, metric), delta, thr.retention); err != nil {
+		log("aggregate throttler storage error is suppressed: %v", err)
+	}
+}
+
+func (thr taggregate) key(key string, hour time.Time, metric string) string {
+	return fmt.Sprintf("gohalt_aggregate:%s:%d:%s", key, hour.Unix(), metric)
+}
+
+type tdefer struct {
+	thr      Throttler
+	enq      Throttler
+	priority uint8
+	retry    time.Duration
+}
+
+// NewThrottlerDefer creates new throttler instance that
+// throttles if provided throttler throttles and call priority is not below the specified priority,
+// such high priority calls are rejected immediately with `ErrorRetry` defined by the specified retry duration.
+// Otherwise low priority calls rejected by provided throttler are routed to the provided enqueuer
+// for deferred processing and are throttled only if any enqueuing internal error occurred, see `NewThrottlerEnqueue`.
+// Use `WithPriority` to override context call priority, 1 by default.
+// Use `WithMessage` to specify context message for enqueued message and
+// `WithMarshaler` to specify context message marshaler.
+// - could return `ErrorRetry`;
+// - could return `ErrorInternal`;
+func NewThrottlerDefer(thr Throttler, enq Enqueuer, priority uint8, retry time.Duration) Throttler {
+	return tdefer{thr: thr, enq: NewThrottlerEnqueue(enq), priority: priority, retry: retry}
+}
+
+func (thr tdefer) Acquire(ctx context.Context) error {
+	err := thr.thr.Acquire(ctx)
+	if err == nil {
+		return nil
+	}
+	if ctxPriority(ctx, math.MaxUint8) < thr.priority {
+		return thr.enq.Acquire(ctx)
+	}
+	return ErrorRetry{Throttler: "defer", After: thr.retry, Err: err}
+}
+
+func (thr tdefer) Release(ctx context.Context) error {
+	_ = thr.thr.Release(ctx)
+	return nil
+}
+
+type tmutex struct {
+	stg    Storage
+	key    string
+	ttl    time.Duration
+	lock   sync.Mutex
+	holder []byte
+	// owner keeps holder acquire context, so releases paired with rejected acquires are skipped.
+	owner context.Context
+}
+
+// NewThrottlerMutex creates new throttler instance that
+// throttles each call while the distributed lock defined by the specified key
+// is held by any other holder across all replicas sharing the provided storage.
+// Acquired lock expires after the specified ttl even if it is never released,
+// so the lock is not permanently lost when holder replica disappears.
+// Each successful acquire increments monotonic fencing token stored next to the lock,
+// so stale holders writes could be rejected downstream.
+// New unique holder id `gohalt_mutex_{{uuid}}` is created for each new lock acquire.
+// Lock is released only by the release called with the holder acquire context or context derived from it,
+// so concurrent calls should use their own contexts.
+// Use `WithFence` to observe acquired lock fencing token.
+// - could return `ErrorInternal`;
+// - could return `ErrorThreshold`;
+func NewThrottlerMutex(stg Storage, key string, ttl time.Duration) Throttler {
+	return &tmutex{stg: stg, key: fmt.Sprintf("gohalt_mutex:%s", key), ttl: ttl}
+}
+
+func (thr *tmutex) Acquire(ctx context.Context) error {
+	holder := []byte(fmt.Sprintf("gohalt_mutex_%s", uuid.NewV4()))
+	ok, err := thr.stg.CompareAndSwap(ctx, thr.key, nil, holder, thr.ttl)
+	if err != nil {
+		return ErrorInternal{
+			Throttler: "mutex",
+			Message:   err.Error(),
+		}
+	}
+	if !ok {
+		return ErrorThreshold{
+			Throttler: "mutex",
+			Threshold: strbool(ok),
+		}
+	}
+	fence, err := thr.stg.Incr(ctx, thr.key+":fence", 1, 0)
+	if err != nil {
+		_, _ = thr.stg.CompareAndSwap(ctx, thr.key, holder, nil, 0)
+		return ErrorInternal{
+			Throttler: "mutex",
+			Message:   err.Error(),
+		}
+	}
+	thr.lock.Lock()
+	thr.holder, thr.owner = holder, ctx
+	thr.lock.Unlock()
+	if observer := ctxFence(ctx); observer != nil {
+		observer(uint64(fence))
+	}
+	return nil
+}
+
+func (thr *tmutex) Release(ctx context.Context) error {
+	thr.lock.Lock()
+	// skip releases paired with rejected acquires.
+	if thr.holder == nil || !ctxOrigin(ctx, thr.owner) {
+		thr.lock.Unlock()
+		return nil
+	}
+	holder := thr.holder
+	thr.holder, thr.owner = nil, nil
+	thr.lock.Unlock()
+	ok, err := thr.stg.CompareAndSwap(ctx, thr.key, holder, nil, 0)
+	if err != nil {
+		return ErrorInternal{
+			Throttler: "mutex",
+			Message:   err.Error(),
+		}
+	}
+	if !ok {
+		return ErrorInternal{
+			Throttler: "mutex",
+			Message:   "lock has been expired before release",
+		}
+	}
+	return nil
+}
+
+// gcpressure defines inner garbage collection pressure values.
+type gcpressure struct {
+	fraction  float64
+	pause     time.Duration
+	proximity float64
+}
+
+type tgc struct {
+	sync      Runnable
+	lock      sync.Mutex
+	samples   []metrics.Sample
+	gccpu     float64
+	totalcpu  float64
+	pauses    float64
+	current   gcpressure
+	threshold gcpressure
+	priority  uint8
+}
+
+// NewThrottlerGC creates new throttler instance that
+// throttles each call with priority below the specified priority
+// while the process is under garbage collection pressure defined by runtime metrics.
+// GC pressure is detected if any of the following exceeds the related specified threshold:
+// GC CPU fraction over the last sampling period, total GC pauses over the last sampling period
+// or live heap proximity to the heap goal, zero threshold disables the related check.
+// Runtime metrics are sampled once per specified cache interval.
+// Use `WithPriority` to override context call priority, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerGC(
+	fraction float64,
+	pause time.Duration,
+	proximity float64,
+	priority uint8,
+	cache time.Duration,
+) Throttler {
+	thr := &tgc{
+		samples: []metrics.Sample{
+			{Name: "/cpu/classes/gc/total:cpu-seconds"},
+			{Name: "/cpu/classes/total:cpu-seconds"},
+			{Name: "/gc/pauses:seconds"},
+			{Name: "/gc/heap/live:bytes"},
+			{Name: "/gc/heap/goal:bytes"},
+		},
+		threshold: gcpressure{
+			fraction:  math.Abs(fraction),
+			pause:     pause,
+			proximity: math.Abs(proximity),
+		},
+		priority: priority,
+	}
+	thr.sync, _ = cached(cache, func(context.Context) error {
+		thr.lock.Lock()
+		defer thr.lock.Unlock()
+		thr.read()
+		return nil
+	})
+	return thr
+}
+
+func (thr *tgc) Acquire(ctx context.Context) error {
+	if ctxPriority(ctx, math.MaxUint8) >= thr.priority {
+		return nil
+	}
+	_ = thr.sync(ctx)
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	switch {
+	case thr.threshold.fraction > 0 && thr.current.fraction >= thr.threshold.fraction:
+		return ErrorThreshold{
+			Throttler: "gc",
+			Threshold: strpercents{current: thr.current.fraction, threshold: thr.threshold.fraction},
+		}
+	case thr.threshold.pause > 0 && thr.current.pause >= thr.threshold.pause:
+		return ErrorThreshold{
+			Throttler: "gc",
+			Threshold: strdurations{current: thr.current.pause, threshold: thr.threshold.pause},
+		}
+	case thr.threshold.proximity > 0 && thr.current.proximity >= thr.threshold.proximity:
+		return ErrorThreshold{
+			Throttler: "gc",
+			Threshold: strpercents{current: thr.current.proximity, threshold: thr.threshold.proximity},
+		}
+	}
+	return nil
+}
+
+func (thr *tgc) Release(context.Context) error {
+	return nil
+}
+
+// read reads runtime metrics and updates current gc pressure
+// using cumulative metrics deltas since the previous read.
+func (thr *tgc) read() {
+	metrics.Read(thr.samples)
+	var gccpu, totalcpu, pauses float64
+	var live, goal uint64
+	for _, sample := range thr.samples {
+		switch sample.Name {
+		case "/cpu/classes/gc/total:cpu-seconds":
+			if sample.Value.Kind() == metrics.KindFloat64 {
+				gccpu = sample.Value.Float64()
+			}
+		case "/cpu/classes/total:cpu-seconds":
+			if sample.Value.Kind() == metrics.KindFloat64 {
+				totalcpu = sample.Value.Float64()
+			}
+		case "/gc/pauses:seconds":
+			if sample.Value.Kind() == metrics.KindFloat64Histogram {
+				hist := sample.Value.Float64Histogram()
+				// approximate pauses total by buckets lower bounds.
+				for i, count := range hist.Counts {
+					if bound := hist.Buckets[i]; !math.IsInf(bound, 0) && bound > 0 {
+						pauses += float64(count) * bound
+					}
+				}
+			}
+		case "/gc/heap/live:bytes":
+			if sample.Value.Kind() == metrics.KindUint64 {
+				live = sample.Value.Uint64()
+			}
+		case "/gc/heap/goal:bytes":
+			if sample.Value.Kind() == metrics.KindUint64 {
+				goal = sample.Value.Uint64()
+			}
+		}
+	}
+	if total := totalcpu - thr.totalcpu; total > 0 {
+		thr.current.fraction = (gccpu - thr.gccpu) / total
+	}
+	thr.current.pause = time.Duration((pauses - thr.pauses) * float64(time.Second))
+	if goal > 0 {
+		thr.current.proximity = float64(live) / float64(goal)
+	}
+	thr.gccpu, thr.totalcpu, thr.pauses = gccpu, totalcpu, pauses
+}
+
+// Inflight defines single held acquisition snapshot:
+// - Key shows acquisition context key.
+// - Tenant shows acquisition context tenant.
+// - Priority shows acquisition context priority.
+// - Weight shows acquisition context weight.
+// - Start shows UTC time when acquisition was acquired.
+type Inflight struct {
+	Key      string    `json:"key"`
+	Tenant   string    `json:"tenant"`
+	Priority uint8     `json:"priority"`
+	Weight   int64     `json:"weight"`
+	Start    time.Time `json:"start"`
+}
+
+// Tracker defines throttler that tracks currently held acquisitions
+// and exposes their snapshot both directly and as json http debug endpoint.
+type Tracker interface {
+	Throttler
+	http.Handler
+	// Inflight returns snapshot of currently held acquisitions ordered by start time.
+	Inflight() []Inflight
+}
+
+type tinflight struct {
+	thr      Throttler
+	lock     sync.Mutex
+	inflight []Inflight
+	rejected map[string]uint64
+}
+
+// NewThrottlerInflight creates new throttler instance that
+// throttles if provided throttler throttles and tracks currently held acquisitions
+// with their start times and context labels, so it is visible which calls occupy capacity.
+// Held acquisitions are matched on release by context key in acquire order,
+// releases paired with rejected acquires are not matched.
+// Use `Inflight` or json http debug endpoint to get held acquisitions snapshot.
+// Use `WithKey`, `WithTenant`, `WithPriority` and `WithWeight` to specify context labels.
+// - could return any underlying throttler error;
+func NewThrottlerInflight(thr Throttler) Tracker {
+	return &tinflight{thr: thr, rejected: make(map[string]uint64)}
+}
+
+func (thr *tinflight) Acquire(ctx context.Context) error {
+	key := ctxKey(ctx)
+	if err := thr.thr.Acquire(ctx); err != nil {
+		thr.lock.Lock()
+		thr.rejected[key]++
+		thr.lock.Unlock()
+		return err
+	}
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	thr.inflight = append(thr.inflight, Inflight{
+		Key:      key,
+		Tenant:   ctxTenant(ctx),
+		Priority: ctxPriority(ctx, math.MaxUint8),
+		Weight:   ctxWeight(ctx),
+		Start:    time.Now().UTC(),
+	})
+	return nil
+}
+
+func (thr *tinflight) Release(ctx context.Context) error {
+	key := ctxKey(ctx)
+	thr.lock.Lock()
+	if rejected := thr.rejected[key]; rejected > 0 {
+		if rejected == 1 {
+			delete(thr.rejected, key)
+		} else {
+			thr.rejected[key]--
+		}
+		thr.lock.Unlock()
+		_ = thr.thr.Release(ctx)
+		return nil
+	}
+	for i, inflight := range thr.inflight {
+		if inflight.Key == key {
+			thr.inflight = append(thr.inflight[:i], thr.inflight[i+1:]...)
+			break
+		}
+	}
+	thr.lock.Unlock()
+	_ = thr.thr.Release(ctx)
+	return nil
+}
+
+func (thr *tinflight) Inflight() []Inflight {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	return append([]Inflight{}, thr.inflight...)
+}
+
+func (thr *tinflight) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(thr.Inflight()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+type tprobe struct {
+	probe   Runnable
+	loop    Runnable
+	failing uint64
+}
+
+// NewThrottlerProbe creates new throttler instance that
+// throttles all calls while the provided health probe is failing.
+// Health probe is run on first acquire and then periodically each specified interval,
+// so throttler reopens automatically as soon as the probe recovers.
+// Health probe is run with context of first acquire detached from its cancellation.
+// - could return `ErrorThreshold`;
+func NewThrottlerProbe(probe Runnable, interval time.Duration) Throttler {
+	thr := &tprobe{probe: probe}
+	thr.loop = once(func(ctx context.Context) error {
+		ctx = context.WithoutCancel(ctx)
+		thr.check(ctx)
+		return async(
+			loop(interval, func(ctx context.Context) error {
+				thr.check(ctx)
+				return nil
+			}),
+		)(ctx)
+	})
+	return thr
+}
+
+func (thr *tprobe) Acquire(ctx context.Context) error {
+	// start probe loop on first acquire
+	_ = thr.loop(ctx)
+	if failing := atomicGet(&thr.failing); failing > 0 {
+		return ErrorThreshold{
+			Throttler: "probe",
+			Threshold: strbool(false),
+		}
+	}
+	return nil
+}
+
+func (thr *tprobe) Release(context.Context) error {
+	return nil
+}
+
+func (thr *tprobe) check(ctx context.Context) {
+	if err := thr.probe(ctx); err != nil {
+		if atomicGet(&thr.failing) == 0 {
+			log("probe throttler health probe is failing: %v", err)
+		}
+		atomicSet(&thr.failing, 1)
+		return
+	}
+	atomicSet(&thr.failing, 0)
+}
+
+type trw struct {
+	lock          sync.Mutex
+	reads         uint64
+	writes        uint64
+	borrowed      uint64
+	readLimit     uint64
+	writeLimit    uint64
+	writePriority bool
+}
+
+// NewThrottlerRW creates new throttler instance that
+// throttles each read call which exeeds the read running quota acquired - release
+// defined by the specified read limit and each write call which exeeds the write running quota
+// acquired - release defined by the specified write limit.
+// If write priority flag is set then write calls exeeding the write running quota
+// preempt free read running quota instead of being throttled.
+// Use `WithAccessMode` to specify context call access mode, read by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerRW(readLimit uint64, writeLimit uint64, writePriority bool) Throttler {
+	return &trw{readLimit: readLimit, writeLimit: writeLimit, writePriority: writePriority}
+}
+
+func (thr *trw) Acquire(ctx context.Context) error {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	if ctxAccessMode(ctx) == AccessWrite {
+		thr.writes++
+		if thr.writes <= thr.writeLimit {
+			return nil
+		}
+		// preempt free read running quota for write.
+		if thr.writePriority && thr.reads+thr.borrowed < thr.readLimit {
+			thr.writes--
+			thr.borrowed++
+			return nil
+		}
+		return ErrorThreshold{
+			Throttler: "rw",
+			Threshold: strpair{current: thr.writes, threshold: thr.writeLimit},
+		}
+	}
+	thr.reads++
+	if running := thr.reads + thr.borrowed; running > thr.readLimit {
+		return ErrorThreshold{
+			Throttler: "rw",
+			Threshold: strpair{current: running, threshold: thr.readLimit},
+		}
+	}
+	return nil
+}
+
+func (thr *trw) Release(ctx context.Context) error {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	switch {
+	case ctxAccessMode(ctx) != AccessWrite:
+		if thr.reads > 0 {
+			thr.reads--
+		}
+	case thr.borrowed > 0:
+		thr.borrowed--
+	case thr.writes > 0:
+		thr.writes--
+	}
+	return nil
+}
+
+type tclient struct {
+	clock     clock
+	lock      sync.Mutex
+	threshold uint64
+	interval  time.Duration
+	backoff   float64
+	recovery  float64
+	limit     float64
+	window    int64
+	current   uint64
+}
+
+// NewThrottlerClient creates new throttler instance that
+// throttles each call which exeeds the adaptive admission quota in the specified interval.
+// Admission quota starts from the specified threshold and is multiplicatively reduced
+// by the specified backoff factor each time 429 or 503 response status is reported on release,
+// then it slowly ramps back up by the specified recovery value on each other reported response status
+// until it reaches the specified threshold again, admission quota is never reduced below single call.
+// Backoff factor is normalized to [0.0, 1.0] range.
+// Use `WithStatus` to report outbound call response status on release.
+// - could return `ErrorThreshold`;
+func NewThrottlerClient(threshold uint64, interval time.Duration, backoff float64, recovery float64) Throttler {
+	backoff = math.Abs(backoff)
+	if backoff > 1.0 {
+		backoff = 1.0
+	}
+	return &tclient{
+		threshold: threshold,
+		interval:  interval,
+		backoff:   backoff,
+		recovery:  math.Abs(recovery),
+		limit:     float64(threshold),
+	}
+}
+
+func (thr *tclient) Acquire(context.Context) error {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	if thr.interval > 0 {
+		now, jump := thr.clock.now("client")
+		// start new window on clock jump.
+		if window := now.UnixNano() / int64(thr.interval); window != thr.window || jump != 0 {
+			thr.window, thr.current = window, 0
+		}
+	}
+	thr.current++
+	if limit := uint64(thr.limit); thr.current > limit {
+		return ErrorThreshold{
+			Throttler: "client",
+			Threshold: strpair{current: thr.current, threshold: limit},
+		}
+	}
+	return nil
+}
+
+func (thr *tclient) Release(ctx context.Context) error {
+	status := ctxStatus(ctx)
+	if status == 0 {
+		return nil
+	}
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	switch status {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		thr.limit = math.Max(thr.limit*thr.backoff, 1)
+	default:
+		thr.limit = math.Min(thr.limit+thr.recovery, float64(thr.threshold))
+	}
+	return nil
+}
+
+type tpacing struct {
+	clock    clock
+	lock     sync.Mutex
+	interval time.Duration
+	accrual  float64
+	cap      float64
+	credit   float64
+	last     time.Time
+}
+
+// NewThrottlerPacing creates new throttler instance that
+// paces calls to single call per the specified interval and throttles each call
+// which exeeds the pace unless there is unused burst credit to spend on it.
+// Each fully idle interval without calls accrues burst credit defined by the specified accrual rate
+// bounded by the specified cap, so unused capacity of bursty but light clients is not wasted.
+// Use `WithWeight` to override context call burst credit cost, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerPacing(interval time.Duration, accrual float64, cap uint64) Throttler {
+	return &tpacing{interval: interval, accrual: math.Abs(accrual), cap: float64(cap)}
+}
+
+func (thr *tpacing) Acquire(ctx context.Context) error {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	now, jump := thr.clock.now("pacing")
+	// shift last call time by clock jump to keep elapsed duration monotonic.
+	if jump != 0 && !thr.last.IsZero() {
+		thr.last = thr.last.Add(jump)
+	}
+	if thr.last.IsZero() {
+		thr.last = now
+		return nil
+	}
+	elapsed := now.Sub(thr.last)
+	if elapsed >= thr.interval {
+		if thr.interval > 0 {
+			idle := float64(elapsed-thr.interval) / float64(thr.interval)
+			thr.credit = math.Min(thr.credit+math.Floor(idle)*thr.accrual, thr.cap)
+		}
+		thr.last = now
+		return nil
+	}
+	if weight := float64(ctxWeightMod(ctx)); thr.credit >= weight {
+		thr.credit -= weight
+		return nil
+	}
+	return ErrorThreshold{
+		Throttler: "pacing",
+		Threshold: strdurations{current: elapsed, threshold: thr.interval},
+	}
+}
+
+func (thr *tpacing) Release(context.Context) error {
+	return nil
+}
+
+type thedge struct {
+	clock     clock
+	lock      sync.Mutex
+	budget    float64
+	interval  time.Duration
+	window    int64
+	primaries uint64
+	hedges    uint64
+}
+
+// NewThrottlerHedge creates new throttler instance that
+// throttles each hedged call which exeeds the hedge budget defined by the specified
+// budget percentage of primary calls in the specified interval, primary calls are never throttled.
+// Periodically each specified interval primary and hedged calls numbers are reseted.
+// Use `WithHedge` to mark context call as hedged call, primary by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerHedge(budget float64, interval time.Duration) Throttler {
+	return &thedge{budget: math.Abs(budget), interval: interval}
+}
+
+func (thr *thedge) Acquire(ctx context.Context) error {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	if thr.interval > 0 {
+		now, jump := thr.clock.now("hedge")
+		// start new window on clock jump.
+		if window := now.UnixNano() / int64(thr.interval); window != thr.window || jump != 0 {
+			thr.window, thr.primaries, thr.hedges = window, 0, 0
+		}
+	}
+	if !ctxHedge(ctx) {
+		thr.primaries++
+		return nil
+	}
+	budget := uint64(thr.budget * float64(thr.primaries))
+	if hedges := thr.hedges + 1; hedges > budget {
+		return ErrorThreshold{
+			Throttler: "hedge",
+			Threshold: strpair{current: hedges, threshold: budget},
+		}
+	}
+	thr.hedges++
+	return nil
+}
+
+func (thr *thedge) Release(context.Context) error {
+	return nil
+}
+
+// Weighted defines a pair of weight and related throttler.
+type Weighted struct {
+	Weight    uint64
+	Throttler Throttler
+}
+
+type tweighted struct {
+	weighted []Weighted
+	total    uint64
+	lock     sync.Mutex
+	chosen   choices
+}
+
+// choices keeps throttlers indexes chosen on acquire paired with acquire contexts,
+// so releases could be routed back to throttlers chosen for their acquires.
+type choices []choice
+
+type choice struct {
+	ctx   context.Context
+	index int
+}
+
+func (chs *choices) push(ctx context.Context, index int) {
+	*chs = append(*chs, choice{ctx: ctx, index: index})
+}
+
+// pop removes and returns throttler index chosen for acquire matching the provided release context,
+// or the oldest chosen throttler index if no acquire matches.
+func (chs *choices) pop(ctx context.Context) (int, bool) {
+	if len(*chs) == 0 {
+		return 0, false
+	}
+	pos := 0
+	for i, ch := range *chs {
+		if ctxOrigin(ctx, ch.ctx) {
+			pos = i
+			break
+		}
+	}
+	index := (*chs)[pos].index
+	last := len(*chs) - 1
+	copy((*chs)[pos:], (*chs)[pos+1:])
+	(*chs)[last] = choice{}
+	*chs = (*chs)[:last]
+	return index, true
+}
+
+// NewThrottlerWeighted creates new throttler instance that
+// throttles if randomly chosen throttler from provided weighted throttlers throttles.
+// Each call throttler is chosen with the chance proportional to its weight,
+// which is useful to canary new throttling algorithm against a fraction of calls.
+// Chosen throttler is released by the release called with its acquire context or context derived from it,
+// releases with unknown contexts release throttlers in the same order as they were chosen on acquire.
+// Implementation uses secure `crypto/rand` as PRNG function.
+// See `Weighted` which defines a pair of weight and related throttler.
+// - could return `ErrorInternal`;
+// - could return any underlying throttler error;
+func NewThrottlerWeighted(weighted ...Weighted) Throttler {
+	var total uint64
+	for _, w := range weighted {
+		total += w.Weight
+	}
+	return &tweighted{weighted: weighted, total: total}
+}
+
+func (thr *tweighted) Acquire(ctx context.Context) error {
+	if thr.total == 0 {
+		return ErrorInternal{
+			Throttler: "weighted",
+			Message:   "known weight is not found",
+		}
+	}
+	point := uint64(rndf64(0.5) * float64(thr.total))
+	index := len(thr.weighted) - 1
+	for i, w := range thr.weighted {
+		if point < w.Weight {
+			index = i
+			break
+		}
+		point -= w.Weight
+	}
+	// skip possible zero weight tail throttlers.
+	for thr.weighted[index].Weight == 0 {
+		index--
+	}
+	thr.lock.Lock()
+	thr.chosen.push(ctx, index)
+	thr.lock.Unlock()
+	return thr.weighted[index].Throttler.Acquire(ctx)
+}
+
+func (thr *tweighted) Release(ctx context.Context) error {
+	thr.lock.Lock()
+	index, ok := thr.chosen.pop(ctx)
+	thr.lock.Unlock()
+	if ok {
+		_ = thr.weighted[index].Throttler.Release(ctx)
+	}
+	return nil
+}
+
+type troundrobin struct {
+	thrs    []Throttler
+	acquire uint64
+	lock    sync.Mutex
+	chosen  choices
+}
+
+// NewThrottlerRoundRobin creates new throttler instance that
+// rotates calls across provided throttlers list starting from the *i-th* call throttler,
+// if rotated throttler throttles then the next throttler from provided list is tried,
+// so call is throttled only if all provided throttlers throttle.
+// Tried throttlers that throttle are released immediately on acquire,
+// chosen throttler is released by the release called with its acquire context or context derived from it,
+// releases with unknown contexts release throttlers in the same order as they were chosen on acquire.
+// - could return `ErrorInternal`;
+func NewThrottlerRoundRobin(thrs ...Throttler) Throttler {
+	return &troundrobin{thrs: thrs}
+}
+
+func (thr *troundrobin) Acquire(ctx context.Context) error {
+	length := len(thr.thrs)
+	if length == 0 {
+		return ErrorInternal{
+			Throttler: "roundrobin",
+			Message:   "known index is not found",
+		}
+	}
+	acquire := atomicIncr(&thr.acquire) - 1
+	chosen, err := -1, error(nil)
+	for i := 0; i < length; i++ {
+		index := int((acquire + uint64(i)) % uint64(length))
+		if err = thr.thrs[index].Acquire(ctx); err == nil {
+			chosen = index
+			break
+		}
+		// release throttled throttlers right away as they are never chosen.
+		_ = thr.thrs[index].Release(ctx)
+	}
+	thr.lock.Lock()
+	thr.chosen.push(ctx, chosen)
+	thr.lock.Unlock()
+	if chosen < 0 {
+		return ErrorInternal{
+			Throttler: "roundrobin",
+			Message:   err.Error(),
+		}
+	}
+	return nil
+}
+
+func (thr *troundrobin) Release(ctx context.Context) error {
+	thr.lock.Lock()
+	index, ok := thr.chosen.pop(ctx)
+	thr.lock.Unlock()
+	// don't release throttlers for throttled calls.
+	if ok && index >= 0 {
+		_ = thr.thrs[index].Release(ctx)
+	}
+	return nil
+}
+
+type trace struct {
+	thrs  []Throttler
+	allow bool
+}
+
+// NewThrottlerRace creates new throttler instance that
+// runs provided throttlers acquire concurrently and returns the first decision back.
+// If provided allow flag is set the first allowing throttler wins,
+// so call is throttled only if all provided throttlers throttle,
+// otherwise the first throttling throttler wins,
+// so call is throttled if any of provided throttlers throttles.
+// The rest of throttlers acquire context is canceled as soon as the decision is made,
+// which is useful when one of provided throttlers involves slow io, e.g. remote quota check.
+// - could return `ErrorInternal`;
+func NewThrottlerRace(allow bool, thrs ...Throttler) Throttler {
+	return trace{thrs: thrs, allow: allow}
+}
+
+func (thr trace) Acquire(ctx context.Context) error {
+	runs := make([]Runnable, 0, len(thr.thrs))
+	for _, thr := range thr.thrs {
+		runs = append(runs, thr.Acquire)
+	}
+	match := func(err error) bool {
+		return (err == nil) == thr.allow
+	}
+	if err := first(match, runs...)(ctx); err != nil {
+		return ErrorInternal{
+			Throttler: "race",
+			Message:   err.Error(),
+		}
+	}
+	return nil
+}
+
+func (thr trace) Release(ctx context.Context) error {
+	runs := make([]Runnable, 0, len(thr.thrs))
+	for _, thr := range thr.thrs {
+		thr := thr
+		runs = append(runs, func(ctx context.Context) error {
+			_ = thr.Release(ctx)
+			return nil
+		})
+	}
+	return all(runs...)(ctx)
+}
+
+type tcached struct {
+	clock   clock
+	thr     Throttler
+	ttl     time.Duration
+	lock    sync.Mutex
+	swept   time.Time
+	cache   map[string]memoized
+	pending map[string]uint64
+}
+
+// NewThrottlerCached creates new throttler instance that
+// caches provided throttler decisions per context key for the provided ttl duration,
+// which reduces calls to expensive throttlers, e.g. remote quota lookups, while keeping approximate enforcement.
+// Both throttling and non throttling calls are cached,
+// only calls that reached provided throttler are released back.
+// Expired cached decisions are periodically removed on new decisions arrival.
+// Use `WithKey` to specify key for cached decisions.
+// - could return any underlying throttler error;
+func NewThrottlerCached(thr Throttler, ttl time.Duration) Throttler {
+	return &tcached{
+		thr:     thr,
+		ttl:     ttl,
+		cache:   make(map[string]memoized),
+		pending: make(map[string]uint64),
+	}
+}
+
+func (thr *tcached) Acquire(ctx context.Context) error {
+	now, jump := thr.clock.now("cached")
+	key := ctxKey(ctx)
+	thr.lock.Lock()
+	// drop all cached decisions on clock jump as their deadlines are not reliable.
+	if jump != 0 {
+		thr.cache = make(map[string]memoized)
+	}
+	if memo, ok := thr.cache[key]; ok && now.Before(memo.deadline) {
+		thr.lock.Unlock()
+		return memo.err
+	}
+	delete(thr.cache, key)
+	thr.pending[key]++
+	thr.lock.Unlock()
+	err := thr.thr.Acquire(ctx)
+	thr.lock.Lock()
+	thr.sweep(now)
+	thr.cache[key] = memoized{err: err, deadline: now.Add(thr.ttl)}
+	thr.lock.Unlock()
+	return err
+}
+
+func (thr *tcached) Release(ctx context.Context) error {
+	key := ctxKey(ctx)
+	thr.lock.Lock()
+	pending := thr.pending[key]
+	if pending == 0 {
+		thr.lock.Unlock()
+		return nil
+	}
+	if pending == 1 {
+		delete(thr.pending, key)
+	} else {
+		thr.pending[key]--
+	}
+	thr.lock.Unlock()
+	_ = thr.thr.Release(ctx)
+	return nil
+}
+
+// sweep removes expired cached decisions at most once per ttl,
+// it needs to be called under cached lock.
+func (thr *tcached) sweep(now time.Time) {
+	if now.Before(thr.swept.Add(thr.ttl)) {
+		return
+	}
+	thr.swept = now
+	for key, memo := range thr.cache {
+		if !now.Before(memo.deadline) {
+			delete(thr.cache, key)
+		}
+	}
+}
+
+type tsuppresserrs struct {
+	thr     Throttler
+	classes []error
+}
+
+// NewThrottlerSuppressErrors creates new throttler instance that
+// suppresses provided throttler errors of the provided error classes to never throttle,
+// while any other errors are still passed through.
+// Error is suppressed if it or any error in its unwrap chain has the same type as any of provided error classes,
+// e.g. `ErrorInternal{}` class suppresses monitor and metric infrastructure errors
+// while `ErrorThreshold` errors are still enforced.
+// Composed `all` and `any` throttlers errors, see `ErrorComposite`, are suppressed
+// only if all their children errors are suppressed, unless `ErrorComposite{}` class is provided.
+// - could return any underlying throttler error;
+func NewThrottlerSuppressErrors(thr Throttler, classes ...error) Throttler {
+	return tsuppresserrs{thr: thr, classes: classes}
+}
+
+func (thr tsuppresserrs) Acquire(ctx context.Context) error {
+	err := thr.thr.Acquire(ctx)
+	if err != nil && thr.suppressed(err) {
+		log("throttler error is suppressed: %v", err)
+		return nil
+	}
+	return err
+}
+
+func (thr tsuppresserrs) Release(ctx context.Context) error {
+	_ = thr.thr.Release(ctx)
+	return nil
+}
+
+// suppressed checks whether the error or any error in its unwrap chain matches any of error classes,
+// composite errors are checked against their children errors instead of their wrapping errors.
+func (thr tsuppresserrs) suppressed(err error) bool {
+	var cerr ErrorComposite
+	if errors.As(err, &cerr) && !thr.matches(cerr) {
+		for _, err := range cerr.Errors {
+			if !thr.suppressed(err) {
+				return false
+			}
+		}
+		return len(cerr.Errors) > 0
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if thr.matches(e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (thr tsuppresserrs) matches(err error) bool {
+	for _, class := range thr.classes {
+		if reflect.TypeOf(err) == reflect.TypeOf(class) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShortCircuit defines chained throttlers evaluation policy.
+type ShortCircuit uint8
+
+const (
+	// ShortCircuitDeny stops chain evaluation at the first throttling throttler,
+	// so call is throttled if any of chained throttlers throttles.
+	ShortCircuitDeny ShortCircuit = iota
+	// ShortCircuitAllow stops chain evaluation at the first non throttling throttler,
+	// so call is throttled only if all chained throttlers throttle.
+	ShortCircuitAllow
+	// ShortCircuitNone always evaluates all chained throttlers, so every throttler state still advances,
+	// call is throttled if any of chained throttlers throttles.
+	ShortCircuitNone
+)
+
+type tchain struct {
+	thrs   []Throttler
+	policy ShortCircuit
+}
+
+// NewThrottlerChain creates new throttler instance that
+// evaluates provided throttlers consecutively in the provided order
+// with regard to the specified short circuit policy, see `ShortCircuit`.
+// Evaluation policy matters for side effectful throttlers, e.g. `each` or `after`,
+// as skipped throttlers state doesn't advance.
+// All chained throttlers are released back regardless of evaluation policy.
+// - could return any underlying throttler error;
+func NewThrottlerChain(policy ShortCircuit, thrs ...Throttler) Throttler {
+	return tchain{thrs: thrs, policy: policy}
+}
+
+func (thr tchain) Acquire(ctx context.Context) error {
+	var result error
+	for _, t := range thr.thrs {
+		err := t.Acquire(ctx)
+		switch thr.policy {
+		case ShortCircuitDeny:
+			if err != nil {
+				return err
+			}
+		case ShortCircuitAllow:
+			if err == nil {
+				return nil
+			}
+			result = err
+		default:
+			if err != nil && result == nil {
+				result = err
+			}
+		}
+	}
+	return result
+}
+
+func (thr tchain) Release(ctx context.Context) error {
+	for _, t := range thr.thrs {
+		_ = t.Release(ctx)
+	}
+	return nil
+}
+
+// Swapper defines throttler which inner throttler could be atomically replaced at runtime.
+type Swapper interface {
+	Throttler
+	// Swap installs the provided throttler as new generation for all following acquires
+	// and returns previous generation throttler back.
+	Swap(Throttler) Throttler
+}
+
+type generation struct {
+	thr      Throttler
+	acquires []context.Context
+}
+
+type tswappable struct {
+	lock sync.Mutex
+	gens []*generation
+}
+
+// NewThrottlerSwappable creates new throttler instance that
+// throttles if current generation throttler throttles.
+// Current generation throttler could be atomically replaced at runtime via `Swap`,
+// so configuration reloads could install newly constructed throttlers pipeline
+// without racing inflight acquire release pairs.
+// Each release is routed to the generation throttler which served the acquire
+// called with the release context or context derived from it,
+// otherwise it is routed to the oldest generation throttler with pending acquires,
+// previous generations are dropped as soon as they have no pending acquires left.
+// - could return any underlying throttler error;
+func NewThrottlerSwappable(thr Throttler) Swapper {
+	return &tswappable{gens: []*generation{{thr: thr}}}
+}
+
+func (thr *tswappable) Acquire(ctx context.Context) error {
+	thr.lock.Lock()
+	gen := thr.gens[len(thr.gens)-1]
+	gen.acquires = append(gen.acquires, ctx)
+	thr.lock.Unlock()
+	return gen.thr.Acquire(ctx)
+}
+
+func (thr *tswappable) Release(ctx context.Context) error {
+	thr.lock.Lock()
+	gen, index := thr.serving(ctx)
+	if gen == nil {
+		thr.lock.Unlock()
+		return nil
+	}
+	last := len(gen.acquires) - 1
+	copy(gen.acquires[index:], gen.acquires[index+1:])
+	gen.acquires[last] = nil
+	gen.acquires = gen.acquires[:last]
+	thr.compact()
+	thr.lock.Unlock()
+	_ = gen.thr.Release(ctx)
+	return nil
+}
+
+func (thr *tswappable) Swap(next Throttler) Throttler {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	prev := thr.gens[len(thr.gens)-1].thr
+	thr.gens = append(thr.gens, &generation{thr: next})
+	thr.compact()
+	return prev
+}
+
+// serving returns generation and its pending acquire index matching the provided release context,
+// or the oldest generation pending acquire if no acquire matches, it needs to be called under swappable lock.
+func (thr *tswappable) serving(ctx context.Context) (*generation, int) {
+	for _, gen := range thr.gens {
+		for i, actx := range gen.acquires {
+			if ctxOrigin(ctx, actx) {
+				return gen, i
+			}
+		}
+	}
+	for _, gen := range thr.gens {
+		if len(gen.acquires) > 0 {
+			return gen, 0
+		}
+	}
+	return nil, 0
+}
+
+// compact drops previous generations without pending acquires,
+// it needs to be called under swappable lock.
+func (thr *tswappable) compact() {
+	gens := thr.gens[:0]
+	for i, gen := range thr.gens {
+		if len(gen.acquires) > 0 || i == len(thr.gens)-1 {
+			gens = append(gens, gen)
+		}
+	}
+	for i := len(gens); i < len(thr.gens); i++ {
+		thr.gens[i] = nil
+	}
+	thr.gens = gens
+}
+
+// Router defines throttler which dispatches calls to throttlers registered by route names.
+type Router interface {
+	Throttler
+	// Handle registers the provided throttler for the provided route name
+	// replacing previously registered route throttler if any.
+	Handle(route string, thr Throttler)
+	// Route returns throttler registered for the provided route name and whether it exists.
+	Route(route string) (Throttler, bool)
+	// Routes returns all registered route names sorted.
+	Routes() []string
+}
+
+type troute struct {
+	route     string
+	glob      *regexp.Regexp
+	throttler Throttler
+}
+
+type trouter struct {
+	lock   sync.RWMutex
+	exact  map[string]Throttler
+	routes []troute
+}
+
+// NewThrottlerRouter creates new throttler instance that
+// throttles if matching throttler from registered routes throttles.
+// Throttlers are registered via `Handle` keyed by method or route names, e.g. `GET /users` or `/pkg.Service/Method`.
+// Route names are matched exactly first, then route names with glob wildcards are matched
+// in the registration order via `Glob`, so `**` route could be registered last as default route.
+// Registered routes could be listed and inspected via `Routes` and `Route`.
+// Use `WithKey` to specify key for route throttler matching.
+// - could return `ErrorInternal`;
+// - could return any underlying throttler error;
+func NewThrottlerRouter() Router {
+	return &trouter{exact: make(map[string]Throttler)}
+}
+
+func (thr *trouter) Acquire(ctx context.Context) error {
+	if t, ok := thr.match(ctxKey(ctx)); ok {
+		return t.Acquire(ctx)
+	}
+	return ErrorInternal{
+		Throttler: "router",
+		Message:   "known route is not found",
+	}
+}
+
+func (thr *trouter) Release(ctx context.Context) error {
+	if t, ok := thr.match(ctxKey(ctx)); ok {
+		_ = t.Release(ctx)
+	}
+	return nil
+}
+
+func (thr *trouter) Handle(route string, t Throttler) {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	if !strings.ContainsAny(route, "*?") {
+		thr.exact[route] = t
+		return
+	}
+	for i := range thr.routes {
+		if thr.routes[i].route == route {
+			thr.routes[i].throttler = t
+			return
+		}
+	}
+	thr.routes = append(thr.routes, troute{route: route, glob: Glob(route), throttler: t})
+}
+
+func (thr *trouter) Route(route string) (Throttler, bool) {
+	thr.lock.RLock()
+	defer thr.lock.RUnlock()
+	if t, ok := thr.exact[route]; ok {
+		return t, true
+	}
+	for _, r := range thr.routes {
+		if r.route == route {
+			return r.throttler, true
+		}
+	}
+	return nil, false
+}
+
+func (thr *trouter) Routes() []string {
+	thr.lock.RLock()
+	defer thr.lock.RUnlock()
+	routes := make([]string, 0, len(thr.exact)+len(thr.routes))
+	for route := range thr.exact {
+		routes = append(routes, route)
+	}
+	for _, r := range thr.routes {
+		routes = append(routes, r.route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+func (thr *trouter) match(key string) (Throttler, bool) {
+	thr.lock.RLock()
+	defer thr.lock.RUnlock()
+	if t, ok := thr.exact[key]; ok {
+		return t, true
+	}
+	for _, r := range thr.routes {
+		if r.glob.MatchString(key) {
+			return r.throttler, true
+		}
+	}
+	return nil, false
+}
+
+type tspacing struct {
+	clock     clock
+	spacing   time.Duration
+	threshold uint64
+	running   uint64
+	lock      sync.Mutex
+	next      time.Time
+}
+
+// NewThrottlerSpacing creates new throttler instance that
+// throttles each call which exeeds the running quota *acquired - release* q defined by the specified threshold
+// and then waits for the minimal spacing between calls defined by the specified spacing duration.
+// Spacing is reserved only after the call fits into the running quota,
+// so calls throttled by the running quota don't consume spacing between calls.
+// - could return `ErrorThreshold`;
+func NewThrottlerSpacing(spacing time.Duration, threshold uint64) Throttler {
+	return &tspacing{spacing: spacing, threshold: threshold}
+}
+
+func (thr *tspacing) Acquire(ctx context.Context) error {
+	if running := atomicBIncr(&thr.running); running > thr.threshold {
+		return ErrorThreshold{
+			Throttler: "spacing",
+			Threshold: strpair{current: running, threshold: thr.threshold},
+		}
+	}
+	thr.lock.Lock()
+	now, jump := thr.clock.now("spacing")
+	// shift next reserved slot by clock jump to keep spacing monotonic.
+	if jump != 0 && !thr.next.IsZero() {
+		thr.next = thr.next.Add(jump)
+	}
+	slot := thr.next
+	if slot.Before(now) {
+		slot = now
+	}
+	thr.next = slot.Add(thr.spacing)
+	thr.lock.Unlock()
+	return sleep(ctx, slot.Sub(now))
+}
+
+func (thr *tspacing) Release(context.Context) error {
+	atomicBDecr(&thr.running)
+	return nil
+}
+
+type tretried struct {
+	thr      Throttler
+	backoff  Backoff
+	attempts uint64
+	lock     sync.Mutex
+	// canceled keeps contexts of acquires canceled during backoff, which releases should be skipped.
+	canceled []context.Context
+}
+
+// NewThrottlerRetried creates new throttler instance that
+// retries provided throttler acquire with delays defined by the provided backoff
+// until it stops throttling, the context is done or the specified max attempts number is reached,
+// which converts reject style throttlers into wait style throttlers.
+// Zero max attempts number means that acquire is retried until the context is done.
+// Provided throttler is released after each failed attempt right before the backoff delay except the last one,
+// which is released by the call release as usual, if the context is done during the backoff delay
+// the call release called with the acquire context or context derived from it is skipped.
+// See `Backoff` and builtin `NewBackoffConstant` and `NewBackoffExponential` backoffs.
+// - could return any underlying throttler error;
+func NewThrottlerRetried(thr Throttler, backoff Backoff, attempts uint64) Throttler {
+	return &tretried{thr: thr, backoff: backoff, attempts: attempts}
+}
+
+func (thr *tretried) Acquire(ctx context.Context) error {
+	for attempt := uint64(1); ; attempt++ {
+		err := thr.thr.Acquire(ctx)
+		if err == nil || (thr.attempts > 0 && attempt >= thr.attempts) {
+			return err
+		}
+		// release failed attempt before backoff delay.
+		_ = thr.thr.Release(ctx)
+		log("error happened in retried: %v", err)
+		timer := time.NewTimer(thr.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			thr.lock.Lock()
+			thr.canceled = append(thr.canceled, ctx)
+			thr.lock.Unlock()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (thr *tretried) Release(ctx context.Context) error {
+	thr.lock.Lock()
+	for i, cctx := range thr.canceled {
+		// skip releases paired with acquires canceled during backoff.
+		if ctxOrigin(ctx, cctx) {
+			thr.canceled = append(thr.canceled[:i], thr.canceled[i+1:]...)
+			thr.lock.Unlock()
+			return nil
+		}
+	}
+	thr.lock.Unlock()
+	_ = thr.thr.Release(ctx)
+	return nil
+}
+
+type ttimeout struct {
+	thr     Throttler
+	timeout time.Duration
+}
+
+// NewThrottlerTimeout creates new throttler instance that
+// throttles if provided throttler throttles or if provided throttler acquire
+// exceeds the specified timeout, so hung throttler backend, e.g. slow monitor, metric or remote storage,
+// cannot stall calls indefinitely.
+// Provided throttler acquire context is canceled on timeout, timed out acquire still needs to be released.
+// - could return `ErrorTimeout`;
+// - could return `ErrorInternal`;
+// - could return any underlying throttler error;
+func NewThrottlerTimeout(thr Throttler, timeout time.Duration) Throttler {
+	return ttimeout{thr: thr, timeout: timeout}
+}
+
+func (thr ttimeout) Acquire(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, thr.timeout)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		result <- thr.thr.Acquire(ctx)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if err := ctx.Err(); err != context.DeadlineExceeded {
+			return ErrorInternal{
+				Throttler: "timeout",
+				Message:   err.Error(),
+			}
+		}
+		return ErrorTimeout{
+			Throttler: "timeout",
+			Timeout:   thr.timeout,
+		}
+	}
+}
+
+func (thr ttimeout) Release(ctx context.Context) error {
+	_ = thr.thr.Release(ctx)
+	return nil
+}
+
+type tstgafter struct {
+	stg       Storage
+	key       string
+	threshold uint64
+}
+
+// NewThrottlerStorageAfter creates new throttler instance that
+// throttles each call after the i-th call defined by the specified threshold
+// counted across all replicas sharing the provided storage under the specified key.
+// Storage key is defined as `gohalt_after:{{key}}`.
+// Storage failures are only logged and never throttle calls, so throttler gracefully degrades to allow all calls.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerStorageAfter(stg Storage, key string, threshold uint64) Throttler {
+	return tstgafter{stg: stg, key: fmt.Sprintf("gohalt_after:%s", key), threshold: threshold}
+}
+
+func (thr tstgafter) Acquire(ctx context.Context) error {
+	current, err := thr.stg.Incr(ctx, thr.key, ctxWeight(ctx), 0)
+	if err != nil {
+		log("storage after throttler error is suppressed: %v", err)
+		return nil
+	}
+	if uint64(current) > thr.threshold {
+		return ErrorThreshold{
+			Throttler: "after",
+			Threshold: strpair{current: uint64(current), threshold: thr.threshold},
+		}
+	}
+	return nil
+}
+
+func (thr tstgafter) Release(context.Context) error {
+	return nil
+}
+
+type tstgeach struct {
+	stg       Storage
+	key       string
+	threshold uint64
+}
+
+// NewThrottlerStorageEach creates new throttler instance that
+// throttles each periodic i-th call defined by the specified threshold
+// counted across all replicas sharing the provided storage under the specified key.
+// Storage key is defined as `gohalt_each:{{key}}`.
+// Storage failures are only logged and never throttle calls, so throttler gracefully degrades to allow all calls.
+// - could return `ErrorThreshold`;
+func NewThrottlerStorageEach(stg Storage, key string, threshold uint64) Throttler {
+	return tstgeach{stg: stg, key: fmt.Sprintf("gohalt_each:%s", key), threshold: threshold}
+}
+
+func (thr tstgeach) Acquire(ctx context.Context) error {
+	current, err := thr.stg.Incr(ctx, thr.key, 1, 0)
+	if err != nil {
+		log("storage each throttler error is suppressed: %v", err)
+		return nil
+	}
+	if uint64(current)%thr.threshold == 0 {
+		return ErrorThreshold{
+			Throttler: "each",
+			Threshold: strpair{current: uint64(current), threshold: thr.threshold},
+		}
+	}
+	return nil
+}
+
+func (thr tstgeach) Release(context.Context) error {
+	return nil
+}
+
+type tstgtimed struct {
+	clock     *clock
+	stg       Storage
+	key       string
+	threshold uint64
+	interval  time.Duration
+}
+
+// NewThrottlerStorageTimed creates new throttler instance that
+// throttles each call which exeeds the quota q defined by the specified threshold in the specified interval
+// counted across all replicas sharing the provided storage under the specified key.
+// Quota is counted in fixed interval windows aligned to unix epoch, each window counter expires after the interval.
+// Zero interval means that quota is counted in single never expiring window.
+// Storage key is defined as `gohalt_timed:{{key}}:{{window}}`.
+// Storage failures are only logged and never throttle calls, so throttler gracefully degrades to allow all calls.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerStorageTimed(stg Storage, key string, threshold uint64, interval time.Duration) Throttler {
+	return tstgtimed{clock: &clock{}, stg: stg, key: key, threshold: threshold, interval: interval}
+}
+
+func (thr tstgtimed) Acquire(ctx context.Context) error {
+	var window int64
+	if thr.interval > 0 {
+		// timed windows are aligned to wall time shared across replicas, so clock jumps need no resynchronization.
+		now, _ := thr.clock.now("timed")
+		window = now.UnixNano() / int64(thr.interval)
+	}
+	key := fmt.Sprintf("gohalt_timed:%s:%d", thr.key, window)
+	current, err := thr.stg.Incr(ctx, key, ctxWeight(ctx), thr.interval)
+	if err != nil {
+		log("storage timed throttler error is suppressed: %v", err)
+		return nil
+	}
+	if uint64(current) > thr.threshold {
+		return ErrorThreshold{
+			Throttler: "timed",
+			Threshold: strpair{current: uint64(current), threshold: thr.threshold},
+		}
+	}
+	return nil
+}
+
+func (thr tstgtimed) Release(context.Context) error {
+	return nil
+}
+
+type tstghybrid struct {
+	clock     clock
+	stg       Storage
+	key       string
+	threshold uint64
+	interval  time.Duration
+	loop      Runnable
+	lock      sync.Mutex
+	window    int64
+	pending   uint64
+	inflight  uint64
+	global    uint64
+}
+
+// NewThrottlerStorageHybrid creates new throttler instance that
+// throttles each call which exeeds the quota q defined by the specified threshold in the specified interval
+// counted approximately across all replicas sharing the provided storage under the specified key.
+// Calls are granted locally against the last known shared counter and local consumption,
+// which is asynchronously reconciled with the storage in batches each specified sync period, 100ms by default,
+// so no storage round trip is done on acquire and the quota could be exceeded
+// by at most replicas consumption within single sync period.
+// Quota is counted in fixed interval windows aligned to unix epoch, each window counter expires after the interval.
+// Zero interval means that quota is counted in single never expiring window.
+// Storage key is defined as `gohalt_timed:{{key}}:{{window}}` the same as for storage timed throttler,
+// so both throttlers could share the same quota.
+// Storage sync loop is started on first acquire, failed syncs are only logged and retried on next sync.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+func NewThrottlerStorageHybrid(
+	stg Storage,
+	key string,
+	threshold uint64,
+	interval time.Duration,
+	period time.Duration,
+) Throttler {
+	if period <= 0 {
+		period = 100 * time.Millisecond
+	}
+	thr := &tstghybrid{stg: stg, key: key, threshold: threshold, interval: interval}
+	thr.loop = once(func(ctx context.Context) error {
+		return async(
+			loop(period, func(ctx context.Context) error {
+				thr.sync(ctx)
+				return nil
+			}),
+		)(context.WithoutCancel(ctx))
+	})
+	return thr
+}
+
+func (thr *tstghybrid) Acquire(ctx context.Context) error {
+	// start sync loop on first acquire
+	_ = thr.loop(ctx)
+	weight := uint64(ctxWeightMod(ctx))
+	var window int64
+	if thr.interval > 0 {
+		// hybrid windows are aligned to wall time shared across replicas, so clock jumps need no resynchronization.
+		now, _ := thr.clock.now("hybrid")
+		window = now.UnixNano() / int64(thr.interval)
+	}
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	if thr.window != window {
+		thr.window, thr.pending, thr.inflight, thr.global = window, 0, 0, 0
+	}
+	if current := thr.global + thr.inflight + thr.pending + weight; current > thr.threshold {
+		return ErrorThreshold{
+			Throttler: "hybrid",
+			Threshold: strpair{current: current, threshold: thr.threshold},
+		}
+	}
+	thr.pending += weight
+	return nil
+}
+
+func (thr *tstghybrid) Release(context.Context) error {
+	return nil
+}
+
+// sync flushes pending local consumption to the storage and fetches the shared counter back.
+func (thr *tstghybrid) sync(ctx context.Context) {
+	thr.lock.Lock()
+	window, pending := thr.window, thr.pending
+	thr.pending, thr.inflight = 0, pending
+	thr.lock.Unlock()
+	// skip sync until the first window is acquired, zero interval window is always synced.
+	if window == 0 && thr.interval > 0 {
+		return
+	}
+	key := fmt.Sprintf("gohalt_timed:%s:%d", thr.key, window)
+	current, err := thr.stg.Incr(ctx, key, int64(pending), thr.interval)
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	if thr.window != window {
+		return
+	}
+	thr.inflight = 0
+	if err != nil {
+		thr.pending += pending
+		log("storage hybrid throttler sync error happened: %v", err)
+		return
+	}
+	if uint64(current) > thr.global {
+		thr.global = uint64(current)
+	}
+}
+
+type quotagrant struct {
+	tokens   uint64
+	deadline time.Time
+	retry    time.Time
+}
+
+type tquota struct {
+	clock  clock
+	client quotapb.QuotaClient
+	batch  uint64
+	lock   sync.Mutex
+	flight singleflight.Group
+	grants map[string]*quotagrant
+}
+
+// NewThrottlerQuota creates new throttler instance that
+// throttles each call after locally granted tokens are exhausted
+// and central quota coordination service refuses to grant new tokens batch, see `NewServiceQuota`.
+// New tokens batch of the specified size is requested from the service via provided gRPC client
+// only when local tokens are exhausted or expired, so most calls are throttled locally without any round trip.
+// Concurrent calls for the same key share single batch request, calls for other keys are never blocked by it.
+// If service refuses to grant any tokens with retry after duration then no new batch is requested until the duration passes.
+// Use `WithKey` to specify key for quota, each key is granted separately.
+// Use `WithWeight` to override context call qunatity, 1 by default.
+// - could return `ErrorThreshold`;
+// - could return `ErrorRetry`;
+// - could return `ErrorInternal`;
+func NewThrottlerQuota(client quotapb.QuotaClient, batch uint64) Throttler {
+	return &tquota{client: client, batch: batch, grants: make(map[string]*quotagrant)}
+}
+
+func (thr *tquota) Acquire(ctx context.Context) error {
+	key, weight := ctxKey(ctx), uint64(ctxWeightMod(ctx))
+	now, jump := thr.clock.now("quota")
+	if jump != 0 {
+		thr.shift(jump)
+	}
+	ok, tokens, refill := thr.take(key, weight, now)
+	if ok {
+		return nil
+	}
+	if refill {
+		// grant rpc is shared by concurrent calls for the same key and is done without holding the lock.
+		_, err, _ := thr.flight.Do(key, func() (interface{}, error) {
+			resp, err := thr.client.Grant(ctx, &quotapb.GrantRequest{Key: key, Tokens: tokens})
+			if err != nil {
+				return nil, err
+			}
+			thr.lock.Lock()
+			defer thr.lock.Unlock()
+			grant := thr.grants[key]
+			grant.tokens += resp.GetTokens()
+			if ttl := resp.GetTtl().AsDuration(); ttl > 0 {
+				grant.deadline = now.Add(ttl)
+			}
+			grant.retry = now.Add(resp.GetRetryAfter().AsDuration())
+			return nil, nil
+		})
+		if err != nil {
+			return ErrorInternal{
+				Throttler: "quota",
+				Message:   err.Error(),
+			}
+		}
+		if ok, _, _ := thr.take(key, weight, now); ok {
+			return nil
+		}
+	}
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	grant := thr.grants[key]
+	err := ErrorThreshold{
+		Throttler: "quota",
+		Threshold: strpair{current: weight, threshold: grant.tokens},
+	}
+	if after := grant.retry.Sub(now); after > 0 {
+		return ErrorRetry{
+			Throttler: "quota",
+			After:     after,
+			Err:       err,
+		}
+	}
+	return err
+}
+
+// take consumes local tokens of the key if there is enough of them,
+// otherwise it returns tokens batch size to request and whether the batch could be requested.
+func (thr *tquota) take(key string, weight uint64, now time.Time) (bool, uint64, bool) {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	grant, ok := thr.grants[key]
+	if !ok {
+		grant = &quotagrant{}
+		thr.grants[key] = grant
+	}
+	if !grant.deadline.IsZero() && !now.Before(grant.deadline) {
+		grant.tokens, grant.deadline = 0, time.Time{}
+	}
+	if grant.tokens >= weight {
+		grant.tokens -= weight
+		return true, 0, false
+	}
+	tokens := thr.batch
+	if tokens < weight-grant.tokens {
+		tokens = weight - grant.tokens
+	}
+	return false, tokens, !now.Before(grant.retry)
+}
+
+// shift shifts all grants deadlines and retries by clock jump,
+// so granted tokens are neither expired earlier nor kept longer after clock jump.
+func (thr *tquota) shift(jump time.Duration) {
+	thr.lock.Lock()
+	defer thr.lock.Unlock()
+	for _, grant := range thr.grants {
+		if !grant.deadline.IsZero() {
+			grant.deadline = grant.deadline.Add(jump)
+		}
+		if !grant.retry.IsZero() {
+			grant.retry = grant.retry.Add(jump)
+		}
+	}
+}
+
+func (thr *tquota) Release(context.Context) error {
+	return nil
+}
+
+type tsplit struct {
+	swapper    Swapper
+	membership Membership
+	limit      uint64
+	gen        func(uint64) Throttler
+	loop       Runnable
+	members    uint64
+}
+
+// NewThrottlerSplit creates new throttler instance that
+// throttles if throttler generated by the provided generator for per instance limit throttles.
+// Per instance limit is defined as the specified global limit divided by the number of live instances
+// returned by the provided membership, but no less than one.
+// Membership is checked on first acquire and then periodically each specified interval,
+// generated throttler is swapped as soon as the number of live instances changes, see `NewThrottlerSwappable`,
+// so each release is routed to the generated throttler which served its acquire.
+// Membership failures are only logged and the last known per instance limit is kept.
+// - could return any underlying throttler error;
+func NewThrottlerSplit(
+	membership Membership,
+	limit uint64,
+	gen func(limit uint64) Throttler,
+	interval time.Duration,
+) Throttler {
+	thr := &tsplit{
+		swapper:    NewThrottlerSwappable(gen(limit)),
+		membership: membership,
+		limit:      limit,
+		gen:        gen,
+		members:    1,
+	}
+	thr.loop = once(func(ctx context.Context) error {
+		ctx = context.WithoutCancel(ctx)
+		thr.split(ctx)
+		return async(
+			loop(interval, func(ctx context.Context) error {
+				thr.split(ctx)
+				return nil
+			}),
+		)(ctx)
+	})
+	return thr
+}
+
+func (thr *tsplit) Acquire(ctx context.Context) error {
+	// start membership loop on first acquire
+	_ = thr.loop(ctx)
+	return thr.swapper.Acquire(ctx)
+}
+
+func (thr *tsplit) Release(ctx context.Context) error {
+	return thr.swapper.Release(ctx)
+}
+
+func (thr *tsplit) split(ctx context.Context) {
+	members, err := thr.membership.Members(ctx)
+	if err != nil {
+		log("split throttler membership error happened: %v", err)
+		return
+	}
+	if members == 0 {
+		members = 1
+	}
+	if atomicGet(&thr.members) == members {
+		return
+	}
+	atomicSet(&thr.members, members)
+	limit := thr.limit / members
+	if limit == 0 {
+		limit = 1
+	}
+	_ = thr.swapper.Swap(thr.gen(limit))
+}
+
+type tredlock struct {
+	stgs   []Storage
+	key    string
+	ttl    time.Duration
+	lock   sync.Mutex
+	holder []byte
+	cancel context.CancelFunc
+	// owner keeps holder acquire context, so releases paired with rejected acquires are skipped.
+	owner context.Context
+}
+
+// NewThrottlerRedlock creates new throttler instance that
+// throttles each call while the distributed lock defined by the specified key
+// is held by any other holder across all replicas sharing the provided independent storages
+// using Redlock algorithm, e.g. independent Redis masters storages created with `gohaltredis.NewStorage`.
+// Lock is acquired only if it is acquired on the majority of storages within the specified ttl minus clock drift,
+// otherwise it is released from all storages right away.
+// Acquired lock is automatically extended on all storages each third of the specified ttl until it is released,
+// so long running holders keep the lock while the lock is not permanently lost when holder replica disappears.
+// New unique holder id `gohalt_redlock_{{uuid}}` is created for each new lock acquire.
+// Lock is released only by the release called with the holder acquire context or context derived from it,
+// so concurrent calls should use their own contexts.
+// Storage key is defined as `gohalt_redlock:{{key}}`.
+// - could return `ErrorInternal`;
+// - could return `ErrorThreshold`;
+func NewThrottlerRedlock(stgs []Storage, key string, ttl time.Duration) Throttler {
+	return &tredlock{stgs: stgs, key: fmt.Sprintf("gohalt_redlock:%s", key), ttl: ttl}
+}
+
+func (thr *tredlock) Acquire(ctx context.Context) error {
+	holder := []byte(fmt.Sprintf("gohalt_redlock_%s", uuid.NewV4()))
+	start := time.Now()
+	locked, failed, err := thr.quorum(func(stg Storage) (bool, error) {
+		return stg.CompareAndSwap(ctx, thr.key, nil, holder, thr.ttl)
+	})
+	// clock drift is defined as 1% of ttl plus 2 milliseconds for small ttls.
+	drift := thr.ttl/100 + 2*time.Millisecond
+	if locked > uint64(len(thr.stgs))/2 && time.Since(start) < thr.ttl-drift {
+		extctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		thr.lock.Lock()
+		thr.holder, thr.cancel, thr.owner = holder, cancel, ctx
+		thr.lock.Unlock()
+		_ = async(loop(thr.ttl/3, func(ctx context.Context) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			extended, _, err := thr.quorum(func(stg Storage) (bool, error) {
+				return stg.CompareAndSwap(ctx, thr.key, holder, holder, thr.ttl)
+			})
+			if extended <= uint64(len(thr.stgs))/2 && ctx.Err() == nil {
+				log("redlock throttler has failed to extend the lock: %v", err)
+			}
+			return nil
+		}))(extctx)
+		return nil
+	}
+	_, _, _ = thr.quorum(func(stg Storage) (bool, error) {
+		return stg.CompareAndSwap(ctx, thr.key, holder, nil, 0)
+	})
+	// storages failures alone prevent the majority.
+	if failed > uint64(len(thr.stgs))-uint64(len(thr.stgs))/2-1 {
+		return ErrorInternal{
+			Throttler: "redlock",
+			Message:   err.Error(),
+		}
+	}
+	return ErrorThreshold{
+		Throttler: "redlock",
+		Threshold: strbool(false),
+	}
+}
+
+func (thr *tredlock) Release(ctx context.Context) error {
+	thr.lock.Lock()
+	// skip releases paired with rejected acquires.
+	if thr.holder == nil || !ctxOrigin(ctx, thr.owner) {
+		thr.lock.Unlock()
+		return nil
+	}
+	holder, cancel := thr.holder, thr.cancel
+	thr.holder, thr.cancel, thr.owner = nil, nil, nil
+	thr.lock.Unlock()
+	cancel()
+	unlocked, _, err := thr.quorum(func(stg Storage) (bool, error) {
+		return stg.CompareAndSwap(ctx, thr.key, holder, nil, 0)
+	})
+	if unlocked <= uint64(len(thr.stgs))/2 {
+		if err != nil {
+			return ErrorInternal{
+				Throttler: "redlock",
+				Message:   err.Error(),
+			}
+		}
+		return ErrorInternal{
+			Throttler: "redlock",
+			Message:   "lock has been expired before release",
+		}
+	}
+	return nil
+}
+
+// quorum runs the provided operation on all storages concurrently
+// and returns the numbers of successful and failed operations and the last error if any happened.
+func (thr *tredlock) quorum(run func(Storage) (bool, error)) (uint64, uint64, error) {
+	var succeeded, failed uint64
+	var lock sync.Mutex
+	var result error
+	var wg sync.WaitGroup
+	for _, stg := range thr.stgs {
+		wg.Add(1)
+		go func(stg Storage) {
+			defer wg.Done()
+			ok, err := run(stg)
+			if err != nil {
+				lock.Lock()
+				result = err
+				lock.Unlock()
+				atomicIncr(&failed)
+				return
+			}
+			if ok {
+				atomicIncr(&succeeded)
+			}
+		}(stg)
+	}
+	wg.Wait()
+	return succeeded, failed, result
+}
@@ -2,9 +2,13 @@ package gohalt
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
@@ -128,6 +132,9 @@ func TestThrottlers(t *testing.T) {
 	cctx, cancel := context.WithCancel(context.TODO())
 	cancel()
 	testerr := errors.New("test")
+	dsecret := []byte("secret")
+	dtoken, _ := MintDelegation(context.TODO(), NewThrottlerEcho(nil), dsecret, 2, time.Minute)
+	dexpired, _ := MintDelegation(context.TODO(), NewThrottlerEcho(nil), dsecret, 2, -time.Minute)
 	table := map[string]tcase{
 		"Throttler echo should not throttle on nil input": {
 			tms: 3,
@@ -708,6 +715,151 @@ func TestThrottlers(t *testing.T) {
 				Stats{},
 			),
 		},
+		"Throttler monitor should throttle on goroutines above threshold": {
+			tms: 3,
+			thr: NewThrottlerMonitor(
+				mntmock{
+					stats: Stats{
+						Goroutines: 500,
+					},
+				},
+				Stats{
+					MEMAlloc:   1000,
+					Goroutines: 100,
+				},
+			),
+			errs: []error{
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current: Stats{
+							Goroutines: 500,
+						},
+						threshold: Stats{
+							MEMAlloc:   1000,
+							Goroutines: 100,
+						},
+					},
+				},
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current: Stats{
+							Goroutines: 500,
+						},
+						threshold: Stats{
+							MEMAlloc:   1000,
+							Goroutines: 100,
+						},
+					},
+				},
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current: Stats{
+							Goroutines: 500,
+						},
+						threshold: Stats{
+							MEMAlloc:   1000,
+							Goroutines: 100,
+						},
+					},
+				},
+			},
+		},
+		"Throttler monitor should throttle on file descriptors usage above threshold": {
+			tms: 2,
+			thr: NewThrottlerMonitor(
+				mntmock{
+					stats: Stats{
+						FDUsage: 95,
+					},
+				},
+				Stats{
+					FDUsage: 90,
+				},
+			),
+			errs: []error{
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current:   Stats{FDUsage: 95},
+						threshold: Stats{FDUsage: 90},
+					},
+				},
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current:   Stats{FDUsage: 95},
+						threshold: Stats{FDUsage: 90},
+					},
+				},
+			},
+		},
+		"Throttler monitor should throttle on io rates above threshold": {
+			tms: 2,
+			thr: NewThrottlerMonitor(
+				mntmock{
+					stats: Stats{
+						DISKThroughput: 1000,
+						DISKIOPS:       10,
+						NETBandwidth:   500,
+					},
+				},
+				Stats{
+					DISKThroughput: 2000,
+					NETBandwidth:   500,
+				},
+			),
+			errs: []error{
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current:   Stats{DISKThroughput: 1000, DISKIOPS: 10, NETBandwidth: 500},
+						threshold: Stats{DISKThroughput: 2000, NETBandwidth: 500},
+					},
+				},
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current:   Stats{DISKThroughput: 1000, DISKIOPS: 10, NETBandwidth: 500},
+						threshold: Stats{DISKThroughput: 2000, NETBandwidth: 500},
+					},
+				},
+			},
+		},
+		"Throttler monitor should throttle on load average above threshold": {
+			tms: 2,
+			thr: NewThrottlerMonitor(
+				mntmock{
+					stats: Stats{
+						LOADAvg1:  4.5,
+						LOADAvg5:  2.5,
+						LOADAvg15: 1.5,
+					},
+				},
+				Stats{
+					LOADAvg1:  8,
+					LOADAvg15: 1.5,
+				},
+			),
+			errs: []error{
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current:   Stats{LOADAvg1: 4.5, LOADAvg5: 2.5, LOADAvg15: 1.5},
+						threshold: Stats{LOADAvg1: 8, LOADAvg15: 1.5},
+					},
+				},
+				ErrorThreshold{
+					Throttler: "monitor",
+					Threshold: strstats{
+						current:   Stats{LOADAvg1: 4.5, LOADAvg5: 2.5, LOADAvg15: 1.5},
+						threshold: Stats{LOADAvg1: 8, LOADAvg15: 1.5},
+					},
+				},
+			},
+		},
 		"Throttler monitor should throttle on stats above threshold": {
 			tms: 3,
 			thr: NewThrottlerMonitor(
@@ -987,9 +1139,9 @@ func TestThrottlers(t *testing.T) {
 				NewThrottlerEcho(testerr),
 			),
 			errs: []error{
-				ErrorInternal{Throttler: "all", Message: testerr.Error()},
-				ErrorInternal{Throttler: "all", Message: testerr.Error()},
-				ErrorInternal{Throttler: "all", Message: testerr.Error()},
+				composite("all", map[int]error{0: testerr, 1: testerr, 2: testerr}),
+				composite("all", map[int]error{0: testerr, 1: testerr, 2: testerr}),
+				composite("all", map[int]error{0: testerr, 1: testerr, 2: testerr}),
 			},
 		},
 		"Throttler any should not throttle on empty list": {
@@ -1012,9 +1164,9 @@ func TestThrottlers(t *testing.T) {
 				NewThrottlerEcho(testerr),
 			),
 			errs: []error{
-				ErrorInternal{Throttler: "any", Message: testerr.Error()},
-				ErrorInternal{Throttler: "any", Message: testerr.Error()},
-				ErrorInternal{Throttler: "any", Message: testerr.Error()},
+				composite("any", map[int]error{0: testerr, 2: testerr}),
+				composite("any", map[int]error{0: testerr, 2: testerr}),
+				composite("any", map[int]error{0: testerr, 2: testerr}),
 			},
 		},
 		"Throttler any should throttle on all internal errors": {
@@ -1025,9 +1177,9 @@ func TestThrottlers(t *testing.T) {
 				NewThrottlerEcho(testerr),
 			),
 			errs: []error{
-				ErrorInternal{Throttler: "any", Message: testerr.Error()},
-				ErrorInternal{Throttler: "any", Message: testerr.Error()},
-				ErrorInternal{Throttler: "any", Message: testerr.Error()},
+				composite("any", map[int]error{0: testerr, 1: testerr, 2: testerr}),
+				composite("any", map[int]error{0: testerr, 1: testerr, 2: testerr}),
+				composite("any", map[int]error{0: testerr, 1: testerr, 2: testerr}),
 			},
 		},
 		"Throttler not should not throttle on internal errors": {
@@ -1377,30 +1529,1619 @@ func TestThrottlers(t *testing.T) {
 				nil,
 			},
 		},
-	}
-	for tname, ptrtcase := range table {
-		t.Run(tname, func(t *testing.T) {
-			var wg sync.WaitGroup
-			wg.Add(int(ptrtcase.tms))
-			for i := 0; i < int(ptrtcase.tms); i++ {
-				t.Run(fmt.Sprintf("run %d", i+1), func(t *testing.T) {
-					go func(index int, tcase *tcase) {
-						defer wg.Done()
-						rdur, rerr := tcase.result(index)
-						dur, err := tcase.run(index)
-						trun.Run(func(context.Context) error {
-							log("expected error %v actual err %v", rerr, err)
-							log("expected duration le %s actual duration %s", rdur/2, dur)
-							require.Equal(t, rerr, err)
-							require.LessOrEqual(t, int64(rdur/2), int64(dur))
-							return nil
-						})
-					}(i, &ptrtcase)
-				})
-			}
-			wg.Wait()
-		})
-	}
+		"Throttler delegation should throttle on internal token errors": {
+			tms: 3,
+			thr: NewThrottlerDelegation(dsecret, nil),
+			ctxs: []context.Context{
+				context.TODO(),
+				WithDelegation(context.TODO(), dexpired),
+				WithDelegation(context.TODO(), dtoken+"test"),
+			},
+			errs: []error{
+				ErrorInternal{Throttler: "delegation", Message: "context doesn't contain required delegation token"},
+				ErrorInternal{Throttler: "delegation", Message: "delegation token has expired"},
+				ErrorInternal{Throttler: "delegation", Message: "delegation token signature is invalid"},
+			},
+		},
+		"Throttler delegation should throttle on exhausted delegated quota": {
+			tms: 4,
+			thr: NewThrottlerDelegation(dsecret, nil),
+			ctxs: []context.Context{
+				WithDelegation(context.TODO(), dtoken),
+				WithDelegation(context.TODO(), dtoken),
+				WithDelegation(context.TODO(), dtoken),
+				WithWeight(WithDelegation(context.TODO(), dtoken), 2),
+			},
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "delegation",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+				ErrorThreshold{
+					Throttler: "delegation",
+					Threshold: strpair{current: 4, threshold: 2},
+				},
+			},
+		},
+		"Throttler migration should not flip on disagreement": {
+			tms: 3,
+			thr: NewThrottlerMigration(NewThrottlerEcho(nil), NewThrottlerEcho(testerr), 0.5, ms0_0),
+		},
+		"Throttler migration should flip on agreement": {
+			tms: 3,
+			thr: NewThrottlerMigration(NewThrottlerEcho(nil), NewThrottlerAfter(1), 1.0, ms0_0),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 3, threshold: 1},
+				},
+			},
+		},
+		"Throttler tenant should throttle on internal quota provider error": {
+			tms: 3,
+			thr: NewThrottlerTenant(qpmock{err: testerr}, 1, ms0_0),
+			errs: []error{
+				ErrorInternal{Throttler: "tenant", Message: testerr.Error()},
+				ErrorInternal{Throttler: "tenant", Message: testerr.Error()},
+				ErrorInternal{Throttler: "tenant", Message: testerr.Error()},
+			},
+		},
+		"Throttler tenant should throttle on tenant quota threshold": {
+			tms: 6,
+			thr: NewThrottlerTenant(NewQuotaProviderStatic(map[string]uint64{"test": 2}), 1, time.Minute),
+			ctxs: []context.Context{
+				WithTenant(context.TODO(), "test"),
+				WithTenant(context.TODO(), "test"),
+				WithTenant(context.TODO(), "test"),
+				WithTenant(context.TODO(), "nontest"),
+				WithTenant(context.TODO(), "nontest"),
+				WithWeight(WithTenant(context.TODO(), "test"), 2),
+			},
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "tenant",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+				nil,
+				ErrorThreshold{
+					Throttler: "tenant",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "tenant",
+					Threshold: strpair{current: 4, threshold: 2},
+				},
+			},
+		},
+		"Throttler sharded should throttle on generator error": {
+			tms: 3,
+			thr: NewThrottlerSharded(
+				func(string) (Throttler, error) {
+					return nil, testerr
+				},
+				2,
+			),
+			errs: []error{
+				ErrorInternal{Throttler: "sharded", Message: testerr.Error()},
+				ErrorInternal{Throttler: "sharded", Message: testerr.Error()},
+				ErrorInternal{Throttler: "sharded", Message: testerr.Error()},
+			},
+		},
+		"Throttler sharded should throttle on matching shard throttler": {
+			tms: 4,
+			thr: NewThrottlerSharded(
+				func(string) (Throttler, error) {
+					return NewThrottlerAfter(1), nil
+				},
+				2,
+			),
+			ctxs: []context.Context{
+				WithKey(context.TODO(), "test"),
+				WithKey(context.TODO(), "nontest"),
+				WithKey(context.TODO(), "125"),
+				WithKey(context.TODO(), "c"),
+			},
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+			},
+		},
+		"Throttler lease should throttle on internal lease error": {
+			tms: 3,
+			thr: NewThrottlerLease(1, ms5_0),
+			errs: []error{
+				ErrorInternal{Throttler: "lease", Message: "context doesn't contain required lease"},
+				ErrorInternal{Throttler: "lease", Message: "context doesn't contain required lease"},
+				ErrorInternal{Throttler: "lease", Message: "context doesn't contain required lease"},
+			},
+		},
+		"Throttler lease should not throttle after lease expiration": {
+			tms: 3,
+			thr: NewThrottlerLease(1, ms5_0),
+			ctxs: []context.Context{
+				WithLease(context.TODO(), "test"),
+				WithLease(context.TODO(), "nontest"),
+				WithLease(context.TODO(), "nontest"),
+			},
+			pres: []Runnable{
+				nil,
+				nil,
+				delayed(ms7_0, nope),
+			},
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "lease",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				nil,
+			},
+			pass: true,
+		},
+		"Throttler resizable should throttle on capacity threshold": {
+			tms: 3,
+			thr: NewThrottlerResizable(3),
+			ctxs: []context.Context{
+				WithWeight(context.TODO(), 2),
+				WithWeight(context.TODO(), 1),
+				WithWeight(context.TODO(), 3),
+			},
+			acts: []Runnable{
+				delayed(ms1_0, nope),
+				delayed(ms1_0, nope),
+				delayed(ms1_0, nope),
+			},
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "resizable",
+					Threshold: strpair{current: 6, threshold: 3},
+				},
+			},
+		},
+		"Throttler memo should throttle on memoized rejections": {
+			tms: 5,
+			thr: NewThrottlerMemo(NewThrottlerRing(NewThrottlerEcho(testerr), NewThrottlerEcho(nil)), ms30_0, ms0_0),
+			ctxs: []context.Context{
+				WithKey(context.TODO(), "test"),
+				WithKey(context.TODO(), "test"),
+				WithWeight(WithKey(context.TODO(), "test"), 2),
+				WithWeight(WithKey(context.TODO(), "test"), 3),
+				WithWeight(WithKey(context.TODO(), "test"), 2),
+			},
+			errs: []error{
+				testerr,
+				testerr,
+				nil,
+				testerr,
+				testerr,
+			},
+		},
+		"Throttler memo should not throttle on expired memoized rejections": {
+			tms: 3,
+			thr: NewThrottlerMemo(NewThrottlerRing(NewThrottlerEcho(testerr), NewThrottlerEcho(nil)), ms1_0, ms0_0),
+			pres: []Runnable{
+				nil,
+				delayed(ms3_0, nope),
+				nil,
+			},
+			errs: []error{
+				testerr,
+				nil,
+				testerr,
+			},
+		},
+		"Throttler pattern should throttle on matching glob pattern or default": {
+			tms: 5,
+			thr: NewThrottlerPattern(
+				Pattern{
+					Pattern:   Glob("/api/v1/*"),
+					Throttler: NewThrottlerEcho(nil),
+				},
+				Pattern{
+					Pattern:   Glob("/admin/**"),
+					Throttler: NewThrottlerEcho(testerr),
+				},
+				Pattern{
+					Throttler: NewThrottlerAfter(1),
+				},
+			),
+			ctxs: []context.Context{
+				WithKey(context.TODO(), "/api/v1/test"),
+				WithKey(context.TODO(), "/admin/test/1"),
+				WithKey(context.TODO(), "/api/v1/test/1"),
+				WithKey(context.TODO(), "/api/v1/test.1"),
+				WithKey(context.TODO(), "/test"),
+			},
+			errs: []error{
+				nil,
+				testerr,
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+			},
+		},
+		"Throttler drain should throttle on underlying throttler error": {
+			tms: 3,
+			thr: NewThrottlerDrain(NewThrottlerEcho(testerr)),
+			errs: []error{
+				testerr,
+				testerr,
+				testerr,
+			},
+		},
+		"Throttler random should throttle within interval": {
+			tms: 4,
+			thr: NewThrottlerRandom(ms5_0, ms5_0),
+			pres: []Runnable{
+				nil,
+				nil,
+				delayed(ms7_0, nope),
+				nil,
+			},
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "random",
+					Threshold: strdurations{current: ms0_0, threshold: ms5_0},
+				},
+				nil,
+				ErrorThreshold{
+					Throttler: "random",
+					Threshold: strdurations{current: ms0_0, threshold: ms5_0},
+				},
+			},
+		},
+		"Throttler aggregate should throttle on internal throttler": {
+			tms: 3,
+			thr: NewThrottlerAggregate(NewThrottlerAfter(1), NewStorageMemory(), time.Hour),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 3, threshold: 1},
+				},
+			},
+		},
+		"Throttler aggregate should not throttle on storage errors": {
+			tms: 3,
+			thr: NewThrottlerAggregate(NewThrottlerEcho(nil), stgmock{err: testerr}, time.Hour),
+		},
+		"Throttler defer should defer low priority and reject high priority calls": {
+			tms: 4,
+			thr: NewThrottlerDefer(NewThrottlerAfter(1), enqmock{}, 2, ms30_0),
+			ctxs: []context.Context{
+				WithPriority(WithMessage(context.TODO(), "test"), 2),
+				WithMessage(context.TODO(), "test"),
+				WithPriority(WithMessage(context.TODO(), "test"), 3),
+				WithPriority(context.TODO(), 1),
+			},
+			errs: []error{
+				nil,
+				nil,
+				ErrorRetry{
+					Throttler: "defer",
+					After:     ms30_0,
+					Err: ErrorThreshold{
+						Throttler: "after",
+						Threshold: strpair{current: 3, threshold: 1},
+					},
+				},
+				ErrorInternal{Throttler: "enqueue", Message: "context doesn't contain required message"},
+			},
+		},
+		"Throttler defer should throttle on enqueue errors": {
+			tms: 2,
+			thr: NewThrottlerDefer(NewThrottlerEcho(testerr), enqmock{err: testerr}, 2, ms30_0),
+			ctxs: []context.Context{
+				WithMessage(context.TODO(), "test"),
+				WithPriority(WithMessage(context.TODO(), "test"), 2),
+			},
+			errs: []error{
+				ErrorInternal{Throttler: "enqueue", Message: testerr.Error()},
+				ErrorRetry{Throttler: "defer", After: ms30_0, Err: testerr},
+			},
+		},
+		"Throttler mutex should throttle on held lock": {
+			tms:  3,
+			thr:  NewThrottlerMutex(NewStorageMemory(), "test", time.Minute),
+			pass: true,
+			errs: []error{
+				nil,
+				ErrorThreshold{Throttler: "mutex", Threshold: strbool(false)},
+				ErrorThreshold{Throttler: "mutex", Threshold: strbool(false)},
+			},
+		},
+		"Throttler mutex should throttle on storage errors": {
+			tms: 2,
+			thr: NewThrottlerMutex(stgmock{err: testerr}, "test", time.Minute),
+			errs: []error{
+				ErrorInternal{Throttler: "mutex", Message: testerr.Error()},
+				ErrorInternal{Throttler: "mutex", Message: testerr.Error()},
+			},
+		},
+		"Throttler gc should not throttle on disabled thresholds": {
+			tms: 3,
+			thr: NewThrottlerGC(0, 0, 0, 2, time.Minute),
+		},
+		"Throttler inflight should throttle on internal throttler": {
+			tms: 3,
+			thr: NewThrottlerInflight(NewThrottlerEach(2)),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "each",
+					Threshold: strpair{current: 2, threshold: 2},
+				},
+				nil,
+			},
+		},
+		"Throttler probe should throttle on failing probe": {
+			tms: 3,
+			thr: NewThrottlerProbe(use(testerr), time.Minute),
+			errs: []error{
+				ErrorThreshold{Throttler: "probe", Threshold: strbool(false)},
+				ErrorThreshold{Throttler: "probe", Threshold: strbool(false)},
+				ErrorThreshold{Throttler: "probe", Threshold: strbool(false)},
+			},
+		},
+		"Throttler probe should not throttle on healthy probe": {
+			tms: 3,
+			thr: NewThrottlerProbe(nope, time.Minute),
+		},
+		"Throttler rw should throttle on separate read and write quotas": {
+			tms:  5,
+			thr:  NewThrottlerRW(2, 1, false),
+			pass: true,
+			ctxs: []context.Context{
+				WithAccessMode(context.TODO(), AccessRead),
+				WithAccessMode(context.TODO(), AccessWrite),
+				context.TODO(),
+				WithAccessMode(context.TODO(), AccessWrite),
+				WithAccessMode(context.TODO(), AccessRead),
+			},
+			errs: []error{
+				nil,
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "rw",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "rw",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+			},
+		},
+		"Throttler rw should preempt read quota for writes with write priority": {
+			tms:  5,
+			thr:  NewThrottlerRW(2, 1, true),
+			pass: true,
+			ctxs: []context.Context{
+				WithAccessMode(context.TODO(), AccessWrite),
+				WithAccessMode(context.TODO(), AccessWrite),
+				WithAccessMode(context.TODO(), AccessRead),
+				WithAccessMode(context.TODO(), AccessWrite),
+				WithAccessMode(context.TODO(), AccessRead),
+			},
+			errs: []error{
+				nil,
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "rw",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "rw",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+			},
+		},
+		"Throttler client should throttle on exceeding admission quota": {
+			tms: 3,
+			thr: NewThrottlerClient(2, time.Hour, 0.5, 1),
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "client",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+			},
+		},
+		"Throttler pacing should throttle on exceeding pace without credit": {
+			tms: 3,
+			thr: NewThrottlerPacing(ms30_0, 1, 2),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "pacing",
+					Threshold: strdurations{current: ms0_0, threshold: ms30_0},
+				},
+				ErrorThreshold{
+					Throttler: "pacing",
+					Threshold: strdurations{current: ms0_0, threshold: ms30_0},
+				},
+			},
+		},
+		"Throttler hedge should throttle hedged calls exceeding budget": {
+			tms: 6,
+			thr: NewThrottlerHedge(0.5, time.Hour),
+			ctxs: []context.Context{
+				WithHedge(context.TODO(), true),
+				context.TODO(),
+				WithHedge(context.TODO(), false),
+				WithHedge(context.TODO(), true),
+				WithHedge(context.TODO(), true),
+				context.TODO(),
+			},
+			errs: []error{
+				ErrorThreshold{
+					Throttler: "hedge",
+					Threshold: strpair{current: 1, threshold: 0},
+				},
+				nil,
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "hedge",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				nil,
+			},
+		},
+		"Throttler cellrate spec should throttle on independent burst": {
+			tms: 5,
+			thr: NewThrottlerCellRateSpec(RateSpec{Rate: 1, Interval: time.Hour, Burst: 3}, true),
+			errs: []error{
+				nil,
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "cellrate",
+					Threshold: strpair{current: 4, threshold: 3},
+				},
+				ErrorThreshold{
+					Throttler: "cellrate",
+					Threshold: strpair{current: 4, threshold: 3},
+				},
+			},
+		},
+		"Throttler bucket spec should throttle on independent burst": {
+			tms: 5,
+			thr: NewThrottlerBucketSpec(RateSpec{Rate: 1, Interval: time.Hour, Burst: 3}, true),
+			errs: []error{
+				nil,
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "bucket",
+					Threshold: strpair{current: 4, threshold: 3},
+				},
+				ErrorThreshold{
+					Throttler: "bucket",
+					Threshold: strpair{current: 4, threshold: 3},
+				},
+			},
+		},
+		"Throttler timed spec should throttle on independent burst": {
+			tms: 5,
+			thr: NewThrottlerTimedSpec(RateSpec{Rate: 1, Interval: time.Hour, Burst: 3}, 0),
+			errs: []error{
+				nil,
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 4, threshold: 3},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 4, threshold: 3},
+				},
+			},
+		},
+		"Throttler adaptive spec should throttle on independent burst": {
+			tms: 4,
+			thr: NewThrottlerAdaptiveSpec(RateSpec{Rate: 1, Interval: time.Hour, Burst: 3}, 0, 0, NewThrottlerEcho(nil)),
+			errs: []error{
+				nil,
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 4, threshold: 3},
+				},
+			},
+		},
+		"Throttler not should throttle inside inverted time window": {
+			tms: 3,
+			thr: NewThrottlerNot(NewThrottlerAny(
+				NewThrottlerPast(time.Date(2000, 1, 1, 9, 0, 0, 0, time.UTC)),
+				NewThrottlerFuture(time.Date(2000, 1, 1, 18, 0, 0, 0, time.UTC)),
+			)),
+			ctxs: []context.Context{
+				WithTimestamp(context.TODO(), time.Date(2000, 1, 1, 8, 0, 0, 0, time.UTC)),
+				WithTimestamp(context.TODO(), time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)),
+				WithTimestamp(context.TODO(), time.Date(2000, 1, 1, 20, 0, 0, 0, time.UTC)),
+			},
+			errs: []error{
+				nil,
+				ErrorInternal{
+					Throttler: "not",
+					Message:   "no error happened",
+				},
+				nil,
+			},
+		},
+		"Throttler weighted should throttle on empty weights": {
+			tms: 3,
+			thr: NewThrottlerWeighted(Weighted{Throttler: NewThrottlerEcho(nil)}),
+			errs: []error{
+				ErrorInternal{
+					Throttler: "weighted",
+					Message:   "known weight is not found",
+				},
+				ErrorInternal{
+					Throttler: "weighted",
+					Message:   "known weight is not found",
+				},
+				ErrorInternal{
+					Throttler: "weighted",
+					Message:   "known weight is not found",
+				},
+			},
+		},
+		"Throttler weighted should throttle on weighted throttlers": {
+			tms: 3,
+			thr: NewThrottlerWeighted(
+				Weighted{Throttler: NewThrottlerEcho(nil)},
+				Weighted{Weight: 5, Throttler: NewThrottlerEcho(testerr)},
+				Weighted{Throttler: NewThrottlerEcho(nil)},
+			),
+			errs: []error{
+				testerr,
+				testerr,
+				testerr,
+			},
+		},
+		"Throttler weighted should not throttle on weighted throttlers": {
+			tms: 3,
+			thr: NewThrottlerWeighted(
+				Weighted{Weight: 1, Throttler: NewThrottlerEcho(nil)},
+				Weighted{Throttler: NewThrottlerEcho(testerr)},
+			),
+		},
+		"Throttler round robin should throttle on empty list": {
+			tms: 2,
+			thr: NewThrottlerRoundRobin(),
+			errs: []error{
+				ErrorInternal{
+					Throttler: "roundrobin",
+					Message:   "known index is not found",
+				},
+				ErrorInternal{
+					Throttler: "roundrobin",
+					Message:   "known index is not found",
+				},
+			},
+		},
+		"Throttler round robin should throttle only if all throttlers throttle": {
+			tms: 5,
+			thr: NewThrottlerRoundRobin(
+				NewThrottlerAfter(2),
+				NewThrottlerAfter(2),
+			),
+			errs: []error{
+				nil,
+				nil,
+				nil,
+				nil,
+				ErrorInternal{
+					Throttler: "roundrobin",
+					Message: ErrorThreshold{
+						Throttler: "after",
+						Threshold: strpair{current: 3, threshold: 2},
+					}.Error(),
+				},
+			},
+		},
+		"Throttler race should not throttle on empty list": {
+			tms: 2,
+			thr: NewThrottlerRace(true),
+		},
+		"Throttler race should not throttle on first allow": {
+			tms: 3,
+			thr: NewThrottlerRace(true, NewThrottlerEcho(testerr), NewThrottlerEcho(nil)),
+		},
+		"Throttler race should throttle if all throttle on first allow": {
+			tms: 2,
+			thr: NewThrottlerRace(true, NewThrottlerEcho(testerr), NewThrottlerEcho(testerr)),
+			errs: []error{
+				ErrorInternal{Throttler: "race", Message: testerr.Error()},
+				ErrorInternal{Throttler: "race", Message: testerr.Error()},
+			},
+		},
+		"Throttler race should throttle on first deny": {
+			tms: 3,
+			thr: NewThrottlerRace(false, NewThrottlerEcho(nil), NewThrottlerEcho(testerr)),
+			errs: []error{
+				ErrorInternal{Throttler: "race", Message: testerr.Error()},
+				ErrorInternal{Throttler: "race", Message: testerr.Error()},
+				ErrorInternal{Throttler: "race", Message: testerr.Error()},
+			},
+		},
+		"Throttler race should not throttle if none throttle on first deny": {
+			tms: 3,
+			thr: NewThrottlerRace(false, NewThrottlerEcho(nil), NewThrottlerContext()),
+		},
+		"Throttler cached should not throttle on cached decisions": {
+			tms: 3,
+			thr: NewThrottlerCached(NewThrottlerAfter(1), time.Hour),
+		},
+		"Throttler cached should throttle on cached decisions per key": {
+			tms: 4,
+			thr: NewThrottlerCached(NewThrottlerAfter(1), time.Hour),
+			ctxs: []context.Context{
+				WithKey(context.TODO(), "a"),
+				WithKey(context.TODO(), "b"),
+				WithKey(context.TODO(), "a"),
+				WithKey(context.TODO(), "b"),
+			},
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+			},
+		},
+		"Throttler cached should throttle on expired decisions": {
+			tms: 3,
+			thr: NewThrottlerCached(NewThrottlerAfter(1), 0),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 3, threshold: 1},
+				},
+			},
+		},
+		"Throttler suppress errors should not throttle on suppressed error classes": {
+			tms: 3,
+			thr: NewThrottlerSuppressErrors(
+				NewThrottlerEcho(ErrorInternal{Throttler: "monitor", Message: "test"}),
+				ErrorInternal{},
+			),
+		},
+		"Throttler suppress errors should not throttle on wrapped suppressed error classes": {
+			tms: 3,
+			thr: NewThrottlerSuppressErrors(
+				NewThrottlerEcho(ErrorRetry{Throttler: "defer", Err: ErrorInternal{Throttler: "metric"}}),
+				ErrorInternal{},
+			),
+		},
+		"Throttler suppress errors should not throttle on suppressed composite children error classes": {
+			tms: 3,
+			thr: NewThrottlerSuppressErrors(
+				NewThrottlerAll(
+					NewThrottlerEcho(ErrorInternal{Throttler: "monitor", Message: "test"}),
+					NewThrottlerEcho(ErrorRetry{Throttler: "defer", Err: ErrorInternal{Throttler: "metric"}}),
+				),
+				ErrorInternal{},
+			),
+		},
+		"Throttler suppress errors should not throttle on suppressed composite error class": {
+			tms: 3,
+			thr: NewThrottlerSuppressErrors(
+				NewThrottlerAny(NewThrottlerAfter(0), NewThrottlerEcho(testerr)),
+				ErrorComposite{},
+			),
+		},
+		"Throttler suppress errors should throttle on not suppressed composite children error classes": {
+			tms: 2,
+			thr: NewThrottlerSuppressErrors(
+				NewThrottlerAny(
+					NewThrottlerEcho(ErrorInternal{Throttler: "monitor", Message: "test"}),
+					NewThrottlerAfter(0),
+				),
+				ErrorInternal{},
+			),
+			errs: []error{
+				composite("any", map[int]error{
+					0: ErrorInternal{Throttler: "monitor", Message: "test"},
+					1: ErrorThreshold{Throttler: "after", Threshold: strpair{current: 1, threshold: 0}},
+				}),
+				composite("any", map[int]error{
+					0: ErrorInternal{Throttler: "monitor", Message: "test"},
+					1: ErrorThreshold{Throttler: "after", Threshold: strpair{current: 2, threshold: 0}},
+				}),
+			},
+		},
+		"Throttler suppress errors should throttle on not suppressed error classes": {
+			tms: 3,
+			thr: NewThrottlerSuppressErrors(NewThrottlerAfter(1), ErrorInternal{}, testerr),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 3, threshold: 1},
+				},
+			},
+		},
+		"Throttler chain should not throttle on empty list": {
+			tms: 2,
+			thr: NewThrottlerChain(ShortCircuitDeny),
+		},
+		"Throttler chain should stop at first denial": {
+			tms: 3,
+			thr: NewThrottlerChain(ShortCircuitDeny, NewThrottlerEach(2), NewThrottlerAfter(1)),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "each",
+					Threshold: strpair{current: 2, threshold: 2},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 2, threshold: 1},
+				},
+			},
+		},
+		"Throttler chain should stop at first allowance": {
+			tms: 3,
+			thr: NewThrottlerChain(ShortCircuitAllow, NewThrottlerEach(2), NewThrottlerAfter(1)),
+			errs: []error{
+				nil,
+				nil,
+				nil,
+			},
+		},
+		"Throttler chain should evaluate all throttlers": {
+			tms: 3,
+			thr: NewThrottlerChain(ShortCircuitNone, NewThrottlerEach(2), NewThrottlerAfter(1)),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "each",
+					Threshold: strpair{current: 2, threshold: 2},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 3, threshold: 1},
+				},
+			},
+		},
+		"Throttler spacing should wait for spacing between calls": {
+			tms:  3,
+			thr:  NewThrottlerSpacing(ms10_0, 3),
+			pass: true,
+			durs: []time.Duration{
+				0,
+				ms10_0,
+				2 * ms10_0,
+			},
+		},
+		"Throttler spacing should throttle on running threshold": {
+			tms:  3,
+			thr:  NewThrottlerSpacing(0, 2),
+			pass: true,
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "spacing",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+			},
+		},
+		"Throttler retried should not throttle on retried throttler": {
+			tms: 3,
+			thr: NewThrottlerRetried(NewThrottlerEach(2), NewBackoffConstant(ms1_0), 3),
+		},
+		"Throttler retried should throttle on max attempts": {
+			tms: 3,
+			thr: NewThrottlerRetried(NewThrottlerAfter(1), NewBackoffConstant(0), 2),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 3, threshold: 1},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 5, threshold: 1},
+				},
+			},
+		},
+		"Throttler retried should throttle on done context": {
+			tms: 2,
+			thr: NewThrottlerRetried(NewThrottlerEcho(testerr), NewBackoffConstant(time.Hour), 0),
+			ctxs: []context.Context{
+				cctx,
+				cctx,
+			},
+			errs: []error{
+				testerr,
+				testerr,
+			},
+		},
+		"Throttler timeout should not throttle within timeout": {
+			tms: 3,
+			thr: NewThrottlerTimeout(NewThrottlerWait(ms1_0), time.Hour),
+		},
+		"Throttler timeout should throttle on underlying throttler errors": {
+			tms: 2,
+			thr: NewThrottlerTimeout(NewThrottlerEcho(testerr), time.Hour),
+			errs: []error{
+				testerr,
+				testerr,
+			},
+		},
+		"Throttler timeout should throttle on exceeded timeout": {
+			tms: 2,
+			thr: NewThrottlerTimeout(NewThrottlerWait(time.Second), ms1_0),
+			errs: []error{
+				ErrorTimeout{Throttler: "timeout", Timeout: ms1_0},
+				ErrorTimeout{Throttler: "timeout", Timeout: ms1_0},
+			},
+			durs: []time.Duration{
+				ms1_0,
+				ms1_0,
+			},
+		},
+		"Throttler timeout should throttle on done context": {
+			tms: 2,
+			thr: NewThrottlerTimeout(NewThrottlerWait(time.Second), time.Hour),
+			ctxs: []context.Context{
+				cctx,
+				cctx,
+			},
+			errs: []error{
+				ErrorInternal{Throttler: "timeout", Message: context.Canceled.Error()},
+				ErrorInternal{Throttler: "timeout", Message: context.Canceled.Error()},
+			},
+		},
+		"Throttler storage after should throttle on shared threshold": {
+			tms: 4,
+			thr: NewThrottlerStorageAfter(NewStorageMemory(), "test", 2),
+			ctxs: []context.Context{
+				context.TODO(),
+				context.TODO(),
+				context.TODO(),
+				WithWeight(context.TODO(), 2),
+			},
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+				ErrorThreshold{
+					Throttler: "after",
+					Threshold: strpair{current: 5, threshold: 2},
+				},
+			},
+		},
+		"Throttler storage each should throttle on shared threshold": {
+			tms: 4,
+			thr: NewThrottlerStorageEach(NewStorageMemory(), "test", 2),
+			errs: []error{
+				nil,
+				ErrorThreshold{
+					Throttler: "each",
+					Threshold: strpair{current: 2, threshold: 2},
+				},
+				nil,
+				ErrorThreshold{
+					Throttler: "each",
+					Threshold: strpair{current: 4, threshold: 2},
+				},
+			},
+		},
+		"Throttler storage timed should throttle on zero interval": {
+			tms: 3,
+			thr: NewThrottlerStorageTimed(NewStorageMemory(), "test", 2, 0),
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "timed",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+			},
+		},
+		"Throttler storage timed should throttle on shared threshold": {
+			tms: 3,
+			thr: NewThrottlerStorageTimed(NewStorageMemory(), "test", 2, time.Hour),
+			errs: []error{
+				nil,
+				nil,
+				ErrorThreshold{
+					Throttler: "timed",
+					Threshold: strpair{current: 3, threshold: 2},
+				},
+			},
+		},
+		"Throttler storage throttlers should not throttle on storage errors": {
+			tms: 3,
+			thr: NewThrottlerAny(
+				NewThrottlerStorageAfter(stgmock{err: testerr}, "test", 0),
+				NewThrottlerStorageEach(stgmock{err: testerr}, "test", 1),
+				NewThrottlerStorageTimed(stgmock{err: testerr}, "test", 0, time.Hour),
+			),
+		},
+	}
+	for tname, ptrtcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			var wg sync.WaitGroup
+			wg.Add(int(ptrtcase.tms))
+			for i := 0; i < int(ptrtcase.tms); i++ {
+				t.Run(fmt.Sprintf("run %d", i+1), func(t *testing.T) {
+					go func(index int, tcase *tcase) {
+						defer wg.Done()
+						rdur, rerr := tcase.result(index)
+						dur, err := tcase.run(index)
+						trun.Run(func(context.Context) error {
+							log("expected error %v actual err %v", rerr, err)
+							log("expected duration le %s actual duration %s", rdur/2, dur)
+							require.Equal(t, rerr, err)
+							require.LessOrEqual(t, int64(rdur/2), int64(dur))
+							return nil
+						})
+					}(i, &ptrtcase)
+				})
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestThrottlerBufferedQueueing(t *testing.T) {
+	thr := NewThrottlerBuffered(1)
+	require.NoError(t, thr.Acquire(context.TODO()))
+	queueings := make(chan Queueing, 1)
+	ctx := WithQueueing(context.TODO(), func(q Queueing) {
+		queueings <- q
+	})
+	done := make(chan error)
+	go func() {
+		done <- thr.Acquire(ctx)
+	}()
+	require.Equal(t, Queueing{Position: 1}, <-queueings)
+	require.NoError(t, thr.Release(context.TODO()))
+	require.NoError(t, <-done)
+	require.NoError(t, thr.Release(context.TODO()))
+}
+
+func TestThrottlerLeaseHeartbeat(t *testing.T) {
+	// heartbeats are an order of magnitude more frequent than lease ttl
+	// and keep the lease alive for longer than single lease ttl.
+	thr := NewThrottlerLease(1, 10*ms10_0)
+	ctx := WithLease(context.TODO(), "test")
+	require.NoError(t, thr.Acquire(ctx))
+	for i := 0; i < 12; i++ {
+		_ = sleep(ctx, ms10_0)
+		require.NoError(t, thr.Heartbeat(ctx))
+	}
+	require.Error(t, thr.Acquire(WithLease(context.TODO(), "nontest")))
+	require.NoError(t, thr.Release(ctx))
+	require.Equal(t, ErrorInternal{Throttler: "lease", Message: "lease is not found"}, thr.Heartbeat(ctx))
+}
+
+func TestThrottlerResizableSetCapacity(t *testing.T) {
+	thr := NewThrottlerResizable(2)
+	ctx := context.TODO()
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+	thr.SetCapacity(1)
+	require.Equal(t, ErrorThreshold{
+		Throttler: "resizable",
+		Threshold: strpair{current: 3, threshold: 1},
+	}, thr.Acquire(ctx))
+	require.NoError(t, thr.Release(ctx))
+	require.Error(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Release(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+	thr.SetCapacity(3)
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+}
+
+func TestThrottlerSwappable(t *testing.T) {
+	prev := NewThrottlerRunning(1)
+	thr := NewThrottlerSwappable(prev)
+	ctx := context.TODO()
+	require.NoError(t, thr.Acquire(ctx))
+	require.Error(t, thr.Acquire(ctx))
+	next := NewThrottlerRunning(1)
+	require.Equal(t, prev, thr.Swap(next))
+	require.NoError(t, thr.Acquire(ctx))
+	// releases are routed to previous generation first.
+	require.NoError(t, thr.Release(ctx))
+	require.NoError(t, thr.Release(ctx))
+	require.NoError(t, prev.Acquire(ctx))
+	require.Error(t, next.Acquire(ctx))
+	require.NoError(t, thr.Release(ctx))
+	require.NoError(t, thr.Release(ctx))
+	require.Equal(t, next, thr.Swap(NewThrottlerEcho(nil)))
+	// releases are routed to generation serving their acquires.
+	prev, next = NewThrottlerRunning(1), NewThrottlerRunning(1)
+	thr = NewThrottlerSwappable(prev)
+	first, second := WithKey(ctx, "first"), WithKey(ctx, "second")
+	require.NoError(t, thr.Acquire(first))
+	thr.Swap(next)
+	require.NoError(t, thr.Acquire(second))
+	require.NoError(t, thr.Release(WithStatus(second, http.StatusOK)))
+	require.Error(t, prev.Acquire(ctx))
+	require.NoError(t, prev.Release(ctx))
+	require.NoError(t, thr.Acquire(second))
+	require.NoError(t, thr.Release(first))
+	require.NoError(t, prev.Acquire(ctx))
+	require.Error(t, next.Acquire(ctx))
+}
+
+func TestThrottlerRouter(t *testing.T) {
+	thr := NewThrottlerRouter()
+	thr.Handle("GET /users", NewThrottlerEcho(nil))
+	thr.Handle("/api/**", NewThrottlerAfter(1))
+	thr.Handle("**", NewThrottlerEcho(ErrorInternal{Throttler: "test"}))
+	thr.Handle("POST /users", NewThrottlerEach(1))
+	require.Equal(t, []string{"**", "/api/**", "GET /users", "POST /users"}, thr.Routes())
+	def, ok := thr.Route("**")
+	require.True(t, ok)
+	require.Equal(t, NewThrottlerEcho(ErrorInternal{Throttler: "test"}), def)
+	_, ok = thr.Route("/api/v1")
+	require.False(t, ok)
+	require.NoError(t, thr.Acquire(WithKey(context.TODO(), "GET /users")))
+	require.NoError(t, thr.Acquire(WithKey(context.TODO(), "/api/v1/users")))
+	require.Equal(t, ErrorThreshold{
+		Throttler: "after",
+		Threshold: strpair{current: 2, threshold: 1},
+	}, thr.Acquire(WithKey(context.TODO(), "/api/v2/users")))
+	require.Equal(t, ErrorInternal{Throttler: "test"}, thr.Acquire(WithKey(context.TODO(), "DELETE /users")))
+	require.Equal(t, ErrorThreshold{
+		Throttler: "each",
+		Threshold: strpair{current: 1, threshold: 1},
+	}, thr.Acquire(WithKey(context.TODO(), "POST /users")))
+	thr.Handle("POST /users", NewThrottlerEcho(nil))
+	require.NoError(t, thr.Acquire(WithKey(context.TODO(), "POST /users")))
+	require.NoError(t, thr.Release(WithKey(context.TODO(), "POST /users")))
+	require.Equal(t, ErrorInternal{
+		Throttler: "router",
+		Message:   "known route is not found",
+	}, NewThrottlerRouter().Acquire(context.TODO()))
+}
+
+func TestThrottlerAnyErrorComposite(t *testing.T) {
+	testerr := errors.New("test")
+	err := NewThrottlerAny(NewThrottlerEcho(nil), NewThrottlerAfter(0), NewThrottlerEcho(testerr)).Acquire(context.TODO())
+	require.True(t, errors.Is(err, testerr))
+	var terr ErrorThreshold
+	require.True(t, errors.As(err, &terr))
+	require.Equal(t, "after", terr.Throttler)
+	var ierr ErrorInternal
+	require.True(t, errors.As(err, &ierr))
+	require.Equal(t, "any", ierr.Throttler)
+	var cerr ErrorComposite
+	require.True(t, errors.As(err, &cerr))
+	require.Equal(t, []int{1, 2}, cerr.indexes())
+	require.Equal(
+		t,
+		`throttler "any" internal error happened: throttler "any" children throttlers have throttled: `+
+			`[1] throttler "after" has reached its threshold: 1 out of 0; [2] test`,
+		err.Error(),
+	)
+}
+
+func TestThrottlerStorageHybrid(t *testing.T) {
+	stg := NewStorageMemory()
+	first := NewThrottlerStorageHybrid(stg, "test", 3, time.Hour, ms1_0)
+	second := NewThrottlerStorageHybrid(stg, "test", 3, time.Hour, ms1_0)
+	ctx := context.TODO()
+	require.NoError(t, first.Acquire(ctx))
+	require.NoError(t, first.Acquire(ctx))
+	require.NoError(t, second.Acquire(ctx))
+	key := fmt.Sprintf("gohalt_timed:test:%d", time.Now().UTC().UnixNano()/int64(time.Hour))
+	require.Eventually(t, func() bool {
+		val, _, _ := stg.Get(ctx, key)
+		return string(val) == "3"
+	}, time.Second, ms1_0)
+	global := func(thr Throttler) uint64 {
+		thr.(*tstghybrid).lock.Lock()
+		defer thr.(*tstghybrid).lock.Unlock()
+		return thr.(*tstghybrid).global
+	}
+	require.Eventually(t, func() bool {
+		return global(first) == 3 && global(second) == 3
+	}, time.Second, ms1_0)
+	err := ErrorThreshold{
+		Throttler: "hybrid",
+		Threshold: strpair{current: 4, threshold: 3},
+	}
+	require.Equal(t, err, first.Acquire(ctx))
+	require.Equal(t, err, second.Acquire(ctx))
+	require.NoError(t, first.Release(ctx))
+	// zero interval and period are counted in single window synced with default period.
+	stg = NewStorageMemory()
+	thr := NewThrottlerStorageHybrid(stg, "test", 2, 0, 0)
+	// non positive weights are counted as single call.
+	require.NoError(t, thr.Acquire(WithWeight(ctx, -1)))
+	require.NoError(t, thr.Acquire(ctx))
+	require.Equal(t, ErrorThreshold{
+		Throttler: "hybrid",
+		Threshold: strpair{current: 3, threshold: 2},
+	}, thr.Acquire(ctx))
+	require.Eventually(t, func() bool {
+		val, _, _ := stg.Get(ctx, "gohalt_timed:test:0")
+		return string(val) == "2"
+	}, time.Second, ms1_0)
+}
+
+func TestThrottlerSplit(t *testing.T) {
+	ctx := context.TODO()
+	thr := NewThrottlerSplit(NewMembershipStatic(2), 5, func(limit uint64) Throttler {
+		return NewThrottlerAfter(limit)
+	}, time.Hour)
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+	require.Equal(t, ErrorThreshold{
+		Throttler: "after",
+		Threshold: strpair{current: 3, threshold: 2},
+	}, thr.Acquire(ctx))
+	require.NoError(t, thr.Release(ctx))
+	thr = NewThrottlerSplit(mbmock{err: errors.New("test")}, 1, func(limit uint64) Throttler {
+		return NewThrottlerAfter(limit)
+	}, time.Hour)
+	require.NoError(t, thr.Acquire(ctx))
+	require.Error(t, thr.Acquire(ctx))
+	thr = NewThrottlerSplit(NewMembershipStatic(10), 5, func(limit uint64) Throttler {
+		return NewThrottlerAfter(limit)
+	}, time.Hour)
+	require.NoError(t, thr.Acquire(ctx))
+	require.Error(t, thr.Acquire(ctx))
+	// releases are routed to generated throttler serving their acquires.
+	var gens []Throttler
+	split := NewThrottlerSplit(NewMembershipStatic(1), 2, func(limit uint64) Throttler {
+		gen := NewThrottlerRunning(limit)
+		gens = append(gens, gen)
+		return gen
+	}, time.Hour).(*tsplit)
+	first, second := WithKey(ctx, "first"), WithKey(ctx, "second")
+	require.NoError(t, split.Acquire(first))
+	split.membership = mbmock{members: 2}
+	split.split(ctx)
+	require.Len(t, gens, 2)
+	require.NoError(t, split.Acquire(second))
+	require.NoError(t, split.Release(second))
+	require.NoError(t, gens[1].Acquire(ctx))
+	require.NoError(t, split.Release(first))
+	require.NoError(t, gens[0].Acquire(ctx))
+	require.NoError(t, gens[0].Acquire(ctx))
+}
+
+func TestThrottlerRetried(t *testing.T) {
+	ctx := context.TODO()
+	inner := NewThrottlerRunning(1)
+	thr := NewThrottlerRetried(inner, NewBackoffConstant(time.Hour), 0)
+	require.NoError(t, inner.Acquire(ctx))
+	cctx, cancel := context.WithCancel(WithKey(ctx, "retried"))
+	result := make(chan error, 1)
+	go func() {
+		result <- thr.Acquire(cctx)
+	}()
+	// failed attempt is released before backoff delay
+	time.Sleep(ms10_0)
+	require.NoError(t, inner.Release(ctx))
+	require.NoError(t, inner.Acquire(ctx))
+	cancel()
+	require.Error(t, <-result)
+	// release of acquire canceled during backoff is skipped
+	require.NoError(t, thr.Release(cctx))
+	require.Error(t, inner.Acquire(ctx))
+	require.NoError(t, inner.Release(ctx))
+}
+
+func TestThrottlerWeighted(t *testing.T) {
+	ctx := context.TODO()
+	first, second := NewThrottlerRunning(100), NewThrottlerRunning(100)
+	thr := NewThrottlerWeighted(Weighted{Weight: 1, Throttler: first}, Weighted{Weight: 1, Throttler: second})
+	running := func(thr Throttler) uint64 {
+		return atomicGet(&thr.(*trunning).running)
+	}
+	ctxs := make([]context.Context, 0, 20)
+	for i := 0; i < 20; i++ {
+		ctx := WithKey(ctx, fmt.Sprintf("%d", i))
+		require.NoError(t, thr.Acquire(ctx))
+		ctxs = append(ctxs, ctx)
+	}
+	// releases are routed to throttlers chosen for their acquires regardless of release order.
+	for i := len(ctxs) - 1; i >= 0; i-- {
+		index := thr.(*tweighted).chosen[i].index
+		chosen := thr.(*tweighted).weighted[index].Throttler
+		current := running(chosen)
+		require.NoError(t, thr.Release(WithStatus(ctxs[i], http.StatusOK)))
+		require.Equal(t, current-1, running(chosen))
+	}
+	require.Zero(t, running(first)+running(second))
+	require.NoError(t, thr.Release(ctx))
+}
+
+func TestThrottlerRoundRobin(t *testing.T) {
+	ctx := context.TODO()
+	thr := NewThrottlerRoundRobin(NewThrottlerRunning(1), NewThrottlerRunning(1))
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+	require.Error(t, thr.Acquire(ctx))
+	// throttled calls leave no running throttlers behind
+	for i := 0; i < 3; i++ {
+		require.NoError(t, thr.Release(ctx))
+	}
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+	// releases are routed to throttlers chosen for their acquires regardless of release order.
+	first, second := NewThrottlerRunning(1), NewThrottlerRunning(1)
+	thr = NewThrottlerRoundRobin(first, second)
+	fctx, sctx := WithKey(ctx, "first"), WithKey(ctx, "second")
+	require.NoError(t, thr.Acquire(fctx))
+	require.NoError(t, thr.Acquire(sctx))
+	require.NoError(t, thr.Release(WithStatus(sctx, http.StatusOK)))
+	require.Error(t, first.Acquire(ctx))
+	require.NoError(t, first.Release(ctx))
+	require.NoError(t, second.Acquire(ctx))
+	require.NoError(t, second.Release(ctx))
+	require.NoError(t, thr.Release(fctx))
+	require.NoError(t, first.Acquire(ctx))
+}
+
+func TestThrottlerRedlock(t *testing.T) {
+	ctx := context.TODO()
+	stgs := []Storage{NewStorageMemory(), NewStorageMemory(), stgmock{err: errors.New("test")}}
+	first := NewThrottlerRedlock(stgs, "test", ms30_0)
+	second := NewThrottlerRedlock(stgs, "test", ms30_0)
+	require.NoError(t, first.Acquire(ctx))
+	require.Equal(t, ErrorThreshold{Throttler: "redlock", Threshold: strbool(false)}, second.Acquire(ctx))
+	require.NoError(t, second.Release(ctx))
+	// lock is kept by extension after its ttl
+	time.Sleep(3 * ms30_0)
+	require.Error(t, second.Acquire(ctx))
+	require.NoError(t, second.Release(ctx))
+	require.NoError(t, first.Release(ctx))
+	require.NoError(t, first.Release(ctx))
+	require.NoError(t, second.Acquire(ctx))
+	require.NoError(t, second.Release(ctx))
+	// rejected calls releases never release the holder lock
+	owner, rejected := WithKey(ctx, "owner"), WithKey(ctx, "rejected")
+	require.NoError(t, first.Acquire(owner))
+	require.Error(t, first.Acquire(rejected))
+	require.NoError(t, first.Release(rejected))
+	require.Error(t, second.Acquire(rejected))
+	require.NoError(t, first.Release(WithStatus(owner, http.StatusOK)))
+	require.NoError(t, second.Acquire(rejected))
+	require.NoError(t, second.Release(rejected))
+	// lock is never acquired without storages majority
+	failing := NewThrottlerRedlock(append(stgs[:1:1], stgs[2], stgs[2]), "test", ms30_0)
+	require.Equal(t, ErrorInternal{Throttler: "redlock", Message: "test"}, failing.Acquire(ctx))
+	require.NoError(t, failing.Release(ctx))
+	_, ok, _ := stgs[0].Get(ctx, "gohalt_redlock:test")
+	require.False(t, ok)
+}
+
+func TestThrottlerDrain(t *testing.T) {
+	thr := NewThrottlerDrain(NewThrottlerRunning(2))
+	ctx := context.TODO()
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+	thr.Drain()
+	require.Equal(t, ErrorInternal{Throttler: "drain", Message: "throttler is draining"}, thr.Acquire(ctx))
+	require.NoError(t, thr.Release(ctx))
+	require.NoError(t, thr.Release(ctx))
+	select {
+	case <-thr.Done():
+		require.FailNow(t, "drain throttler is done with calls in flight")
+	default:
+	}
+	require.NoError(t, thr.Release(ctx))
+	<-thr.Done()
+}
+
+func TestThrottlerOutlier(t *testing.T) {
+	thr := NewThrottlerOutlier(10, 2, time.Minute)
+	for _, ts := range []time.Duration{-ms1_0, -ms2_0, -ms1_0, -ms30_0} {
+		ctx := WithTimestamp(context.TODO(), time.Now().Add(ts))
+		require.NoError(t, thr.Acquire(ctx))
+		require.NoError(t, thr.Release(ctx))
+	}
+	err := thr.Acquire(context.TODO())
+	require.IsType(t, ErrorThreshold{}, err)
+	terr := err.(ErrorThreshold)
+	require.Equal(t, "outlier", terr.Throttler)
+	durs := terr.Threshold.(strdurations)
+	require.GreaterOrEqual(t, int64(durs.current), int64(ms30_0))
+	require.Less(t, int64(durs.threshold), int64(ms30_0))
+}
+
+func TestThrottlerMemo(t *testing.T) {
+	testerr := errors.New("test")
+	thr := NewThrottlerMemo(NewThrottlerEcho(testerr), ms1_0, 0)
+	require.Equal(t, testerr, thr.Acquire(WithKey(context.TODO(), "first")))
+	require.Equal(t, testerr, thr.Acquire(WithKey(context.TODO(), "second")))
+	require.Len(t, thr.(*tmemo).memo, 2)
+	time.Sleep(ms2_0)
+	// expired memoized rejections are removed on new rejections arrival.
+	require.Equal(t, testerr, thr.Acquire(WithKey(context.TODO(), "third")))
+	require.Len(t, thr.(*tmemo).memo, 1)
+	time.Sleep(ms2_0)
+	require.Equal(t, testerr, thr.Acquire(WithKey(context.TODO(), "third")))
+	require.Len(t, thr.(*tmemo).memo, 1)
+}
+
+func TestThrottlerCached(t *testing.T) {
+	thr := NewThrottlerCached(NewThrottlerEcho(nil), ms1_0)
+	require.NoError(t, thr.Acquire(WithKey(context.TODO(), "first")))
+	require.NoError(t, thr.Acquire(WithKey(context.TODO(), "second")))
+	require.Len(t, thr.(*tcached).cache, 2)
+	time.Sleep(ms2_0)
+	// expired cached decisions are removed on new decisions arrival.
+	require.NoError(t, thr.Acquire(WithKey(context.TODO(), "third")))
+	require.Len(t, thr.(*tcached).cache, 1)
+}
+
+func TestThrottlerAggregate(t *testing.T) {
+	ctx := context.TODO()
+	thr := NewThrottlerAggregate(NewThrottlerAfter(4), NewStorageMemory(), time.Hour)
+	for _, ctx := range []context.Context{
+		WithWeight(WithKey(ctx, "test"), 3),
+		WithKey(ctx, "other"),
+		WithWeight(WithKey(ctx, "test"), 2),
+		WithKey(ctx, "test"),
+	} {
+		_ = thr.Acquire(ctx)
+		require.NoError(t, thr.Release(ctx))
+	}
+	now := time.Now().UTC()
+	aggs, err := thr.Aggregates(ctx, "test", now.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, aggs, 1)
+	require.Equal(t, Aggregate{
+		Key:      "test",
+		Hour:     now.Truncate(time.Hour),
+		Admitted: 1,
+		Rejected: 2,
+		Cost:     3,
+	}, aggs[0])
+	aggs, err = thr.Aggregates(ctx, "test", now.Add(-3*time.Hour), now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, aggs)
+	// non positive weights are counted as single call cost
+	thr = NewThrottlerAggregate(NewThrottlerEcho(nil), NewStorageMemory(), time.Hour)
+	require.NoError(t, thr.Acquire(WithWeight(WithKey(ctx, "test"), -3)))
+	aggs, err = thr.Aggregates(ctx, "test", now.Add(-time.Hour), now)
+	require.NoError(t, err)
+	require.Len(t, aggs, 1)
+	require.Equal(t, uint64(1), aggs[0].Cost)
+	_, err = NewThrottlerAggregate(NewThrottlerEcho(nil), stgmock{err: errors.New("test")}, 0).
+		Aggregates(ctx, "test", now, now)
+	require.Error(t, err)
+}
+
+func TestThrottlerClockJump(t *testing.T) {
+	var jumps []ClockJump
+	handler := DefaultClockJumpHandler
+	defer func() { DefaultClockJumpHandler = handler }()
+	DefaultClockJumpHandler = func(jump ClockJump) {
+		jumps = append(jumps, jump)
+	}
+	ctx := context.TODO()
+	// cellrate resynchronizes state after clock jump
+	cellrate := NewThrottlerCellRate(1, time.Hour, true).(*tcellrate)
+	require.NoError(t, cellrate.Acquire(ctx))
+	require.Error(t, cellrate.Acquire(ctx))
+	cellrate.clock.offset -= int64(time.Hour)
+	require.NoError(t, cellrate.Acquire(ctx))
+	require.Error(t, cellrate.Acquire(ctx))
+	require.Len(t, jumps, 1)
+	require.Equal(t, "cellrate", jumps[0].Throttler)
+	require.InDelta(t, float64(time.Hour), float64(jumps[0].Jump), float64(time.Second))
+	// lease keeps leases alive after clock jump
+	lease := NewThrottlerLease(1, time.Minute).(*tlease)
+	require.NoError(t, lease.Acquire(WithLease(ctx, "first")))
+	lease.clock.offset -= int64(time.Hour)
+	lease.leases["first"] = lease.leases["first"].Add(-time.Hour)
+	require.Error(t, lease.Acquire(WithLease(ctx, "second")))
+	require.NoError(t, lease.Heartbeat(WithLease(ctx, "first")))
+	require.Len(t, jumps, 2)
+	require.Equal(t, "lease", jumps[1].Throttler)
+	// latency skips samples after clock jump
+	latency := NewThrottlerLatency(ms1_0, time.Minute).(*tlatency)
+	require.NoError(t, latency.Release(WithTimestamp(ctx, time.Now())))
+	latency.clock.offset -= int64(time.Hour)
+	require.NoError(t, latency.Release(WithTimestamp(ctx, time.Now().Add(-time.Minute))))
+	require.NoError(t, latency.Acquire(ctx))
+	require.Len(t, jumps, 3)
+	// cached drops cached decisions after clock jump
+	cached := NewThrottlerCached(NewThrottlerBefore(1), time.Hour).(*tcached)
+	require.Error(t, cached.Acquire(ctx))
+	require.NoError(t, cached.Release(ctx))
+	require.Error(t, cached.Acquire(ctx))
+	cached.clock.offset -= int64(time.Hour)
+	require.NoError(t, cached.Acquire(ctx))
+	require.Len(t, jumps, 4)
+	require.Equal(t, "cached", jumps[3].Throttler)
+	// quota shifts grants deadlines after clock jump
+	quota := NewThrottlerQuota(nil, 1).(*tquota)
+	deadline := time.Now().Add(time.Minute)
+	quota.grants["test"] = &quotagrant{tokens: 1, deadline: deadline, retry: deadline}
+	_, _ = quota.clock.now("quota")
+	quota.clock.offset -= int64(time.Hour)
+	require.NoError(t, quota.Acquire(WithKey(ctx, "test")))
+	require.WithinDuration(t, deadline.Add(time.Hour), quota.grants["test"].deadline, time.Second)
+	require.Len(t, jumps, 5)
+}
+
+func TestThrottlerMutex(t *testing.T) {
+	stg := NewStorageMemory()
+	first := NewThrottlerMutex(stg, "test", time.Minute)
+	second := NewThrottlerMutex(stg, "test", ms3_0)
+	var fences []uint64
+	ctx := WithFence(context.TODO(), func(fence uint64) {
+		fences = append(fences, fence)
+	})
+	// only single holder across replicas
+	require.NoError(t, first.Acquire(ctx))
+	require.Error(t, second.Acquire(ctx))
+	require.NoError(t, second.Release(ctx))
+	require.NoError(t, first.Release(ctx))
+	// rejected calls releases never release the holder lock
+	owner, rejected := WithKey(ctx, "owner"), WithKey(ctx, "rejected")
+	require.NoError(t, first.Acquire(owner))
+	require.Error(t, first.Acquire(rejected))
+	require.NoError(t, first.Release(rejected))
+	require.Error(t, second.Acquire(rejected))
+	require.NoError(t, first.Release(WithStatus(owner, http.StatusOK)))
+	require.NoError(t, second.Acquire(rejected))
+	require.NoError(t, second.Release(rejected))
+	// lock is expired after ttl
+	require.NoError(t, second.Acquire(ctx))
+	time.Sleep(ms5_0)
+	require.NoError(t, first.Acquire(ctx))
+	require.Equal(t, ErrorInternal{
+		Throttler: "mutex",
+		Message:   "lock has been expired before release",
+	}, second.Release(ctx))
+	require.NoError(t, first.Release(ctx))
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, fences)
+}
+
+func TestThrottlerGC(t *testing.T) {
+	runtime.GC()
+	thr := NewThrottlerGC(0, 0, 0.0001, 2, time.Minute)
+	err := thr.Acquire(context.TODO())
+	require.IsType(t, ErrorThreshold{}, err)
+	require.Equal(t, "gc", err.(ErrorThreshold).Throttler)
+	require.NoError(t, thr.Acquire(WithPriority(context.TODO(), 2)))
+	require.NoError(t, thr.Release(context.TODO()))
+}
+
+func TestThrottlerInflight(t *testing.T) {
+	thr := NewThrottlerInflight(NewThrottlerRunning(2))
+	first := WithTenant(WithKey(context.TODO(), "first"), "tenant")
+	second := WithPriority(WithKey(context.TODO(), "second"), 2)
+	require.NoError(t, thr.Acquire(first))
+	require.NoError(t, thr.Acquire(second))
+	require.Error(t, thr.Acquire(first))
+	require.NoError(t, thr.Release(first))
+	inflight := thr.Inflight()
+	require.Len(t, inflight, 2)
+	require.Equal(t, "first", inflight[0].Key)
+	require.Equal(t, "tenant", inflight[0].Tenant)
+	require.Equal(t, "second", inflight[1].Key)
+	require.Equal(t, uint8(2), inflight[1].Priority)
+	require.Equal(t, int64(1), inflight[1].Weight)
+	require.NoError(t, thr.Release(first))
+	rec := httptest.NewRecorder()
+	thr.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/inflight", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var snapshot []Inflight
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &snapshot))
+	require.Len(t, snapshot, 1)
+	require.Equal(t, "second", snapshot[0].Key)
+}
+
+func TestThrottlerProbe(t *testing.T) {
+	var failing uint64 = 1
+	thr := NewThrottlerProbe(func(context.Context) error {
+		if atomicGet(&failing) > 0 {
+			return errors.New("test")
+		}
+		return nil
+	}, ms1_0)
+	ctx, cancel := context.WithCancel(context.TODO())
+	require.Error(t, thr.Acquire(ctx))
+	cancel()
+	atomicSet(&failing, 0)
+	time.Sleep(ms10_0)
+	require.NoError(t, thr.Acquire(context.TODO()))
+	atomicSet(&failing, 1)
+	time.Sleep(ms10_0)
+	require.Error(t, thr.Acquire(context.TODO()))
+	require.NoError(t, thr.Release(context.TODO()))
+}
+
+func TestThrottlerClient(t *testing.T) {
+	thr := NewThrottlerClient(4, ms10_0, 0.5, 0.5)
+	ctx := context.TODO()
+	// backoff on overload statuses
+	require.NoError(t, thr.Release(WithStatus(ctx, http.StatusTooManyRequests)))
+	require.NoError(t, thr.Release(WithStatus(ctx, http.StatusServiceUnavailable)))
+	require.NoError(t, thr.Release(WithStatus(ctx, http.StatusServiceUnavailable)))
+	require.Equal(t, 1.0, thr.(*tclient).limit)
+	time.Sleep(ms10_0)
+	require.NoError(t, thr.Acquire(ctx))
+	require.Error(t, thr.Acquire(ctx))
+	// ramp up on other statuses
+	for i := 0; i < 10; i++ {
+		require.NoError(t, thr.Release(WithStatus(ctx, http.StatusOK)))
+	}
+	require.NoError(t, thr.Release(ctx))
+	require.Equal(t, 4.0, thr.(*tclient).limit)
+	time.Sleep(ms10_0)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, thr.Acquire(ctx))
+	}
+}
+
+func TestThrottlerPacingBurstCredit(t *testing.T) {
+	thr := NewThrottlerPacing(ms5_0, 1, 2)
+	ctx := context.TODO()
+	require.NoError(t, thr.Acquire(ctx))
+	time.Sleep(ms30_0)
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Acquire(ctx))
+	require.Error(t, thr.Acquire(ctx))
+	require.NoError(t, thr.Release(ctx))
 }
 
 func BenchmarkComplexThrottlers(b *testing.B) {
@@ -0,0 +1,162 @@
+package gohalt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Warning defines composed throttlers tree validation warning:
+// - Path shows offending throttler path in composed tree, e.g. `all.any[1].wait`.
+// - Throttler shows offending throttler name.
+// - Message shows human readable warning description.
+type Warning struct {
+	Path      string
+	Throttler string
+	Message   string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("throttler %q at %q: %s", w.Throttler, w.Path, w.Message)
+}
+
+// Validate statically checks provided composed throttlers tree for common mistakes
+// and returns list of validation warnings or nil if no mistake was found.
+// Currently validation detects:
+// - blocking throttler inside `any` throttler that blocks all its sibling throttlers;
+// - counting throttler under `suppress` throttler which running quota drifts
+// as suppressed rejected acquires are still released;
+// - unreachable `pattern` throttler children placed after default pattern or duplicated pattern.
+// Dynamic throttlers like `generator` and `sharded` children are not validated.
+func Validate(thr Throttler) []Warning {
+	var warns []Warning
+	validate(thr, validname(thr), false, false, &warns)
+	return warns
+}
+
+func validate(thr Throttler, path string, inany bool, insuppress bool, warns *[]Warning) {
+	name := validname(thr)
+	warn := func(message string) {
+		*warns = append(*warns, Warning{Path: path, Throttler: name, Message: message})
+	}
+	switch thr.(type) {
+	case twait, *tsquare, *tjitter, *tbuffered, tpriority, *tspacing, *tretried:
+		if inany {
+			warn("blocking throttler inside any throttler blocks all sibling throttlers")
+		}
+	}
+	switch thr.(type) {
+	case *trunning, *tbuffered, tpriority, tsemaphore, *tlease, *tresizable:
+		if insuppress {
+			warn("counting throttler under suppress throttler drifts as suppressed acquires are still released")
+		}
+	}
+	child := func(thr Throttler, name string) {
+		validate(thr, path+"."+name, inany, insuppress, warns)
+	}
+	switch tthr := thr.(type) {
+	case tall:
+		for i, thr := range tthr {
+			child(thr, fmt.Sprintf("%s[%d]", validname(thr), i))
+		}
+	case tany:
+		for i, thr := range tthr {
+			validate(thr, fmt.Sprintf("%s.%s[%d]", path, validname(thr), i), true, insuppress, warns)
+		}
+	case *tring:
+		for i, thr := range tthr.thrs {
+			child(thr, fmt.Sprintf("%s[%d]", validname(thr), i))
+		}
+	case tchain:
+		for i, thr := range tthr.thrs {
+			child(thr, fmt.Sprintf("%s[%d]", validname(thr), i))
+		}
+	case trace:
+		for i, thr := range tthr.thrs {
+			child(thr, fmt.Sprintf("%s[%d]", validname(thr), i))
+		}
+	case *troundrobin:
+		for i, thr := range tthr.thrs {
+			child(thr, fmt.Sprintf("%s[%d]", validname(thr), i))
+		}
+	case *tweighted:
+		for i, w := range tthr.weighted {
+			child(w.Throttler, fmt.Sprintf("%s[%d]", validname(w.Throttler), i))
+		}
+	case tpattern:
+		patterns := make(map[string]bool, len(tthr))
+		var def bool
+		for i, pattern := range tthr {
+			ppath := fmt.Sprintf("%s.%s[%d]", path, validname(pattern.Throttler), i)
+			var key string
+			if pattern.Pattern != nil {
+				key = pattern.Pattern.String()
+			}
+			switch {
+			case def:
+				*warns = append(*warns, Warning{
+					Path:      ppath,
+					Throttler: validname(pattern.Throttler),
+					Message:   "unreachable pattern after default pattern",
+				})
+			case patterns[key]:
+				*warns = append(*warns, Warning{
+					Path:      ppath,
+					Throttler: validname(pattern.Throttler),
+					Message:   fmt.Sprintf("unreachable duplicated pattern %q", key),
+				})
+			}
+			patterns[key], def = true, def || pattern.Pattern == nil
+			validate(pattern.Throttler, ppath, inany, insuppress, warns)
+		}
+	case tsuppress:
+		validate(tthr.thr, path+"."+validname(tthr.thr), inany, true, warns)
+	case tsuppresserrs:
+		child(tthr.thr, validname(tthr.thr))
+	case tnot:
+		child(tthr.thr, validname(tthr.thr))
+	case tretry:
+		child(tthr.thr, validname(tthr.thr))
+	case *tretried:
+		child(tthr.thr, validname(tthr.thr))
+	case ttimeout:
+		child(tthr.thr, validname(tthr.thr))
+	case tcache:
+		child(tthr.thr, validname(tthr.thr))
+	case *tmigration:
+		child(tthr.prev, validname(tthr.prev))
+		child(tthr.next, validname(tthr.next))
+	case *tcached:
+		child(tthr.thr, validname(tthr.thr))
+	case *trouter:
+		for _, route := range tthr.Routes() {
+			thr, _ := tthr.Route(route)
+			child(thr, fmt.Sprintf("%s[%s]", validname(thr), route))
+		}
+	case *tswappable:
+		tthr.lock.Lock()
+		thr := tthr.gens[len(tthr.gens)-1].thr
+		tthr.lock.Unlock()
+		child(thr, validname(thr))
+	case *tsplit:
+		child(tthr.swapper, validname(tthr.swapper))
+	case *tmemo:
+		child(tthr.thr, validname(tthr.thr))
+	case *tdrain:
+		child(tthr.thr, validname(tthr.thr))
+	case *tinflight:
+		child(tthr.thr, validname(tthr.thr))
+	case taggregate:
+		child(tthr.thr, validname(tthr.thr))
+	case tdefer:
+		child(tthr.thr, validname(tthr.thr))
+	}
+}
+
+// validname returns builtin throttler name or custom throttler type name.
+func validname(thr Throttler) string {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", thr), "*")
+	if strings.HasPrefix(name, "gohalt.t") {
+		return strings.TrimPrefix(name, "gohalt.t")
+	}
+	return name
+}
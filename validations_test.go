@@ -0,0 +1,104 @@
+package gohalt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	table := map[string]struct {
+		thr   Throttler
+		warns []Warning
+	}{
+		"Validate should not warn on valid throttlers tree": {
+			thr: NewThrottlerAll(
+				NewThrottlerAny(NewThrottlerAfter(1), NewThrottlerRunning(1)),
+				NewThrottlerSuppress(NewThrottlerEach(2)),
+				NewThrottlerPattern(
+					Pattern{Pattern: Glob("/api/*"), Throttler: NewThrottlerWait(time.Millisecond)},
+					Pattern{Throttler: NewThrottlerEcho(nil)},
+				),
+			),
+		},
+		"Validate should warn on blocking throttler inside any": {
+			thr: NewThrottlerAny(
+				NewThrottlerAfter(1),
+				NewThrottlerNot(NewThrottlerWait(time.Millisecond)),
+			),
+			warns: []Warning{
+				{
+					Path:      "any.not[1].wait",
+					Throttler: "wait",
+					Message:   "blocking throttler inside any throttler blocks all sibling throttlers",
+				},
+			},
+		},
+		"Validate should warn on spacing throttler inside any": {
+			thr: NewThrottlerAny(NewThrottlerAfter(1), NewThrottlerSpacing(time.Millisecond, 1)),
+			warns: []Warning{
+				{
+					Path:      "any.spacing[1]",
+					Throttler: "spacing",
+					Message:   "blocking throttler inside any throttler blocks all sibling throttlers",
+				},
+			},
+		},
+		"Validate should warn on retried throttler inside any": {
+			thr: NewThrottlerAny(NewThrottlerRetried(NewThrottlerAfter(1), NewBackoffConstant(time.Millisecond), 0)),
+			warns: []Warning{
+				{
+					Path:      "any.retried[0]",
+					Throttler: "retried",
+					Message:   "blocking throttler inside any throttler blocks all sibling throttlers",
+				},
+			},
+		},
+		"Validate should warn on throttlers wrapped by inflight": {
+			thr: NewThrottlerAny(NewThrottlerInflight(NewThrottlerWait(time.Millisecond))),
+			warns: []Warning{
+				{
+					Path:      "any.inflight[0].wait",
+					Throttler: "wait",
+					Message:   "blocking throttler inside any throttler blocks all sibling throttlers",
+				},
+			},
+		},
+		"Validate should warn on counting throttler under suppress": {
+			thr: NewThrottlerRing(NewThrottlerSuppress(NewThrottlerSemaphore(1))),
+			warns: []Warning{
+				{
+					Path:      "ring.suppress[0].semaphore",
+					Throttler: "semaphore",
+					Message:   "counting throttler under suppress throttler drifts as suppressed acquires are still released",
+				},
+			},
+		},
+		"Validate should warn on unreachable patterns": {
+			thr: NewThrottlerPattern(
+				Pattern{Pattern: Glob("/api/*"), Throttler: NewThrottlerEcho(nil)},
+				Pattern{Pattern: Glob("/api/*"), Throttler: NewThrottlerAfter(1)},
+				Pattern{Throttler: NewThrottlerEcho(nil)},
+				Pattern{Pattern: Glob("/admin/*"), Throttler: NewThrottlerBuffered(1)},
+			),
+			warns: []Warning{
+				{
+					Path:      "pattern.after[1]",
+					Throttler: "after",
+					Message:   `unreachable duplicated pattern "^/api/[^/]*$"`,
+				},
+				{
+					Path:      "pattern.buffered[3]",
+					Throttler: "buffered",
+					Message:   "unreachable pattern after default pattern",
+				},
+			},
+		},
+	}
+	for tname, tcase := range table {
+		t.Run(tname, func(t *testing.T) {
+			require.Equal(t, tcase.warns, Validate(tcase.thr))
+		})
+	}
+}